@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/humanbeeng/checkpost/server/config"
+	"github.com/humanbeeng/checkpost/server/db/migration"
+)
+
+const commandUsage = `usage: checkpost [flags] [command]
+
+Without a command the server is started. The config is read from defaults, config.toml, CP_ environment
+variables and flags, later sources overriding earlier ones. CP_<KEY>_FILE reads the value of a key from a file.
+
+flags:
+  -config path        config file, config.toml when present otherwise
+  -set key=value      override a single key, e.g. -set postgres.maxconns=20. May be repeated
+
+commands:
+  migrate up          apply all pending migrations
+  migrate down [n]    revert the last n migrations, 1 by default
+  migrate status      print the schema version and pending migrations
+  config print        print the effective config with secrets redacted`
+
+func runCommand(args []string, cfg *config.AppConfig) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:], cfg)
+	case "config":
+		return runConfig(args[1:], cfg)
+	case "help", "-h", "--help":
+		fmt.Println(commandUsage)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q\n\n%s", args[0], commandUsage)
+}
+
+func runMigrate(args []string, cfg *config.AppConfig) error {
+	if len(args) == 0 {
+		return errors.New(commandUsage)
+	}
+
+	ctx := context.Background()
+	// Migrations like index builds may run longer than queries of the server
+	pgCfg := cfg.Postgres
+	pgCfg.StatementTimeoutSeconds = 0
+	pool, err := newPool(ctx, pgCfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	migrator, err := migration.NewMigrator(pool)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		return migrator.Up()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+		return migrator.Down(steps)
+	case "status":
+		status, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	return fmt.Errorf("unknown migrate command %q\n\n%s", args[0], commandUsage)
+}
+
+func isConfigCommand(args []string) bool {
+	return len(args) > 0 && args[0] == "config"
+}
+
+func runConfig(args []string, cfg *config.AppConfig) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New(commandUsage)
+	}
+	if err := cfg.Print(os.Stdout); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config.\n%w", err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testKey = "rJM6HEmSnO9UnfNwgajL1ZLAdeYoUnxT"
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, "config.toml", `
+[postgres]
+user = "file"
+host = "file"
+maxconns = 10
+
+[admin]
+emails = ["file@checkpost.io"]
+`)
+	t.Setenv("CP_POSTGRES_HOST", "env")
+	t.Setenv("CP_POSTGRES_DATABASE", "env")
+	t.Setenv("CP_ADMIN_EMAILS", "a@checkpost.io,b@checkpost.io")
+	t.Setenv("CP_PASETO_KEY_FILE", writeFile(t, "paseto", testKey+"\n"))
+
+	cfg, args, err := Load([]string{"-config", path, "-set", "postgres.database=flag", "migrate", "up"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"migrate", "up"}, args)
+
+	// Defaults
+	assert.Equal(t, 5432, cfg.Postgres.Port)
+	assert.Equal(t, 25, cfg.Shutdown.TimeoutSeconds)
+	// File
+	assert.Equal(t, "file", cfg.Postgres.User)
+	assert.Equal(t, 10, cfg.Postgres.MaxConns)
+	// Environment over file
+	assert.Equal(t, "env", cfg.Postgres.Host)
+	assert.Equal(t, []string{"a@checkpost.io", "b@checkpost.io"}, cfg.Admin.Emails)
+	assert.Equal(t, testKey, cfg.Paseto.Key)
+	// Flags over environment
+	assert.Equal(t, "flag", cfg.Postgres.Database)
+
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.toml")})
+	assert.Error(t, err)
+
+	t.Setenv("CP_PASETO_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	_, _, err = Load([]string{"-config", writeFile(t, "config.toml", "")})
+	assert.ErrorContains(t, err, "CP_PASETO_KEY_FILE")
+}
+
+func TestValidate(t *testing.T) {
+	cfg := AppConfig{
+		Production: true,
+		DevAuth:    DevAuth{Enabled: true},
+		Paseto:     Paseto{Key: "short"},
+		Postgres:   Postgres{Host: "localhost", Database: "checkpost", User: "checkpost", Port: 5432, SSLMode: "sometimes", MaxConns: 2, MinConns: 4},
+		Tracing:    Tracing{SampleRatio: 2},
+		Mail:       Mail{Transport: "smtp"},
+		Proxy:      Proxy{Header: "X-Envoy-External-Address"},
+	}
+
+	err := cfg.Validate()
+	for _, key := range []string{"devauth.enabled", "paseto.key", "postgres.sslmode", "postgres.minconns", "tracing.sampleratio", "mail.smtp.host", "proxy.trusted"} {
+		assert.ErrorContains(t, err, key+":")
+	}
+
+	// Deployments without email sign in need no mail transport
+	cfg = AppConfig{Production: true, Paseto: Paseto{Key: testKey}, Postgres: Postgres{DSN: "postgres://db/checkpost?sslmode=verify-full"}}
+	assert.NoError(t, cfg.Validate())
+	cfg.Mail.Transport = "none"
+	assert.NoError(t, cfg.Validate())
+	cfg.Mail.Transport = "pigeon"
+	assert.ErrorContains(t, cfg.Validate(), "mail.transport:")
+
+	cfg = AppConfig{Paseto: Paseto{Key: testKey}, Postgres: Postgres{DSN: "postgres://checkpost:password@db/checkpost?sslmode=verify-full"}}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestPostgresURL(t *testing.T) {
+	p := Postgres{User: "checkpost", Password: "p@ss word", Host: "db", Port: 5432, Database: "checkpost", SSLMode: "require", ConnectTimeoutSeconds: 5}
+	assert.Equal(t, "postgres://checkpost:p%40ss%20word@db:5432/checkpost?connect_timeout=5&sslmode=require", p.URL())
+
+	p.DSN = "postgres://other@db/other"
+	assert.Equal(t, p.DSN, p.URL())
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := AppConfig{
+		Paseto:   Paseto{Key: testKey},
+		Postgres: Postgres{Host: "db", Password: "pg-password"},
+		Github:   Github{ClientId: "client", Secret: "gh-secret"},
+		Tracing:  Tracing{Headers: map[string]string{"authorization": "Bearer otlp"}},
+		Oidc:     map[string]OidcProvider{"keycloak": {Secret: "oidc-secret"}},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, cfg.Print(&buf))
+	out := buf.String()
+	for _, secret := range []string{testKey, "pg-password", "gh-secret", "Bearer otlp", "oidc-secret"} {
+		assert.NotContains(t, out, secret)
+	}
+	assert.Contains(t, out, `host = "db"`)
+	assert.Contains(t, out, `clientid = "client"`)
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/knadh/koanf/providers/env"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+const (
+	CheckpostConfigPrefix = "CP_"
+	DefaultPath           = "config.toml"
+	// Environment variables ending in _FILE name a file holding the value, e.g. CP_PASETO_KEY_FILE for
+	// secrets mounted by Kubernetes.
+	fileSuffix = "_FILE"
+)
+
+// Lowest layer of the config. Only keys whose zero value is not a sensible default are listed.
+var defaults = map[string]any{
+	"hosting.scheme":          "https",
+	"hosting.apihost":         "api.checkpost.io",
+	"hosting.addressing":      "subdomain",
+	"hosting.domains":         []string{"checkpost.io"},
+	"tls.addr":                ":443",
+	"tls.clientauth":          "none",
+	"shutdown.timeoutseconds": 25,
+	"tracing.endpoint":        "localhost:4318",
+	"tracing.sampleratio":     1.0,
+	"tracing.servicename":     "checkpost",
+	"log.format":              "json",
+	"log.level":               "info",
+	"postgres.host":           "localhost",
+	"postgres.port":           5432,
+	"postgres.database":       "postgres",
+	"postgres.sslmode":        "prefer",
+	"mail.transport":          "none",
+	"mail.smtp.port":          587,
+}
+
+// Overrides of single keys given as -set key=value.
+type setFlags []string
+
+func (s *setFlags) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *setFlags) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("want key=value, got %q", v)
+	}
+	*s = append(*s, v)
+	return nil
+}
+
+// Loads the config in layers, each overriding the previous one: defaults, the config file, CP_ environment
+// variables and flags. Environment variables map to keys by replacing _ with ., e.g. CP_POSTGRES_MAXCONNS,
+// lists are comma separated. The arguments left after the flags, e.g. a command, are returned as well. The
+// config is not validated, see Validate.
+func Load(args []string) (*AppConfig, []string, error) {
+	flags := flag.NewFlagSet("checkpost", flag.ContinueOnError)
+	// Parse errors are returned and the usage is printed by the caller
+	flags.SetOutput(io.Discard)
+	path := flags.String("config", "", "path of the config file, "+DefaultPath+" when present otherwise")
+	var sets setFlags
+	flags.Var(&sets, "set", "override a single key, e.g. -set postgres.maxconns=20. May be repeated")
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	k := koanf.New(".")
+	if err := k.Load(confmap.Provider(defaults, "."), nil); err != nil {
+		return nil, nil, err
+	}
+
+	if err := loadFile(k, *path); err != nil {
+		return nil, nil, err
+	}
+
+	var fileErrs []error
+	if err := k.Load(env.ProviderWithValue(CheckpostConfigPrefix, ".", func(name string, value string) (string, any) {
+		if strings.HasSuffix(name, fileSuffix) {
+			name = strings.TrimSuffix(name, fileSuffix)
+			b, err := os.ReadFile(value)
+			if err != nil {
+				fileErrs = append(fileErrs, fmt.Errorf("%s%s: %w", name, fileSuffix, err))
+				return "", nil
+			}
+			// Secret files usually end in a newline
+			value = strings.TrimRight(string(b), "\r\n")
+		}
+		return envKey(name), value
+	}), nil); err != nil {
+		return nil, nil, err
+	}
+	if len(fileErrs) > 0 {
+		return nil, nil, fmt.Errorf("unable to read secret files. %w", errors.Join(fileErrs...))
+	}
+
+	for _, s := range sets {
+		key, value, _ := strings.Cut(s, "=")
+		if err := k.Set(strings.ToLower(key), value); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var appConfig AppConfig
+	if err := k.UnmarshalWithConf("", &appConfig, koanf.UnmarshalConf{
+		DecoderConfig: &mapstructure.DecoderConfig{
+			DecodeHook: mapstructure.ComposeDecodeHookFunc(
+				mapstructure.StringToTimeDurationHookFunc(),
+				mapstructure.StringToSliceHookFunc(","),
+			),
+			Result:           &appConfig,
+			WeaklyTypedInput: true,
+		},
+	}); err != nil {
+		return nil, nil, fmt.Errorf("invalid config. %w", err)
+	}
+
+	return &appConfig, flags.Args(), nil
+}
+
+// The default file is optional, a file given explicitly has to exist.
+func loadFile(k *koanf.Koanf, path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath
+	}
+	err := k.Load(file.Provider(path), toml.Parser())
+	if err != nil && (explicit || !errors.Is(err, fs.ErrNotExist)) {
+		return fmt.Errorf("unable to load config file %s. %w", path, err)
+	}
+	return nil
+}
+
+func envKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(name, CheckpostConfigPrefix)), "_", ".")
+}
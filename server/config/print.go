@@ -0,0 +1,82 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/knadh/koanf/parsers/toml"
+)
+
+const redacted = "[REDACTED]"
+
+// Keys whose values are secrets, matched by their last segment.
+var secretKeys = []string{"password", "secret", "key", "dsn"}
+
+// Writes the effective config as TOML with secrets redacted.
+func (c *AppConfig) Print(w io.Writer) error {
+	m := toMap(reflect.ValueOf(*c), "")
+	b, err := toml.Parser().Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func isSecret(path string) bool {
+	// Exporter headers carry credentials of the collector
+	if strings.HasPrefix(path, "tracing.headers.") {
+		return true
+	}
+	last := path[strings.LastIndex(path, ".")+1:]
+	for _, s := range secretKeys {
+		if last == s {
+			return true
+		}
+	}
+	return strings.HasSuffix(last, "secret") || strings.HasSuffix(last, "token")
+}
+
+// Converts a config struct to a map keyed like the config file.
+func toMap(v reflect.Value, prefix string) map[string]any {
+	m := make(map[string]any)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("koanf")
+		if key == "" {
+			continue
+		}
+		m[key] = toValue(v.Field(i), prefix+key)
+	}
+	return m
+}
+
+func toValue(v reflect.Value, path string) any {
+	switch v.Kind() {
+	case reflect.Struct:
+		return toMap(v, path+".")
+	case reflect.Map:
+		m := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			m[key] = toValue(iter.Value(), path+"."+key)
+		}
+		return m
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			items := make([]map[string]any, v.Len())
+			for i := range items {
+				items[i] = toMap(v.Index(i), path+".")
+			}
+			return items
+		}
+		return v.Interface()
+	case reflect.String:
+		if v.String() != "" && isSecret(path) {
+			return redacted
+		}
+	}
+	return v.Interface()
+}
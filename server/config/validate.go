@@ -0,0 +1,183 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Length of the symmetric Paseto key in bytes.
+const PasetoKeySize = 32
+
+var (
+	schemes       = []string{"http", "https"}
+	addressings   = []string{"subdomain", "path"}
+	clientAuths   = []string{"none", "request"}
+	logFormats    = []string{"json", "text"}
+	sslModes      = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	mailTransport = []string{"smtp", "file", "log", "none"}
+)
+
+// Collects the problems of a config, each prefixed with its key.
+type problems []error
+
+func (p *problems) add(key string, format string, args ...any) {
+	*p = append(*p, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+// Empty values keep the default of the consuming package.
+func (p *problems) oneOf(key string, value string, allowed []string) {
+	if value != "" && !slices.Contains(allowed, strings.ToLower(value)) {
+		p.add(key, "%q must be one of %s", value, strings.Join(allowed, ", "))
+	}
+}
+
+func (p *problems) nonNegative(key string, value int) {
+	if value < 0 {
+		p.add(key, "must not be negative, got %d", value)
+	}
+}
+
+func (p *problems) port(key string, value int) {
+	if value < 1 || value > 65535 {
+		p.add(key, "must be a port between 1 and 65535, got %d", value)
+	}
+}
+
+// Reports every problem of the config at once, one per line.
+func (c *AppConfig) Validate() error {
+	var p problems
+
+	if c.Production && c.DevAuth.Enabled {
+		p.add("devauth.enabled", "must not be set in production")
+	}
+
+	if c.Paseto.Key == "" {
+		p.add("paseto.key", "is required")
+	} else if len(c.Paseto.Key) != PasetoKeySize {
+		p.add("paseto.key", "must be exactly %d bytes, got %d", PasetoKeySize, len(c.Paseto.Key))
+	}
+
+	p.oneOf("hosting.scheme", c.Hosting.Scheme, schemes)
+	p.oneOf("hosting.addressing", c.Hosting.Addressing, addressings)
+
+	if c.Proxy.Header != "" && len(c.Proxy.Trusted) == 0 {
+		p.add("proxy.trusted", "is required when a header is set")
+	}
+	for _, proxy := range c.Proxy.Trusted {
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				p.add("proxy.trusted", "%q is not an IP or CIDR range", proxy)
+			}
+		}
+	}
+
+	p.oneOf("tls.clientauth", c.TLS.ClientAuth, clientAuths)
+	if c.TLS.Enabled && len(c.TLS.Certificates) == 0 && c.TLS.Dir == "" {
+		p.add("tls", "certificates or dir are required when enabled")
+	}
+	for i, cert := range c.TLS.Certificates {
+		if cert.CertFile == "" || cert.KeyFile == "" {
+			p.add(fmt.Sprintf("tls.certificates[%d]", i), "certfile and keyfile are required")
+		}
+	}
+
+	p.nonNegative("shutdown.timeoutseconds", c.Shutdown.TimeoutSeconds)
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		p.add("tracing.sampleratio", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	p.oneOf("log.format", c.Log.Format, logFormats)
+	p.logLevel("log.level", c.Log.Level)
+	for pkg, level := range c.Log.Packages {
+		p.logLevel("log.packages."+pkg, level)
+	}
+
+	p.postgres(c.Postgres)
+
+	p.oneOf("mail.transport", c.Mail.Transport, mailTransport)
+	if strings.EqualFold(c.Mail.Transport, "smtp") {
+		if c.Mail.Smtp.Host == "" {
+			p.add("mail.smtp.host", "is required by the smtp transport")
+		}
+		if c.Mail.From == "" {
+			p.add("mail.from", "is required by the smtp transport")
+		}
+		p.port("mail.smtp.port", c.Mail.Smtp.Port)
+	}
+
+	for name, provider := range c.Oidc {
+		if provider.Issuer == "" {
+			p.add("oidc."+name+".issuer", "is required")
+		}
+		if provider.ClientId == "" {
+			p.add("oidc."+name+".clientid", "is required")
+		}
+	}
+
+	for name, limits := range c.Plans {
+		key := "plans." + name
+		p.nonNegative(key+".maxbodybytes", limits.MaxBodyBytes)
+		p.nonNegative(key+".retentionhours", limits.RetentionHours)
+		p.nonNegative(key+".maxendpoints", limits.MaxEndpoints)
+		p.nonNegative(key+".maxsessions", limits.MaxSessions)
+		p.nonNegative(key+".burst", limits.Burst)
+		p.nonNegative(key+".ipburst", limits.IpBurst)
+		if limits.Rate < 0 || limits.IpRate < 0 {
+			p.add(key, "rates must not be negative")
+		}
+		if limits.MonthlyRequests < 0 || limits.MonthlyBytes < 0 {
+			p.add(key, "monthly quotas must not be negative")
+		}
+		if limits.QuotaWarnPercent < 0 || limits.QuotaWarnPercent > 100 {
+			p.add(key+".quotawarnpercent", "must be between 0 and 100, got %d", limits.QuotaWarnPercent)
+		}
+	}
+
+	return errors.Join(p...)
+}
+
+func (p *problems) logLevel(key string, level string) {
+	if level == "" {
+		return
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		p.add(key, "%q must be one of debug, info, warn, error", level)
+	}
+}
+
+func (p *problems) postgres(cfg Postgres) {
+	if cfg.DSN == "" {
+		if cfg.Host == "" {
+			p.add("postgres.host", "is required without a dsn")
+		}
+		if cfg.Database == "" {
+			p.add("postgres.database", "is required without a dsn")
+		}
+		if cfg.User == "" {
+			p.add("postgres.user", "is required without a dsn")
+		}
+		p.port("postgres.port", cfg.Port)
+		p.oneOf("postgres.sslmode", cfg.SSLMode, sslModes)
+	} else if _, err := pgx.ParseConfig(cfg.DSN); err != nil {
+		// pgx masks the password in parse errors
+		p.add("postgres.dsn", "%v", err)
+	}
+
+	p.nonNegative("postgres.maxconns", cfg.MaxConns)
+	p.nonNegative("postgres.minconns", cfg.MinConns)
+	if cfg.MaxConns > 0 && cfg.MinConns > cfg.MaxConns {
+		p.add("postgres.minconns", "must not exceed maxconns %d, got %d", cfg.MaxConns, cfg.MinConns)
+	}
+	p.nonNegative("postgres.connecttimeoutseconds", cfg.ConnectTimeoutSeconds)
+	p.nonNegative("postgres.statementtimeoutseconds", cfg.StatementTimeoutSeconds)
+	p.nonNegative("postgres.maxconnlifetimeseconds", cfg.MaxConnLifetimeSeconds)
+	p.nonNegative("postgres.maxconnidleseconds", cfg.MaxConnIdleSeconds)
+}
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "IDX_Request_Blocked";
+
+ALTER TABLE "request" DROP COLUMN IF EXISTS "blocked";
+
+DROP TABLE IF EXISTS endpoint_access;
@@ -0,0 +1,24 @@
+CREATE TABLE "endpoint_access" (
+  "endpoint_id" bigint PRIMARY KEY,
+  "allowed_ips" text[] NOT NULL DEFAULT '{}',
+  "basic_username" text NOT NULL DEFAULT '',
+  "basic_password_hash" text NOT NULL DEFAULT '',
+  "header_name" text NOT NULL DEFAULT '',
+  "header_value" text NOT NULL DEFAULT '',
+  "query_param" text NOT NULL DEFAULT '',
+  "query_value" text NOT NULL DEFAULT '',
+  "client_cert_fingerprints" text[] NOT NULL DEFAULT '{}',
+  "reject_code" int NOT NULL DEFAULT 403,
+  "created_at" timestamptz DEFAULT (now()),
+  "updated_at" timestamptz DEFAULT (now())
+);
+
+ALTER TABLE "request" ADD COLUMN "blocked" bool NOT NULL DEFAULT false;
+
+CREATE INDEX "IDX_Request_Blocked" ON "request" ("endpoint_id", "blocked");
+
+COMMENT ON COLUMN "endpoint_access"."basic_password_hash" IS 'hex encoded SHA-256';
+
+COMMENT ON COLUMN "endpoint_access"."client_cert_fingerprints" IS 'hex encoded SHA-256 of DER certificate';
+
+ALTER TABLE "endpoint_access" ADD FOREIGN KEY ("endpoint_id") REFERENCES "endpoint" ("id");
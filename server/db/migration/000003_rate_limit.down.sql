@@ -0,0 +1,6 @@
+ALTER TABLE "endpoint"
+  DROP COLUMN IF EXISTS "rate_limit",
+  DROP COLUMN IF EXISTS "rate_burst",
+  DROP COLUMN IF EXISTS "ip_rate_limit",
+  DROP COLUMN IF EXISTS "ip_rate_burst",
+  DROP COLUMN IF EXISTS "dropped_count";
@@ -0,0 +1,10 @@
+ALTER TABLE "endpoint"
+  ADD COLUMN "rate_limit" double precision NOT NULL DEFAULT 0,
+  ADD COLUMN "rate_burst" int NOT NULL DEFAULT 0,
+  ADD COLUMN "ip_rate_limit" double precision NOT NULL DEFAULT 0,
+  ADD COLUMN "ip_rate_burst" int NOT NULL DEFAULT 0,
+  ADD COLUMN "dropped_count" bigint NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN "endpoint"."rate_limit" IS 'Requests per second. 0 falls back to plan default';
+
+COMMENT ON COLUMN "endpoint"."ip_rate_limit" IS 'Requests per second per source IP. 0 falls back to plan default';
@@ -0,0 +1,19 @@
+-- Overrides for the plan catalog. A row replaces the configured limits of the plan with the same name.
+-- Named plan_limit since "plan" is taken by the enum type.
+CREATE TABLE "plan_limit" (
+  "name" text PRIMARY KEY,
+  "max_body_bytes" int NOT NULL,
+  "retention_hours" int NOT NULL,
+  "max_endpoints" int NOT NULL,
+  "max_sessions" int NOT NULL,
+  "rate_limit" double precision NOT NULL DEFAULT 0,
+  "rate_burst" int NOT NULL DEFAULT 0,
+  "ip_rate_limit" double precision NOT NULL DEFAULT 0,
+  "ip_rate_burst" int NOT NULL DEFAULT 0,
+  "features" text[] NOT NULL DEFAULT '{}',
+  "updated_at" timestamptz DEFAULT (now())
+);
+
+COMMENT ON COLUMN "plan_limit"."retention_hours" IS '0 keeps requests forever';
+
+COMMENT ON COLUMN "plan_limit"."max_endpoints" IS '0 is unlimited';
@@ -0,0 +1,6 @@
+ALTER TABLE "plan_limit"
+  DROP COLUMN IF EXISTS "monthly_requests",
+  DROP COLUMN IF EXISTS "monthly_bytes",
+  DROP COLUMN IF EXISTS "quota_warn_percent";
+
+DROP TABLE IF EXISTS "usage";
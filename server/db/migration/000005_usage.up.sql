@@ -0,0 +1,23 @@
+CREATE TABLE "usage" (
+  "user_id" bigint NOT NULL,
+  "period_start" date NOT NULL,
+  "request_count" bigint NOT NULL DEFAULT 0,
+  "stored_bytes" bigint NOT NULL DEFAULT 0,
+  "replay_count" bigint NOT NULL DEFAULT 0,
+  "forward_count" bigint NOT NULL DEFAULT 0,
+  "updated_at" timestamptz DEFAULT (now()),
+  PRIMARY KEY ("user_id", "period_start")
+);
+
+ALTER TABLE "plan_limit"
+  ADD COLUMN "monthly_requests" bigint NOT NULL DEFAULT 0,
+  ADD COLUMN "monthly_bytes" bigint NOT NULL DEFAULT 0,
+  ADD COLUMN "quota_warn_percent" int NOT NULL DEFAULT 80;
+
+COMMENT ON COLUMN "usage"."period_start" IS 'First day of the billing period (UTC calendar month)';
+
+COMMENT ON COLUMN "plan_limit"."monthly_requests" IS '0 is unlimited';
+
+COMMENT ON COLUMN "plan_limit"."monthly_bytes" IS '0 is unlimited';
+
+ALTER TABLE "usage" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id");
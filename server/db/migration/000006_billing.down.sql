@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS billing_event;
+
+ALTER TABLE "user" DROP COLUMN IF EXISTS "billing_customer_id";
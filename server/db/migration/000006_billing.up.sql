@@ -0,0 +1,12 @@
+ALTER TABLE "user" ADD COLUMN "billing_customer_id" text UNIQUE;
+
+CREATE TABLE "billing_event" (
+  "id" text PRIMARY KEY,
+  "type" text NOT NULL,
+  "user_id" bigint,
+  "received_at" timestamptz DEFAULT (now())
+);
+
+COMMENT ON TABLE "billing_event" IS 'Processed billing provider events, used to skip redelivered webhooks';
+
+ALTER TABLE "billing_event" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id");
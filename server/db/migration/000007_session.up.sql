@@ -0,0 +1,20 @@
+CREATE TABLE "session" (
+  "id" text PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "refresh_token_hash" text UNIQUE NOT NULL,
+  "previous_refresh_hash" text,
+  "user_agent" text NOT NULL DEFAULT '',
+  "ip" text NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "last_used_at" timestamptz NOT NULL DEFAULT (now()),
+  "expires_at" timestamptz NOT NULL,
+  "revoked_at" timestamptz
+);
+
+COMMENT ON TABLE "session" IS 'Signed in sessions. id is the jti embedded in access tokens';
+
+COMMENT ON COLUMN "session"."previous_refresh_hash" IS 'Hash of the last rotated refresh token, used to detect refresh token reuse';
+
+CREATE INDEX ON "session" ("user_id");
+
+ALTER TABLE "session" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON DELETE CASCADE;
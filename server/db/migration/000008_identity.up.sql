@@ -0,0 +1,16 @@
+CREATE TABLE "identity" (
+  "id" BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "user_id" bigint NOT NULL,
+  "provider" text NOT NULL,
+  "subject" text NOT NULL,
+  "email" text NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  UNIQUE ("provider", "subject"),
+  UNIQUE ("user_id", "provider")
+);
+
+COMMENT ON TABLE "identity" IS 'Login providers linked to a user. subject is the stable user id at the provider';
+
+CREATE INDEX ON "identity" ("user_id");
+
+ALTER TABLE "identity" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON DELETE CASCADE;
@@ -0,0 +1,12 @@
+CREATE TABLE "magic_link" (
+  "id" text PRIMARY KEY,
+  "email" text NOT NULL,
+  "ip" text NOT NULL DEFAULT '',
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "expires_at" timestamptz NOT NULL,
+  "used_at" timestamptz
+);
+
+COMMENT ON TABLE "magic_link" IS 'Issued email sign in links. id is the jti of the signed link token';
+
+CREATE INDEX ON "magic_link" ("created_at");
@@ -0,0 +1,32 @@
+ALTER TABLE "endpoint" DROP CONSTRAINT "endpoint_user_id_fkey";
+ALTER TABLE "endpoint" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id");
+
+ALTER TABLE "request" DROP CONSTRAINT "request_user_id_fkey";
+ALTER TABLE "request" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id");
+
+ALTER TABLE "request" DROP CONSTRAINT "request_endpoint_id_fkey";
+ALTER TABLE "request" ADD FOREIGN KEY ("endpoint_id") REFERENCES "endpoint" ("id");
+
+ALTER TABLE "request" DROP CONSTRAINT "request_response_id_fkey";
+ALTER TABLE "request" ADD FOREIGN KEY ("response_id") REFERENCES "response" ("id");
+
+ALTER TABLE "file_attachment" DROP CONSTRAINT "file_attachment_endpoint_id_fkey";
+ALTER TABLE "file_attachment" ADD FOREIGN KEY ("endpoint_id") REFERENCES "endpoint" ("id");
+
+ALTER TABLE "file_attachment" DROP CONSTRAINT "file_attachment_user_id_fkey";
+ALTER TABLE "file_attachment" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id");
+
+ALTER TABLE "response" DROP CONSTRAINT "response_user_id_fkey";
+ALTER TABLE "response" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id");
+
+ALTER TABLE "response" DROP CONSTRAINT "response_endpoint_id_fkey";
+ALTER TABLE "response" ADD FOREIGN KEY ("endpoint_id") REFERENCES "endpoint" ("id");
+
+ALTER TABLE "endpoint_access" DROP CONSTRAINT "endpoint_access_endpoint_id_fkey";
+ALTER TABLE "endpoint_access" ADD FOREIGN KEY ("endpoint_id") REFERENCES "endpoint" ("id");
+
+ALTER TABLE "usage" DROP CONSTRAINT "usage_user_id_fkey";
+ALTER TABLE "usage" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id");
+
+ALTER TABLE "billing_event" DROP CONSTRAINT "billing_event_user_id_fkey";
+ALTER TABLE "billing_event" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id");
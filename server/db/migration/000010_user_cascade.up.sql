@@ -0,0 +1,35 @@
+-- Deleting a user erases everything owned by them
+
+ALTER TABLE "endpoint" DROP CONSTRAINT "endpoint_user_id_fkey";
+ALTER TABLE "endpoint" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "request" DROP CONSTRAINT "request_user_id_fkey";
+ALTER TABLE "request" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "request" DROP CONSTRAINT "request_endpoint_id_fkey";
+ALTER TABLE "request" ADD FOREIGN KEY ("endpoint_id") REFERENCES "endpoint" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "request" DROP CONSTRAINT "request_response_id_fkey";
+ALTER TABLE "request" ADD FOREIGN KEY ("response_id") REFERENCES "response" ("id") ON DELETE SET NULL;
+
+ALTER TABLE "file_attachment" DROP CONSTRAINT "file_attachment_endpoint_id_fkey";
+ALTER TABLE "file_attachment" ADD FOREIGN KEY ("endpoint_id") REFERENCES "endpoint" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "file_attachment" DROP CONSTRAINT "file_attachment_user_id_fkey";
+ALTER TABLE "file_attachment" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "response" DROP CONSTRAINT "response_user_id_fkey";
+ALTER TABLE "response" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "response" DROP CONSTRAINT "response_endpoint_id_fkey";
+ALTER TABLE "response" ADD FOREIGN KEY ("endpoint_id") REFERENCES "endpoint" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "endpoint_access" DROP CONSTRAINT "endpoint_access_endpoint_id_fkey";
+ALTER TABLE "endpoint_access" ADD FOREIGN KEY ("endpoint_id") REFERENCES "endpoint" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "usage" DROP CONSTRAINT "usage_user_id_fkey";
+ALTER TABLE "usage" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON DELETE CASCADE;
+
+-- Processed events are kept so that redelivered webhooks are still skipped
+ALTER TABLE "billing_event" DROP CONSTRAINT "billing_event_user_id_fkey";
+ALTER TABLE "billing_event" ADD FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON DELETE SET NULL;
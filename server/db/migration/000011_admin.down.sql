@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS reserved_name;
+
+ALTER TABLE "user" DROP COLUMN IF EXISTS "suspended_at";
+
+ALTER TABLE "user" DROP COLUMN IF EXISTS "role";
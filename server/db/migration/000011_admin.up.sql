@@ -0,0 +1,112 @@
+ALTER TABLE "user" ADD COLUMN "role" text NOT NULL DEFAULT 'user' CHECK ("role" IN ('user', 'admin'));
+
+ALTER TABLE "user" ADD COLUMN "suspended_at" timestamptz;
+
+-- Subdomains that cannot be claimed. Companies can only be claimed by users with a mail from that organisation.
+CREATE TABLE "reserved_name" (
+  "name" text PRIMARY KEY,
+  "kind" text NOT NULL CHECK ("kind" IN ('subdomain', 'company')),
+  "created_at" timestamptz DEFAULT (now())
+);
+
+INSERT INTO "reserved_name" ("name", "kind") VALUES
+  ('api', 'subdomain'),
+  ('hook', 'subdomain'),
+  ('blog', 'subdomain'),
+  ('dash', 'subdomain'),
+  ('dashboard', 'subdomain'),
+  ('uat', 'subdomain'),
+  ('qa', 'subdomain'),
+  ('user', 'subdomain'),
+  ('client', 'subdomain'),
+  ('prod', 'subdomain'),
+  ('staging', 'subdomain'),
+  ('jobs', 'subdomain'),
+  ('career', 'subdomain'),
+  ('auth', 'subdomain'),
+  ('cdn', 'subdomain'),
+  ('files', 'subdomain'),
+  ('file', 'subdomain'),
+  ('free', 'subdomain'),
+  ('secure', 'subdomain'),
+  ('media', 'subdomain'),
+  ('portal', 'subdomain'),
+  ('forum', 'subdomain'),
+  ('support', 'subdomain'),
+  ('www', 'subdomain'),
+  ('help', 'subdomain'),
+  ('console', 'subdomain'),
+  ('app', 'subdomain'),
+  ('share', 'subdomain'),
+  ('dev', 'subdomain'),
+  ('community', 'subdomain'),
+  ('payment', 'subdomain'),
+  ('endpoint', 'subdomain'),
+  ('http', 'subdomain'),
+  ('https', 'subdomain'),
+  ('request', 'subdomain'),
+  ('payments', 'subdomain'),
+  ('url', 'subdomain'),
+  ('link', 'subdomain'),
+  ('demo', 'subdomain'),
+  ('shop', 'subdomain'),
+  ('about', 'subdomain'),
+  ('google', 'company'),
+  ('figma', 'company'),
+  ('github', 'company'),
+  ('checkpost', 'company'),
+  ('microsoft', 'company'),
+  ('cloudflare', 'company'),
+  ('ford', 'company'),
+  ('intel', 'company'),
+  ('xerox', 'company'),
+  ('cocacola', 'company'),
+  ('jpmorgan', 'company'),
+  ('apple', 'company'),
+  ('nvidia', 'company'),
+  ('alphabet', 'company'),
+  ('amazon', 'company'),
+  ('netflix', 'company'),
+  ('meta', 'company'),
+  ('tesla', 'company'),
+  ('samsung', 'company'),
+  ('tencent', 'company'),
+  ('oracle', 'company'),
+  ('salesforce', 'company'),
+  ('amd', 'company'),
+  ('adobe', 'company'),
+  ('qualcomm', 'company'),
+  ('cisco', 'company'),
+  ('intuit', 'company'),
+  ('uber', 'company'),
+  ('dell', 'company'),
+  ('sony', 'company'),
+  ('airbnb', 'company'),
+  ('linkedin', 'company'),
+  ('paypal', 'company'),
+  ('xiaomi', 'company'),
+  ('spotify', 'company'),
+  ('snowflake', 'company'),
+  ('instagram', 'company'),
+  ('hotstar', 'company'),
+  ('adidas', 'company'),
+  ('brave', 'company'),
+  ('cred', 'company'),
+  ('flipkart', 'company'),
+  ('notion', 'company'),
+  ('nike', 'company'),
+  ('slack', 'company'),
+  ('twitch', 'company'),
+  ('whatsapp', 'company'),
+  ('youtube', 'company'),
+  ('coinbase', 'company'),
+  ('atlassian', 'company'),
+  ('palantir', 'company'),
+  ('datadog', 'company'),
+  ('hubspot', 'company'),
+  ('snap', 'company'),
+  ('mongodb', 'company'),
+  ('zscaler', 'company'),
+  ('sourcegraph', 'company'),
+  ('eraser', 'company'),
+  ('supabase', 'company');
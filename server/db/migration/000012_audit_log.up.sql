@@ -0,0 +1,33 @@
+-- Append-only trail of security relevant actions.
+-- actor_id and user_id are not foreign keys so that entries outlive deleted accounts.
+CREATE TABLE "audit_log" (
+  "id" BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "actor_id" bigint,
+  "user_id" bigint,
+  "action" text NOT NULL,
+  "target" text NOT NULL DEFAULT '',
+  "ip" text NOT NULL DEFAULT '',
+  "user_agent" text NOT NULL DEFAULT '',
+  "before" jsonb,
+  "after" jsonb,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "audit_log"."actor_id" IS 'User that performed the action';
+
+COMMENT ON COLUMN "audit_log"."user_id" IS 'User whose account or resources were affected';
+
+CREATE INDEX ON "audit_log" ("actor_id", "id");
+
+CREATE INDEX ON "audit_log" ("user_id", "id");
+
+CREATE INDEX ON "audit_log" ("target", "id");
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON "audit_log"
+  FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
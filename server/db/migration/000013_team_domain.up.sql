@@ -0,0 +1,35 @@
+CREATE TABLE "team" (
+  "id" BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "name" text NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "team_member" (
+  "team_id" bigint NOT NULL REFERENCES "team" ("id") ON DELETE CASCADE,
+  "user_id" bigint NOT NULL REFERENCES "user" ("id") ON DELETE CASCADE,
+  "role" text NOT NULL DEFAULT 'member' CHECK ("role" IN ('owner', 'member')),
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("team_id", "user_id")
+);
+
+CREATE INDEX ON "team_member" ("user_id");
+
+-- Domains claimed by a team. Members of the team that verified a domain can claim the reserved company
+-- subdomain matching it, e.g. google.com grants google.
+CREATE TABLE "team_domain" (
+  "team_id" bigint NOT NULL REFERENCES "team" ("id") ON DELETE CASCADE,
+  "domain" text NOT NULL,
+  "company" text NOT NULL,
+  "token" text NOT NULL,
+  "method" text CHECK ("method" IN ('dns', 'email')),
+  "verified_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("team_id", "domain")
+);
+
+COMMENT ON COLUMN "team_domain"."company" IS 'Registrable label of the domain, e.g. google for mail.google.co.uk';
+
+-- A domain can be claimed by many teams but verified by only one.
+CREATE UNIQUE INDEX ON "team_domain" ("domain") WHERE "verified_at" IS NOT NULL;
+
+CREATE INDEX ON "team_domain" ("company") WHERE "verified_at" IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE "endpoint"
+DROP COLUMN IF EXISTS "domain";
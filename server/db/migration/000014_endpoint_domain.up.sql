@@ -0,0 +1,4 @@
+-- Base domain the endpoint is served on. Empty for endpoints created before domains were
+-- configurable; these are assigned the primary configured domain on startup.
+ALTER TABLE "endpoint"
+ADD COLUMN "domain" text NOT NULL DEFAULT '';
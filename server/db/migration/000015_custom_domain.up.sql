@@ -0,0 +1,14 @@
+-- Hostnames owned by users, e.g. webhooks.acme.dev, serving an endpoint once ownership is proved
+-- through a TXT challenge.
+CREATE TABLE "custom_domain" (
+  "id" BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "endpoint_id" bigint NOT NULL REFERENCES "endpoint" ("id") ON DELETE CASCADE,
+  "hostname" text NOT NULL,
+  "token" text NOT NULL,
+  "verified_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  UNIQUE ("endpoint_id", "hostname")
+);
+
+-- A hostname can be claimed for many endpoints but verified for only one.
+CREATE UNIQUE INDEX ON "custom_domain" ("hostname") WHERE "verified_at" IS NOT NULL;
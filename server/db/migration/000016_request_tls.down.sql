@@ -0,0 +1,2 @@
+ALTER TABLE "request"
+DROP COLUMN IF EXISTS "tls";
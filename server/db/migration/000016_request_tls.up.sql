@@ -0,0 +1,4 @@
+-- TLS details of requests received over in process TLS: version, cipher suite, SNI and client
+-- certificate subject. NULL for plain HTTP or TLS terminated by a proxy.
+ALTER TABLE "request"
+ADD COLUMN "tls" jsonb;
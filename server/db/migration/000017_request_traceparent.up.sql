@@ -0,0 +1,4 @@
+-- W3C traceparent sent along with a hook, linking the request to the trace of its sender. Empty when absent
+-- or invalid.
+ALTER TABLE "request"
+ADD COLUMN "traceparent" text NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS team_invitation;
+
+DROP TABLE IF EXISTS company_domain;
+
+COMMENT ON COLUMN "team_domain"."company" IS 'Registrable label of the domain, e.g. google for mail.google.co.uk';
@@ -0,0 +1,107 @@
+-- Registrable domains of each reserved company. Only teams that verified one of these (or a subdomain of one)
+-- can claim the company name, a look alike such as ford.ninja grants nothing.
+CREATE TABLE "company_domain" (
+  "domain" text PRIMARY KEY,
+  "company" text NOT NULL REFERENCES "reserved_name" ("name") ON DELETE CASCADE,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "company_domain" ("company");
+
+INSERT INTO "company_domain" ("domain", "company")
+SELECT v.domain, v.company
+FROM (VALUES
+  ('google.com', 'google'),
+  ('google.co.uk', 'google'),
+  ('google.co.in', 'google'),
+  ('google.de', 'google'),
+  ('google.fr', 'google'),
+  ('google.co.jp', 'google'),
+  ('figma.com', 'figma'),
+  ('github.com', 'github'),
+  ('checkpost.io', 'checkpost'),
+  ('microsoft.com', 'microsoft'),
+  ('cloudflare.com', 'cloudflare'),
+  ('ford.com', 'ford'),
+  ('intel.com', 'intel'),
+  ('xerox.com', 'xerox'),
+  ('coca-cola.com', 'cocacola'),
+  ('jpmorgan.com', 'jpmorgan'),
+  ('jpmchase.com', 'jpmorgan'),
+  ('apple.com', 'apple'),
+  ('nvidia.com', 'nvidia'),
+  ('abc.xyz', 'alphabet'),
+  ('amazon.com', 'amazon'),
+  ('amazon.co.uk', 'amazon'),
+  ('amazon.de', 'amazon'),
+  ('amazon.in', 'amazon'),
+  ('netflix.com', 'netflix'),
+  ('meta.com', 'meta'),
+  ('fb.com', 'meta'),
+  ('tesla.com', 'tesla'),
+  ('samsung.com', 'samsung'),
+  ('tencent.com', 'tencent'),
+  ('oracle.com', 'oracle'),
+  ('salesforce.com', 'salesforce'),
+  ('amd.com', 'amd'),
+  ('adobe.com', 'adobe'),
+  ('qualcomm.com', 'qualcomm'),
+  ('cisco.com', 'cisco'),
+  ('intuit.com', 'intuit'),
+  ('uber.com', 'uber'),
+  ('dell.com', 'dell'),
+  ('sony.com', 'sony'),
+  ('airbnb.com', 'airbnb'),
+  ('linkedin.com', 'linkedin'),
+  ('paypal.com', 'paypal'),
+  ('xiaomi.com', 'xiaomi'),
+  ('spotify.com', 'spotify'),
+  ('snowflake.com', 'snowflake'),
+  ('instagram.com', 'instagram'),
+  ('hotstar.com', 'hotstar'),
+  ('adidas.com', 'adidas'),
+  ('brave.com', 'brave'),
+  ('cred.club', 'cred'),
+  ('flipkart.com', 'flipkart'),
+  ('notion.so', 'notion'),
+  ('nike.com', 'nike'),
+  ('slack.com', 'slack'),
+  ('twitch.tv', 'twitch'),
+  ('whatsapp.com', 'whatsapp'),
+  ('youtube.com', 'youtube'),
+  ('coinbase.com', 'coinbase'),
+  ('atlassian.com', 'atlassian'),
+  ('palantir.com', 'palantir'),
+  ('datadoghq.com', 'datadog'),
+  ('hubspot.com', 'hubspot'),
+  ('snap.com', 'snap'),
+  ('mongodb.com', 'mongodb'),
+  ('zscaler.com', 'zscaler'),
+  ('sourcegraph.com', 'sourcegraph'),
+  ('eraser.io', 'eraser'),
+  ('supabase.com', 'supabase'),
+  ('supabase.io', 'supabase')
+) AS v (domain, company)
+-- Companies removed by an admin are skipped
+JOIN "reserved_name" ON "reserved_name"."name" = v.company AND "reserved_name"."kind" = 'company';
+
+COMMENT ON COLUMN "team_domain"."company" IS 'Reserved company whose allowlisted domain this is, empty when none';
+
+UPDATE "team_domain" SET "company" = COALESCE(
+  (SELECT "company_domain"."company" FROM "company_domain"
+   WHERE "team_domain"."domain" = "company_domain"."domain"
+      OR "team_domain"."domain" LIKE '%.' || "company_domain"."domain"
+   LIMIT 1),
+  ''
+);
+
+-- Owners invite users, who join the team only once they accept.
+CREATE TABLE "team_invitation" (
+  "team_id" bigint NOT NULL REFERENCES "team" ("id") ON DELETE CASCADE,
+  "user_id" bigint NOT NULL REFERENCES "user" ("id") ON DELETE CASCADE,
+  "invited_by" bigint REFERENCES "user" ("id") ON DELETE SET NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("team_id", "user_id")
+);
+
+CREATE INDEX ON "team_invitation" ("user_id");
@@ -0,0 +1,25 @@
+-- Fails while users, endpoints or requests are on a plan other than free, basic and pro.
+CREATE TYPE "plan" AS ENUM (
+  'free',
+  'basic',
+  'pro'
+);
+
+ALTER TABLE "request"
+  ALTER COLUMN "plan" DROP DEFAULT,
+  ALTER COLUMN "plan" TYPE plan USING "plan"::plan,
+  ALTER COLUMN "plan" SET DEFAULT 'free';
+
+ALTER TABLE "endpoint"
+  DROP CONSTRAINT IF EXISTS "endpoint_plan_fkey",
+  ALTER COLUMN "plan" DROP DEFAULT,
+  ALTER COLUMN "plan" TYPE plan USING "plan"::plan,
+  ALTER COLUMN "plan" SET DEFAULT 'free';
+
+ALTER TABLE "user"
+  DROP CONSTRAINT IF EXISTS "user_plan_fkey",
+  ALTER COLUMN "plan" TYPE plan USING "plan"::plan;
+
+ALTER TABLE "plan_limit" DROP CONSTRAINT IF EXISTS "plan_limit_name_fkey";
+
+DROP TABLE IF EXISTS plan_catalog;
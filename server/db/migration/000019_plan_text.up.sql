@@ -0,0 +1,30 @@
+-- Plans used to be a fixed enum. Now any plan registered in plan_catalog can be assigned, e.g. a team tier
+-- defined in config or plan_limit.
+CREATE TABLE "plan_catalog" (
+  "name" text PRIMARY KEY,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+INSERT INTO "plan_catalog" ("name") VALUES ('free'), ('basic'), ('pro');
+
+INSERT INTO "plan_catalog" ("name") SELECT "name" FROM "plan_limit" ON CONFLICT DO NOTHING;
+
+ALTER TABLE "plan_limit" ADD FOREIGN KEY ("name") REFERENCES "plan_catalog" ("name");
+
+ALTER TABLE "user"
+  ALTER COLUMN "plan" TYPE text USING "plan"::text,
+  ADD FOREIGN KEY ("plan") REFERENCES "plan_catalog" ("name");
+
+ALTER TABLE "endpoint"
+  ALTER COLUMN "plan" DROP DEFAULT,
+  ALTER COLUMN "plan" TYPE text USING "plan"::text,
+  ALTER COLUMN "plan" SET DEFAULT 'free',
+  ADD FOREIGN KEY ("plan") REFERENCES "plan_catalog" ("name");
+
+-- Snapshot of the plan of the endpoint when the request was received, not checked against the catalog
+ALTER TABLE "request"
+  ALTER COLUMN "plan" DROP DEFAULT,
+  ALTER COLUMN "plan" TYPE text USING "plan"::text,
+  ALTER COLUMN "plan" SET DEFAULT 'free';
+
+DROP TYPE "plan";
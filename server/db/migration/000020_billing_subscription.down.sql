@@ -0,0 +1,4 @@
+ALTER TABLE "endpoint"
+DROP COLUMN IF EXISTS "expires_at_before_downgrade";
+
+DROP TABLE IF EXISTS billing_subscription;
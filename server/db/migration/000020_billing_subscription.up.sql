@@ -0,0 +1,16 @@
+-- Webhooks can arrive out of order. The creation time of the last applied event of each subscription is kept,
+-- so that older events are ignored.
+CREATE TABLE "billing_subscription" (
+  "id" text PRIMARY KEY,
+  "user_id" bigint NOT NULL REFERENCES "user" ("id") ON DELETE CASCADE,
+  "last_event_at" timestamptz NOT NULL,
+  "deleted" bool NOT NULL DEFAULT false,
+  "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "billing_subscription" ("user_id");
+
+-- Endpoints expired by a downgrade keep their expiry from before, so that upgrading again restores them.
+ALTER TABLE "endpoint" ADD COLUMN "expires_at_before_downgrade" timestamptz;
+
+COMMENT ON COLUMN "endpoint"."expires_at_before_downgrade" IS 'Set while expired for exceeding the endpoint limit of the plan';
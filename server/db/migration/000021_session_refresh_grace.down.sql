@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS "IDX_Session_PreviousRefreshHash";
+
+ALTER TABLE "session"
+DROP COLUMN IF EXISTS "rotated_at";
@@ -0,0 +1,8 @@
+-- Concurrent requests of a client refresh with the same token. The rotation time lets the replaced
+-- token be accepted for a few seconds instead of being treated as reuse.
+ALTER TABLE "session" ADD COLUMN "rotated_at" timestamptz;
+
+COMMENT ON COLUMN "session"."rotated_at" IS 'When refresh_token_hash last replaced previous_refresh_hash';
+
+-- Refresh tokens are looked up by their current or previous hash
+CREATE INDEX "IDX_Session_PreviousRefreshHash" ON "session" ("previous_refresh_hash");
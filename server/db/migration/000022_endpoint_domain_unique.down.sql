@@ -0,0 +1,5 @@
+ALTER TABLE "endpoint"
+DROP CONSTRAINT IF EXISTS "endpoint_domain_endpoint_key";
+
+ALTER TABLE "endpoint"
+ADD CONSTRAINT "endpoint_endpoint_key" UNIQUE ("endpoint");
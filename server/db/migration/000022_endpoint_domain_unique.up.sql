@@ -0,0 +1,6 @@
+-- Each base domain has its own set of endpoints, so a name is only unique within its domain
+ALTER TABLE "endpoint"
+DROP CONSTRAINT IF EXISTS "endpoint_endpoint_key";
+
+ALTER TABLE "endpoint"
+ADD CONSTRAINT "endpoint_domain_endpoint_key" UNIQUE ("domain", "endpoint");
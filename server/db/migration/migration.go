@@ -0,0 +1,21 @@
+// Package migration embeds the schema migrations so the server knows which schema version it was built for.
+package migration
+
+import (
+	"embed"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// Version of the newest migration, taken from the NNNNNN_ prefix of the file names.
+func LatestVersion() (int64, error) {
+	versions, err := versions()
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	return versions[len(versions)-1], nil
+}
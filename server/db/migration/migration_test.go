@@ -0,0 +1,28 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatestVersion(t *testing.T) {
+	vs, err := versions()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), vs[0])
+	for i := 1; i < len(vs); i++ {
+		assert.Equal(t, vs[i-1]+1, vs[i], "migrations are numbered without gaps")
+	}
+
+	latest, err := LatestVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, vs[len(vs)-1], latest)
+}
+
+func TestCheckVersion(t *testing.T) {
+	assert.NoError(t, CheckVersion(17, false, 17))
+	// Schemas migrated by a newer release are accepted
+	assert.NoError(t, CheckVersion(18, false, 17))
+	assert.Error(t, CheckVersion(16, false, 17))
+	assert.Error(t, CheckVersion(17, true, 17))
+}
@@ -0,0 +1,150 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	pgxmigrate "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Applies the embedded migrations. The version is tracked in schema_migrations, the table used by the migrate
+// CLI, so databases migrated by hand are picked up as is. Every run holds a Postgres advisory lock, so
+// replicas starting at the same time apply each migration once.
+type Migrator struct {
+	m      *migrate.Migrate
+	latest int64
+}
+
+type Status struct {
+	Version int64   `json:"version"`
+	Dirty   bool    `json:"dirty"`
+	Latest  int64   `json:"latest"`
+	Pending []int64 `json:"pending"`
+}
+
+func NewMigrator(pool *pgxpool.Pool) (*Migrator, error) {
+	source, err := iofs.New(FS, ".")
+	if err != nil {
+		return nil, err
+	}
+	driver, err := pgxmigrate.WithInstance(stdlib.OpenDBFromPool(pool), &pgxmigrate.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to init migration driver: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "pgx5", driver)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{m: m, latest: latest}, nil
+}
+
+// Applies all pending migrations.
+func (mg *Migrator) Up() error {
+	err := mg.m.Up()
+	if errors.Is(err, migrate.ErrNoChange) {
+		slog.Info("Schema is up to date", "version", mg.latest)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Schema migrated", "version", mg.latest)
+	return nil
+}
+
+// Reverts the given number of migrations.
+func (mg *Migrator) Down(steps int) error {
+	if steps < 1 {
+		return fmt.Errorf("steps must be at least 1")
+	}
+	err := mg.m.Steps(-steps)
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+func (mg *Migrator) Status() (Status, error) {
+	version, dirty, err := mg.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		version, err = 0, nil
+	}
+	if err != nil {
+		return Status{}, err
+	}
+
+	versions, err := versions()
+	if err != nil {
+		return Status{}, err
+	}
+	pending := []int64{}
+	for _, v := range versions {
+		if v > int64(version) {
+			pending = append(pending, v)
+		}
+	}
+	return Status{Version: int64(version), Dirty: dirty, Latest: mg.latest, Pending: pending}, nil
+}
+
+// Errors unless the schema is at least the version this build was made for and not dirty. Newer schemas are
+// accepted, so instances of the previous release keep running while a rollout migrates.
+func (mg *Migrator) Check() error {
+	status, err := mg.Status()
+	if err != nil {
+		return err
+	}
+	return CheckVersion(status.Version, status.Dirty, mg.latest)
+}
+
+func CheckVersion(version int64, dirty bool, latest int64) error {
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty. A migration failed halfway and has to be fixed by hand", version)
+	}
+	if version < latest {
+		return fmt.Errorf("schema version %d is behind %d. Run migrate up or enable automigrate", version, latest)
+	}
+	return nil
+}
+
+func (mg *Migrator) Close() error {
+	sourceErr, dbErr := mg.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+// Versions of the embedded migrations in ascending order.
+func versions() ([]int64, error) {
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int64
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok {
+			continue
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %s: %w", entry.Name(), err)
+		}
+		if !slices.Contains(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+	slices.Sort(versions)
+	return versions, nil
+}
@@ -0,0 +1,107 @@
+-- name: SearchUsers :many
+SELECT
+    *
+FROM
+    "user"
+WHERE
+    sqlc.arg('query')::text = ''
+    OR username ILIKE '%' || sqlc.arg('query')::text || '%'
+    OR email ILIKE '%' || sqlc.arg('query')::text || '%'
+    OR NAME ILIKE '%' || sqlc.arg('query')::text || '%'
+ORDER BY
+    id
+LIMIT
+    sqlc.arg('limit')
+OFFSET
+    sqlc.arg('offset');
+
+-- name: SetUserSuspended :one
+UPDATE "user"
+SET
+    suspended_at = $2
+WHERE
+    id = $1
+RETURNING
+    *;
+
+-- name: SetUserRole :one
+UPDATE "user"
+SET
+    role = $2
+WHERE
+    id = $1
+RETURNING
+    *;
+
+-- name: PromoteAdmins :execrows
+UPDATE "user"
+SET
+    role = 'admin'
+WHERE
+    email = ANY (sqlc.arg('emails')::text[])
+    AND role <> 'admin';
+
+-- name: ReleaseEndpoint :execrows
+DELETE FROM "endpoint"
+WHERE
+    endpoint = $1
+    AND domain = $2;
+
+-- name: GetSystemStats :one
+SELECT
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "user"
+    ) AS num_users,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "user"
+        WHERE
+            "user".suspended_at IS NOT NULL
+    ) AS num_suspended_users,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "endpoint"
+        WHERE
+            "endpoint".expires_at > NOW()
+    ) AS num_endpoints,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "request"
+    ) AS num_requests,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "request"
+        WHERE
+            "request".created_at > NOW() - INTERVAL '24 hours'
+    ) AS num_requests_last_day,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "session"
+        WHERE
+            "session".revoked_at IS NULL
+            AND "session".expires_at > NOW()
+    ) AS num_active_sessions;
+
+-- name: CountUsersByPlan :many
+SELECT
+    plan,
+    COUNT(*) AS num_users
+FROM
+    "user"
+GROUP BY
+    plan
+ORDER BY
+    plan;
@@ -0,0 +1,61 @@
+-- name: InsertAuditLog :exec
+INSERT INTO
+    audit_log (
+        actor_id,
+        user_id,
+        action,
+        target,
+        ip,
+        user_agent,
+        before,
+        after
+    )
+VALUES
+    ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: ListUserAuditLog :many
+SELECT
+    *
+FROM
+    audit_log
+WHERE
+    (
+        actor_id = sqlc.arg('user_id')::bigint
+        OR user_id = sqlc.arg('user_id')::bigint
+    )
+    AND (
+        sqlc.arg('before_id')::bigint = 0
+        OR id < sqlc.arg('before_id')::bigint
+    )
+ORDER BY
+    id DESC
+LIMIT
+    sqlc.arg('limit');
+
+-- name: ListAuditLog :many
+SELECT
+    *
+FROM
+    audit_log
+WHERE
+    (
+        sqlc.arg('user_id')::bigint = 0
+        OR actor_id = sqlc.arg('user_id')::bigint
+        OR user_id = sqlc.arg('user_id')::bigint
+    )
+    AND (
+        sqlc.arg('action')::text = ''
+        OR action = sqlc.arg('action')::text
+    )
+    AND (
+        sqlc.arg('target')::text = ''
+        OR target = sqlc.arg('target')::text
+    )
+    AND (
+        sqlc.arg('before_id')::bigint = 0
+        OR id < sqlc.arg('before_id')::bigint
+    )
+ORDER BY
+    id DESC
+LIMIT
+    sqlc.arg('limit');
@@ -0,0 +1,24 @@
+-- name: InsertBillingEvent :execrows
+INSERT INTO
+    billing_event (id, type, user_id)
+VALUES
+    ($1, $2, $3)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: AdvanceBillingSubscription :execrows
+INSERT INTO
+    billing_subscription (id, user_id, last_event_at, deleted)
+VALUES
+    ($1, $2, $3, $4)
+ON CONFLICT (id) DO UPDATE
+SET
+    user_id = EXCLUDED.user_id,
+    last_event_at = EXCLUDED.last_event_at,
+    deleted = EXCLUDED.deleted,
+    updated_at = NOW()
+WHERE
+    billing_subscription.last_event_at < EXCLUDED.last_event_at
+    OR (
+        billing_subscription.last_event_at = EXCLUDED.last_event_at
+        AND NOT billing_subscription.deleted
+    );
@@ -0,0 +1,58 @@
+-- name: CreateCustomDomain :one
+INSERT INTO
+    custom_domain (endpoint_id, hostname, token)
+VALUES
+    ($1, $2, $3)
+RETURNING
+    *;
+
+-- name: GetCustomDomain :one
+SELECT
+    *
+FROM
+    custom_domain
+WHERE
+    endpoint_id = $1
+    AND hostname = $2;
+
+-- name: ListCustomDomains :many
+SELECT
+    *
+FROM
+    custom_domain
+WHERE
+    endpoint_id = $1
+ORDER BY
+    created_at;
+
+-- name: VerifyCustomDomain :one
+UPDATE custom_domain
+SET
+    verified_at = NOW()
+WHERE
+    endpoint_id = $1
+    AND hostname = $2
+RETURNING
+    *;
+
+-- name: DeleteCustomDomain :execrows
+DELETE FROM custom_domain
+WHERE
+    endpoint_id = $1
+    AND hostname = $2;
+
+-- name: ResolveCustomDomain :one
+SELECT
+    endpoint.endpoint,
+    endpoint.domain,
+    "user".plan
+FROM
+    custom_domain
+    JOIN endpoint ON endpoint.id = custom_domain.endpoint_id
+    JOIN "user" ON "user".id = endpoint.user_id
+WHERE
+    custom_domain.hostname = $1
+    AND custom_domain.verified_at IS NOT NULL
+    AND endpoint.is_deleted = FALSE
+LIMIT
+    1;
@@ -5,6 +5,7 @@ FROM
     "endpoint"
 WHERE
     endpoint = $1
+    AND domain = $2
     AND is_deleted = FALSE
 LIMIT
     1;
@@ -27,6 +28,7 @@ SELECT
             endpoint
         WHERE
             endpoint = $1
+            AND domain = $2
             AND expires_at > NOW()
             AND is_deleted = FALSE
         LIMIT
@@ -45,16 +47,154 @@ WHERE
 
 -- name: InsertEndpoint :one
 INSERT INTO
-    endpoint (endpoint, user_id, plan, expires_at)
+    endpoint (endpoint, user_id, plan, expires_at, domain)
 VALUES
-    ($1, $2, $3, $4)
+    ($1, $2, $3, $4, $5)
 RETURNING
     *;
 
 -- name: InsertFreeEndpoint :one
 INSERT INTO
-    endpoint (endpoint, user_id, plan, expires_at)
+    endpoint (endpoint, user_id, plan, expires_at, domain)
 VALUES
-    ($1, $2, 'free', $3)
+    ($1, $2, 'free', $3, $4)
 RETURNING
-    *;
\ No newline at end of file
+    *;
+
+-- name: AssignEndpointDomain :execrows
+UPDATE endpoint
+SET
+    domain = $1
+WHERE
+    domain = '';
+
+-- name: GetEndpointAccess :one
+SELECT
+    endpoint_access.*
+FROM
+    endpoint_access
+    JOIN endpoint ON endpoint_access.endpoint_id = endpoint.id
+WHERE
+    endpoint.endpoint = $1
+    AND endpoint.domain = $2
+    AND endpoint.is_deleted = FALSE
+LIMIT
+    1;
+
+-- name: UpsertEndpointAccess :one
+INSERT INTO
+    endpoint_access (
+        endpoint_id,
+        allowed_ips,
+        basic_username,
+        basic_password_hash,
+        header_name,
+        header_value,
+        query_param,
+        query_value,
+        client_cert_fingerprints,
+        reject_code
+    )
+VALUES
+    ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (endpoint_id) DO UPDATE
+SET
+    allowed_ips = EXCLUDED.allowed_ips,
+    basic_username = EXCLUDED.basic_username,
+    basic_password_hash = EXCLUDED.basic_password_hash,
+    header_name = EXCLUDED.header_name,
+    header_value = EXCLUDED.header_value,
+    query_param = EXCLUDED.query_param,
+    query_value = EXCLUDED.query_value,
+    client_cert_fingerprints = EXCLUDED.client_cert_fingerprints,
+    reject_code = EXCLUDED.reject_code,
+    updated_at = NOW()
+RETURNING
+    *;
+
+-- name: DeleteEndpointAccess :exec
+DELETE FROM endpoint_access
+WHERE
+    endpoint_id = $1;
+
+-- name: UpdateEndpointRateLimit :one
+UPDATE endpoint
+SET
+    rate_limit = $2,
+    rate_burst = $3,
+    ip_rate_limit = $4,
+    ip_rate_burst = $5
+WHERE
+    id = $1
+RETURNING
+    *;
+
+-- name: IncrementEndpointDroppedCount :exec
+UPDATE endpoint
+SET
+    dropped_count = dropped_count + $3
+WHERE
+    endpoint = $1
+    AND domain = $2;
+
+-- name: UpdateUserEndpointsPlan :exec
+UPDATE endpoint
+SET
+    plan = $2
+WHERE
+    user_id = $1
+    AND is_deleted = FALSE;
+
+-- name: ExpireEndpointsBeyondLimit :execrows
+UPDATE endpoint
+SET
+    expires_at_before_downgrade = expires_at,
+    expires_at = NOW()
+WHERE
+    id IN (
+        SELECT
+            id
+        FROM
+            endpoint e
+        WHERE
+            e.user_id = $1
+            AND e.expires_at > NOW()
+            AND e.is_deleted = FALSE
+        ORDER BY
+            e.created_at ASC
+        OFFSET
+            $2
+    );
+
+-- name: RestoreDowngradedEndpoints :execrows
+UPDATE endpoint
+SET
+    expires_at = expires_at_before_downgrade,
+    expires_at_before_downgrade = NULL
+WHERE
+    id IN (
+        SELECT
+            e.id
+        FROM
+            endpoint e
+        WHERE
+            e.user_id = $1
+            AND e.expires_at_before_downgrade > NOW()
+            AND e.is_deleted = FALSE
+        ORDER BY
+            e.created_at ASC
+        LIMIT
+            GREATEST(
+                sqlc.arg(max_endpoints)::int - (
+                    SELECT
+                        COUNT(*)
+                    FROM
+                        endpoint a
+                    WHERE
+                        a.user_id = $1
+                        AND a.expires_at > NOW()
+                        AND a.is_deleted = FALSE
+                ),
+                0
+            )
+    );
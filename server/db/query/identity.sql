@@ -0,0 +1,34 @@
+-- name: CreateIdentity :one
+INSERT INTO
+	"identity" (user_id, provider, subject, email)
+VALUES
+	($1, $2, $3, $4)
+RETURNING
+	*;
+
+-- name: GetIdentity :one
+SELECT
+	*
+FROM
+	"identity"
+WHERE
+	provider = $1
+	AND subject = $2
+LIMIT
+	1;
+
+-- name: ListUserIdentities :many
+SELECT
+	*
+FROM
+	"identity"
+WHERE
+	user_id = $1
+ORDER BY
+	created_at;
+
+-- name: DeleteIdentity :execrows
+DELETE FROM "identity"
+WHERE
+	user_id = $1
+	AND provider = $2;
@@ -0,0 +1,41 @@
+-- name: CreateMagicLink :exec
+INSERT INTO
+	"magic_link" (id, email, ip, expires_at)
+VALUES
+	($1, $2, $3, $4);
+
+-- name: CountRecentMagicLinks :one
+SELECT
+	count(*) FILTER (
+		WHERE
+			email = sqlc.arg('email')
+	) AS email_count,
+	count(*) FILTER (
+		WHERE
+			ip = sqlc.arg('ip')
+	) AS ip_count
+FROM
+	"magic_link"
+WHERE
+	created_at > sqlc.arg('since');
+
+-- name: UseMagicLink :one
+UPDATE "magic_link"
+SET
+	used_at = now()
+WHERE
+	id = $1
+	AND used_at IS NULL
+	AND expires_at > now()
+RETURNING
+	email;
+
+-- name: DeleteExpiredMagicLinks :execrows
+DELETE FROM "magic_link"
+WHERE
+	expires_at < now();
+
+-- name: DeleteMagicLinksForEmail :exec
+DELETE FROM "magic_link"
+WHERE
+	email = $1;
@@ -0,0 +1,14 @@
+-- name: ListPlanLimits :many
+SELECT
+    *
+FROM
+    plan_limit
+ORDER BY
+    name;
+
+-- name: RegisterPlans :exec
+INSERT INTO
+    plan_catalog (name)
+SELECT
+    unnest(@names::text[])
+ON CONFLICT DO NOTHING;
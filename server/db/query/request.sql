@@ -15,7 +15,10 @@ INSERT INTO
         response_code,
         headers,
         query_params,
-        expires_at
+        expires_at,
+        blocked,
+        tls,
+        traceparent
     )
 VALUES
     (
@@ -32,7 +35,7 @@ VALUES
         $11,
         $12,
         $13,
-    $14, $15
+    $14, $15, $16, $17, $18
     )
 RETURNING
     *;
@@ -56,21 +59,29 @@ SELECT
     request.query_params,
     request.created_at,
     request.expires_at,
+    request.blocked,
+    request.tls,
+    request.traceparent,
     endpoint.endpoint AS endpoint
 FROM
     request
     LEFT JOIN endpoint ON request.endpoint_id = endpoint.id
 WHERE
-    endpoint.endpoint = $1
-    AND request.user_id = $2
+    endpoint.endpoint = sqlc.arg(endpoint)
+    AND endpoint.domain = sqlc.arg(domain)
+    AND request.user_id = sqlc.arg(user_id)
     AND request.is_deleted = FALSE
     AND request.expires_at > NOW()
+    AND (
+        sqlc.arg(include_blocked)::bool
+        OR request.blocked = FALSE
+    )
 ORDER BY
     request.id DESC
 LIMIT
-    $3
+    sqlc.arg('limit')
 OFFSET
-    $4;
+    sqlc.arg('offset');
 
 -- name: GetRequestById :one
 SELECT
@@ -96,14 +107,20 @@ SELECT
         CASE
             WHEN response_code != 200 THEN 1
         END
-    ) AS failure_count
+    ) AS failure_count,
+    COUNT(
+        CASE
+            WHEN blocked = TRUE THEN 1
+        END
+    ) AS blocked_count
 FROM
     request r
     LEFT JOIN endpoint e ON r.endpoint_id = e.id
 WHERE
-    endpoint = $1
-    AND is_deleted = FALSE
-    AND expires_at > NOW();
+    e.endpoint = $1
+    AND e.domain = $2
+    AND r.is_deleted = FALSE
+    AND r.expires_at > NOW();
 
 -- name: GetRequestByUUID :one
 SELECT
@@ -117,7 +134,15 @@ WHERE
 LIMIT
     1;
 
--- name: DeleteExpiredRequests :exec
+-- name: DeleteExpiredRequests :execrows
 DELETE FROM request
 WHERE
     expires_at < NOW();
+
+-- name: CapUserRequestsExpiry :execrows
+UPDATE request
+SET
+    expires_at = $2
+WHERE
+    user_id = $1
+    AND expires_at > $2;
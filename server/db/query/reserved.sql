@@ -0,0 +1,51 @@
+-- name: ListReservedNames :many
+SELECT
+    *
+FROM
+    reserved_name
+ORDER BY
+    kind,
+    name;
+
+-- name: UpsertReservedName :one
+INSERT INTO
+    reserved_name (name, kind)
+VALUES
+    ($1, $2)
+ON CONFLICT (name) DO UPDATE
+SET
+    kind = EXCLUDED.kind
+RETURNING
+    *;
+
+-- name: DeleteReservedName :execrows
+DELETE FROM reserved_name
+WHERE
+    name = $1
+    AND kind = $2;
+
+-- name: ListCompanyDomains :many
+SELECT
+    *
+FROM
+    company_domain
+ORDER BY
+    company,
+    domain;
+
+-- name: UpsertCompanyDomain :one
+INSERT INTO
+    company_domain (domain, company)
+VALUES
+    ($1, $2)
+ON CONFLICT (domain) DO UPDATE
+SET
+    company = EXCLUDED.company
+RETURNING
+    *;
+
+-- name: DeleteCompanyDomain :execrows
+DELETE FROM company_domain
+WHERE
+    domain = $1
+    AND company = $2;
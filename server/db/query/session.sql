@@ -0,0 +1,79 @@
+-- name: CreateSession :one
+INSERT INTO
+	"session" (id, user_id, refresh_token_hash, user_agent, ip, expires_at)
+VALUES
+	($1, $2, $3, $4, $5, $6)
+RETURNING
+	*;
+
+-- name: GetSession :one
+SELECT
+	*
+FROM
+	"session"
+WHERE
+	id = $1
+LIMIT
+	1;
+
+-- name: GetSessionFromRefreshToken :one
+SELECT
+	*
+FROM
+	"session"
+WHERE
+	refresh_token_hash = $1
+	OR previous_refresh_hash = $1
+LIMIT
+	1;
+
+-- name: RotateSession :one
+UPDATE "session"
+SET
+	previous_refresh_hash = refresh_token_hash,
+	refresh_token_hash = sqlc.arg('new_refresh_token_hash'),
+	user_agent = sqlc.arg('user_agent'),
+	ip = sqlc.arg('ip'),
+	expires_at = sqlc.arg('expires_at'),
+	rotated_at = sqlc.arg('rotated_at'),
+	last_used_at = now()
+WHERE
+	id = sqlc.arg('id')
+	AND refresh_token_hash = sqlc.arg('refresh_token_hash')
+	AND revoked_at IS NULL
+RETURNING
+	*;
+
+-- name: ListUserSessions :many
+SELECT
+	*
+FROM
+	"session"
+WHERE
+	user_id = $1
+	AND revoked_at IS NULL
+	AND expires_at > now()
+ORDER BY
+	last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE "session"
+SET
+	revoked_at = now()
+WHERE
+	id = $1
+	AND user_id = $2
+	AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :execrows
+UPDATE "session"
+SET
+	revoked_at = now()
+WHERE
+	user_id = $1
+	AND revoked_at IS NULL;
+
+-- name: DeleteExpiredSessions :execrows
+DELETE FROM "session"
+WHERE
+	expires_at < now();
@@ -0,0 +1,180 @@
+-- name: CreateTeam :one
+INSERT INTO
+    team (name)
+VALUES
+    ($1)
+RETURNING
+    *;
+
+-- name: GetTeam :one
+SELECT
+    *
+FROM
+    team
+WHERE
+    id = $1;
+
+-- name: AddTeamMember :one
+INSERT INTO
+    team_member (team_id, user_id, role)
+VALUES
+    ($1, $2, $3)
+ON CONFLICT (team_id, user_id) DO UPDATE
+SET
+    role = EXCLUDED.role
+RETURNING
+    *;
+
+-- name: RemoveTeamMember :execrows
+DELETE FROM team_member
+WHERE
+    team_id = $1
+    AND user_id = $2
+    AND role <> 'owner';
+
+-- name: GetTeamMember :one
+SELECT
+    *
+FROM
+    team_member
+WHERE
+    team_id = $1
+    AND user_id = $2;
+
+-- name: ListUserTeams :many
+SELECT
+    team.*,
+    team_member.role
+FROM
+    team
+    JOIN team_member ON team_member.team_id = team.id
+WHERE
+    team_member.user_id = $1
+ORDER BY
+    team.id;
+
+-- name: ListTeamMembers :many
+SELECT
+    team_member.user_id,
+    team_member.role,
+    "user".username
+FROM
+    team_member
+    JOIN "user" ON "user".id = team_member.user_id
+WHERE
+    team_member.team_id = $1
+ORDER BY
+    team_member.created_at;
+
+-- name: CreateTeamDomain :one
+INSERT INTO
+    team_domain (team_id, domain, company, token)
+VALUES
+    ($1, $2, $3, $4)
+RETURNING
+    *;
+
+-- name: GetTeamDomain :one
+SELECT
+    *
+FROM
+    team_domain
+WHERE
+    team_id = $1
+    AND domain = $2;
+
+-- name: ListTeamDomains :many
+SELECT
+    *
+FROM
+    team_domain
+WHERE
+    team_id = $1
+ORDER BY
+    domain;
+
+-- name: VerifyTeamDomain :one
+UPDATE team_domain
+SET
+    verified_at = NOW(),
+    method = $3
+WHERE
+    team_id = $1
+    AND domain = $2
+RETURNING
+    *;
+
+-- name: DeleteTeamDomain :execrows
+DELETE FROM team_domain
+WHERE
+    team_id = $1
+    AND domain = $2;
+
+-- name: UserHasVerifiedCompany :one
+SELECT
+    EXISTS (
+        SELECT
+            1
+        FROM
+            team_domain
+            JOIN team_member ON team_member.team_id = team_domain.team_id
+            JOIN company_domain ON team_domain.domain = company_domain.domain
+            OR team_domain.domain LIKE '%.' || company_domain.domain
+        WHERE
+            team_member.user_id = $1
+            AND company_domain.company = $2
+            AND team_domain.verified_at IS NOT NULL
+    );
+
+-- name: GetCompanyOfDomain :one
+SELECT
+    company
+FROM
+    company_domain
+WHERE
+    domain = @domain::text
+    OR @domain::text LIKE '%.' || domain
+LIMIT
+    1;
+
+-- name: CreateTeamInvitation :one
+INSERT INTO
+    team_invitation (team_id, user_id, invited_by)
+VALUES
+    ($1, $2, $3)
+RETURNING
+    *;
+
+-- name: DeleteTeamInvitation :execrows
+DELETE FROM team_invitation
+WHERE
+    team_id = $1
+    AND user_id = $2;
+
+-- name: ListTeamInvitations :many
+SELECT
+    team_invitation.user_id,
+    team_invitation.created_at,
+    "user".username
+FROM
+    team_invitation
+    JOIN "user" ON "user".id = team_invitation.user_id
+WHERE
+    team_invitation.team_id = $1
+ORDER BY
+    team_invitation.created_at;
+
+-- name: ListUserInvitations :many
+SELECT
+    team_invitation.team_id,
+    team_invitation.created_at,
+    team.name AS team_name,
+    inviter.username AS invited_by
+FROM
+    team_invitation
+    JOIN team ON team.id = team_invitation.team_id
+    LEFT JOIN "user" inviter ON inviter.id = team_invitation.invited_by
+WHERE
+    team_invitation.user_id = $1
+ORDER BY
+    team_invitation.created_at;
@@ -0,0 +1,44 @@
+-- name: IncrementUsage :one
+INSERT INTO
+    "usage" (
+        user_id,
+        period_start,
+        request_count,
+        stored_bytes,
+        replay_count,
+        forward_count
+    )
+VALUES
+    ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id, period_start) DO UPDATE
+SET
+    request_count = "usage".request_count + EXCLUDED.request_count,
+    stored_bytes = "usage".stored_bytes + EXCLUDED.stored_bytes,
+    replay_count = "usage".replay_count + EXCLUDED.replay_count,
+    forward_count = "usage".forward_count + EXCLUDED.forward_count,
+    updated_at = NOW()
+RETURNING
+    *;
+
+-- name: GetUsage :one
+SELECT
+    *
+FROM
+    "usage"
+WHERE
+    user_id = $1
+    AND period_start = $2
+LIMIT
+    1;
+
+-- name: ListUsage :many
+SELECT
+    *
+FROM
+    "usage"
+WHERE
+    user_id = $1
+ORDER BY
+    period_start DESC
+LIMIT
+    $2;
@@ -1,8 +1,10 @@
+-- Returns no rows when the username is taken.
 -- name: CreateUser :one
 INSERT INTO
 	"user" (NAME, avatar_url, username, plan, email)
 VALUES
 	($1, $2, $3, $4, $5)
+ON CONFLICT (username) DO NOTHING
 RETURNING
 	*;
 
@@ -49,4 +51,84 @@ OFFSET
 -- name: DeleteUser :exec
 DELETE FROM "user"
 WHERE
-	id = $1;
\ No newline at end of file
+	id = $1;
+
+-- name: UpdateUserPlan :one
+UPDATE "user"
+SET
+	plan = $2
+WHERE
+	id = $1
+RETURNING
+	*;
+
+-- name: SetUserBillingCustomer :exec
+UPDATE "user"
+SET
+	billing_customer_id = $2
+WHERE
+	id = $1;
+
+-- name: GetUserFromBillingCustomer :one
+SELECT
+	*
+FROM
+	"user"
+WHERE
+	billing_customer_id = $1
+LIMIT
+	1;
+
+-- name: UpdateUserProfile :one
+UPDATE "user"
+SET
+	NAME = $2,
+	avatar_url = $3,
+	username = $4
+WHERE
+	id = $1
+RETURNING
+	*;
+
+-- name: ExportUserEndpoints :many
+SELECT
+	*
+FROM
+	"endpoint"
+WHERE
+	user_id = $1
+ORDER BY
+	id;
+
+-- name: ExportUserRequests :many
+SELECT
+	*
+FROM
+	"request"
+WHERE
+	(
+		"request".user_id = sqlc.arg('user_id')
+		OR "request".endpoint_id IN (
+			SELECT
+				id
+			FROM
+				"endpoint"
+			WHERE
+				"endpoint".user_id = sqlc.arg('user_id')
+		)
+	)
+	AND "request".id > sqlc.arg('after_id')
+ORDER BY
+	"request".id
+LIMIT
+	sqlc.arg('limit');
+
+-- name: ExportUserResponses :many
+SELECT
+	*
+FROM
+	"response"
+WHERE
+	user_id = $1
+ORDER BY
+	id;
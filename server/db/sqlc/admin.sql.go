@@ -0,0 +1,282 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: admin.sql
+
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const countUsersByPlan = `-- name: CountUsersByPlan :many
+SELECT
+    plan,
+    COUNT(*) AS num_users
+FROM
+    "user"
+GROUP BY
+    plan
+ORDER BY
+    plan
+`
+
+type CountUsersByPlanRow struct {
+	Plan     Plan  `json:"plan"`
+	NumUsers int64 `json:"num_users"`
+}
+
+func (q *Queries) CountUsersByPlan(ctx context.Context) ([]CountUsersByPlanRow, error) {
+	rows, err := q.db.Query(ctx, countUsersByPlan)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountUsersByPlanRow{}
+	for rows.Next() {
+		var i CountUsersByPlanRow
+		if err := rows.Scan(&i.Plan, &i.NumUsers); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSystemStats = `-- name: GetSystemStats :one
+SELECT
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "user"
+    ) AS num_users,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "user"
+        WHERE
+            "user".suspended_at IS NOT NULL
+    ) AS num_suspended_users,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "endpoint"
+        WHERE
+            "endpoint".expires_at > NOW()
+    ) AS num_endpoints,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "request"
+    ) AS num_requests,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "request"
+        WHERE
+            "request".created_at > NOW() - INTERVAL '24 hours'
+    ) AS num_requests_last_day,
+    (
+        SELECT
+            COUNT(*)
+        FROM
+            "session"
+        WHERE
+            "session".revoked_at IS NULL
+            AND "session".expires_at > NOW()
+    ) AS num_active_sessions
+`
+
+type GetSystemStatsRow struct {
+	NumUsers           int64 `json:"num_users"`
+	NumSuspendedUsers  int64 `json:"num_suspended_users"`
+	NumEndpoints       int64 `json:"num_endpoints"`
+	NumRequests        int64 `json:"num_requests"`
+	NumRequestsLastDay int64 `json:"num_requests_last_day"`
+	NumActiveSessions  int64 `json:"num_active_sessions"`
+}
+
+func (q *Queries) GetSystemStats(ctx context.Context) (GetSystemStatsRow, error) {
+	row := q.db.QueryRow(ctx, getSystemStats)
+	var i GetSystemStatsRow
+	err := row.Scan(
+		&i.NumUsers,
+		&i.NumSuspendedUsers,
+		&i.NumEndpoints,
+		&i.NumRequests,
+		&i.NumRequestsLastDay,
+		&i.NumActiveSessions,
+	)
+	return i, err
+}
+
+const promoteAdmins = `-- name: PromoteAdmins :execrows
+UPDATE "user"
+SET
+    role = 'admin'
+WHERE
+    email = ANY ($1::text[])
+    AND role <> 'admin'
+`
+
+func (q *Queries) PromoteAdmins(ctx context.Context, emails []string) (int64, error) {
+	result, err := q.db.Exec(ctx, promoteAdmins, emails)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const releaseEndpoint = `-- name: ReleaseEndpoint :execrows
+DELETE FROM "endpoint"
+WHERE
+    endpoint = $1
+    AND domain = $2
+`
+
+type ReleaseEndpointParams struct {
+	Endpoint string `json:"endpoint"`
+	Domain   string `json:"domain"`
+}
+
+func (q *Queries) ReleaseEndpoint(ctx context.Context, arg ReleaseEndpointParams) (int64, error) {
+	result, err := q.db.Exec(ctx, releaseEndpoint, arg.Endpoint, arg.Domain)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT
+    id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
+FROM
+    "user"
+WHERE
+    $1::text = ''
+    OR username ILIKE '%' || $1::text || '%'
+    OR email ILIKE '%' || $1::text || '%'
+    OR NAME ILIKE '%' || $1::text || '%'
+ORDER BY
+    id
+LIMIT
+    $3
+OFFSET
+    $2
+`
+
+type SearchUsersParams struct {
+	Query  string `json:"query"`
+	Offset int32  `json:"offset"`
+	Limit  int32  `json:"limit"`
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, searchUsers, arg.Query, arg.Offset, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.AvatarUrl,
+			&i.Username,
+			&i.Plan,
+			&i.Email,
+			&i.CreatedAt,
+			&i.IsDeleted,
+			&i.BillingCustomerID,
+			&i.Role,
+			&i.SuspendedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE "user"
+SET
+    role = $2
+WHERE
+    id = $1
+RETURNING
+    id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
+`
+
+type SetUserRoleParams struct {
+	ID   int64  `json:"id"`
+	Role string `json:"role"`
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AvatarUrl,
+		&i.Username,
+		&i.Plan,
+		&i.Email,
+		&i.CreatedAt,
+		&i.IsDeleted,
+		&i.BillingCustomerID,
+		&i.Role,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const setUserSuspended = `-- name: SetUserSuspended :one
+UPDATE "user"
+SET
+    suspended_at = $2
+WHERE
+    id = $1
+RETURNING
+    id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
+`
+
+type SetUserSuspendedParams struct {
+	ID          int64              `json:"id"`
+	SuspendedAt pgtype.Timestamptz `json:"suspended_at"`
+}
+
+func (q *Queries) SetUserSuspended(ctx context.Context, arg SetUserSuspendedParams) (User, error) {
+	row := q.db.QueryRow(ctx, setUserSuspended, arg.ID, arg.SuspendedAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AvatarUrl,
+		&i.Username,
+		&i.Plan,
+		&i.Email,
+		&i.CreatedAt,
+		&i.IsDeleted,
+		&i.BillingCustomerID,
+		&i.Role,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,184 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: audit.sql
+
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const insertAuditLog = `-- name: InsertAuditLog :exec
+INSERT INTO
+    audit_log (
+        actor_id,
+        user_id,
+        action,
+        target,
+        ip,
+        user_agent,
+        before,
+        after
+    )
+VALUES
+    ($1, $2, $3, $4, $5, $6, $7, $8)
+`
+
+type InsertAuditLogParams struct {
+	ActorID   pgtype.Int8 `json:"actor_id"`
+	UserID    pgtype.Int8 `json:"user_id"`
+	Action    string      `json:"action"`
+	Target    string      `json:"target"`
+	Ip        string      `json:"ip"`
+	UserAgent string      `json:"user_agent"`
+	Before    []byte      `json:"before"`
+	After     []byte      `json:"after"`
+}
+
+func (q *Queries) InsertAuditLog(ctx context.Context, arg InsertAuditLogParams) error {
+	_, err := q.db.Exec(ctx, insertAuditLog,
+		arg.ActorID,
+		arg.UserID,
+		arg.Action,
+		arg.Target,
+		arg.Ip,
+		arg.UserAgent,
+		arg.Before,
+		arg.After,
+	)
+	return err
+}
+
+const listAuditLog = `-- name: ListAuditLog :many
+SELECT
+    id, actor_id, user_id, action, target, ip, user_agent, before, after, created_at
+FROM
+    audit_log
+WHERE
+    (
+        $1::bigint = 0
+        OR actor_id = $1::bigint
+        OR user_id = $1::bigint
+    )
+    AND (
+        $2::text = ''
+        OR action = $2::text
+    )
+    AND (
+        $3::text = ''
+        OR target = $3::text
+    )
+    AND (
+        $4::bigint = 0
+        OR id < $4::bigint
+    )
+ORDER BY
+    id DESC
+LIMIT
+    $5
+`
+
+type ListAuditLogParams struct {
+	UserID   int64  `json:"user_id"`
+	Action   string `json:"action"`
+	Target   string `json:"target"`
+	BeforeID int64  `json:"before_id"`
+	Limit    int32  `json:"limit"`
+}
+
+func (q *Queries) ListAuditLog(ctx context.Context, arg ListAuditLogParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditLog,
+		arg.UserID,
+		arg.Action,
+		arg.Target,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuditLog{}
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.ActorID,
+			&i.UserID,
+			&i.Action,
+			&i.Target,
+			&i.Ip,
+			&i.UserAgent,
+			&i.Before,
+			&i.After,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserAuditLog = `-- name: ListUserAuditLog :many
+SELECT
+    id, actor_id, user_id, action, target, ip, user_agent, before, after, created_at
+FROM
+    audit_log
+WHERE
+    (
+        actor_id = $1::bigint
+        OR user_id = $1::bigint
+    )
+    AND (
+        $2::bigint = 0
+        OR id < $2::bigint
+    )
+ORDER BY
+    id DESC
+LIMIT
+    $3
+`
+
+type ListUserAuditLogParams struct {
+	UserID   int64 `json:"user_id"`
+	BeforeID int64 `json:"before_id"`
+	Limit    int32 `json:"limit"`
+}
+
+func (q *Queries) ListUserAuditLog(ctx context.Context, arg ListUserAuditLogParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listUserAuditLog, arg.UserID, arg.BeforeID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuditLog{}
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.ActorID,
+			&i.UserID,
+			&i.Action,
+			&i.Target,
+			&i.Ip,
+			&i.UserAgent,
+			&i.Before,
+			&i.After,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
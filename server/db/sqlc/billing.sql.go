@@ -0,0 +1,73 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: billing.sql
+
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const advanceBillingSubscription = `-- name: AdvanceBillingSubscription :execrows
+INSERT INTO
+    billing_subscription (id, user_id, last_event_at, deleted)
+VALUES
+    ($1, $2, $3, $4)
+ON CONFLICT (id) DO UPDATE
+SET
+    user_id = EXCLUDED.user_id,
+    last_event_at = EXCLUDED.last_event_at,
+    deleted = EXCLUDED.deleted,
+    updated_at = NOW()
+WHERE
+    billing_subscription.last_event_at < EXCLUDED.last_event_at
+    OR (
+        billing_subscription.last_event_at = EXCLUDED.last_event_at
+        AND NOT billing_subscription.deleted
+    )
+`
+
+type AdvanceBillingSubscriptionParams struct {
+	ID          string             `json:"id"`
+	UserID      int64              `json:"user_id"`
+	LastEventAt pgtype.Timestamptz `json:"last_event_at"`
+	Deleted     bool               `json:"deleted"`
+}
+
+func (q *Queries) AdvanceBillingSubscription(ctx context.Context, arg AdvanceBillingSubscriptionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, advanceBillingSubscription,
+		arg.ID,
+		arg.UserID,
+		arg.LastEventAt,
+		arg.Deleted,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const insertBillingEvent = `-- name: InsertBillingEvent :execrows
+INSERT INTO
+    billing_event (id, type, user_id)
+VALUES
+    ($1, $2, $3)
+ON CONFLICT (id) DO NOTHING
+`
+
+type InsertBillingEventParams struct {
+	ID     string      `json:"id"`
+	Type   string      `json:"type"`
+	UserID pgtype.Int8 `json:"user_id"`
+}
+
+func (q *Queries) InsertBillingEvent(ctx context.Context, arg InsertBillingEventParams) (int64, error) {
+	result, err := q.db.Exec(ctx, insertBillingEvent, arg.ID, arg.Type, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
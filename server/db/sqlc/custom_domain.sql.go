@@ -0,0 +1,186 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: custom_domain.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createCustomDomain = `-- name: CreateCustomDomain :one
+INSERT INTO
+    custom_domain (endpoint_id, hostname, token)
+VALUES
+    ($1, $2, $3)
+RETURNING
+    id, endpoint_id, hostname, token, verified_at, created_at
+`
+
+type CreateCustomDomainParams struct {
+	EndpointID int64  `json:"endpoint_id"`
+	Hostname   string `json:"hostname"`
+	Token      string `json:"token"`
+}
+
+func (q *Queries) CreateCustomDomain(ctx context.Context, arg CreateCustomDomainParams) (CustomDomain, error) {
+	row := q.db.QueryRow(ctx, createCustomDomain, arg.EndpointID, arg.Hostname, arg.Token)
+	var i CustomDomain
+	err := row.Scan(
+		&i.ID,
+		&i.EndpointID,
+		&i.Hostname,
+		&i.Token,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteCustomDomain = `-- name: DeleteCustomDomain :execrows
+DELETE FROM custom_domain
+WHERE
+    endpoint_id = $1
+    AND hostname = $2
+`
+
+type DeleteCustomDomainParams struct {
+	EndpointID int64  `json:"endpoint_id"`
+	Hostname   string `json:"hostname"`
+}
+
+func (q *Queries) DeleteCustomDomain(ctx context.Context, arg DeleteCustomDomainParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteCustomDomain, arg.EndpointID, arg.Hostname)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getCustomDomain = `-- name: GetCustomDomain :one
+SELECT
+    id, endpoint_id, hostname, token, verified_at, created_at
+FROM
+    custom_domain
+WHERE
+    endpoint_id = $1
+    AND hostname = $2
+`
+
+type GetCustomDomainParams struct {
+	EndpointID int64  `json:"endpoint_id"`
+	Hostname   string `json:"hostname"`
+}
+
+func (q *Queries) GetCustomDomain(ctx context.Context, arg GetCustomDomainParams) (CustomDomain, error) {
+	row := q.db.QueryRow(ctx, getCustomDomain, arg.EndpointID, arg.Hostname)
+	var i CustomDomain
+	err := row.Scan(
+		&i.ID,
+		&i.EndpointID,
+		&i.Hostname,
+		&i.Token,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listCustomDomains = `-- name: ListCustomDomains :many
+SELECT
+    id, endpoint_id, hostname, token, verified_at, created_at
+FROM
+    custom_domain
+WHERE
+    endpoint_id = $1
+ORDER BY
+    created_at
+`
+
+func (q *Queries) ListCustomDomains(ctx context.Context, endpointID int64) ([]CustomDomain, error) {
+	rows, err := q.db.Query(ctx, listCustomDomains, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CustomDomain{}
+	for rows.Next() {
+		var i CustomDomain
+		if err := rows.Scan(
+			&i.ID,
+			&i.EndpointID,
+			&i.Hostname,
+			&i.Token,
+			&i.VerifiedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const resolveCustomDomain = `-- name: ResolveCustomDomain :one
+SELECT
+    endpoint.endpoint,
+    endpoint.domain,
+    "user".plan
+FROM
+    custom_domain
+    JOIN endpoint ON endpoint.id = custom_domain.endpoint_id
+    JOIN "user" ON "user".id = endpoint.user_id
+WHERE
+    custom_domain.hostname = $1
+    AND custom_domain.verified_at IS NOT NULL
+    AND endpoint.is_deleted = FALSE
+LIMIT
+    1
+`
+
+type ResolveCustomDomainRow struct {
+	Endpoint string `json:"endpoint"`
+	Domain   string `json:"domain"`
+	Plan     Plan   `json:"plan"`
+}
+
+func (q *Queries) ResolveCustomDomain(ctx context.Context, hostname string) (ResolveCustomDomainRow, error) {
+	row := q.db.QueryRow(ctx, resolveCustomDomain, hostname)
+	var i ResolveCustomDomainRow
+	err := row.Scan(&i.Endpoint, &i.Domain, &i.Plan)
+	return i, err
+}
+
+const verifyCustomDomain = `-- name: VerifyCustomDomain :one
+UPDATE custom_domain
+SET
+    verified_at = NOW()
+WHERE
+    endpoint_id = $1
+    AND hostname = $2
+RETURNING
+    id, endpoint_id, hostname, token, verified_at, created_at
+`
+
+type VerifyCustomDomainParams struct {
+	EndpointID int64  `json:"endpoint_id"`
+	Hostname   string `json:"hostname"`
+}
+
+func (q *Queries) VerifyCustomDomain(ctx context.Context, arg VerifyCustomDomainParams) (CustomDomain, error) {
+	row := q.db.QueryRow(ctx, verifyCustomDomain, arg.EndpointID, arg.Hostname)
+	var i CustomDomain
+	err := row.Scan(
+		&i.ID,
+		&i.EndpointID,
+		&i.Hostname,
+		&i.Token,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
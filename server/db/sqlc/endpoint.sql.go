@@ -11,15 +11,32 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const assignEndpointDomain = `-- name: AssignEndpointDomain :execrows
+UPDATE endpoint
+SET
+    domain = $1
+WHERE
+    domain = ''
+`
+
+func (q *Queries) AssignEndpointDomain(ctx context.Context, domain string) (int64, error) {
+	result, err := q.db.Exec(ctx, assignEndpointDomain, domain)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const checkEndpointExists = `-- name: CheckEndpointExists :one
 SELECT
     EXISTS (
         SELECT
-            id, endpoint, user_id, plan, created_at, expires_at, is_deleted
+            id, endpoint, user_id, plan, created_at, expires_at, is_deleted, rate_limit, rate_burst, ip_rate_limit, ip_rate_burst, dropped_count, domain, expires_at_before_downgrade
         FROM
             endpoint
         WHERE
             endpoint = $1
+            AND domain = $2
             AND expires_at > NOW()
             AND is_deleted = FALSE
         LIMIT
@@ -27,27 +44,123 @@ SELECT
     )
 `
 
-func (q *Queries) CheckEndpointExists(ctx context.Context, endpoint string) (bool, error) {
-	row := q.db.QueryRow(ctx, checkEndpointExists, endpoint)
+type CheckEndpointExistsParams struct {
+	Endpoint string `json:"endpoint"`
+	Domain   string `json:"domain"`
+}
+
+func (q *Queries) CheckEndpointExists(ctx context.Context, arg CheckEndpointExistsParams) (bool, error) {
+	row := q.db.QueryRow(ctx, checkEndpointExists, arg.Endpoint, arg.Domain)
 	var exists bool
 	err := row.Scan(&exists)
 	return exists, err
 }
 
+const deleteEndpointAccess = `-- name: DeleteEndpointAccess :exec
+DELETE FROM endpoint_access
+WHERE
+    endpoint_id = $1
+`
+
+func (q *Queries) DeleteEndpointAccess(ctx context.Context, endpointID int64) error {
+	_, err := q.db.Exec(ctx, deleteEndpointAccess, endpointID)
+	return err
+}
+
+const expireEndpointsBeyondLimit = `-- name: ExpireEndpointsBeyondLimit :execrows
+UPDATE endpoint
+SET
+    expires_at_before_downgrade = expires_at,
+    expires_at = NOW()
+WHERE
+    id IN (
+        SELECT
+            id
+        FROM
+            endpoint e
+        WHERE
+            e.user_id = $1
+            AND e.expires_at > NOW()
+            AND e.is_deleted = FALSE
+        ORDER BY
+            e.created_at ASC
+        OFFSET
+            $2
+    )
+`
+
+type ExpireEndpointsBeyondLimitParams struct {
+	UserID pgtype.Int8 `json:"user_id"`
+	Offset int32       `json:"offset"`
+}
+
+func (q *Queries) ExpireEndpointsBeyondLimit(ctx context.Context, arg ExpireEndpointsBeyondLimitParams) (int64, error) {
+	result, err := q.db.Exec(ctx, expireEndpointsBeyondLimit, arg.UserID, arg.Offset)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getEndpointAccess = `-- name: GetEndpointAccess :one
+SELECT
+    endpoint_access.endpoint_id, endpoint_access.allowed_ips, endpoint_access.basic_username, endpoint_access.basic_password_hash, endpoint_access.header_name, endpoint_access.header_value, endpoint_access.query_param, endpoint_access.query_value, endpoint_access.client_cert_fingerprints, endpoint_access.reject_code, endpoint_access.created_at, endpoint_access.updated_at
+FROM
+    endpoint_access
+    JOIN endpoint ON endpoint_access.endpoint_id = endpoint.id
+WHERE
+    endpoint.endpoint = $1
+    AND endpoint.domain = $2
+    AND endpoint.is_deleted = FALSE
+LIMIT
+    1
+`
+
+type GetEndpointAccessParams struct {
+	Endpoint string `json:"endpoint"`
+	Domain   string `json:"domain"`
+}
+
+func (q *Queries) GetEndpointAccess(ctx context.Context, arg GetEndpointAccessParams) (EndpointAccess, error) {
+	row := q.db.QueryRow(ctx, getEndpointAccess, arg.Endpoint, arg.Domain)
+	var i EndpointAccess
+	err := row.Scan(
+		&i.EndpointID,
+		&i.AllowedIps,
+		&i.BasicUsername,
+		&i.BasicPasswordHash,
+		&i.HeaderName,
+		&i.HeaderValue,
+		&i.QueryParam,
+		&i.QueryValue,
+		&i.ClientCertFingerprints,
+		&i.RejectCode,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const getEndpointDetails = `-- name: GetEndpointDetails :one
 SELECT
-    id, endpoint, user_id, plan, created_at, expires_at, is_deleted
+    id, endpoint, user_id, plan, created_at, expires_at, is_deleted, rate_limit, rate_burst, ip_rate_limit, ip_rate_burst, dropped_count, domain, expires_at_before_downgrade
 FROM
     "endpoint"
 WHERE
     endpoint = $1
+    AND domain = $2
     AND is_deleted = FALSE
 LIMIT
     1
 `
 
-func (q *Queries) GetEndpointDetails(ctx context.Context, endpoint string) (Endpoint, error) {
-	row := q.db.QueryRow(ctx, getEndpointDetails, endpoint)
+type GetEndpointDetailsParams struct {
+	Endpoint string `json:"endpoint"`
+	Domain   string `json:"domain"`
+}
+
+func (q *Queries) GetEndpointDetails(ctx context.Context, arg GetEndpointDetailsParams) (Endpoint, error) {
+	row := q.db.QueryRow(ctx, getEndpointDetails, arg.Endpoint, arg.Domain)
 	var i Endpoint
 	err := row.Scan(
 		&i.ID,
@@ -57,13 +170,20 @@ func (q *Queries) GetEndpointDetails(ctx context.Context, endpoint string) (Endp
 		&i.CreatedAt,
 		&i.ExpiresAt,
 		&i.IsDeleted,
+		&i.RateLimit,
+		&i.RateBurst,
+		&i.IpRateLimit,
+		&i.IpRateBurst,
+		&i.DroppedCount,
+		&i.Domain,
+		&i.ExpiresAtBeforeDowngrade,
 	)
 	return i, err
 }
 
 const getNonExpiredEndpointsOfUser = `-- name: GetNonExpiredEndpointsOfUser :many
 SELECT
-    id, endpoint, user_id, plan, created_at, expires_at, is_deleted
+    id, endpoint, user_id, plan, created_at, expires_at, is_deleted, rate_limit, rate_burst, ip_rate_limit, ip_rate_burst, dropped_count, domain, expires_at_before_downgrade
 FROM
     "endpoint"
 WHERE
@@ -89,6 +209,13 @@ func (q *Queries) GetNonExpiredEndpointsOfUser(ctx context.Context, userID pgtyp
 			&i.CreatedAt,
 			&i.ExpiresAt,
 			&i.IsDeleted,
+			&i.RateLimit,
+			&i.RateBurst,
+			&i.IpRateLimit,
+			&i.IpRateBurst,
+			&i.DroppedCount,
+			&i.Domain,
+			&i.ExpiresAtBeforeDowngrade,
 		); err != nil {
 			return nil, err
 		}
@@ -102,7 +229,7 @@ func (q *Queries) GetNonExpiredEndpointsOfUser(ctx context.Context, userID pgtyp
 
 const getUserEndpoints = `-- name: GetUserEndpoints :many
 SELECT
-    id, endpoint, user_id, plan, created_at, expires_at, is_deleted
+    id, endpoint, user_id, plan, created_at, expires_at, is_deleted, rate_limit, rate_burst, ip_rate_limit, ip_rate_burst, dropped_count, domain, expires_at_before_downgrade
 FROM
     "endpoint"
 WHERE
@@ -127,6 +254,13 @@ func (q *Queries) GetUserEndpoints(ctx context.Context, userID pgtype.Int8) ([]E
 			&i.CreatedAt,
 			&i.ExpiresAt,
 			&i.IsDeleted,
+			&i.RateLimit,
+			&i.RateBurst,
+			&i.IpRateLimit,
+			&i.IpRateBurst,
+			&i.DroppedCount,
+			&i.Domain,
+			&i.ExpiresAtBeforeDowngrade,
 		); err != nil {
 			return nil, err
 		}
@@ -138,13 +272,33 @@ func (q *Queries) GetUserEndpoints(ctx context.Context, userID pgtype.Int8) ([]E
 	return items, nil
 }
 
+const incrementEndpointDroppedCount = `-- name: IncrementEndpointDroppedCount :exec
+UPDATE endpoint
+SET
+    dropped_count = dropped_count + $3
+WHERE
+    endpoint = $1
+    AND domain = $2
+`
+
+type IncrementEndpointDroppedCountParams struct {
+	Endpoint     string `json:"endpoint"`
+	Domain       string `json:"domain"`
+	DroppedCount int64  `json:"dropped_count"`
+}
+
+func (q *Queries) IncrementEndpointDroppedCount(ctx context.Context, arg IncrementEndpointDroppedCountParams) error {
+	_, err := q.db.Exec(ctx, incrementEndpointDroppedCount, arg.Endpoint, arg.Domain, arg.DroppedCount)
+	return err
+}
+
 const insertEndpoint = `-- name: InsertEndpoint :one
 INSERT INTO
-    endpoint (endpoint, user_id, plan, expires_at)
+    endpoint (endpoint, user_id, plan, expires_at, domain)
 VALUES
-    ($1, $2, $3, $4)
+    ($1, $2, $3, $4, $5)
 RETURNING
-    id, endpoint, user_id, plan, created_at, expires_at, is_deleted
+    id, endpoint, user_id, plan, created_at, expires_at, is_deleted, rate_limit, rate_burst, ip_rate_limit, ip_rate_burst, dropped_count, domain, expires_at_before_downgrade
 `
 
 type InsertEndpointParams struct {
@@ -152,6 +306,7 @@ type InsertEndpointParams struct {
 	UserID    pgtype.Int8        `json:"user_id"`
 	Plan      Plan               `json:"plan"`
 	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	Domain    string             `json:"domain"`
 }
 
 func (q *Queries) InsertEndpoint(ctx context.Context, arg InsertEndpointParams) (Endpoint, error) {
@@ -160,6 +315,7 @@ func (q *Queries) InsertEndpoint(ctx context.Context, arg InsertEndpointParams)
 		arg.UserID,
 		arg.Plan,
 		arg.ExpiresAt,
+		arg.Domain,
 	)
 	var i Endpoint
 	err := row.Scan(
@@ -170,27 +326,136 @@ func (q *Queries) InsertEndpoint(ctx context.Context, arg InsertEndpointParams)
 		&i.CreatedAt,
 		&i.ExpiresAt,
 		&i.IsDeleted,
+		&i.RateLimit,
+		&i.RateBurst,
+		&i.IpRateLimit,
+		&i.IpRateBurst,
+		&i.DroppedCount,
+		&i.Domain,
+		&i.ExpiresAtBeforeDowngrade,
 	)
 	return i, err
 }
 
 const insertFreeEndpoint = `-- name: InsertFreeEndpoint :one
 INSERT INTO
-    endpoint (endpoint, user_id, plan, expires_at)
+    endpoint (endpoint, user_id, plan, expires_at, domain)
 VALUES
-    ($1, $2, 'free', $3)
+    ($1, $2, 'free', $3, $4)
 RETURNING
-    id, endpoint, user_id, plan, created_at, expires_at, is_deleted
+    id, endpoint, user_id, plan, created_at, expires_at, is_deleted, rate_limit, rate_burst, ip_rate_limit, ip_rate_burst, dropped_count, domain, expires_at_before_downgrade
 `
 
 type InsertFreeEndpointParams struct {
 	Endpoint  string             `json:"endpoint"`
 	UserID    pgtype.Int8        `json:"user_id"`
 	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	Domain    string             `json:"domain"`
 }
 
 func (q *Queries) InsertFreeEndpoint(ctx context.Context, arg InsertFreeEndpointParams) (Endpoint, error) {
-	row := q.db.QueryRow(ctx, insertFreeEndpoint, arg.Endpoint, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRow(ctx, insertFreeEndpoint,
+		arg.Endpoint,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.Domain,
+	)
+	var i Endpoint
+	err := row.Scan(
+		&i.ID,
+		&i.Endpoint,
+		&i.UserID,
+		&i.Plan,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.IsDeleted,
+		&i.RateLimit,
+		&i.RateBurst,
+		&i.IpRateLimit,
+		&i.IpRateBurst,
+		&i.DroppedCount,
+		&i.Domain,
+		&i.ExpiresAtBeforeDowngrade,
+	)
+	return i, err
+}
+
+const restoreDowngradedEndpoints = `-- name: RestoreDowngradedEndpoints :execrows
+UPDATE endpoint
+SET
+    expires_at = expires_at_before_downgrade,
+    expires_at_before_downgrade = NULL
+WHERE
+    id IN (
+        SELECT
+            e.id
+        FROM
+            endpoint e
+        WHERE
+            e.user_id = $1
+            AND e.expires_at_before_downgrade > NOW()
+            AND e.is_deleted = FALSE
+        ORDER BY
+            e.created_at ASC
+        LIMIT
+            GREATEST(
+                $2::int - (
+                    SELECT
+                        COUNT(*)
+                    FROM
+                        endpoint a
+                    WHERE
+                        a.user_id = $1
+                        AND a.expires_at > NOW()
+                        AND a.is_deleted = FALSE
+                ),
+                0
+            )
+    )
+`
+
+type RestoreDowngradedEndpointsParams struct {
+	UserID       pgtype.Int8 `json:"user_id"`
+	MaxEndpoints int32       `json:"max_endpoints"`
+}
+
+func (q *Queries) RestoreDowngradedEndpoints(ctx context.Context, arg RestoreDowngradedEndpointsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, restoreDowngradedEndpoints, arg.UserID, arg.MaxEndpoints)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateEndpointRateLimit = `-- name: UpdateEndpointRateLimit :one
+UPDATE endpoint
+SET
+    rate_limit = $2,
+    rate_burst = $3,
+    ip_rate_limit = $4,
+    ip_rate_burst = $5
+WHERE
+    id = $1
+RETURNING
+    id, endpoint, user_id, plan, created_at, expires_at, is_deleted, rate_limit, rate_burst, ip_rate_limit, ip_rate_burst, dropped_count, domain, expires_at_before_downgrade
+`
+
+type UpdateEndpointRateLimitParams struct {
+	ID          int64   `json:"id"`
+	RateLimit   float64 `json:"rate_limit"`
+	RateBurst   int32   `json:"rate_burst"`
+	IpRateLimit float64 `json:"ip_rate_limit"`
+	IpRateBurst int32   `json:"ip_rate_burst"`
+}
+
+func (q *Queries) UpdateEndpointRateLimit(ctx context.Context, arg UpdateEndpointRateLimitParams) (Endpoint, error) {
+	row := q.db.QueryRow(ctx, updateEndpointRateLimit,
+		arg.ID,
+		arg.RateLimit,
+		arg.RateBurst,
+		arg.IpRateLimit,
+		arg.IpRateBurst,
+	)
 	var i Endpoint
 	err := row.Scan(
 		&i.ID,
@@ -200,6 +465,108 @@ func (q *Queries) InsertFreeEndpoint(ctx context.Context, arg InsertFreeEndpoint
 		&i.CreatedAt,
 		&i.ExpiresAt,
 		&i.IsDeleted,
+		&i.RateLimit,
+		&i.RateBurst,
+		&i.IpRateLimit,
+		&i.IpRateBurst,
+		&i.DroppedCount,
+		&i.Domain,
+		&i.ExpiresAtBeforeDowngrade,
+	)
+	return i, err
+}
+
+const updateUserEndpointsPlan = `-- name: UpdateUserEndpointsPlan :exec
+UPDATE endpoint
+SET
+    plan = $2
+WHERE
+    user_id = $1
+    AND is_deleted = FALSE
+`
+
+type UpdateUserEndpointsPlanParams struct {
+	UserID pgtype.Int8 `json:"user_id"`
+	Plan   Plan        `json:"plan"`
+}
+
+func (q *Queries) UpdateUserEndpointsPlan(ctx context.Context, arg UpdateUserEndpointsPlanParams) error {
+	_, err := q.db.Exec(ctx, updateUserEndpointsPlan, arg.UserID, arg.Plan)
+	return err
+}
+
+const upsertEndpointAccess = `-- name: UpsertEndpointAccess :one
+INSERT INTO
+    endpoint_access (
+        endpoint_id,
+        allowed_ips,
+        basic_username,
+        basic_password_hash,
+        header_name,
+        header_value,
+        query_param,
+        query_value,
+        client_cert_fingerprints,
+        reject_code
+    )
+VALUES
+    ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (endpoint_id) DO UPDATE
+SET
+    allowed_ips = EXCLUDED.allowed_ips,
+    basic_username = EXCLUDED.basic_username,
+    basic_password_hash = EXCLUDED.basic_password_hash,
+    header_name = EXCLUDED.header_name,
+    header_value = EXCLUDED.header_value,
+    query_param = EXCLUDED.query_param,
+    query_value = EXCLUDED.query_value,
+    client_cert_fingerprints = EXCLUDED.client_cert_fingerprints,
+    reject_code = EXCLUDED.reject_code,
+    updated_at = NOW()
+RETURNING
+    endpoint_id, allowed_ips, basic_username, basic_password_hash, header_name, header_value, query_param, query_value, client_cert_fingerprints, reject_code, created_at, updated_at
+`
+
+type UpsertEndpointAccessParams struct {
+	EndpointID             int64    `json:"endpoint_id"`
+	AllowedIps             []string `json:"allowed_ips"`
+	BasicUsername          string   `json:"basic_username"`
+	BasicPasswordHash      string   `json:"basic_password_hash"`
+	HeaderName             string   `json:"header_name"`
+	HeaderValue            string   `json:"header_value"`
+	QueryParam             string   `json:"query_param"`
+	QueryValue             string   `json:"query_value"`
+	ClientCertFingerprints []string `json:"client_cert_fingerprints"`
+	RejectCode             int32    `json:"reject_code"`
+}
+
+func (q *Queries) UpsertEndpointAccess(ctx context.Context, arg UpsertEndpointAccessParams) (EndpointAccess, error) {
+	row := q.db.QueryRow(ctx, upsertEndpointAccess,
+		arg.EndpointID,
+		arg.AllowedIps,
+		arg.BasicUsername,
+		arg.BasicPasswordHash,
+		arg.HeaderName,
+		arg.HeaderValue,
+		arg.QueryParam,
+		arg.QueryValue,
+		arg.ClientCertFingerprints,
+		arg.RejectCode,
+	)
+	var i EndpointAccess
+	err := row.Scan(
+		&i.EndpointID,
+		&i.AllowedIps,
+		&i.BasicUsername,
+		&i.BasicPasswordHash,
+		&i.HeaderName,
+		&i.HeaderValue,
+		&i.QueryParam,
+		&i.QueryValue,
+		&i.ClientCertFingerprints,
+		&i.RejectCode,
+		&i.CreatedAt,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
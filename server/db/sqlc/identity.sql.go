@@ -0,0 +1,134 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: identity.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createIdentity = `-- name: CreateIdentity :one
+INSERT INTO
+	"identity" (user_id, provider, subject, email)
+VALUES
+	($1, $2, $3, $4)
+RETURNING
+	id, user_id, provider, subject, email, created_at
+`
+
+type CreateIdentityParams struct {
+	UserID   int64  `json:"user_id"`
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	Email    string `json:"email"`
+}
+
+func (q *Queries) CreateIdentity(ctx context.Context, arg CreateIdentityParams) (Identity, error) {
+	row := q.db.QueryRow(ctx, createIdentity,
+		arg.UserID,
+		arg.Provider,
+		arg.Subject,
+		arg.Email,
+	)
+	var i Identity
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteIdentity = `-- name: DeleteIdentity :execrows
+DELETE FROM "identity"
+WHERE
+	user_id = $1
+	AND provider = $2
+`
+
+type DeleteIdentityParams struct {
+	UserID   int64  `json:"user_id"`
+	Provider string `json:"provider"`
+}
+
+func (q *Queries) DeleteIdentity(ctx context.Context, arg DeleteIdentityParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteIdentity, arg.UserID, arg.Provider)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getIdentity = `-- name: GetIdentity :one
+SELECT
+	id, user_id, provider, subject, email, created_at
+FROM
+	"identity"
+WHERE
+	provider = $1
+	AND subject = $2
+LIMIT
+	1
+`
+
+type GetIdentityParams struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+}
+
+func (q *Queries) GetIdentity(ctx context.Context, arg GetIdentityParams) (Identity, error) {
+	row := q.db.QueryRow(ctx, getIdentity, arg.Provider, arg.Subject)
+	var i Identity
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listUserIdentities = `-- name: ListUserIdentities :many
+SELECT
+	id, user_id, provider, subject, email, created_at
+FROM
+	"identity"
+WHERE
+	user_id = $1
+ORDER BY
+	created_at
+`
+
+func (q *Queries) ListUserIdentities(ctx context.Context, userID int64) ([]Identity, error) {
+	rows, err := q.db.Query(ctx, listUserIdentities, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Identity{}
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Provider,
+			&i.Subject,
+			&i.Email,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
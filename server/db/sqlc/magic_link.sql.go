@@ -0,0 +1,114 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: magic_link.sql
+
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const countRecentMagicLinks = `-- name: CountRecentMagicLinks :one
+SELECT
+	count(*) FILTER (
+		WHERE
+			email = $1
+	) AS email_count,
+	count(*) FILTER (
+		WHERE
+			ip = $2
+	) AS ip_count
+FROM
+	"magic_link"
+WHERE
+	created_at > $3
+`
+
+type CountRecentMagicLinksParams struct {
+	Email string             `json:"email"`
+	Ip    string             `json:"ip"`
+	Since pgtype.Timestamptz `json:"since"`
+}
+
+type CountRecentMagicLinksRow struct {
+	EmailCount int64 `json:"email_count"`
+	IpCount    int64 `json:"ip_count"`
+}
+
+func (q *Queries) CountRecentMagicLinks(ctx context.Context, arg CountRecentMagicLinksParams) (CountRecentMagicLinksRow, error) {
+	row := q.db.QueryRow(ctx, countRecentMagicLinks, arg.Email, arg.Ip, arg.Since)
+	var i CountRecentMagicLinksRow
+	err := row.Scan(&i.EmailCount, &i.IpCount)
+	return i, err
+}
+
+const createMagicLink = `-- name: CreateMagicLink :exec
+INSERT INTO
+	"magic_link" (id, email, ip, expires_at)
+VALUES
+	($1, $2, $3, $4)
+`
+
+type CreateMagicLinkParams struct {
+	ID        string             `json:"id"`
+	Email     string             `json:"email"`
+	Ip        string             `json:"ip"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateMagicLink(ctx context.Context, arg CreateMagicLinkParams) error {
+	_, err := q.db.Exec(ctx, createMagicLink,
+		arg.ID,
+		arg.Email,
+		arg.Ip,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const deleteExpiredMagicLinks = `-- name: DeleteExpiredMagicLinks :execrows
+DELETE FROM "magic_link"
+WHERE
+	expires_at < now()
+`
+
+func (q *Queries) DeleteExpiredMagicLinks(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredMagicLinks)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteMagicLinksForEmail = `-- name: DeleteMagicLinksForEmail :exec
+DELETE FROM "magic_link"
+WHERE
+	email = $1
+`
+
+func (q *Queries) DeleteMagicLinksForEmail(ctx context.Context, email string) error {
+	_, err := q.db.Exec(ctx, deleteMagicLinksForEmail, email)
+	return err
+}
+
+const useMagicLink = `-- name: UseMagicLink :one
+UPDATE "magic_link"
+SET
+	used_at = now()
+WHERE
+	id = $1
+	AND used_at IS NULL
+	AND expires_at > now()
+RETURNING
+	email
+`
+
+func (q *Queries) UseMagicLink(ctx context.Context, id string) (string, error) {
+	row := q.db.QueryRow(ctx, useMagicLink, id)
+	var email string
+	err := row.Scan(&email)
+	return email, err
+}
@@ -60,47 +60,50 @@ func (ns NullHttpMethod) Value() (driver.Value, error) {
 	return string(ns.HttpMethod), nil
 }
 
-type Plan string
-
-const (
-	PlanFree  Plan = "free"
-	PlanBasic Plan = "basic"
-	PlanPro   Plan = "pro"
-)
+type AuditLog struct {
+	ID int64 `json:"id"`
+	// User that performed the action
+	ActorID pgtype.Int8 `json:"actor_id"`
+	// User whose account or resources were affected
+	UserID    pgtype.Int8        `json:"user_id"`
+	Action    string             `json:"action"`
+	Target    string             `json:"target"`
+	Ip        string             `json:"ip"`
+	UserAgent string             `json:"user_agent"`
+	Before    []byte             `json:"before"`
+	After     []byte             `json:"after"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
 
-func (e *Plan) Scan(src interface{}) error {
-	switch s := src.(type) {
-	case []byte:
-		*e = Plan(s)
-	case string:
-		*e = Plan(s)
-	default:
-		return fmt.Errorf("unsupported scan type for Plan: %T", src)
-	}
-	return nil
+// Processed billing provider events, used to skip redelivered webhooks
+type BillingEvent struct {
+	ID         string             `json:"id"`
+	Type       string             `json:"type"`
+	UserID     pgtype.Int8        `json:"user_id"`
+	ReceivedAt pgtype.Timestamptz `json:"received_at"`
 }
 
-type NullPlan struct {
-	Plan  Plan `json:"plan"`
-	Valid bool `json:"valid"` // Valid is true if Plan is not NULL
+type BillingSubscription struct {
+	ID          string             `json:"id"`
+	UserID      int64              `json:"user_id"`
+	LastEventAt pgtype.Timestamptz `json:"last_event_at"`
+	Deleted     bool               `json:"deleted"`
+	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
 }
 
-// Scan implements the Scanner interface.
-func (ns *NullPlan) Scan(value interface{}) error {
-	if value == nil {
-		ns.Plan, ns.Valid = "", false
-		return nil
-	}
-	ns.Valid = true
-	return ns.Plan.Scan(value)
+type CompanyDomain struct {
+	Domain    string             `json:"domain"`
+	Company   string             `json:"company"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
 }
 
-// Value implements the driver Valuer interface.
-func (ns NullPlan) Value() (driver.Value, error) {
-	if !ns.Valid {
-		return nil, nil
-	}
-	return string(ns.Plan), nil
+type CustomDomain struct {
+	ID         int64              `json:"id"`
+	EndpointID int64              `json:"endpoint_id"`
+	Hostname   string             `json:"hostname"`
+	Token      string             `json:"token"`
+	VerifiedAt pgtype.Timestamptz `json:"verified_at"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
 }
 
 type Endpoint struct {
@@ -111,6 +114,33 @@ type Endpoint struct {
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
 	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
 	IsDeleted pgtype.Bool        `json:"is_deleted"`
+	// Requests per second. 0 falls back to plan default
+	RateLimit float64 `json:"rate_limit"`
+	RateBurst int32   `json:"rate_burst"`
+	// Requests per second per source IP. 0 falls back to plan default
+	IpRateLimit  float64 `json:"ip_rate_limit"`
+	IpRateBurst  int32   `json:"ip_rate_burst"`
+	DroppedCount int64   `json:"dropped_count"`
+	Domain       string  `json:"domain"`
+	// Set while expired for exceeding the endpoint limit of the plan
+	ExpiresAtBeforeDowngrade pgtype.Timestamptz `json:"expires_at_before_downgrade"`
+}
+
+type EndpointAccess struct {
+	EndpointID    int64    `json:"endpoint_id"`
+	AllowedIps    []string `json:"allowed_ips"`
+	BasicUsername string   `json:"basic_username"`
+	// hex encoded SHA-256
+	BasicPasswordHash string `json:"basic_password_hash"`
+	HeaderName        string `json:"header_name"`
+	HeaderValue       string `json:"header_value"`
+	QueryParam        string `json:"query_param"`
+	QueryValue        string `json:"query_value"`
+	// hex encoded SHA-256 of DER certificate
+	ClientCertFingerprints []string           `json:"client_cert_fingerprints"`
+	RejectCode             int32              `json:"reject_code"`
+	CreatedAt              pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt              pgtype.Timestamptz `json:"updated_at"`
 }
 
 type FileAttachment struct {
@@ -122,6 +152,52 @@ type FileAttachment struct {
 	IsDeleted  pgtype.Bool        `json:"is_deleted"`
 }
 
+// Login providers linked to a user. subject is the stable user id at the provider
+type Identity struct {
+	ID        int64              `json:"id"`
+	UserID    int64              `json:"user_id"`
+	Provider  string             `json:"provider"`
+	Subject   string             `json:"subject"`
+	Email     string             `json:"email"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+// Issued email sign in links. id is the jti of the signed link token
+type MagicLink struct {
+	ID        string             `json:"id"`
+	Email     string             `json:"email"`
+	Ip        string             `json:"ip"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+}
+
+type PlanCatalog struct {
+	Name      string             `json:"name"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type PlanLimit struct {
+	Name         string `json:"name"`
+	MaxBodyBytes int32  `json:"max_body_bytes"`
+	// 0 keeps requests forever
+	RetentionHours int32 `json:"retention_hours"`
+	// 0 is unlimited
+	MaxEndpoints int32              `json:"max_endpoints"`
+	MaxSessions  int32              `json:"max_sessions"`
+	RateLimit    float64            `json:"rate_limit"`
+	RateBurst    int32              `json:"rate_burst"`
+	IpRateLimit  float64            `json:"ip_rate_limit"`
+	IpRateBurst  int32              `json:"ip_rate_burst"`
+	Features     []string           `json:"features"`
+	UpdatedAt    pgtype.Timestamptz `json:"updated_at"`
+	// 0 is unlimited
+	MonthlyRequests int64 `json:"monthly_requests"`
+	// 0 is unlimited
+	MonthlyBytes     int64 `json:"monthly_bytes"`
+	QuotaWarnPercent int32 `json:"quota_warn_percent"`
+}
+
 type Request struct {
 	ID           int64       `json:"id"`
 	Uuid         string      `json:"uuid"`
@@ -144,6 +220,15 @@ type Request struct {
 	CreatedAt    pgtype.Timestamptz `json:"created_at"`
 	ExpiresAt    pgtype.Timestamptz `json:"expires_at"`
 	IsDeleted    pgtype.Bool        `json:"is_deleted"`
+	Blocked      bool               `json:"blocked"`
+	Tls          []byte             `json:"tls"`
+	Traceparent  string             `json:"traceparent"`
+}
+
+type ReservedName struct {
+	Name      string             `json:"name"`
+	Kind      string             `json:"kind"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
 }
 
 type Response struct {
@@ -156,13 +241,75 @@ type Response struct {
 	IsDeleted    pgtype.Bool        `json:"is_deleted"`
 }
 
-type User struct {
+// Signed in sessions. id is the jti embedded in access tokens
+type Session struct {
+	ID               string `json:"id"`
+	UserID           int64  `json:"user_id"`
+	RefreshTokenHash string `json:"refresh_token_hash"`
+	// Hash of the last rotated refresh token, used to detect refresh token reuse
+	PreviousRefreshHash pgtype.Text        `json:"previous_refresh_hash"`
+	UserAgent           string             `json:"user_agent"`
+	Ip                  string             `json:"ip"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt          pgtype.Timestamptz `json:"last_used_at"`
+	ExpiresAt           pgtype.Timestamptz `json:"expires_at"`
+	RevokedAt           pgtype.Timestamptz `json:"revoked_at"`
+	// When refresh_token_hash last replaced previous_refresh_hash
+	RotatedAt pgtype.Timestamptz `json:"rotated_at"`
+}
+
+type Team struct {
 	ID        int64              `json:"id"`
 	Name      string             `json:"name"`
-	AvatarUrl string             `json:"avatar_url"`
-	Username  string             `json:"username"`
-	Plan      Plan               `json:"plan"`
-	Email     string             `json:"email"`
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
-	IsDeleted pgtype.Bool        `json:"is_deleted"`
+}
+
+type TeamDomain struct {
+	TeamID int64  `json:"team_id"`
+	Domain string `json:"domain"`
+	// Reserved company whose allowlisted domain this is, empty when none
+	Company    string             `json:"company"`
+	Token      string             `json:"token"`
+	Method     pgtype.Text        `json:"method"`
+	VerifiedAt pgtype.Timestamptz `json:"verified_at"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+}
+
+type TeamInvitation struct {
+	TeamID    int64              `json:"team_id"`
+	UserID    int64              `json:"user_id"`
+	InvitedBy pgtype.Int8        `json:"invited_by"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type TeamMember struct {
+	TeamID    int64              `json:"team_id"`
+	UserID    int64              `json:"user_id"`
+	Role      string             `json:"role"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type Usage struct {
+	UserID int64 `json:"user_id"`
+	// First day of the billing period (UTC calendar month)
+	PeriodStart  pgtype.Date        `json:"period_start"`
+	RequestCount int64              `json:"request_count"`
+	StoredBytes  int64              `json:"stored_bytes"`
+	ReplayCount  int64              `json:"replay_count"`
+	ForwardCount int64              `json:"forward_count"`
+	UpdatedAt    pgtype.Timestamptz `json:"updated_at"`
+}
+
+type User struct {
+	ID                int64              `json:"id"`
+	Name              string             `json:"name"`
+	AvatarUrl         string             `json:"avatar_url"`
+	Username          string             `json:"username"`
+	Plan              Plan               `json:"plan"`
+	Email             string             `json:"email"`
+	CreatedAt         pgtype.Timestamptz `json:"created_at"`
+	IsDeleted         pgtype.Bool        `json:"is_deleted"`
+	BillingCustomerID pgtype.Text        `json:"billing_customer_id"`
+	Role              string             `json:"role"`
+	SuspendedAt       pgtype.Timestamptz `json:"suspended_at"`
 }
@@ -0,0 +1,11 @@
+package db
+
+// Name of a subscription plan, one of the names in plan_catalog.
+type Plan string
+
+// Built in plans, always present in plan_catalog.
+const (
+	PlanFree  Plan = "free"
+	PlanBasic Plan = "basic"
+	PlanPro   Plan = "pro"
+)
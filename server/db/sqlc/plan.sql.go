@@ -0,0 +1,67 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: plan.sql
+
+package db
+
+import (
+	"context"
+)
+
+const listPlanLimits = `-- name: ListPlanLimits :many
+SELECT
+    name, max_body_bytes, retention_hours, max_endpoints, max_sessions, rate_limit, rate_burst, ip_rate_limit, ip_rate_burst, features, updated_at, monthly_requests, monthly_bytes, quota_warn_percent
+FROM
+    plan_limit
+ORDER BY
+    name
+`
+
+func (q *Queries) ListPlanLimits(ctx context.Context) ([]PlanLimit, error) {
+	rows, err := q.db.Query(ctx, listPlanLimits)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []PlanLimit{}
+	for rows.Next() {
+		var i PlanLimit
+		if err := rows.Scan(
+			&i.Name,
+			&i.MaxBodyBytes,
+			&i.RetentionHours,
+			&i.MaxEndpoints,
+			&i.MaxSessions,
+			&i.RateLimit,
+			&i.RateBurst,
+			&i.IpRateLimit,
+			&i.IpRateBurst,
+			&i.Features,
+			&i.UpdatedAt,
+			&i.MonthlyRequests,
+			&i.MonthlyBytes,
+			&i.QuotaWarnPercent,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const registerPlans = `-- name: RegisterPlans :exec
+INSERT INTO
+    plan_catalog (name)
+SELECT
+    unnest($1::text[])
+ON CONFLICT DO NOTHING
+`
+
+func (q *Queries) RegisterPlans(ctx context.Context, names []string) error {
+	_, err := q.db.Exec(ctx, registerPlans, names)
+	return err
+}
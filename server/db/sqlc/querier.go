@@ -11,24 +11,106 @@ import (
 )
 
 type Querier interface {
-	CheckEndpointExists(ctx context.Context, endpoint string) (bool, error)
+	AddTeamMember(ctx context.Context, arg AddTeamMemberParams) (TeamMember, error)
+	AdvanceBillingSubscription(ctx context.Context, arg AdvanceBillingSubscriptionParams) (int64, error)
+	AssignEndpointDomain(ctx context.Context, domain string) (int64, error)
+	CapUserRequestsExpiry(ctx context.Context, arg CapUserRequestsExpiryParams) (int64, error)
+	CheckEndpointExists(ctx context.Context, arg CheckEndpointExistsParams) (bool, error)
+	CountRecentMagicLinks(ctx context.Context, arg CountRecentMagicLinksParams) (CountRecentMagicLinksRow, error)
+	CountUsersByPlan(ctx context.Context) ([]CountUsersByPlanRow, error)
+	CreateCustomDomain(ctx context.Context, arg CreateCustomDomainParams) (CustomDomain, error)
+	CreateIdentity(ctx context.Context, arg CreateIdentityParams) (Identity, error)
+	CreateMagicLink(ctx context.Context, arg CreateMagicLinkParams) error
 	CreateNewRequest(ctx context.Context, arg CreateNewRequestParams) (Request, error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
+	CreateTeam(ctx context.Context, name string) (Team, error)
+	CreateTeamDomain(ctx context.Context, arg CreateTeamDomainParams) (TeamDomain, error)
+	CreateTeamInvitation(ctx context.Context, arg CreateTeamInvitationParams) (TeamInvitation, error)
+	// Returns no rows when the username is taken.
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
-	DeleteExpiredRequests(ctx context.Context) error
+	DeleteCompanyDomain(ctx context.Context, arg DeleteCompanyDomainParams) (int64, error)
+	DeleteCustomDomain(ctx context.Context, arg DeleteCustomDomainParams) (int64, error)
+	DeleteEndpointAccess(ctx context.Context, endpointID int64) error
+	DeleteExpiredMagicLinks(ctx context.Context) (int64, error)
+	DeleteExpiredRequests(ctx context.Context) (int64, error)
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+	DeleteIdentity(ctx context.Context, arg DeleteIdentityParams) (int64, error)
+	DeleteMagicLinksForEmail(ctx context.Context, email string) error
+	DeleteReservedName(ctx context.Context, arg DeleteReservedNameParams) (int64, error)
+	DeleteTeamDomain(ctx context.Context, arg DeleteTeamDomainParams) (int64, error)
+	DeleteTeamInvitation(ctx context.Context, arg DeleteTeamInvitationParams) (int64, error)
 	DeleteUser(ctx context.Context, id int64) error
-	GetEndpointDetails(ctx context.Context, endpoint string) (Endpoint, error)
+	ExpireEndpointsBeyondLimit(ctx context.Context, arg ExpireEndpointsBeyondLimitParams) (int64, error)
+	ExportUserEndpoints(ctx context.Context, userID pgtype.Int8) ([]Endpoint, error)
+	ExportUserRequests(ctx context.Context, arg ExportUserRequestsParams) ([]Request, error)
+	ExportUserResponses(ctx context.Context, userID pgtype.Int8) ([]Response, error)
+	GetCompanyOfDomain(ctx context.Context, domain string) (string, error)
+	GetCustomDomain(ctx context.Context, arg GetCustomDomainParams) (CustomDomain, error)
+	GetEndpointAccess(ctx context.Context, arg GetEndpointAccessParams) (EndpointAccess, error)
+	GetEndpointDetails(ctx context.Context, arg GetEndpointDetailsParams) (Endpoint, error)
 	GetEndpointHistory(ctx context.Context, arg GetEndpointHistoryParams) ([]GetEndpointHistoryRow, error)
-	GetEndpointRequestCount(ctx context.Context, endpoint string) (GetEndpointRequestCountRow, error)
+	GetEndpointRequestCount(ctx context.Context, arg GetEndpointRequestCountParams) (GetEndpointRequestCountRow, error)
+	GetIdentity(ctx context.Context, arg GetIdentityParams) (Identity, error)
 	GetNonExpiredEndpointsOfUser(ctx context.Context, userID pgtype.Int8) ([]Endpoint, error)
 	GetRequestById(ctx context.Context, id int64) (Request, error)
 	GetRequestByUUID(ctx context.Context, uuid string) (Request, error)
+	GetSession(ctx context.Context, id string) (Session, error)
+	GetSessionFromRefreshToken(ctx context.Context, refreshTokenHash string) (Session, error)
+	GetSystemStats(ctx context.Context) (GetSystemStatsRow, error)
+	GetTeam(ctx context.Context, id int64) (Team, error)
+	GetTeamDomain(ctx context.Context, arg GetTeamDomainParams) (TeamDomain, error)
+	GetTeamMember(ctx context.Context, arg GetTeamMemberParams) (TeamMember, error)
+	GetUsage(ctx context.Context, arg GetUsageParams) (Usage, error)
 	GetUser(ctx context.Context, id int64) (User, error)
 	GetUserEndpoints(ctx context.Context, userID pgtype.Int8) ([]Endpoint, error)
+	GetUserFromBillingCustomer(ctx context.Context, billingCustomerID pgtype.Text) (User, error)
 	GetUserFromEmail(ctx context.Context, email string) (User, error)
 	GetUserFromUsername(ctx context.Context, username string) (User, error)
+	IncrementEndpointDroppedCount(ctx context.Context, arg IncrementEndpointDroppedCountParams) error
+	IncrementUsage(ctx context.Context, arg IncrementUsageParams) (Usage, error)
+	InsertAuditLog(ctx context.Context, arg InsertAuditLogParams) error
+	InsertBillingEvent(ctx context.Context, arg InsertBillingEventParams) (int64, error)
 	InsertEndpoint(ctx context.Context, arg InsertEndpointParams) (Endpoint, error)
 	InsertFreeEndpoint(ctx context.Context, arg InsertFreeEndpointParams) (Endpoint, error)
+	ListAuditLog(ctx context.Context, arg ListAuditLogParams) ([]AuditLog, error)
+	ListCompanyDomains(ctx context.Context) ([]CompanyDomain, error)
+	ListCustomDomains(ctx context.Context, endpointID int64) ([]CustomDomain, error)
+	ListPlanLimits(ctx context.Context) ([]PlanLimit, error)
+	ListReservedNames(ctx context.Context) ([]ReservedName, error)
+	ListTeamDomains(ctx context.Context, teamID int64) ([]TeamDomain, error)
+	ListTeamInvitations(ctx context.Context, teamID int64) ([]ListTeamInvitationsRow, error)
+	ListTeamMembers(ctx context.Context, teamID int64) ([]ListTeamMembersRow, error)
+	ListUsage(ctx context.Context, arg ListUsageParams) ([]Usage, error)
+	ListUserAuditLog(ctx context.Context, arg ListUserAuditLogParams) ([]AuditLog, error)
+	ListUserIdentities(ctx context.Context, userID int64) ([]Identity, error)
+	ListUserInvitations(ctx context.Context, userID int64) ([]ListUserInvitationsRow, error)
+	ListUserSessions(ctx context.Context, userID int64) ([]Session, error)
+	ListUserTeams(ctx context.Context, userID int64) ([]ListUserTeamsRow, error)
 	ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error)
+	PromoteAdmins(ctx context.Context, emails []string) (int64, error)
+	RegisterPlans(ctx context.Context, names []string) error
+	ReleaseEndpoint(ctx context.Context, arg ReleaseEndpointParams) (int64, error)
+	RemoveTeamMember(ctx context.Context, arg RemoveTeamMemberParams) (int64, error)
+	ResolveCustomDomain(ctx context.Context, hostname string) (ResolveCustomDomainRow, error)
+	RestoreDowngradedEndpoints(ctx context.Context, arg RestoreDowngradedEndpointsParams) (int64, error)
+	RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error)
+	RevokeUserSessions(ctx context.Context, userID int64) (int64, error)
+	RotateSession(ctx context.Context, arg RotateSessionParams) (Session, error)
+	SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error)
+	SetUserBillingCustomer(ctx context.Context, arg SetUserBillingCustomerParams) error
+	SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error)
+	SetUserSuspended(ctx context.Context, arg SetUserSuspendedParams) (User, error)
+	UpdateEndpointRateLimit(ctx context.Context, arg UpdateEndpointRateLimitParams) (Endpoint, error)
+	UpdateUserEndpointsPlan(ctx context.Context, arg UpdateUserEndpointsPlanParams) error
+	UpdateUserPlan(ctx context.Context, arg UpdateUserPlanParams) (User, error)
+	UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error)
+	UpsertCompanyDomain(ctx context.Context, arg UpsertCompanyDomainParams) (CompanyDomain, error)
+	UpsertEndpointAccess(ctx context.Context, arg UpsertEndpointAccessParams) (EndpointAccess, error)
+	UpsertReservedName(ctx context.Context, arg UpsertReservedNameParams) (ReservedName, error)
+	UseMagicLink(ctx context.Context, id string) (string, error)
+	UserHasVerifiedCompany(ctx context.Context, arg UserHasVerifiedCompanyParams) (bool, error)
+	VerifyCustomDomain(ctx context.Context, arg VerifyCustomDomainParams) (CustomDomain, error)
+	VerifyTeamDomain(ctx context.Context, arg VerifyTeamDomainParams) (TeamDomain, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -11,6 +11,28 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const capUserRequestsExpiry = `-- name: CapUserRequestsExpiry :execrows
+UPDATE request
+SET
+    expires_at = $2
+WHERE
+    user_id = $1
+    AND expires_at > $2
+`
+
+type CapUserRequestsExpiryParams struct {
+	UserID    pgtype.Int8        `json:"user_id"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CapUserRequestsExpiry(ctx context.Context, arg CapUserRequestsExpiryParams) (int64, error) {
+	result, err := q.db.Exec(ctx, capUserRequestsExpiry, arg.UserID, arg.ExpiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const createNewRequest = `-- name: CreateNewRequest :one
 INSERT INTO
     request (
@@ -28,7 +50,10 @@ INSERT INTO
         response_code,
         headers,
         query_params,
-        expires_at
+        expires_at,
+        blocked,
+        tls,
+        traceparent
     )
 VALUES
     (
@@ -45,10 +70,10 @@ VALUES
         $11,
         $12,
         $13,
-    $14, $15
+    $14, $15, $16, $17, $18
     )
 RETURNING
-    id, uuid, user_id, endpoint_id, plan, path, response_id, response_time, content, content_type, method, source_ip, content_size, response_code, headers, form_data, query_params, created_at, expires_at, is_deleted
+    id, uuid, user_id, endpoint_id, plan, path, response_id, response_time, content, content_type, method, source_ip, content_size, response_code, headers, form_data, query_params, created_at, expires_at, is_deleted, blocked, tls, traceparent
 `
 
 type CreateNewRequestParams struct {
@@ -67,6 +92,9 @@ type CreateNewRequestParams struct {
 	Headers      []byte             `json:"headers"`
 	QueryParams  []byte             `json:"query_params"`
 	ExpiresAt    pgtype.Timestamptz `json:"expires_at"`
+	Blocked      bool               `json:"blocked"`
+	Tls          []byte             `json:"tls"`
+	Traceparent  string             `json:"traceparent"`
 }
 
 func (q *Queries) CreateNewRequest(ctx context.Context, arg CreateNewRequestParams) (Request, error) {
@@ -86,6 +114,9 @@ func (q *Queries) CreateNewRequest(ctx context.Context, arg CreateNewRequestPara
 		arg.Headers,
 		arg.QueryParams,
 		arg.ExpiresAt,
+		arg.Blocked,
+		arg.Tls,
+		arg.Traceparent,
 	)
 	var i Request
 	err := row.Scan(
@@ -109,19 +140,25 @@ func (q *Queries) CreateNewRequest(ctx context.Context, arg CreateNewRequestPara
 		&i.CreatedAt,
 		&i.ExpiresAt,
 		&i.IsDeleted,
+		&i.Blocked,
+		&i.Tls,
+		&i.Traceparent,
 	)
 	return i, err
 }
 
-const deleteExpiredRequests = `-- name: DeleteExpiredRequests :exec
+const deleteExpiredRequests = `-- name: DeleteExpiredRequests :execrows
 DELETE FROM request
 WHERE
     expires_at < NOW()
 `
 
-func (q *Queries) DeleteExpiredRequests(ctx context.Context) error {
-	_, err := q.db.Exec(ctx, deleteExpiredRequests)
-	return err
+func (q *Queries) DeleteExpiredRequests(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredRequests)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const getEndpointHistory = `-- name: GetEndpointHistory :many
@@ -143,28 +180,38 @@ SELECT
     request.query_params,
     request.created_at,
     request.expires_at,
+    request.blocked,
+    request.tls,
+    request.traceparent,
     endpoint.endpoint AS endpoint
 FROM
     request
     LEFT JOIN endpoint ON request.endpoint_id = endpoint.id
 WHERE
     endpoint.endpoint = $1
-    AND request.user_id = $2
+    AND endpoint.domain = $2
+    AND request.user_id = $3
     AND request.is_deleted = FALSE
     AND request.expires_at > NOW()
+    AND (
+        $4::bool
+        OR request.blocked = FALSE
+    )
 ORDER BY
     request.id DESC
 LIMIT
-    $3
+    $6
 OFFSET
-    $4
+    $5
 `
 
 type GetEndpointHistoryParams struct {
-	Endpoint string      `json:"endpoint"`
-	UserID   pgtype.Int8 `json:"user_id"`
-	Limit    int32       `json:"limit"`
-	Offset   int32       `json:"offset"`
+	Endpoint       string      `json:"endpoint"`
+	Domain         string      `json:"domain"`
+	UserID         pgtype.Int8 `json:"user_id"`
+	IncludeBlocked bool        `json:"include_blocked"`
+	Offset         int32       `json:"offset"`
+	Limit          int32       `json:"limit"`
 }
 
 type GetEndpointHistoryRow struct {
@@ -185,15 +232,20 @@ type GetEndpointHistoryRow struct {
 	QueryParams  []byte             `json:"query_params"`
 	CreatedAt    pgtype.Timestamptz `json:"created_at"`
 	ExpiresAt    pgtype.Timestamptz `json:"expires_at"`
+	Blocked      bool               `json:"blocked"`
+	Tls          []byte             `json:"tls"`
+	Traceparent  string             `json:"traceparent"`
 	Endpoint     pgtype.Text        `json:"endpoint"`
 }
 
 func (q *Queries) GetEndpointHistory(ctx context.Context, arg GetEndpointHistoryParams) ([]GetEndpointHistoryRow, error) {
 	rows, err := q.db.Query(ctx, getEndpointHistory,
 		arg.Endpoint,
+		arg.Domain,
 		arg.UserID,
-		arg.Limit,
+		arg.IncludeBlocked,
 		arg.Offset,
+		arg.Limit,
 	)
 	if err != nil {
 		return nil, err
@@ -220,6 +272,9 @@ func (q *Queries) GetEndpointHistory(ctx context.Context, arg GetEndpointHistory
 			&i.QueryParams,
 			&i.CreatedAt,
 			&i.ExpiresAt,
+			&i.Blocked,
+			&i.Tls,
+			&i.Traceparent,
 			&i.Endpoint,
 		); err != nil {
 			return nil, err
@@ -244,32 +299,49 @@ SELECT
         CASE
             WHEN response_code != 200 THEN 1
         END
-    ) AS failure_count
+    ) AS failure_count,
+    COUNT(
+        CASE
+            WHEN blocked = TRUE THEN 1
+        END
+    ) AS blocked_count
 FROM
     request r
     LEFT JOIN endpoint e ON r.endpoint_id = e.id
 WHERE
-    endpoint = $1
-    AND is_deleted = FALSE
-    AND expires_at > NOW()
+    e.endpoint = $1
+    AND e.domain = $2
+    AND r.is_deleted = FALSE
+    AND r.expires_at > NOW()
 `
 
+type GetEndpointRequestCountParams struct {
+	Endpoint string `json:"endpoint"`
+	Domain   string `json:"domain"`
+}
+
 type GetEndpointRequestCountRow struct {
 	TotalCount   int64 `json:"total_count"`
 	SuccessCount int64 `json:"success_count"`
 	FailureCount int64 `json:"failure_count"`
+	BlockedCount int64 `json:"blocked_count"`
 }
 
-func (q *Queries) GetEndpointRequestCount(ctx context.Context, endpoint string) (GetEndpointRequestCountRow, error) {
-	row := q.db.QueryRow(ctx, getEndpointRequestCount, endpoint)
+func (q *Queries) GetEndpointRequestCount(ctx context.Context, arg GetEndpointRequestCountParams) (GetEndpointRequestCountRow, error) {
+	row := q.db.QueryRow(ctx, getEndpointRequestCount, arg.Endpoint, arg.Domain)
 	var i GetEndpointRequestCountRow
-	err := row.Scan(&i.TotalCount, &i.SuccessCount, &i.FailureCount)
+	err := row.Scan(
+		&i.TotalCount,
+		&i.SuccessCount,
+		&i.FailureCount,
+		&i.BlockedCount,
+	)
 	return i, err
 }
 
 const getRequestById = `-- name: GetRequestById :one
 SELECT
-    id, uuid, user_id, endpoint_id, plan, path, response_id, response_time, content, content_type, method, source_ip, content_size, response_code, headers, form_data, query_params, created_at, expires_at, is_deleted
+    id, uuid, user_id, endpoint_id, plan, path, response_id, response_time, content, content_type, method, source_ip, content_size, response_code, headers, form_data, query_params, created_at, expires_at, is_deleted, blocked, tls, traceparent
 FROM
     request
 WHERE
@@ -304,13 +376,16 @@ func (q *Queries) GetRequestById(ctx context.Context, id int64) (Request, error)
 		&i.CreatedAt,
 		&i.ExpiresAt,
 		&i.IsDeleted,
+		&i.Blocked,
+		&i.Tls,
+		&i.Traceparent,
 	)
 	return i, err
 }
 
 const getRequestByUUID = `-- name: GetRequestByUUID :one
 SELECT
-    id, uuid, user_id, endpoint_id, plan, path, response_id, response_time, content, content_type, method, source_ip, content_size, response_code, headers, form_data, query_params, created_at, expires_at, is_deleted
+    id, uuid, user_id, endpoint_id, plan, path, response_id, response_time, content, content_type, method, source_ip, content_size, response_code, headers, form_data, query_params, created_at, expires_at, is_deleted, blocked, tls, traceparent
 FROM
     request
 WHERE
@@ -345,6 +420,9 @@ func (q *Queries) GetRequestByUUID(ctx context.Context, uuid string) (Request, e
 		&i.CreatedAt,
 		&i.ExpiresAt,
 		&i.IsDeleted,
+		&i.Blocked,
+		&i.Tls,
+		&i.Traceparent,
 	)
 	return i, err
 }
@@ -0,0 +1,158 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: reserved.sql
+
+package db
+
+import (
+	"context"
+)
+
+const deleteCompanyDomain = `-- name: DeleteCompanyDomain :execrows
+DELETE FROM company_domain
+WHERE
+    domain = $1
+    AND company = $2
+`
+
+type DeleteCompanyDomainParams struct {
+	Domain  string `json:"domain"`
+	Company string `json:"company"`
+}
+
+func (q *Queries) DeleteCompanyDomain(ctx context.Context, arg DeleteCompanyDomainParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteCompanyDomain, arg.Domain, arg.Company)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteReservedName = `-- name: DeleteReservedName :execrows
+DELETE FROM reserved_name
+WHERE
+    name = $1
+    AND kind = $2
+`
+
+type DeleteReservedNameParams struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+func (q *Queries) DeleteReservedName(ctx context.Context, arg DeleteReservedNameParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteReservedName, arg.Name, arg.Kind)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const listCompanyDomains = `-- name: ListCompanyDomains :many
+SELECT
+    domain, company, created_at
+FROM
+    company_domain
+ORDER BY
+    company,
+    domain
+`
+
+func (q *Queries) ListCompanyDomains(ctx context.Context) ([]CompanyDomain, error) {
+	rows, err := q.db.Query(ctx, listCompanyDomains)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CompanyDomain{}
+	for rows.Next() {
+		var i CompanyDomain
+		if err := rows.Scan(&i.Domain, &i.Company, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReservedNames = `-- name: ListReservedNames :many
+SELECT
+    name, kind, created_at
+FROM
+    reserved_name
+ORDER BY
+    kind,
+    name
+`
+
+func (q *Queries) ListReservedNames(ctx context.Context) ([]ReservedName, error) {
+	rows, err := q.db.Query(ctx, listReservedNames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ReservedName{}
+	for rows.Next() {
+		var i ReservedName
+		if err := rows.Scan(&i.Name, &i.Kind, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertCompanyDomain = `-- name: UpsertCompanyDomain :one
+INSERT INTO
+    company_domain (domain, company)
+VALUES
+    ($1, $2)
+ON CONFLICT (domain) DO UPDATE
+SET
+    company = EXCLUDED.company
+RETURNING
+    domain, company, created_at
+`
+
+type UpsertCompanyDomainParams struct {
+	Domain  string `json:"domain"`
+	Company string `json:"company"`
+}
+
+func (q *Queries) UpsertCompanyDomain(ctx context.Context, arg UpsertCompanyDomainParams) (CompanyDomain, error) {
+	row := q.db.QueryRow(ctx, upsertCompanyDomain, arg.Domain, arg.Company)
+	var i CompanyDomain
+	err := row.Scan(&i.Domain, &i.Company, &i.CreatedAt)
+	return i, err
+}
+
+const upsertReservedName = `-- name: UpsertReservedName :one
+INSERT INTO
+    reserved_name (name, kind)
+VALUES
+    ($1, $2)
+ON CONFLICT (name) DO UPDATE
+SET
+    kind = EXCLUDED.kind
+RETURNING
+    name, kind, created_at
+`
+
+type UpsertReservedNameParams struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+func (q *Queries) UpsertReservedName(ctx context.Context, arg UpsertReservedNameParams) (ReservedName, error) {
+	row := q.db.QueryRow(ctx, upsertReservedName, arg.Name, arg.Kind)
+	var i ReservedName
+	err := row.Scan(&i.Name, &i.Kind, &i.CreatedAt)
+	return i, err
+}
@@ -0,0 +1,271 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: session.sql
+
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const createSession = `-- name: CreateSession :one
+INSERT INTO
+	"session" (id, user_id, refresh_token_hash, user_agent, ip, expires_at)
+VALUES
+	($1, $2, $3, $4, $5, $6)
+RETURNING
+	id, user_id, refresh_token_hash, previous_refresh_hash, user_agent, ip, created_at, last_used_at, expires_at, revoked_at, rotated_at
+`
+
+type CreateSessionParams struct {
+	ID               string             `json:"id"`
+	UserID           int64              `json:"user_id"`
+	RefreshTokenHash string             `json:"refresh_token_hash"`
+	UserAgent        string             `json:"user_agent"`
+	Ip               string             `json:"ip"`
+	ExpiresAt        pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
+	row := q.db.QueryRow(ctx, createSession,
+		arg.ID,
+		arg.UserID,
+		arg.RefreshTokenHash,
+		arg.UserAgent,
+		arg.Ip,
+		arg.ExpiresAt,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RefreshTokenHash,
+		&i.PreviousRefreshHash,
+		&i.UserAgent,
+		&i.Ip,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.RotatedAt,
+	)
+	return i, err
+}
+
+const deleteExpiredSessions = `-- name: DeleteExpiredSessions :execrows
+DELETE FROM "session"
+WHERE
+	expires_at < now()
+`
+
+func (q *Queries) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredSessions)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getSession = `-- name: GetSession :one
+SELECT
+	id, user_id, refresh_token_hash, previous_refresh_hash, user_agent, ip, created_at, last_used_at, expires_at, revoked_at, rotated_at
+FROM
+	"session"
+WHERE
+	id = $1
+LIMIT
+	1
+`
+
+func (q *Queries) GetSession(ctx context.Context, id string) (Session, error) {
+	row := q.db.QueryRow(ctx, getSession, id)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RefreshTokenHash,
+		&i.PreviousRefreshHash,
+		&i.UserAgent,
+		&i.Ip,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.RotatedAt,
+	)
+	return i, err
+}
+
+const getSessionFromRefreshToken = `-- name: GetSessionFromRefreshToken :one
+SELECT
+	id, user_id, refresh_token_hash, previous_refresh_hash, user_agent, ip, created_at, last_used_at, expires_at, revoked_at, rotated_at
+FROM
+	"session"
+WHERE
+	refresh_token_hash = $1
+	OR previous_refresh_hash = $1
+LIMIT
+	1
+`
+
+func (q *Queries) GetSessionFromRefreshToken(ctx context.Context, refreshTokenHash string) (Session, error) {
+	row := q.db.QueryRow(ctx, getSessionFromRefreshToken, refreshTokenHash)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RefreshTokenHash,
+		&i.PreviousRefreshHash,
+		&i.UserAgent,
+		&i.Ip,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.RotatedAt,
+	)
+	return i, err
+}
+
+const listUserSessions = `-- name: ListUserSessions :many
+SELECT
+	id, user_id, refresh_token_hash, previous_refresh_hash, user_agent, ip, created_at, last_used_at, expires_at, revoked_at, rotated_at
+FROM
+	"session"
+WHERE
+	user_id = $1
+	AND revoked_at IS NULL
+	AND expires_at > now()
+ORDER BY
+	last_used_at DESC
+`
+
+func (q *Queries) ListUserSessions(ctx context.Context, userID int64) ([]Session, error) {
+	rows, err := q.db.Query(ctx, listUserSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Session{}
+	for rows.Next() {
+		var i Session
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.RefreshTokenHash,
+			&i.PreviousRefreshHash,
+			&i.UserAgent,
+			&i.Ip,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.RotatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE "session"
+SET
+	revoked_at = now()
+WHERE
+	id = $1
+	AND user_id = $2
+	AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	ID     string `json:"id"`
+	UserID int64  `json:"user_id"`
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeSession, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeUserSessions = `-- name: RevokeUserSessions :execrows
+UPDATE "session"
+SET
+	revoked_at = now()
+WHERE
+	user_id = $1
+	AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserSessions(ctx context.Context, userID int64) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeUserSessions, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const rotateSession = `-- name: RotateSession :one
+UPDATE "session"
+SET
+	previous_refresh_hash = refresh_token_hash,
+	refresh_token_hash = $1,
+	user_agent = $2,
+	ip = $3,
+	expires_at = $4,
+	rotated_at = $5,
+	last_used_at = now()
+WHERE
+	id = $6
+	AND refresh_token_hash = $7
+	AND revoked_at IS NULL
+RETURNING
+	id, user_id, refresh_token_hash, previous_refresh_hash, user_agent, ip, created_at, last_used_at, expires_at, revoked_at, rotated_at
+`
+
+type RotateSessionParams struct {
+	NewRefreshTokenHash string             `json:"new_refresh_token_hash"`
+	UserAgent           string             `json:"user_agent"`
+	Ip                  string             `json:"ip"`
+	ExpiresAt           pgtype.Timestamptz `json:"expires_at"`
+	RotatedAt           pgtype.Timestamptz `json:"rotated_at"`
+	ID                  string             `json:"id"`
+	RefreshTokenHash    string             `json:"refresh_token_hash"`
+}
+
+func (q *Queries) RotateSession(ctx context.Context, arg RotateSessionParams) (Session, error) {
+	row := q.db.QueryRow(ctx, rotateSession,
+		arg.NewRefreshTokenHash,
+		arg.UserAgent,
+		arg.Ip,
+		arg.ExpiresAt,
+		arg.RotatedAt,
+		arg.ID,
+		arg.RefreshTokenHash,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RefreshTokenHash,
+		&i.PreviousRefreshHash,
+		&i.UserAgent,
+		&i.Ip,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.RotatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,548 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: team.sql
+
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const addTeamMember = `-- name: AddTeamMember :one
+INSERT INTO
+    team_member (team_id, user_id, role)
+VALUES
+    ($1, $2, $3)
+ON CONFLICT (team_id, user_id) DO UPDATE
+SET
+    role = EXCLUDED.role
+RETURNING
+    team_id, user_id, role, created_at
+`
+
+type AddTeamMemberParams struct {
+	TeamID int64  `json:"team_id"`
+	UserID int64  `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+func (q *Queries) AddTeamMember(ctx context.Context, arg AddTeamMemberParams) (TeamMember, error) {
+	row := q.db.QueryRow(ctx, addTeamMember, arg.TeamID, arg.UserID, arg.Role)
+	var i TeamMember
+	err := row.Scan(
+		&i.TeamID,
+		&i.UserID,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createTeam = `-- name: CreateTeam :one
+INSERT INTO
+    team (name)
+VALUES
+    ($1)
+RETURNING
+    id, name, created_at
+`
+
+func (q *Queries) CreateTeam(ctx context.Context, name string) (Team, error) {
+	row := q.db.QueryRow(ctx, createTeam, name)
+	var i Team
+	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	return i, err
+}
+
+const createTeamDomain = `-- name: CreateTeamDomain :one
+INSERT INTO
+    team_domain (team_id, domain, company, token)
+VALUES
+    ($1, $2, $3, $4)
+RETURNING
+    team_id, domain, company, token, method, verified_at, created_at
+`
+
+type CreateTeamDomainParams struct {
+	TeamID  int64  `json:"team_id"`
+	Domain  string `json:"domain"`
+	Company string `json:"company"`
+	Token   string `json:"token"`
+}
+
+func (q *Queries) CreateTeamDomain(ctx context.Context, arg CreateTeamDomainParams) (TeamDomain, error) {
+	row := q.db.QueryRow(ctx, createTeamDomain,
+		arg.TeamID,
+		arg.Domain,
+		arg.Company,
+		arg.Token,
+	)
+	var i TeamDomain
+	err := row.Scan(
+		&i.TeamID,
+		&i.Domain,
+		&i.Company,
+		&i.Token,
+		&i.Method,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createTeamInvitation = `-- name: CreateTeamInvitation :one
+INSERT INTO
+    team_invitation (team_id, user_id, invited_by)
+VALUES
+    ($1, $2, $3)
+RETURNING
+    team_id, user_id, invited_by, created_at
+`
+
+type CreateTeamInvitationParams struct {
+	TeamID    int64       `json:"team_id"`
+	UserID    int64       `json:"user_id"`
+	InvitedBy pgtype.Int8 `json:"invited_by"`
+}
+
+func (q *Queries) CreateTeamInvitation(ctx context.Context, arg CreateTeamInvitationParams) (TeamInvitation, error) {
+	row := q.db.QueryRow(ctx, createTeamInvitation, arg.TeamID, arg.UserID, arg.InvitedBy)
+	var i TeamInvitation
+	err := row.Scan(
+		&i.TeamID,
+		&i.UserID,
+		&i.InvitedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteTeamDomain = `-- name: DeleteTeamDomain :execrows
+DELETE FROM team_domain
+WHERE
+    team_id = $1
+    AND domain = $2
+`
+
+type DeleteTeamDomainParams struct {
+	TeamID int64  `json:"team_id"`
+	Domain string `json:"domain"`
+}
+
+func (q *Queries) DeleteTeamDomain(ctx context.Context, arg DeleteTeamDomainParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteTeamDomain, arg.TeamID, arg.Domain)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteTeamInvitation = `-- name: DeleteTeamInvitation :execrows
+DELETE FROM team_invitation
+WHERE
+    team_id = $1
+    AND user_id = $2
+`
+
+type DeleteTeamInvitationParams struct {
+	TeamID int64 `json:"team_id"`
+	UserID int64 `json:"user_id"`
+}
+
+func (q *Queries) DeleteTeamInvitation(ctx context.Context, arg DeleteTeamInvitationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteTeamInvitation, arg.TeamID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getCompanyOfDomain = `-- name: GetCompanyOfDomain :one
+SELECT
+    company
+FROM
+    company_domain
+WHERE
+    domain = $1::text
+    OR $1::text LIKE '%.' || domain
+LIMIT
+    1
+`
+
+func (q *Queries) GetCompanyOfDomain(ctx context.Context, domain string) (string, error) {
+	row := q.db.QueryRow(ctx, getCompanyOfDomain, domain)
+	var company string
+	err := row.Scan(&company)
+	return company, err
+}
+
+const getTeam = `-- name: GetTeam :one
+SELECT
+    id, name, created_at
+FROM
+    team
+WHERE
+    id = $1
+`
+
+func (q *Queries) GetTeam(ctx context.Context, id int64) (Team, error) {
+	row := q.db.QueryRow(ctx, getTeam, id)
+	var i Team
+	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	return i, err
+}
+
+const getTeamDomain = `-- name: GetTeamDomain :one
+SELECT
+    team_id, domain, company, token, method, verified_at, created_at
+FROM
+    team_domain
+WHERE
+    team_id = $1
+    AND domain = $2
+`
+
+type GetTeamDomainParams struct {
+	TeamID int64  `json:"team_id"`
+	Domain string `json:"domain"`
+}
+
+func (q *Queries) GetTeamDomain(ctx context.Context, arg GetTeamDomainParams) (TeamDomain, error) {
+	row := q.db.QueryRow(ctx, getTeamDomain, arg.TeamID, arg.Domain)
+	var i TeamDomain
+	err := row.Scan(
+		&i.TeamID,
+		&i.Domain,
+		&i.Company,
+		&i.Token,
+		&i.Method,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getTeamMember = `-- name: GetTeamMember :one
+SELECT
+    team_id, user_id, role, created_at
+FROM
+    team_member
+WHERE
+    team_id = $1
+    AND user_id = $2
+`
+
+type GetTeamMemberParams struct {
+	TeamID int64 `json:"team_id"`
+	UserID int64 `json:"user_id"`
+}
+
+func (q *Queries) GetTeamMember(ctx context.Context, arg GetTeamMemberParams) (TeamMember, error) {
+	row := q.db.QueryRow(ctx, getTeamMember, arg.TeamID, arg.UserID)
+	var i TeamMember
+	err := row.Scan(
+		&i.TeamID,
+		&i.UserID,
+		&i.Role,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listTeamDomains = `-- name: ListTeamDomains :many
+SELECT
+    team_id, domain, company, token, method, verified_at, created_at
+FROM
+    team_domain
+WHERE
+    team_id = $1
+ORDER BY
+    domain
+`
+
+func (q *Queries) ListTeamDomains(ctx context.Context, teamID int64) ([]TeamDomain, error) {
+	rows, err := q.db.Query(ctx, listTeamDomains, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []TeamDomain{}
+	for rows.Next() {
+		var i TeamDomain
+		if err := rows.Scan(
+			&i.TeamID,
+			&i.Domain,
+			&i.Company,
+			&i.Token,
+			&i.Method,
+			&i.VerifiedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTeamInvitations = `-- name: ListTeamInvitations :many
+SELECT
+    team_invitation.user_id,
+    team_invitation.created_at,
+    "user".username
+FROM
+    team_invitation
+    JOIN "user" ON "user".id = team_invitation.user_id
+WHERE
+    team_invitation.team_id = $1
+ORDER BY
+    team_invitation.created_at
+`
+
+type ListTeamInvitationsRow struct {
+	UserID    int64              `json:"user_id"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	Username  string             `json:"username"`
+}
+
+func (q *Queries) ListTeamInvitations(ctx context.Context, teamID int64) ([]ListTeamInvitationsRow, error) {
+	rows, err := q.db.Query(ctx, listTeamInvitations, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTeamInvitationsRow{}
+	for rows.Next() {
+		var i ListTeamInvitationsRow
+		if err := rows.Scan(&i.UserID, &i.CreatedAt, &i.Username); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTeamMembers = `-- name: ListTeamMembers :many
+SELECT
+    team_member.user_id,
+    team_member.role,
+    "user".username
+FROM
+    team_member
+    JOIN "user" ON "user".id = team_member.user_id
+WHERE
+    team_member.team_id = $1
+ORDER BY
+    team_member.created_at
+`
+
+type ListTeamMembersRow struct {
+	UserID   int64  `json:"user_id"`
+	Role     string `json:"role"`
+	Username string `json:"username"`
+}
+
+func (q *Queries) ListTeamMembers(ctx context.Context, teamID int64) ([]ListTeamMembersRow, error) {
+	rows, err := q.db.Query(ctx, listTeamMembers, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTeamMembersRow{}
+	for rows.Next() {
+		var i ListTeamMembersRow
+		if err := rows.Scan(&i.UserID, &i.Role, &i.Username); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserInvitations = `-- name: ListUserInvitations :many
+SELECT
+    team_invitation.team_id,
+    team_invitation.created_at,
+    team.name AS team_name,
+    inviter.username AS invited_by
+FROM
+    team_invitation
+    JOIN team ON team.id = team_invitation.team_id
+    LEFT JOIN "user" inviter ON inviter.id = team_invitation.invited_by
+WHERE
+    team_invitation.user_id = $1
+ORDER BY
+    team_invitation.created_at
+`
+
+type ListUserInvitationsRow struct {
+	TeamID    int64              `json:"team_id"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	TeamName  string             `json:"team_name"`
+	InvitedBy pgtype.Text        `json:"invited_by"`
+}
+
+func (q *Queries) ListUserInvitations(ctx context.Context, userID int64) ([]ListUserInvitationsRow, error) {
+	rows, err := q.db.Query(ctx, listUserInvitations, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserInvitationsRow{}
+	for rows.Next() {
+		var i ListUserInvitationsRow
+		if err := rows.Scan(
+			&i.TeamID,
+			&i.CreatedAt,
+			&i.TeamName,
+			&i.InvitedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserTeams = `-- name: ListUserTeams :many
+SELECT
+    team.id, team.name, team.created_at,
+    team_member.role
+FROM
+    team
+    JOIN team_member ON team_member.team_id = team.id
+WHERE
+    team_member.user_id = $1
+ORDER BY
+    team.id
+`
+
+type ListUserTeamsRow struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	Role      string             `json:"role"`
+}
+
+func (q *Queries) ListUserTeams(ctx context.Context, userID int64) ([]ListUserTeamsRow, error) {
+	rows, err := q.db.Query(ctx, listUserTeams, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserTeamsRow{}
+	for rows.Next() {
+		var i ListUserTeamsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const removeTeamMember = `-- name: RemoveTeamMember :execrows
+DELETE FROM team_member
+WHERE
+    team_id = $1
+    AND user_id = $2
+    AND role <> 'owner'
+`
+
+type RemoveTeamMemberParams struct {
+	TeamID int64 `json:"team_id"`
+	UserID int64 `json:"user_id"`
+}
+
+func (q *Queries) RemoveTeamMember(ctx context.Context, arg RemoveTeamMemberParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeTeamMember, arg.TeamID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const userHasVerifiedCompany = `-- name: UserHasVerifiedCompany :one
+SELECT
+    EXISTS (
+        SELECT
+            1
+        FROM
+            team_domain
+            JOIN team_member ON team_member.team_id = team_domain.team_id
+            JOIN company_domain ON team_domain.domain = company_domain.domain
+            OR team_domain.domain LIKE '%.' || company_domain.domain
+        WHERE
+            team_member.user_id = $1
+            AND company_domain.company = $2
+            AND team_domain.verified_at IS NOT NULL
+    )
+`
+
+type UserHasVerifiedCompanyParams struct {
+	UserID  int64  `json:"user_id"`
+	Company string `json:"company"`
+}
+
+func (q *Queries) UserHasVerifiedCompany(ctx context.Context, arg UserHasVerifiedCompanyParams) (bool, error) {
+	row := q.db.QueryRow(ctx, userHasVerifiedCompany, arg.UserID, arg.Company)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const verifyTeamDomain = `-- name: VerifyTeamDomain :one
+UPDATE team_domain
+SET
+    verified_at = NOW(),
+    method = $3
+WHERE
+    team_id = $1
+    AND domain = $2
+RETURNING
+    team_id, domain, company, token, method, verified_at, created_at
+`
+
+type VerifyTeamDomainParams struct {
+	TeamID int64       `json:"team_id"`
+	Domain string      `json:"domain"`
+	Method pgtype.Text `json:"method"`
+}
+
+func (q *Queries) VerifyTeamDomain(ctx context.Context, arg VerifyTeamDomainParams) (TeamDomain, error) {
+	row := q.db.QueryRow(ctx, verifyTeamDomain, arg.TeamID, arg.Domain, arg.Method)
+	var i TeamDomain
+	err := row.Scan(
+		&i.TeamID,
+		&i.Domain,
+		&i.Company,
+		&i.Token,
+		&i.Method,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
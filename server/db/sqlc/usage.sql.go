@@ -0,0 +1,144 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: usage.sql
+
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const getUsage = `-- name: GetUsage :one
+SELECT
+    user_id, period_start, request_count, stored_bytes, replay_count, forward_count, updated_at
+FROM
+    "usage"
+WHERE
+    user_id = $1
+    AND period_start = $2
+LIMIT
+    1
+`
+
+type GetUsageParams struct {
+	UserID      int64       `json:"user_id"`
+	PeriodStart pgtype.Date `json:"period_start"`
+}
+
+func (q *Queries) GetUsage(ctx context.Context, arg GetUsageParams) (Usage, error) {
+	row := q.db.QueryRow(ctx, getUsage, arg.UserID, arg.PeriodStart)
+	var i Usage
+	err := row.Scan(
+		&i.UserID,
+		&i.PeriodStart,
+		&i.RequestCount,
+		&i.StoredBytes,
+		&i.ReplayCount,
+		&i.ForwardCount,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const incrementUsage = `-- name: IncrementUsage :one
+INSERT INTO
+    "usage" (
+        user_id,
+        period_start,
+        request_count,
+        stored_bytes,
+        replay_count,
+        forward_count
+    )
+VALUES
+    ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id, period_start) DO UPDATE
+SET
+    request_count = "usage".request_count + EXCLUDED.request_count,
+    stored_bytes = "usage".stored_bytes + EXCLUDED.stored_bytes,
+    replay_count = "usage".replay_count + EXCLUDED.replay_count,
+    forward_count = "usage".forward_count + EXCLUDED.forward_count,
+    updated_at = NOW()
+RETURNING
+    user_id, period_start, request_count, stored_bytes, replay_count, forward_count, updated_at
+`
+
+type IncrementUsageParams struct {
+	UserID       int64       `json:"user_id"`
+	PeriodStart  pgtype.Date `json:"period_start"`
+	RequestCount int64       `json:"request_count"`
+	StoredBytes  int64       `json:"stored_bytes"`
+	ReplayCount  int64       `json:"replay_count"`
+	ForwardCount int64       `json:"forward_count"`
+}
+
+func (q *Queries) IncrementUsage(ctx context.Context, arg IncrementUsageParams) (Usage, error) {
+	row := q.db.QueryRow(ctx, incrementUsage,
+		arg.UserID,
+		arg.PeriodStart,
+		arg.RequestCount,
+		arg.StoredBytes,
+		arg.ReplayCount,
+		arg.ForwardCount,
+	)
+	var i Usage
+	err := row.Scan(
+		&i.UserID,
+		&i.PeriodStart,
+		&i.RequestCount,
+		&i.StoredBytes,
+		&i.ReplayCount,
+		&i.ForwardCount,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listUsage = `-- name: ListUsage :many
+SELECT
+    user_id, period_start, request_count, stored_bytes, replay_count, forward_count, updated_at
+FROM
+    "usage"
+WHERE
+    user_id = $1
+ORDER BY
+    period_start DESC
+LIMIT
+    $2
+`
+
+type ListUsageParams struct {
+	UserID int64 `json:"user_id"`
+	Limit  int32 `json:"limit"`
+}
+
+func (q *Queries) ListUsage(ctx context.Context, arg ListUsageParams) ([]Usage, error) {
+	rows, err := q.db.Query(ctx, listUsage, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Usage{}
+	for rows.Next() {
+		var i Usage
+		if err := rows.Scan(
+			&i.UserID,
+			&i.PeriodStart,
+			&i.RequestCount,
+			&i.StoredBytes,
+			&i.ReplayCount,
+			&i.ForwardCount,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
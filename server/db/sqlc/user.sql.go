@@ -7,6 +7,8 @@ package db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -14,8 +16,9 @@ INSERT INTO
 	"user" (NAME, avatar_url, username, plan, email)
 VALUES
 	($1, $2, $3, $4, $5)
+ON CONFLICT (username) DO NOTHING
 RETURNING
-	id, name, avatar_url, username, plan, email, created_at, is_deleted
+	id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
 `
 
 type CreateUserParams struct {
@@ -26,6 +29,7 @@ type CreateUserParams struct {
 	Email     string `json:"email"`
 }
 
+// Returns no rows when the username is taken.
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
 	row := q.db.QueryRow(ctx, createUser,
 		arg.Name,
@@ -44,6 +48,9 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.CreatedAt,
 		&i.IsDeleted,
+		&i.BillingCustomerID,
+		&i.Role,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
@@ -59,9 +66,168 @@ func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
 	return err
 }
 
+const exportUserEndpoints = `-- name: ExportUserEndpoints :many
+SELECT
+	id, endpoint, user_id, plan, created_at, expires_at, is_deleted, rate_limit, rate_burst, ip_rate_limit, ip_rate_burst, dropped_count, domain, expires_at_before_downgrade
+FROM
+	"endpoint"
+WHERE
+	user_id = $1
+ORDER BY
+	id
+`
+
+func (q *Queries) ExportUserEndpoints(ctx context.Context, userID pgtype.Int8) ([]Endpoint, error) {
+	rows, err := q.db.Query(ctx, exportUserEndpoints, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Endpoint{}
+	for rows.Next() {
+		var i Endpoint
+		if err := rows.Scan(
+			&i.ID,
+			&i.Endpoint,
+			&i.UserID,
+			&i.Plan,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.IsDeleted,
+			&i.RateLimit,
+			&i.RateBurst,
+			&i.IpRateLimit,
+			&i.IpRateBurst,
+			&i.DroppedCount,
+			&i.Domain,
+			&i.ExpiresAtBeforeDowngrade,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const exportUserRequests = `-- name: ExportUserRequests :many
+SELECT
+	id, uuid, user_id, endpoint_id, plan, path, response_id, response_time, content, content_type, method, source_ip, content_size, response_code, headers, form_data, query_params, created_at, expires_at, is_deleted, blocked, tls, traceparent
+FROM
+	"request"
+WHERE
+	(
+		"request".user_id = $1
+		OR "request".endpoint_id IN (
+			SELECT
+				id
+			FROM
+				"endpoint"
+			WHERE
+				"endpoint".user_id = $1
+		)
+	)
+	AND "request".id > $2
+ORDER BY
+	"request".id
+LIMIT
+	$3
+`
+
+type ExportUserRequestsParams struct {
+	UserID  pgtype.Int8 `json:"user_id"`
+	AfterID int64       `json:"after_id"`
+	Limit   int32       `json:"limit"`
+}
+
+func (q *Queries) ExportUserRequests(ctx context.Context, arg ExportUserRequestsParams) ([]Request, error) {
+	rows, err := q.db.Query(ctx, exportUserRequests, arg.UserID, arg.AfterID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Request{}
+	for rows.Next() {
+		var i Request
+		if err := rows.Scan(
+			&i.ID,
+			&i.Uuid,
+			&i.UserID,
+			&i.EndpointID,
+			&i.Plan,
+			&i.Path,
+			&i.ResponseID,
+			&i.ResponseTime,
+			&i.Content,
+			&i.ContentType,
+			&i.Method,
+			&i.SourceIp,
+			&i.ContentSize,
+			&i.ResponseCode,
+			&i.Headers,
+			&i.FormData,
+			&i.QueryParams,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.IsDeleted,
+			&i.Blocked,
+			&i.Tls,
+			&i.Traceparent,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const exportUserResponses = `-- name: ExportUserResponses :many
+SELECT
+	id, user_id, endpoint_id, response_code, content, created_at, is_deleted
+FROM
+	"response"
+WHERE
+	user_id = $1
+ORDER BY
+	id
+`
+
+func (q *Queries) ExportUserResponses(ctx context.Context, userID pgtype.Int8) ([]Response, error) {
+	rows, err := q.db.Query(ctx, exportUserResponses, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Response{}
+	for rows.Next() {
+		var i Response
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.EndpointID,
+			&i.ResponseCode,
+			&i.Content,
+			&i.CreatedAt,
+			&i.IsDeleted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUser = `-- name: GetUser :one
 SELECT
-	id, name, avatar_url, username, plan, email, created_at, is_deleted
+	id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
 FROM
 	"user"
 WHERE
@@ -82,13 +248,46 @@ func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {
 		&i.Email,
 		&i.CreatedAt,
 		&i.IsDeleted,
+		&i.BillingCustomerID,
+		&i.Role,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const getUserFromBillingCustomer = `-- name: GetUserFromBillingCustomer :one
+SELECT
+	id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
+FROM
+	"user"
+WHERE
+	billing_customer_id = $1
+LIMIT
+	1
+`
+
+func (q *Queries) GetUserFromBillingCustomer(ctx context.Context, billingCustomerID pgtype.Text) (User, error) {
+	row := q.db.QueryRow(ctx, getUserFromBillingCustomer, billingCustomerID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AvatarUrl,
+		&i.Username,
+		&i.Plan,
+		&i.Email,
+		&i.CreatedAt,
+		&i.IsDeleted,
+		&i.BillingCustomerID,
+		&i.Role,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
 
 const getUserFromEmail = `-- name: GetUserFromEmail :one
 SELECT
-	id, name, avatar_url, username, plan, email, created_at, is_deleted
+	id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
 FROM
 	"user"
 WHERE
@@ -109,13 +308,16 @@ func (q *Queries) GetUserFromEmail(ctx context.Context, email string) (User, err
 		&i.Email,
 		&i.CreatedAt,
 		&i.IsDeleted,
+		&i.BillingCustomerID,
+		&i.Role,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
 
 const getUserFromUsername = `-- name: GetUserFromUsername :one
 SELECT
-	id, name, avatar_url, username, plan, email, created_at, is_deleted
+	id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
 FROM
 	"user"
 WHERE
@@ -136,13 +338,16 @@ func (q *Queries) GetUserFromUsername(ctx context.Context, username string) (Use
 		&i.Email,
 		&i.CreatedAt,
 		&i.IsDeleted,
+		&i.BillingCustomerID,
+		&i.Role,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
 
 const listUsers = `-- name: ListUsers :many
 SELECT
-	id, name, avatar_url, username, plan, email, created_at, is_deleted
+	id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
 FROM
 	"user"
 LIMIT
@@ -174,6 +379,9 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 			&i.Email,
 			&i.CreatedAt,
 			&i.IsDeleted,
+			&i.BillingCustomerID,
+			&i.Role,
+			&i.SuspendedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -184,3 +392,98 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 	}
 	return items, nil
 }
+
+const setUserBillingCustomer = `-- name: SetUserBillingCustomer :exec
+UPDATE "user"
+SET
+	billing_customer_id = $2
+WHERE
+	id = $1
+`
+
+type SetUserBillingCustomerParams struct {
+	ID                int64       `json:"id"`
+	BillingCustomerID pgtype.Text `json:"billing_customer_id"`
+}
+
+func (q *Queries) SetUserBillingCustomer(ctx context.Context, arg SetUserBillingCustomerParams) error {
+	_, err := q.db.Exec(ctx, setUserBillingCustomer, arg.ID, arg.BillingCustomerID)
+	return err
+}
+
+const updateUserPlan = `-- name: UpdateUserPlan :one
+UPDATE "user"
+SET
+	plan = $2
+WHERE
+	id = $1
+RETURNING
+	id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
+`
+
+type UpdateUserPlanParams struct {
+	ID   int64 `json:"id"`
+	Plan Plan  `json:"plan"`
+}
+
+func (q *Queries) UpdateUserPlan(ctx context.Context, arg UpdateUserPlanParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserPlan, arg.ID, arg.Plan)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AvatarUrl,
+		&i.Username,
+		&i.Plan,
+		&i.Email,
+		&i.CreatedAt,
+		&i.IsDeleted,
+		&i.BillingCustomerID,
+		&i.Role,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE "user"
+SET
+	NAME = $2,
+	avatar_url = $3,
+	username = $4
+WHERE
+	id = $1
+RETURNING
+	id, name, avatar_url, username, plan, email, created_at, is_deleted, billing_customer_id, role, suspended_at
+`
+
+type UpdateUserProfileParams struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	AvatarUrl string `json:"avatar_url"`
+	Username  string `json:"username"`
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserProfile,
+		arg.ID,
+		arg.Name,
+		arg.AvatarUrl,
+		arg.Username,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.AvatarUrl,
+		&i.Username,
+		&i.Plan,
+		&i.Email,
+		&i.CreatedAt,
+		&i.IsDeleted,
+		&i.BillingCustomerID,
+		&i.Role,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,285 @@
+package admin
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/audit"
+)
+
+type AdminController struct {
+	service *AdminService
+	audit   *audit.AuditService
+}
+
+func NewAdminController(service *AdminService, audit *audit.AuditService) *AdminController {
+	return &AdminController{
+		service: service,
+		audit:   audit,
+	}
+}
+
+// adminmw must run after authmw.
+func (ac *AdminController) RegisterRoutes(app *fiber.App, authmw fiber.Handler, adminmw fiber.Handler) {
+	adminGroup := app.Group("/admin", authmw, adminmw)
+
+	adminGroup.Get("/stats", ac.StatsHandler)
+
+	adminGroup.Get("/users", ac.SearchUsersHandler)
+	adminGroup.Get("/users/:id", ac.GetUserHandler)
+	adminGroup.Put("/users/:id/plan", ac.ChangePlanHandler)
+	adminGroup.Put("/users/:id/role", ac.SetRoleHandler)
+	adminGroup.Post("/users/:id/suspend", ac.SuspendHandler)
+	adminGroup.Delete("/users/:id/suspend", ac.UnsuspendHandler)
+
+	adminGroup.Delete("/endpoints/:endpoint", ac.ReleaseEndpointHandler)
+
+	adminGroup.Get("/reserved", ac.ListReservedHandler)
+	adminGroup.Put("/reserved/:kind/:name", ac.AddReservedHandler)
+	adminGroup.Delete("/reserved/:kind/:name", ac.RemoveReservedHandler)
+	adminGroup.Put("/reserved/company/:name/domains/:domain", ac.AddCompanyDomainHandler)
+	adminGroup.Delete("/reserved/company/:name/domains/:domain", ac.RemoveCompanyDomainHandler)
+}
+
+func (ac *AdminController) StatsHandler(c *fiber.Ctx) error {
+	stats, adminErr := ac.service.Stats(c.UserContext())
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+	return c.JSON(stats)
+}
+
+// Lists users, optionally filtered by ?q= matching username, email or name.
+func (ac *AdminController) SearchUsersHandler(c *fiber.Ctx) error {
+	limit, err := strconv.ParseInt(c.Query("limit", strconv.Itoa(DefaultPageSize)), 10, 32)
+	if err != nil || limit < 1 || limit > MaxPageSize {
+		return fiber.ErrBadRequest
+	}
+	offset, err := strconv.ParseInt(c.Query("offset", "0"), 10, 32)
+	if err != nil || offset < 0 {
+		return fiber.ErrBadRequest
+	}
+
+	users, adminErr := ac.service.SearchUsers(c.UserContext(), c.Query("q"), int32(limit), int32(offset))
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+	return c.JSON(users)
+}
+
+func (ac *AdminController) GetUserHandler(c *fiber.Ctx) error {
+	userId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	user, adminErr := ac.service.GetUser(c.UserContext(), int64(userId))
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+	return c.JSON(user)
+}
+
+type ChangePlanRequest struct {
+	Plan string `json:"plan"`
+}
+
+func (ac *AdminController) ChangePlanHandler(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(int64)
+	userId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	var req ChangePlanRequest
+	if err := c.BodyParser(&req); err != nil || req.Plan == "" {
+		return fiber.ErrBadRequest
+	}
+
+	before, adminErr := ac.service.GetUser(c.UserContext(), int64(userId))
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	user, adminErr := ac.service.ChangePlan(c.UserContext(), adminId, int64(userId), db.Plan(req.Plan))
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	ac.recordUserChange(c, audit.ActionAdminPlanChange, before.User, user)
+	return c.JSON(user)
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (ac *AdminController) SetRoleHandler(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(int64)
+	userId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	var req SetRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	before, adminErr := ac.service.GetUser(c.UserContext(), int64(userId))
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	user, adminErr := ac.service.SetRole(c.UserContext(), adminId, int64(userId), req.Role)
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	ac.recordUserChange(c, audit.ActionAdminRoleChange, before.User, user)
+	return c.JSON(user)
+}
+
+func (ac *AdminController) SuspendHandler(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(int64)
+	userId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	before, adminErr := ac.service.GetUser(c.UserContext(), int64(userId))
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	user, adminErr := ac.service.Suspend(c.UserContext(), adminId, int64(userId))
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	ac.recordUserChange(c, audit.ActionAdminSuspend, before.User, user)
+	return c.JSON(user)
+}
+
+func (ac *AdminController) UnsuspendHandler(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(int64)
+	userId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	before, adminErr := ac.service.GetUser(c.UserContext(), int64(userId))
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	user, adminErr := ac.service.Unsuspend(c.UserContext(), adminId, int64(userId))
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	ac.recordUserChange(c, audit.ActionAdminUnsuspend, before.User, user)
+	return c.JSON(user)
+}
+
+func (ac *AdminController) ReleaseEndpointHandler(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(int64)
+	endpoint := c.Params("endpoint", "")
+	if endpoint == "" {
+		return fiber.ErrBadRequest
+	}
+
+	domain := c.Query("domain")
+
+	slog.InfoContext(c.UserContext(), "Releasing endpoint", "adminId", adminId, "endpoint", endpoint, "domain", domain)
+
+	if adminErr := ac.service.ReleaseEndpoint(c.UserContext(), adminId, endpoint, domain); adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	ac.audit.Record(c.UserContext(), audit.FromRequest(c, audit.ActionAdminEndpointRelease, audit.EndpointTarget(strings.ToLower(endpoint))))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (ac *AdminController) ListReservedHandler(c *fiber.Ctx) error {
+	names, adminErr := ac.service.ListReserved(c.UserContext())
+	if adminErr != nil {
+		return toFiberError(adminErr)
+	}
+	return c.JSON(names)
+}
+
+func (ac *AdminController) AddReservedHandler(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(int64)
+
+	if adminErr := ac.service.AddReserved(c.UserContext(), adminId, c.Params("kind"), c.Params("name")); adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionAdminReservedAdd, reservedTarget(c))
+	entry.After = map[string]string{"kind": c.Params("kind"), "name": strings.ToLower(c.Params("name"))}
+	ac.audit.Record(c.UserContext(), entry)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (ac *AdminController) RemoveReservedHandler(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(int64)
+
+	if adminErr := ac.service.RemoveReserved(c.UserContext(), adminId, c.Params("kind"), c.Params("name")); adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionAdminReservedRemove, reservedTarget(c))
+	entry.Before = map[string]string{"kind": c.Params("kind"), "name": strings.ToLower(c.Params("name"))}
+	ac.audit.Record(c.UserContext(), entry)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (ac *AdminController) AddCompanyDomainHandler(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(int64)
+
+	if adminErr := ac.service.AddCompanyDomain(c.UserContext(), adminId, c.Params("name"), c.Params("domain")); adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionAdminCompanyDomainAdd, reservedTarget(c))
+	entry.After = map[string]string{"domain": strings.ToLower(c.Params("domain"))}
+	ac.audit.Record(c.UserContext(), entry)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (ac *AdminController) RemoveCompanyDomainHandler(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(int64)
+
+	if adminErr := ac.service.RemoveCompanyDomain(c.UserContext(), adminId, c.Params("name"), c.Params("domain")); adminErr != nil {
+		return toFiberError(adminErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionAdminCompanyDomainRemove, reservedTarget(c))
+	entry.Before = map[string]string{"domain": strings.ToLower(c.Params("domain"))}
+	ac.audit.Record(c.UserContext(), entry)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// The admin is the actor, the changed user is recorded as the affected user.
+func (ac *AdminController) recordUserChange(c *fiber.Ctx, action audit.Action, before User, after User) {
+	entry := audit.FromRequest(c, action, audit.UserTarget(after.Id))
+	entry.UserId = after.Id
+	entry.Before = before
+	entry.After = after
+	ac.audit.Record(c.UserContext(), entry)
+}
+
+func reservedTarget(c *fiber.Ctx) string {
+	return "reserved/" + strings.ToLower(c.Params("name"))
+}
+
+func toFiberError(adminErr *AdminError) *fiber.Error {
+	return &fiber.Error{
+		Code:    adminErr.Code,
+		Message: adminErr.Message,
+	}
+}
@@ -0,0 +1,501 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/auth"
+	"github.com/humanbeeng/checkpost/server/internal/billing"
+	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/humanbeeng/checkpost/server/internal/reserved"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+var reservedNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+type AdminError struct {
+	Code    int
+	Message string
+}
+
+func (a *AdminError) Error() string {
+	return a.Message
+}
+
+func NewInternalServerError() *AdminError {
+	return &AdminError{
+		Code:    http.StatusInternalServerError,
+		Message: "Oops! Something went wrong :(",
+	}
+}
+
+func NewUserNotFoundError() *AdminError {
+	return &AdminError{
+		Code:    http.StatusNotFound,
+		Message: "User not found",
+	}
+}
+
+type SessionRevoker interface {
+	RevokeAllSessions(ctx context.Context, userId int64) *auth.AuthError
+}
+
+type PlanChanger interface {
+	ChangePlan(ctx context.Context, userId int64, plan db.Plan) (db.User, *billing.BillingError)
+}
+
+// User as seen by an admin. Unlike the user API, this includes role, suspension and billing details.
+type User struct {
+	Id                int64      `json:"id"`
+	Name              string     `json:"name"`
+	AvatarUrl         string     `json:"avatar_url"`
+	Username          string     `json:"username"`
+	Email             string     `json:"email"`
+	Plan              string     `json:"plan"`
+	Role              string     `json:"role"`
+	BillingCustomerId string     `json:"billing_customer_id,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	SuspendedAt       *time.Time `json:"suspended_at"`
+}
+
+type UserDetails struct {
+	User
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+type Endpoint struct {
+	Endpoint  string    `json:"endpoint"`
+	Plan      string    `json:"plan"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type Stats struct {
+	NumUsers           int64            `json:"num_users"`
+	NumSuspendedUsers  int64            `json:"num_suspended_users"`
+	UsersByPlan        map[string]int64 `json:"users_by_plan"`
+	NumEndpoints       int64            `json:"num_endpoints"`
+	NumRequests        int64            `json:"num_requests"`
+	NumRequestsLastDay int64            `json:"num_requests_last_day"`
+	NumActiveSessions  int64            `json:"num_active_sessions"`
+}
+
+type ReservedNames struct {
+	Subdomains []string `json:"subdomains"`
+	Companies  []string `json:"companies"`
+	// Registrable domains by company. Teams claim a company by verifying one of its domains.
+	CompanyDomains map[string][]string `json:"company_domains"`
+}
+
+// Operations for running the service. Every method assumes the caller is an admin.
+type AdminService struct {
+	adminq   AdminQuerier
+	names    *reserved.Names
+	plans    PlanChanger
+	sessions SessionRevoker
+	now      func() time.Time
+}
+
+func NewAdminService(adminq AdminQuerier, names *reserved.Names, plans PlanChanger, sessions SessionRevoker) *AdminService {
+	return &AdminService{
+		adminq:   adminq,
+		names:    names,
+		plans:    plans,
+		sessions: sessions,
+		now:      time.Now,
+	}
+}
+
+// Grants the admin role to existing users with the given emails.
+// Used to bootstrap the first admins of an instance from config.
+func (s *AdminService) PromoteAdmins(ctx context.Context, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(emails))
+	for _, email := range emails {
+		normalized = append(normalized, strings.ToLower(strings.TrimSpace(email)))
+	}
+
+	promoted, err := s.adminq.PromoteAdmins(ctx, normalized)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to promote configured admins", "err", err)
+		return err
+	}
+	if promoted > 0 {
+		slog.InfoContext(ctx, "Promoted configured admins", "num_promoted", promoted)
+	}
+	return nil
+}
+
+func (s *AdminService) SearchUsers(ctx context.Context, query string, limit int32, offset int32) ([]User, *AdminError) {
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+	offset = max(offset, 0)
+
+	records, err := s.adminq.SearchUsers(ctx, db.SearchUsersParams{
+		Query:  strings.TrimSpace(query),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to search users", "query", query, "err", err)
+		return nil, NewInternalServerError()
+	}
+
+	users := make([]User, 0, len(records))
+	for _, rec := range records {
+		users = append(users, userFromRecord(rec))
+	}
+	return users, nil
+}
+
+func (s *AdminService) GetUser(ctx context.Context, userId int64) (UserDetails, *AdminError) {
+	rec, adminErr := s.getUser(ctx, userId)
+	if adminErr != nil {
+		return UserDetails{}, adminErr
+	}
+
+	endpointRecs, err := s.adminq.ExportUserEndpoints(ctx, pgtype.Int8{Int64: userId, Valid: true})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to get user endpoints", "userId", userId, "err", err)
+		return UserDetails{}, NewInternalServerError()
+	}
+
+	endpoints := make([]Endpoint, 0, len(endpointRecs))
+	for _, e := range endpointRecs {
+		endpoints = append(endpoints, Endpoint{
+			Endpoint:  e.Endpoint,
+			Plan:      string(e.Plan),
+			CreatedAt: e.CreatedAt.Time,
+			ExpiresAt: e.ExpiresAt.Time,
+		})
+	}
+
+	return UserDetails{User: userFromRecord(rec), Endpoints: endpoints}, nil
+}
+
+func (s *AdminService) ChangePlan(ctx context.Context, adminId int64, userId int64, newPlan db.Plan) (User, *AdminError) {
+	slog.InfoContext(ctx, "Admin changing user plan", "adminId", adminId, "userId", userId, "plan", newPlan)
+
+	rec, billingErr := s.plans.ChangePlan(ctx, userId, newPlan)
+	if billingErr != nil {
+		return User{}, &AdminError{Code: billingErr.Code, Message: billingErr.Message}
+	}
+	return userFromRecord(rec), nil
+}
+
+// Suspended users cannot sign in and are signed out everywhere.
+func (s *AdminService) Suspend(ctx context.Context, adminId int64, userId int64) (User, *AdminError) {
+	if adminId == userId {
+		return User{}, &AdminError{
+			Code:    http.StatusBadRequest,
+			Message: "You cannot suspend yourself.",
+		}
+	}
+
+	rec, adminErr := s.setSuspended(ctx, userId, pgtype.Timestamptz{Time: s.now(), InfinityModifier: pgtype.Finite, Valid: true})
+	if adminErr != nil {
+		return User{}, adminErr
+	}
+
+	if authErr := s.sessions.RevokeAllSessions(ctx, userId); authErr != nil {
+		return User{}, &AdminError{Code: authErr.Code, Message: authErr.Message}
+	}
+
+	slog.InfoContext(ctx, "User suspended", "adminId", adminId, "userId", userId)
+	return userFromRecord(rec), nil
+}
+
+func (s *AdminService) Unsuspend(ctx context.Context, adminId int64, userId int64) (User, *AdminError) {
+	rec, adminErr := s.setSuspended(ctx, userId, pgtype.Timestamptz{})
+	if adminErr != nil {
+		return User{}, adminErr
+	}
+
+	slog.InfoContext(ctx, "User unsuspended", "adminId", adminId, "userId", userId)
+	return userFromRecord(rec), nil
+}
+
+func (s *AdminService) SetRole(ctx context.Context, adminId int64, userId int64, role string) (User, *AdminError) {
+	if role != core.RoleUser && role != core.RoleAdmin {
+		return User{}, &AdminError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Role should be one of %s, %s.", core.RoleUser, core.RoleAdmin),
+		}
+	}
+	if adminId == userId && role != core.RoleAdmin {
+		return User{}, &AdminError{
+			Code:    http.StatusBadRequest,
+			Message: "You cannot remove your own admin role.",
+		}
+	}
+
+	current, adminErr := s.getUser(ctx, userId)
+	if adminErr != nil {
+		return User{}, adminErr
+	}
+
+	rec, err := s.adminq.SetUserRole(ctx, db.SetUserRoleParams{ID: userId, Role: role})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to set user role", "userId", userId, "role", role, "err", err)
+		return User{}, NewInternalServerError()
+	}
+
+	// Access tokens carry the role. Demoted admins are signed out so that the role is not used until expiry.
+	if current.Role == core.RoleAdmin && role != core.RoleAdmin {
+		if authErr := s.sessions.RevokeAllSessions(ctx, userId); authErr != nil {
+			return User{}, &AdminError{Code: authErr.Code, Message: authErr.Message}
+		}
+	}
+
+	slog.InfoContext(ctx, "User role changed", "adminId", adminId, "userId", userId, "from", current.Role, "to", role)
+	return userFromRecord(rec), nil
+}
+
+// Deletes the endpoint along with its requests so that the subdomain can be claimed again on its base domain.
+// The domain is required, as each base domain has its own set of endpoints.
+func (s *AdminService) ReleaseEndpoint(ctx context.Context, adminId int64, endpoint string, domain string) *AdminError {
+	endpoint = strings.ToLower(endpoint)
+	domain = strings.ToLower(domain)
+	if domain == "" {
+		return &AdminError{
+			Code:    http.StatusBadRequest,
+			Message: "Domain of the endpoint is required",
+		}
+	}
+
+	released, err := s.adminq.ReleaseEndpoint(ctx, db.ReleaseEndpointParams{Endpoint: endpoint, Domain: domain})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to release endpoint", "endpoint", endpoint, "domain", domain, "err", err)
+		return NewInternalServerError()
+	}
+	if released == 0 {
+		return &AdminError{
+			Code:    http.StatusNotFound,
+			Message: "Endpoint not found",
+		}
+	}
+
+	slog.InfoContext(ctx, "Endpoint released", "adminId", adminId, "endpoint", endpoint, "domain", domain)
+	return nil
+}
+
+func (s *AdminService) ListReserved(ctx context.Context) (ReservedNames, *AdminError) {
+	domains, err := s.adminq.ListCompanyDomains(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list company domains", "err", err)
+		return ReservedNames{}, NewInternalServerError()
+	}
+
+	companyDomains := make(map[string][]string)
+	for _, d := range domains {
+		companyDomains[d.Company] = append(companyDomains[d.Company], d.Domain)
+	}
+	return ReservedNames{
+		Subdomains:     s.names.List(reserved.KindSubdomain),
+		Companies:      s.names.List(reserved.KindCompany),
+		CompanyDomains: companyDomains,
+	}, nil
+}
+
+func (s *AdminService) AddReserved(ctx context.Context, adminId int64, kind string, name string) *AdminError {
+	k, name, adminErr := parseReserved(kind, name)
+	if adminErr != nil {
+		return adminErr
+	}
+
+	if err := s.names.Add(ctx, s.adminq, k, name); err != nil {
+		slog.ErrorContext(ctx, "unable to add reserved name", "kind", k, "name", name, "err", err)
+		return NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Reserved name added", "adminId", adminId, "kind", k, "name", name)
+	return nil
+}
+
+func (s *AdminService) RemoveReserved(ctx context.Context, adminId int64, kind string, name string) *AdminError {
+	k, name, adminErr := parseReserved(kind, name)
+	if adminErr != nil {
+		return adminErr
+	}
+
+	removed, err := s.names.Remove(ctx, s.adminq, k, name)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to remove reserved name", "kind", k, "name", name, "err", err)
+		return NewInternalServerError()
+	}
+	if !removed {
+		return &AdminError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("%s is not a reserved %s", name, k),
+		}
+	}
+
+	slog.InfoContext(ctx, "Reserved name removed", "adminId", adminId, "kind", k, "name", name)
+	return nil
+}
+
+// Allows teams that verify the domain to claim the company. Only registrable domains are accepted, e.g.
+// google.co.uk but not mail.google.co.uk, subdomains are covered by them.
+func (s *AdminService) AddCompanyDomain(ctx context.Context, adminId int64, company string, domain string) *AdminError {
+	company, domain, adminErr := s.parseCompanyDomain(company, domain)
+	if adminErr != nil {
+		return adminErr
+	}
+
+	if _, err := s.adminq.UpsertCompanyDomain(ctx, db.UpsertCompanyDomainParams{Domain: domain, Company: company}); err != nil {
+		slog.ErrorContext(ctx, "unable to add company domain", "company", company, "domain", domain, "err", err)
+		return NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Company domain added", "adminId", adminId, "company", company, "domain", domain)
+	return nil
+}
+
+func (s *AdminService) RemoveCompanyDomain(ctx context.Context, adminId int64, company string, domain string) *AdminError {
+	company = strings.ToLower(company)
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+
+	removed, err := s.adminq.DeleteCompanyDomain(ctx, db.DeleteCompanyDomainParams{Domain: domain, Company: company})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to remove company domain", "company", company, "domain", domain, "err", err)
+		return NewInternalServerError()
+	}
+	if removed == 0 {
+		return &AdminError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("%s is not a domain of %s", domain, company),
+		}
+	}
+
+	slog.InfoContext(ctx, "Company domain removed", "adminId", adminId, "company", company, "domain", domain)
+	return nil
+}
+
+func (s *AdminService) parseCompanyDomain(company string, domain string) (string, string, *AdminError) {
+	company = strings.ToLower(company)
+	if !s.names.IsCompany(company) {
+		return "", "", &AdminError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("%s is not a reserved company", company),
+		}
+	}
+
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if registrable, err := publicsuffix.EffectiveTLDPlusOne(domain); err != nil || registrable != domain {
+		return "", "", &AdminError{
+			Code:    http.StatusBadRequest,
+			Message: "Domain should be a registrable domain, e.g. example.co.uk.",
+		}
+	}
+	return company, domain, nil
+}
+
+func (s *AdminService) Stats(ctx context.Context) (Stats, *AdminError) {
+	row, err := s.adminq.GetSystemStats(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to get system stats", "err", err)
+		return Stats{}, NewInternalServerError()
+	}
+
+	byPlan, err := s.adminq.CountUsersByPlan(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to count users by plan", "err", err)
+		return Stats{}, NewInternalServerError()
+	}
+
+	usersByPlan := make(map[string]int64, len(byPlan))
+	for _, p := range byPlan {
+		usersByPlan[string(p.Plan)] = p.NumUsers
+	}
+
+	return Stats{
+		NumUsers:           row.NumUsers,
+		NumSuspendedUsers:  row.NumSuspendedUsers,
+		UsersByPlan:        usersByPlan,
+		NumEndpoints:       row.NumEndpoints,
+		NumRequests:        row.NumRequests,
+		NumRequestsLastDay: row.NumRequestsLastDay,
+		NumActiveSessions:  row.NumActiveSessions,
+	}, nil
+}
+
+func (s *AdminService) getUser(ctx context.Context, userId int64) (db.User, *AdminError) {
+	rec, err := s.adminq.GetUser(ctx, userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.User{}, NewUserNotFoundError()
+		}
+		slog.ErrorContext(ctx, "unable to get user", "userId", userId, "err", err)
+		return db.User{}, NewInternalServerError()
+	}
+	return rec, nil
+}
+
+func (s *AdminService) setSuspended(ctx context.Context, userId int64, suspendedAt pgtype.Timestamptz) (db.User, *AdminError) {
+	rec, err := s.adminq.SetUserSuspended(ctx, db.SetUserSuspendedParams{ID: userId, SuspendedAt: suspendedAt})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.User{}, NewUserNotFoundError()
+		}
+		slog.ErrorContext(ctx, "unable to set user suspension", "userId", userId, "err", err)
+		return db.User{}, NewInternalServerError()
+	}
+	return rec, nil
+}
+
+func parseReserved(kind string, name string) (reserved.Kind, string, *AdminError) {
+	k, err := reserved.ParseKind(kind)
+	if err != nil {
+		return "", "", &AdminError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Kind should be one of %s, %s.", reserved.KindSubdomain, reserved.KindCompany),
+		}
+	}
+
+	name = strings.ToLower(name)
+	if !reservedNameRegex.MatchString(name) {
+		return "", "", &AdminError{
+			Code:    http.StatusBadRequest,
+			Message: "Name should only contain letters, digits and hyphens.",
+		}
+	}
+	return k, name, nil
+}
+
+func userFromRecord(rec db.User) User {
+	u := User{
+		Id:                rec.ID,
+		Name:              rec.Name,
+		AvatarUrl:         rec.AvatarUrl,
+		Username:          rec.Username,
+		Email:             rec.Email,
+		Plan:              string(rec.Plan),
+		Role:              rec.Role,
+		BillingCustomerId: rec.BillingCustomerID.String,
+		CreatedAt:         rec.CreatedAt.Time,
+	}
+	if rec.SuspendedAt.Valid {
+		suspendedAt := rec.SuspendedAt.Time
+		u.SuspendedAt = &suspendedAt
+	}
+	return u
+}
@@ -0,0 +1,266 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/auth"
+	"github.com/humanbeeng/checkpost/server/internal/billing"
+	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/humanbeeng/checkpost/server/internal/reserved"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockAdminStore struct {
+	users          map[int64]db.User
+	reserved       map[string]string
+	companyDomains map[string]string
+}
+
+func newMockAdminStore() *MockAdminStore {
+	return &MockAdminStore{
+		users: map[int64]db.User{
+			1: {ID: 1, Username: "admin", Email: "admin@example.com", Role: core.RoleAdmin},
+			2: {ID: 2, Username: "alice", Email: "alice@example.com", Role: core.RoleUser},
+		},
+		reserved:       map[string]string{},
+		companyDomains: map[string]string{},
+	}
+}
+
+func (as *MockAdminStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	u, ok := as.users[userId]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	return u, nil
+}
+
+func (as *MockAdminStore) SearchUsers(ctx context.Context, params db.SearchUsersParams) ([]db.User, error) {
+	return []db.User{}, nil
+}
+
+func (as *MockAdminStore) SetUserSuspended(ctx context.Context, params db.SetUserSuspendedParams) (db.User, error) {
+	u, ok := as.users[params.ID]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	u.SuspendedAt = params.SuspendedAt
+	as.users[params.ID] = u
+	return u, nil
+}
+
+func (as *MockAdminStore) SetUserRole(ctx context.Context, params db.SetUserRoleParams) (db.User, error) {
+	u, ok := as.users[params.ID]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	u.Role = params.Role
+	as.users[params.ID] = u
+	return u, nil
+}
+
+func (as *MockAdminStore) PromoteAdmins(ctx context.Context, emails []string) (int64, error) {
+	return 0, nil
+}
+
+func (as *MockAdminStore) ExportUserEndpoints(ctx context.Context, userId pgtype.Int8) ([]db.Endpoint, error) {
+	return []db.Endpoint{}, nil
+}
+
+func (as *MockAdminStore) ReleaseEndpoint(ctx context.Context, params db.ReleaseEndpointParams) (int64, error) {
+	return 0, nil
+}
+
+func (as *MockAdminStore) GetSystemStats(ctx context.Context) (db.GetSystemStatsRow, error) {
+	return db.GetSystemStatsRow{}, nil
+}
+
+func (as *MockAdminStore) CountUsersByPlan(ctx context.Context) ([]db.CountUsersByPlanRow, error) {
+	return []db.CountUsersByPlanRow{}, nil
+}
+
+func (as *MockAdminStore) ListReservedNames(ctx context.Context) ([]db.ReservedName, error) {
+	names := make([]db.ReservedName, 0, len(as.reserved))
+	for name, kind := range as.reserved {
+		names = append(names, db.ReservedName{Name: name, Kind: kind})
+	}
+	return names, nil
+}
+
+func (as *MockAdminStore) UpsertReservedName(ctx context.Context, params db.UpsertReservedNameParams) (db.ReservedName, error) {
+	as.reserved[params.Name] = params.Kind
+	return db.ReservedName{Name: params.Name, Kind: params.Kind}, nil
+}
+
+func (as *MockAdminStore) DeleteReservedName(ctx context.Context, params db.DeleteReservedNameParams) (int64, error) {
+	if as.reserved[params.Name] != params.Kind {
+		return 0, nil
+	}
+	delete(as.reserved, params.Name)
+	return 1, nil
+}
+
+func (as *MockAdminStore) ListCompanyDomains(ctx context.Context) ([]db.CompanyDomain, error) {
+	domains := make([]db.CompanyDomain, 0, len(as.companyDomains))
+	for domain, company := range as.companyDomains {
+		domains = append(domains, db.CompanyDomain{Domain: domain, Company: company})
+	}
+	return domains, nil
+}
+
+func (as *MockAdminStore) UpsertCompanyDomain(ctx context.Context, params db.UpsertCompanyDomainParams) (db.CompanyDomain, error) {
+	as.companyDomains[params.Domain] = params.Company
+	return db.CompanyDomain{Domain: params.Domain, Company: params.Company}, nil
+}
+
+func (as *MockAdminStore) DeleteCompanyDomain(ctx context.Context, params db.DeleteCompanyDomainParams) (int64, error) {
+	if as.companyDomains[params.Domain] != params.Company {
+		return 0, nil
+	}
+	delete(as.companyDomains, params.Domain)
+	return 1, nil
+}
+
+var _ AdminQuerier = (*MockAdminStore)(nil)
+
+type MockSessionRevoker struct {
+	revoked []int64
+}
+
+func (sr *MockSessionRevoker) RevokeAllSessions(ctx context.Context, userId int64) *auth.AuthError {
+	sr.revoked = append(sr.revoked, userId)
+	return nil
+}
+
+type MockPlanChanger struct{}
+
+func (pc MockPlanChanger) ChangePlan(ctx context.Context, userId int64, plan db.Plan) (db.User, *billing.BillingError) {
+	return db.User{ID: userId, Plan: plan}, nil
+}
+
+func newTestAdminService() (*AdminService, *MockAdminStore, *MockSessionRevoker) {
+	store := newMockAdminStore()
+	sessions := &MockSessionRevoker{}
+	names := reserved.NewNames(map[string]bool{"dash": true}, map[string]bool{"google": true})
+	return NewAdminService(store, names, MockPlanChanger{}, sessions), store, sessions
+}
+
+func TestSuspendRevokesSessions(t *testing.T) {
+	s, store, sessions := newTestAdminService()
+	ctx := context.TODO()
+
+	user, adminErr := s.Suspend(ctx, 1, 2)
+	assert.Nil(t, adminErr)
+	assert.NotNil(t, user.SuspendedAt)
+	assert.True(t, store.users[2].SuspendedAt.Valid)
+	assert.Equal(t, []int64{2}, sessions.revoked)
+
+	user, adminErr = s.Unsuspend(ctx, 1, 2)
+	assert.Nil(t, adminErr)
+	assert.Nil(t, user.SuspendedAt)
+	assert.False(t, store.users[2].SuspendedAt.Valid)
+}
+
+func TestAdminCannotSuspendOrDemoteThemselves(t *testing.T) {
+	s, _, sessions := newTestAdminService()
+	ctx := context.TODO()
+
+	_, adminErr := s.Suspend(ctx, 1, 1)
+	assert.NotNil(t, adminErr)
+	assert.Equal(t, http.StatusBadRequest, adminErr.Code)
+
+	_, adminErr = s.SetRole(ctx, 1, 1, core.RoleUser)
+	assert.NotNil(t, adminErr)
+	assert.Equal(t, http.StatusBadRequest, adminErr.Code)
+	assert.Empty(t, sessions.revoked)
+}
+
+func TestSetRole(t *testing.T) {
+	s, _, sessions := newTestAdminService()
+	ctx := context.TODO()
+
+	_, adminErr := s.SetRole(ctx, 1, 2, "owner")
+	assert.NotNil(t, adminErr)
+	assert.Equal(t, http.StatusBadRequest, adminErr.Code)
+
+	user, adminErr := s.SetRole(ctx, 1, 2, core.RoleAdmin)
+	assert.Nil(t, adminErr)
+	assert.Equal(t, core.RoleAdmin, user.Role)
+	assert.Empty(t, sessions.revoked)
+
+	// Demotion signs the user out so that the admin claim is not used until token expiry
+	_, adminErr = s.SetRole(ctx, 1, 2, core.RoleUser)
+	assert.Nil(t, adminErr)
+	assert.Equal(t, []int64{2}, sessions.revoked)
+
+	_, adminErr = s.SetRole(ctx, 1, 42, core.RoleUser)
+	assert.NotNil(t, adminErr)
+	assert.Equal(t, http.StatusNotFound, adminErr.Code)
+}
+
+func TestManageReservedNames(t *testing.T) {
+	s, store, _ := newTestAdminService()
+	ctx := context.TODO()
+
+	assert.Nil(t, s.AddReserved(ctx, 1, "subdomain", "Status"))
+	assert.True(t, s.names.IsSubdomain("status"))
+	assert.Equal(t, "subdomain", store.reserved["status"])
+
+	// Moving a name to another kind replaces it
+	assert.Nil(t, s.AddReserved(ctx, 1, "company", "status"))
+	assert.False(t, s.names.IsSubdomain("status"))
+	assert.True(t, s.names.IsCompany("status"))
+
+	adminErr := s.RemoveReserved(ctx, 1, "subdomain", "status")
+	assert.NotNil(t, adminErr)
+	assert.Equal(t, http.StatusNotFound, adminErr.Code)
+
+	assert.Nil(t, s.RemoveReserved(ctx, 1, "company", "status"))
+	assert.False(t, s.names.IsCompany("status"))
+
+	adminErr = s.AddReserved(ctx, 1, "team", "status")
+	assert.NotNil(t, adminErr)
+	assert.Equal(t, http.StatusBadRequest, adminErr.Code)
+
+	adminErr = s.AddReserved(ctx, 1, "subdomain", "not a name")
+	assert.NotNil(t, adminErr)
+	assert.Equal(t, http.StatusBadRequest, adminErr.Code)
+
+	// Loading from db replaces the built in names
+	assert.Nil(t, s.names.Load(ctx, store))
+	assert.False(t, s.names.IsSubdomain("dash"))
+	assert.False(t, s.names.IsCompany("google"))
+}
+
+func TestManageCompanyDomains(t *testing.T) {
+	s, store, _ := newTestAdminService()
+	ctx := context.TODO()
+
+	assert.Nil(t, s.AddCompanyDomain(ctx, 1, "Google", "Google.co.uk."))
+	assert.Equal(t, "google", store.companyDomains["google.co.uk"])
+
+	names, adminErr := s.ListReserved(ctx)
+	assert.Nil(t, adminErr)
+	assert.Equal(t, []string{"google.co.uk"}, names.CompanyDomains["google"])
+
+	// Subdomains are covered by their registrable domain
+	adminErr = s.AddCompanyDomain(ctx, 1, "google", "mail.google.com")
+	assert.NotNil(t, adminErr)
+	assert.Equal(t, http.StatusBadRequest, adminErr.Code)
+
+	adminErr = s.AddCompanyDomain(ctx, 1, "dash", "dash.com")
+	assert.NotNil(t, adminErr)
+	assert.Equal(t, http.StatusNotFound, adminErr.Code)
+
+	adminErr = s.RemoveCompanyDomain(ctx, 1, "google", "google.com")
+	assert.NotNil(t, adminErr)
+	assert.Equal(t, http.StatusNotFound, adminErr.Code)
+
+	assert.Nil(t, s.RemoveCompanyDomain(ctx, 1, "google", "google.co.uk"))
+	assert.Empty(t, store.companyDomains)
+}
@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"context"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/reserved"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type AdminQuerier interface {
+	reserved.ReservedQuerier
+	ListCompanyDomains(ctx context.Context) ([]db.CompanyDomain, error)
+	UpsertCompanyDomain(ctx context.Context, params db.UpsertCompanyDomainParams) (db.CompanyDomain, error)
+	DeleteCompanyDomain(ctx context.Context, params db.DeleteCompanyDomainParams) (int64, error)
+
+	GetUser(ctx context.Context, userId int64) (db.User, error)
+	SearchUsers(ctx context.Context, params db.SearchUsersParams) ([]db.User, error)
+	SetUserSuspended(ctx context.Context, params db.SetUserSuspendedParams) (db.User, error)
+	SetUserRole(ctx context.Context, params db.SetUserRoleParams) (db.User, error)
+	PromoteAdmins(ctx context.Context, emails []string) (int64, error)
+
+	ExportUserEndpoints(ctx context.Context, userId pgtype.Int8) ([]db.Endpoint, error)
+	ReleaseEndpoint(ctx context.Context, params db.ReleaseEndpointParams) (int64, error)
+
+	GetSystemStats(ctx context.Context) (db.GetSystemStatsRow, error)
+	CountUsersByPlan(ctx context.Context) ([]db.CountUsersByPlanRow, error)
+}
+
+type AdminStore struct {
+	q db.Querier
+}
+
+func NewAdminStore(q db.Querier) *AdminStore {
+	return &AdminStore{
+		q: q,
+	}
+}
+
+func (as AdminStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	return as.q.GetUser(ctx, userId)
+}
+
+func (as AdminStore) SearchUsers(ctx context.Context, params db.SearchUsersParams) ([]db.User, error) {
+	return as.q.SearchUsers(ctx, params)
+}
+
+func (as AdminStore) SetUserSuspended(ctx context.Context, params db.SetUserSuspendedParams) (db.User, error) {
+	return as.q.SetUserSuspended(ctx, params)
+}
+
+func (as AdminStore) SetUserRole(ctx context.Context, params db.SetUserRoleParams) (db.User, error) {
+	return as.q.SetUserRole(ctx, params)
+}
+
+func (as AdminStore) PromoteAdmins(ctx context.Context, emails []string) (int64, error) {
+	return as.q.PromoteAdmins(ctx, emails)
+}
+
+func (as AdminStore) ExportUserEndpoints(ctx context.Context, userId pgtype.Int8) ([]db.Endpoint, error) {
+	return as.q.ExportUserEndpoints(ctx, userId)
+}
+
+func (as AdminStore) ReleaseEndpoint(ctx context.Context, params db.ReleaseEndpointParams) (int64, error) {
+	return as.q.ReleaseEndpoint(ctx, params)
+}
+
+func (as AdminStore) GetSystemStats(ctx context.Context) (db.GetSystemStatsRow, error) {
+	return as.q.GetSystemStats(ctx)
+}
+
+func (as AdminStore) CountUsersByPlan(ctx context.Context) ([]db.CountUsersByPlanRow, error) {
+	return as.q.CountUsersByPlan(ctx)
+}
+
+func (as AdminStore) ListReservedNames(ctx context.Context) ([]db.ReservedName, error) {
+	return as.q.ListReservedNames(ctx)
+}
+
+func (as AdminStore) UpsertReservedName(ctx context.Context, params db.UpsertReservedNameParams) (db.ReservedName, error) {
+	return as.q.UpsertReservedName(ctx, params)
+}
+
+func (as AdminStore) DeleteReservedName(ctx context.Context, params db.DeleteReservedNameParams) (int64, error) {
+	return as.q.DeleteReservedName(ctx, params)
+}
+
+func (as AdminStore) ListCompanyDomains(ctx context.Context) ([]db.CompanyDomain, error) {
+	return as.q.ListCompanyDomains(ctx)
+}
+
+func (as AdminStore) UpsertCompanyDomain(ctx context.Context, params db.UpsertCompanyDomainParams) (db.CompanyDomain, error) {
+	return as.q.UpsertCompanyDomain(ctx, params)
+}
+
+func (as AdminStore) DeleteCompanyDomain(ctx context.Context, params db.DeleteCompanyDomainParams) (int64, error) {
+	return as.q.DeleteCompanyDomain(ctx, params)
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditController struct {
+	service *AuditService
+}
+
+func NewAuditController(service *AuditService) *AuditController {
+	return &AuditController{
+		service: service,
+	}
+}
+
+// adminmw must run after authmw.
+func (ac *AuditController) RegisterRoutes(app *fiber.App, authmw fiber.Handler, adminmw fiber.Handler) {
+	app.Get("/user/audit", authmw, ac.GetUserAuditHandler)
+	app.Get("/admin/audit", authmw, adminmw, ac.GetAuditHandler)
+}
+
+// Audit trail of the signed in user. Paginate with ?before=<id of the last entry>.
+func (ac *AuditController) GetUserAuditHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+
+	beforeId, limit, err := parsePage(c)
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	logs, auditErr := ac.service.ListUserEntries(c.UserContext(), userId, beforeId, limit)
+	if auditErr != nil {
+		return &fiber.Error{
+			Code:    auditErr.Code,
+			Message: auditErr.Message,
+		}
+	}
+	return c.JSON(logs)
+}
+
+// Audit trail across all users, filtered by ?user=, ?action= and ?target=.
+func (ac *AuditController) GetAuditHandler(c *fiber.Ctx) error {
+	beforeId, limit, err := parsePage(c)
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	userId, err := strconv.ParseInt(c.Query("user", "0"), 10, 64)
+	if err != nil || userId < 0 {
+		return fiber.ErrBadRequest
+	}
+
+	logs, auditErr := ac.service.ListEntries(c.UserContext(), Filter{
+		UserId:   userId,
+		Action:   c.Query("action"),
+		Target:   c.Query("target"),
+		BeforeId: beforeId,
+		Limit:    limit,
+	})
+	if auditErr != nil {
+		return &fiber.Error{
+			Code:    auditErr.Code,
+			Message: auditErr.Message,
+		}
+	}
+	return c.JSON(logs)
+}
+
+func parsePage(c *fiber.Ctx) (int64, int32, error) {
+	beforeId, err := strconv.ParseInt(c.Query("before", "0"), 10, 64)
+	if err != nil || beforeId < 0 {
+		return 0, 0, fiber.ErrBadRequest
+	}
+	limit, err := strconv.ParseInt(c.Query("limit", strconv.Itoa(DefaultPageSize)), 10, 32)
+	if err != nil || limit < 1 || limit > MaxPageSize {
+		return 0, 0, fiber.ErrBadRequest
+	}
+	return beforeId, int32(limit), nil
+}
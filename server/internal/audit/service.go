@@ -0,0 +1,259 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+type Action string
+
+const (
+	ActionLogin          Action = "auth.login"
+	ActionTokenRefresh   Action = "auth.token_refresh"
+	ActionLogout         Action = "auth.logout"
+	ActionSessionRevoke  Action = "auth.session_revoke"
+	ActionIdentityLink   Action = "auth.identity_link"
+	ActionIdentityUnlink Action = "auth.identity_unlink"
+
+	ActionEndpointCreate      Action = "endpoint.create"
+	ActionEndpointAccessSet   Action = "endpoint.access_set"
+	ActionEndpointAccessClear Action = "endpoint.access_clear"
+	ActionEndpointRateLimit   Action = "endpoint.rate_limit_set"
+	ActionEndpointHistoryRead Action = "endpoint.history_read"
+	ActionEndpointInspect     Action = "endpoint.inspect"
+	ActionCustomDomainAdd     Action = "endpoint.custom_domain_add"
+	ActionCustomDomainVerify  Action = "endpoint.custom_domain_verify"
+	ActionCustomDomainRemove  Action = "endpoint.custom_domain_remove"
+	ActionRequestRead         Action = "request.read"
+
+	ActionProfileUpdate Action = "user.profile_update"
+	ActionDataExport    Action = "user.export"
+	ActionAccountDelete Action = "user.delete"
+
+	ActionTeamCreate           Action = "team.create"
+	ActionTeamMemberInvite     Action = "team.member_invite"
+	ActionTeamInvitationDelete Action = "team.invitation_delete"
+	ActionTeamMemberAdd        Action = "team.member_add"
+	ActionTeamMemberRemove     Action = "team.member_remove"
+	ActionTeamDomainAdd        Action = "team.domain_add"
+	ActionTeamDomainVerify     Action = "team.domain_verify"
+	ActionTeamDomainRemove     Action = "team.domain_remove"
+
+	ActionAdminPlanChange          Action = "admin.plan_change"
+	ActionAdminRoleChange          Action = "admin.role_change"
+	ActionAdminSuspend             Action = "admin.suspend"
+	ActionAdminUnsuspend           Action = "admin.unsuspend"
+	ActionAdminEndpointRelease     Action = "admin.endpoint_release"
+	ActionAdminReservedAdd         Action = "admin.reserved_add"
+	ActionAdminReservedRemove      Action = "admin.reserved_remove"
+	ActionAdminCompanyDomainAdd    Action = "admin.company_domain_add"
+	ActionAdminCompanyDomainRemove Action = "admin.company_domain_remove"
+)
+
+// Targets identify the resource an action was performed on, e.g. endpoint/acme.
+func EndpointTarget(endpoint string) string {
+	return "endpoint/" + endpoint
+}
+
+func RequestTarget(uuid string) string {
+	return "request/" + uuid
+}
+
+func SessionTarget(sessionId string) string {
+	return "session/" + sessionId
+}
+
+func TeamTarget(teamId int64) string {
+	return fmt.Sprintf("team/%d", teamId)
+}
+
+func UserTarget(userId int64) string {
+	return fmt.Sprintf("user/%d", userId)
+}
+
+type AuditError struct {
+	Code    int
+	Message string
+}
+
+func (a *AuditError) Error() string {
+	return a.Message
+}
+
+func NewInternalServerError() *AuditError {
+	return &AuditError{
+		Code:    http.StatusInternalServerError,
+		Message: "Oops! Something went wrong :(",
+	}
+}
+
+// An action to be recorded. Before and After are stored as JSON and must never contain secrets.
+type Entry struct {
+	// 0 when the action was not performed by a signed in user
+	ActorId int64
+	// User whose account or resources were affected. Defaults to the actor.
+	UserId    int64
+	Action    Action
+	Target    string
+	Ip        string
+	UserAgent string
+	Before    any
+	After     any
+}
+
+// Entry for an action performed in the given request. The actor is the signed in user, if any.
+func FromRequest(c *fiber.Ctx, action Action, target string) Entry {
+	actorId, _ := c.Locals("userId").(int64)
+	return Entry{
+		ActorId:   actorId,
+		Action:    action,
+		Target:    target,
+		Ip:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+}
+
+type Log struct {
+	Id        int64           `json:"id"`
+	ActorId   *int64          `json:"actor_id"`
+	UserId    *int64          `json:"user_id"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Ip        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type Filter struct {
+	// Matches entries where the user is either the actor or the affected user
+	UserId   int64
+	Action   string
+	Target   string
+	BeforeId int64
+	Limit    int32
+}
+
+// Records and queries the audit trail.
+type AuditService struct {
+	auditq AuditQuerier
+}
+
+func NewAuditService(auditq AuditQuerier) *AuditService {
+	return &AuditService{
+		auditq: auditq,
+	}
+}
+
+// Recording is best effort. A failure is logged but never fails the audited action.
+func (s *AuditService) Record(ctx context.Context, entry Entry) {
+	userId := entry.UserId
+	if userId == 0 {
+		userId = entry.ActorId
+	}
+
+	params := db.InsertAuditLogParams{
+		ActorID:   pgtype.Int8{Int64: entry.ActorId, Valid: entry.ActorId != 0},
+		UserID:    pgtype.Int8{Int64: userId, Valid: userId != 0},
+		Action:    string(entry.Action),
+		Target:    entry.Target,
+		Ip:        entry.Ip,
+		UserAgent: entry.UserAgent,
+	}
+
+	var err error
+	if params.Before, err = marshalValue(entry.Before); err != nil {
+		slog.ErrorContext(ctx, "unable to marshal audit before value", "action", entry.Action, "err", err)
+	}
+	if params.After, err = marshalValue(entry.After); err != nil {
+		slog.ErrorContext(ctx, "unable to marshal audit after value", "action", entry.Action, "err", err)
+	}
+
+	if err := s.auditq.InsertAuditLog(ctx, params); err != nil {
+		slog.ErrorContext(ctx, "unable to record audit log", "action", entry.Action, "actorId", entry.ActorId, "target", entry.Target, "err", err)
+	}
+}
+
+// Entries performed by or affecting the user, newest first.
+func (s *AuditService) ListUserEntries(ctx context.Context, userId int64, beforeId int64, limit int32) ([]Log, *AuditError) {
+	records, err := s.auditq.ListUserAuditLog(ctx, db.ListUserAuditLogParams{
+		UserID:   userId,
+		BeforeID: beforeId,
+		Limit:    pageSize(limit),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list user audit log", "userId", userId, "err", err)
+		return nil, NewInternalServerError()
+	}
+	return logsFromRecords(records), nil
+}
+
+// Entries across all users matching the filter, newest first.
+func (s *AuditService) ListEntries(ctx context.Context, filter Filter) ([]Log, *AuditError) {
+	records, err := s.auditq.ListAuditLog(ctx, db.ListAuditLogParams{
+		UserID:   filter.UserId,
+		Action:   filter.Action,
+		Target:   filter.Target,
+		BeforeID: filter.BeforeId,
+		Limit:    pageSize(filter.Limit),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list audit log", "err", err)
+		return nil, NewInternalServerError()
+	}
+	return logsFromRecords(records), nil
+}
+
+func pageSize(limit int32) int32 {
+	if limit <= 0 {
+		return DefaultPageSize
+	}
+	return min(limit, MaxPageSize)
+}
+
+func marshalValue(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func logsFromRecords(records []db.AuditLog) []Log {
+	logs := make([]Log, 0, len(records))
+	for _, rec := range records {
+		l := Log{
+			Id:        rec.ID,
+			Action:    rec.Action,
+			Target:    rec.Target,
+			Ip:        rec.Ip,
+			UserAgent: rec.UserAgent,
+			Before:    rec.Before,
+			After:     rec.After,
+			CreatedAt: rec.CreatedAt.Time,
+		}
+		if rec.ActorID.Valid {
+			actorId := rec.ActorID.Int64
+			l.ActorId = &actorId
+		}
+		if rec.UserID.Valid {
+			userId := rec.UserID.Int64
+			l.UserId = &userId
+		}
+		logs = append(logs, l)
+	}
+	return logs
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockAuditStore struct {
+	entries []db.InsertAuditLogParams
+	err     error
+}
+
+func (as *MockAuditStore) InsertAuditLog(ctx context.Context, params db.InsertAuditLogParams) error {
+	if as.err != nil {
+		return as.err
+	}
+	as.entries = append(as.entries, params)
+	return nil
+}
+
+func (as *MockAuditStore) ListUserAuditLog(ctx context.Context, params db.ListUserAuditLogParams) ([]db.AuditLog, error) {
+	return []db.AuditLog{
+		{ID: 2, ActorID: pgtype.Int8{Int64: 1, Valid: true}, UserID: pgtype.Int8{Int64: params.UserID, Valid: true}, Action: string(ActionAdminSuspend)},
+		{ID: 1, UserID: pgtype.Int8{Int64: params.UserID, Valid: true}, Action: string(ActionLogin), After: []byte(`{"method":"github"}`)},
+	}, nil
+}
+
+func (as *MockAuditStore) ListAuditLog(ctx context.Context, params db.ListAuditLogParams) ([]db.AuditLog, error) {
+	return []db.AuditLog{}, nil
+}
+
+var _ AuditQuerier = (*MockAuditStore)(nil)
+
+func TestRecordDefaultsAffectedUserToActor(t *testing.T) {
+	store := &MockAuditStore{}
+	s := NewAuditService(store)
+
+	s.Record(context.TODO(), Entry{
+		ActorId: 7,
+		Action:  ActionEndpointRateLimit,
+		Target:  EndpointTarget("acme"),
+		Before:  map[string]int{"rate": 1},
+		After:   map[string]int{"rate": 2},
+	})
+
+	assert.Len(t, store.entries, 1)
+	e := store.entries[0]
+	assert.Equal(t, int64(7), e.ActorID.Int64)
+	assert.Equal(t, int64(7), e.UserID.Int64)
+	assert.Equal(t, "endpoint/acme", e.Target)
+	assert.JSONEq(t, `{"rate":1}`, string(e.Before))
+	assert.JSONEq(t, `{"rate":2}`, string(e.After))
+}
+
+func TestRecordWithoutActor(t *testing.T) {
+	store := &MockAuditStore{}
+	s := NewAuditService(store)
+
+	s.Record(context.TODO(), Entry{Action: ActionLogin})
+
+	e := store.entries[0]
+	assert.False(t, e.ActorID.Valid)
+	assert.False(t, e.UserID.Valid)
+	assert.Nil(t, e.Before)
+	assert.Nil(t, e.After)
+}
+
+func TestRecordFailureDoesNotPanic(t *testing.T) {
+	s := NewAuditService(&MockAuditStore{err: errors.New("db down")})
+	s.Record(context.TODO(), Entry{ActorId: 1, Action: ActionDataExport})
+}
+
+func TestListUserEntries(t *testing.T) {
+	s := NewAuditService(&MockAuditStore{})
+
+	logs, auditErr := s.ListUserEntries(context.TODO(), 3, 0, 0)
+	assert.Nil(t, auditErr)
+	assert.Len(t, logs, 2)
+	assert.Equal(t, int64(1), *logs[0].ActorId)
+	assert.Equal(t, int64(3), *logs[0].UserId)
+	assert.Nil(t, logs[1].ActorId)
+	assert.JSONEq(t, `{"method":"github"}`, string(logs[1].After))
+}
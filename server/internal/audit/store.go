@@ -0,0 +1,35 @@
+package audit
+
+import (
+	"context"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+)
+
+type AuditQuerier interface {
+	InsertAuditLog(ctx context.Context, params db.InsertAuditLogParams) error
+	ListUserAuditLog(ctx context.Context, params db.ListUserAuditLogParams) ([]db.AuditLog, error)
+	ListAuditLog(ctx context.Context, params db.ListAuditLogParams) ([]db.AuditLog, error)
+}
+
+type AuditStore struct {
+	q db.Querier
+}
+
+func NewAuditStore(q db.Querier) *AuditStore {
+	return &AuditStore{
+		q: q,
+	}
+}
+
+func (as AuditStore) InsertAuditLog(ctx context.Context, params db.InsertAuditLogParams) error {
+	return as.q.InsertAuditLog(ctx, params)
+}
+
+func (as AuditStore) ListUserAuditLog(ctx context.Context, params db.ListUserAuditLogParams) ([]db.AuditLog, error) {
+	return as.q.ListUserAuditLog(ctx, params)
+}
+
+func (as AuditStore) ListAuditLog(ctx context.Context, params db.ListAuditLogParams) ([]db.AuditLog, error) {
+	return as.q.ListAuditLog(ctx, params)
+}
@@ -2,40 +2,61 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gofiber/fiber/v2"
 	"github.com/humanbeeng/checkpost/server/config"
 	db "github.com/humanbeeng/checkpost/server/db/sqlc"
-	"github.com/humanbeeng/checkpost/server/internal/core"
-	"github.com/jackc/pgx/v5"
+	"github.com/humanbeeng/checkpost/server/internal/audit"
+	"github.com/humanbeeng/checkpost/server/internal/mail"
+	"github.com/humanbeeng/checkpost/server/internal/metrics"
+	gonanoid "github.com/matoous/go-nanoid/v2"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
 	"golang.org/x/oauth2/google"
 )
 
-type AuthHandler struct {
-	config            *config.AppConfig
-	githubOAuthConfig *oauth2.Config
-	googleOAuthConfig *oauth2.Config
-	pasetoVerifier    *core.PasetoVerifier
-	q                 db.Querier
-}
+const (
+	ProviderGithub = "github"
+	ProviderGoogle = "google"
 
-func NewAuthHandler(config *config.AppConfig, querier db.Querier) (*AuthHandler, error) {
-	symmetricKey := config.Paseto.Key
+	// Binds the OAuth state to the browser that started the flow.
+	// Clients that proxy the callback can pass the nonce in the NonceHeader instead.
+	NonceCookie = "oauth_nonce"
+	NonceHeader = "X-OAuth-Nonce"
+)
 
-	pasetoVerifier, err := core.NewPasetoVerifier(symmetricKey)
-	if err != nil {
-		return nil, err
-	}
+type oauthProvider struct {
+	name string
+	// OpenID Connect providers resolve their endpoints on first use, which can fail.
+	oauthConfig func(ctx context.Context) (*oauth2.Config, error)
+	// OpenID Connect providers receive the state nonce, which is checked against the ID token.
+	oidc bool
+	// Fetches the provider account the token was issued for
+	fetchUser func(ctx context.Context, token *oauth2.Token, nonce string) (*OAuthUser, error)
+}
+
+type AuthHandler struct {
+	config     *config.AppConfig
+	providers  map[string]*oauthProvider
+	sessions   *SessionService
+	identities *IdentityService
+	magicLinks *MagicLinkService
+	states     *stateSigner
+	audit      *audit.AuditService
+}
 
+func NewAuthHandler(config *config.AppConfig, sessions *SessionService, identities *IdentityService, magicLinks *MagicLinkService, audit *audit.AuditService) (*AuthHandler, error) {
 	githubOauthConfig := &oauth2.Config{
 		ClientID:     config.Github.ClientId,
 		ClientSecret: config.Github.Secret,
@@ -51,20 +72,54 @@ func NewAuthHandler(config *config.AppConfig, querier db.Querier) (*AuthHandler,
 		RedirectURL:  config.Google.RedirectUrl,
 	}
 
+	providers := map[string]*oauthProvider{
+		ProviderGithub: {name: ProviderGithub, oauthConfig: staticOAuthConfig(githubOauthConfig), fetchUser: fetchGithubUser},
+		ProviderGoogle: {name: ProviderGoogle, oauthConfig: staticOAuthConfig(googleOAuthConfig), fetchUser: fetchGoogleUser},
+	}
+
+	for name, oidcConfig := range config.Oidc {
+		if _, ok := providers[name]; ok {
+			return nil, fmt.Errorf("oidc provider name %s is reserved", name)
+		}
+		provider, err := newOidcProvider(name, oidcConfig)
+		if err != nil {
+			return nil, err
+		}
+		providers[name] = provider
+		slog.Info("Registered oidc provider", "provider", name, "issuer", oidcConfig.Issuer)
+	}
+
 	return &AuthHandler{
-		githubOAuthConfig: githubOauthConfig,
-		googleOAuthConfig: googleOAuthConfig,
-		config:            config,
-		pasetoVerifier:    pasetoVerifier,
-		q:                 querier,
-	}, err
+		config:     config,
+		providers:  providers,
+		sessions:   sessions,
+		identities: identities,
+		magicLinks: magicLinks,
+		states:     newStateSigner(config.Paseto.Key),
+		audit:      audit,
+	}, nil
 }
 
-func (ac *AuthHandler) RegisterRoutes(app *fiber.App) {
+func (ac *AuthHandler) RegisterRoutes(app *fiber.App, authmw fiber.Handler) {
 	app.Get("/auth/github", ac.GithubLoginHandler)
 	app.Get("/auth/google", ac.GoogleLoginHandler)
 	app.Get("/auth/github/callback", ac.GithubCallbackHandler)
 	app.Get("/auth/google/callback", ac.GoogleCallbackHandler)
+	app.Get("/auth/oidc/:provider", ac.OidcLoginHandler)
+	app.Get("/auth/oidc/:provider/callback", ac.OidcCallbackHandler)
+	// Sign in links must not end up in the logs
+	if mail.Delivers(ac.config.Mail.Transport) {
+		app.Post("/auth/email", ac.EmailLoginHandler)
+		app.Get("/auth/email/callback", ac.EmailCallbackHandler)
+	} else {
+		slog.Info("Email sign in disabled, no mail transport configured", "transport", ac.config.Mail.Transport)
+	}
+	app.Post("/auth/refresh", ac.RefreshHandler)
+	app.Post("/auth/logout", authmw, ac.LogoutHandler)
+
+	app.Get("/auth/identities", authmw, ac.ListIdentitiesHandler)
+	app.Post("/auth/link/:provider", authmw, ac.LinkHandler)
+	app.Delete("/auth/link/:provider", authmw, ac.UnlinkHandler)
 }
 
 type OAuthUser struct {
@@ -72,14 +127,34 @@ type OAuthUser struct {
 	Username  string `json:"login"`
 	Email     string `json:"email"`
 	AvatarUrl string `json:"avatar_url"`
+
+	Provider      string `json:"-"`
+	Subject       string `json:"-"`
+	EmailVerified bool   `json:"-"`
 }
 
 type AuthResponse struct {
-	Token     string `json:"token"`
-	Name      string `json:"name"`
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	AvatarUrl string `json:"avatar_url"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Name         string    `json:"name"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	AvatarUrl    string    `json:"avatar_url"`
+}
+
+// Returned instead of a redirect to clients that start the flow themselves.
+type AuthorizeResponse struct {
+	Url   string `json:"url"`
+	Nonce string `json:"nonce"`
+}
+
+type EmailLoginRequest struct {
+	Email string `json:"email"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 type MailResponseItem struct {
@@ -90,140 +165,383 @@ type MailResponseItem struct {
 }
 
 func (a *AuthHandler) GithubLoginHandler(c *fiber.Ctx) error {
-	slog.Info("Received Github login request")
-	// TODO: Add state to oauth request
-	url := a.githubOAuthConfig.AuthCodeURL("none")
-	return c.Redirect(url)
+	slog.InfoContext(c.UserContext(), "Received Github login request")
+	return a.authorize(c, a.providers[ProviderGithub], 0)
 }
 
 func (a *AuthHandler) GoogleLoginHandler(c *fiber.Ctx) error {
-	slog.Info("Received Google login request")
-	// TODO: Add state to oauth request
-	url := a.googleOAuthConfig.AuthCodeURL("none")
-	return c.Redirect(url)
+	slog.InfoContext(c.UserContext(), "Received Google login request")
+	return a.authorize(c, a.providers[ProviderGoogle], 0)
 }
 
 func (a *AuthHandler) GoogleCallbackHandler(c *fiber.Ctx) error {
-	code := c.Query("code")
+	slog.InfoContext(c.UserContext(), "Received Google callback")
+	return a.callback(c, a.providers[ProviderGoogle])
+}
 
-	if code == "" {
-		slog.Warn("Code not found in callback url")
+func (a *AuthHandler) GithubCallbackHandler(c *fiber.Ctx) error {
+	slog.InfoContext(c.UserContext(), "Received Github callback")
+	return a.callback(c, a.providers[ProviderGithub])
+}
+
+func (a *AuthHandler) OidcLoginHandler(c *fiber.Ctx) error {
+	provider, ok := a.oidcProvider(c.Params("provider"))
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	slog.InfoContext(c.UserContext(), "Received oidc login request", "provider", provider.name)
+	return a.authorize(c, provider, 0)
+}
+
+func (a *AuthHandler) OidcCallbackHandler(c *fiber.Ctx) error {
+	provider, ok := a.oidcProvider(c.Params("provider"))
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	slog.InfoContext(c.UserContext(), "Received oidc callback", "provider", provider.name)
+	return a.callback(c, provider)
+}
+
+func staticOAuthConfig(config *oauth2.Config) func(ctx context.Context) (*oauth2.Config, error) {
+	return func(ctx context.Context) (*oauth2.Config, error) {
+		return config, nil
+	}
+}
+
+func (a *AuthHandler) oidcProvider(name string) (*oauthProvider, bool) {
+	provider, ok := a.providers[name]
+	if !ok || !provider.oidc {
+		return nil, false
+	}
+	return provider, true
+}
+
+// Mails a single use sign in link. Responds the same whether or not an account exists.
+func (a *AuthHandler) EmailLoginHandler(c *fiber.Ctx) error {
+	var req EmailLoginRequest
+	if err := c.BodyParser(&req); err != nil {
 		return fiber.ErrBadRequest
 	}
 
-	slog.Info("Received Google callback")
+	slog.InfoContext(c.UserContext(), "Received email login request")
+	if authErr := a.magicLinks.SendLink(c.UserContext(), req.Email, c.IP()); authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
 
-	googleUser, err := a.exchangeGoogleCodeForUser(c, code)
-	if err != nil {
-		slog.Error("unable to exchange code for google user", "err", err)
-		return fiber.ErrInternalServerError
+func (a *AuthHandler) EmailCallbackHandler(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return fiber.ErrBadRequest
 	}
 
-	user, err := a.q.GetUserFromEmail(context.Background(), googleUser.Email)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			slog.Info("Creating new user", "username", googleUser.Name, "email", googleUser.Email)
-			user, err = a.q.CreateUser(c.Context(), db.CreateUserParams{
-				Name:      googleUser.Name,
-				AvatarUrl: googleUser.AvatarUrl,
-				Username:  googleUser.Username,
-				Plan:      db.PlanFree,
-				Email:     googleUser.Email,
-			})
-			if err != nil {
-				slog.Error("unable to create new user", "err", err)
-				return fiber.ErrInternalServerError
-			}
-		} else {
-			slog.Error("unable to fetch existing user", "err", err)
+	slog.InfoContext(c.UserContext(), "Received email callback")
+	user, authErr := a.magicLinks.Redeem(c.UserContext(), token)
+	if authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
 		}
-	} else {
-		slog.Info("Logging in existing user", "username", user.Username, "email", user.Email)
 	}
+	return a.signIn(c, user, ProviderEmail)
+}
 
-	// Create token and encrypt it
-	args := core.CreateTokenArgs{
-		Username: user.Username,
-		UserId:   user.ID,
-		Plan:     db.PlanFree,
+// Redirects to the consent screen of the provider with a signed state and a PKCE challenge.
+// With redirect=false the url and nonce are returned as JSON instead.
+func (a *AuthHandler) authorize(c *fiber.Ctx, provider *oauthProvider, linkUserId int64) error {
+	oauthConfig, err := provider.oauthConfig(c.UserContext())
+	if err != nil {
+		slog.WarnContext(c.UserContext(), "OAuth provider unavailable", "provider", provider.name, "err", err)
+		return providerUnavailableError(provider)
 	}
-	pasetoToken, err := a.pasetoVerifier.CreateToken(args, time.Hour*24*30)
+
+	nonce, err := gonanoid.New()
 	if err != nil {
-		return err
+		slog.ErrorContext(c.UserContext(), "unable to generate oauth nonce", "err", err)
+		return fiber.ErrInternalServerError
 	}
 
-	res := AuthResponse{Token: pasetoToken}
-	return c.JSON(res)
+	verifier := oauth2.GenerateVerifier()
+	state, err := a.states.Create(OAuthState{
+		Provider:   provider.name,
+		Nonce:      nonce,
+		Verifier:   verifier,
+		LinkUserId: linkUserId,
+	})
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "unable to create oauth state", "err", err)
+		return fiber.ErrInternalServerError
+	}
 
+	c.Cookie(&fiber.Cookie{
+		Name:     NonceCookie,
+		Value:    nonce,
+		Path:     "/auth",
+		Expires:  time.Now().Add(StateDuration),
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}
+	if provider.oidc {
+		opts = append(opts, oidc.Nonce(nonce))
+	}
+
+	authUrl := oauthConfig.AuthCodeURL(state, opts...)
+	if linkUserId != 0 || !c.QueryBool("redirect", true) {
+		return c.JSON(AuthorizeResponse{Url: authUrl, Nonce: nonce})
+	}
+	return c.Redirect(authUrl)
 }
 
-func (a *AuthHandler) GithubCallbackHandler(c *fiber.Ctx) error {
+func (a *AuthHandler) callback(c *fiber.Ctx, provider *oauthProvider) error {
 	code := c.Query("code")
 	if code == "" {
-		slog.Warn("Code not found in callback url")
+		slog.WarnContext(c.UserContext(), "Code not found in callback url")
+		metrics.OAuthCallbackFailures.WithLabelValues(provider.name, "missing_code").Inc()
 		return fiber.ErrBadRequest
 	}
 
-	githubUser, err := a.exchangeGithubCodeForUser(c, code)
+	state, err := a.states.Verify(c.Query("state"))
+	if err != nil || state.Provider != provider.name {
+		slog.WarnContext(c.UserContext(), "Invalid oauth state", "provider", provider.name, "err", err)
+		metrics.OAuthCallbackFailures.WithLabelValues(provider.name, "invalid_state").Inc()
+		return &fiber.Error{
+			Code:    fiber.StatusBadRequest,
+			Message: "Sign in request is invalid or has expired. Please try again.",
+		}
+	}
+
+	nonce := c.Cookies(NonceCookie, c.Get(NonceHeader))
+	if subtle.ConstantTimeCompare([]byte(nonce), []byte(state.Nonce)) != 1 {
+		slog.WarnContext(c.UserContext(), "OAuth nonce mismatch", "provider", provider.name)
+		metrics.OAuthCallbackFailures.WithLabelValues(provider.name, "nonce_mismatch").Inc()
+		return &fiber.Error{
+			Code:    fiber.StatusBadRequest,
+			Message: "Sign in was started from another browser. Please try again.",
+		}
+	}
+	c.ClearCookie(NonceCookie)
+
+	oauthUser, err := a.exchangeCodeForUser(c.UserContext(), provider, code, state)
 	if err != nil {
-		slog.Error("unable to exchange code for github user", "err", err)
+		slog.ErrorContext(c.UserContext(), "unable to exchange code for user", "provider", provider.name, "err", err)
+		metrics.OAuthCallbackFailures.WithLabelValues(provider.name, "exchange").Inc()
+		if errors.Is(err, ErrProviderUnavailable) {
+			return providerUnavailableError(provider)
+		}
 		return fiber.ErrInternalServerError
 	}
 
-	user, err := a.q.GetUserFromEmail(context.Background(), githubUser.Email)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			slog.Info("Creating new user", "username", githubUser.Username, "email", githubUser.Email)
-			user, err = a.q.CreateUser(c.Context(), db.CreateUserParams{
-				Name:      githubUser.Name,
-				AvatarUrl: githubUser.AvatarUrl,
-				Username:  githubUser.Username,
-				Plan:      db.PlanFree,
-				Email:     githubUser.Email,
-			})
-			if err != nil {
-				slog.Error("unable to create new user", "err", err)
-				return fiber.ErrInternalServerError
+	if state.LinkUserId != 0 {
+		if authErr := a.identities.Link(c.UserContext(), state.LinkUserId, *oauthUser); authErr != nil {
+			metrics.OAuthCallbackFailures.WithLabelValues(provider.name, "link").Inc()
+			return &fiber.Error{
+				Code:    authErr.Code,
+				Message: authErr.Message,
 			}
-		} else {
-			slog.Error("unable to fetch existing user", "err", err)
 		}
-	} else {
-		slog.Info("Logging in existing user", "username", user.Username, "email", user.Email)
+
+		entry := audit.FromRequest(c, audit.ActionIdentityLink, provider.name)
+		entry.ActorId = state.LinkUserId
+		entry.After = map[string]string{"provider": provider.name, "subject": oauthUser.Subject, "email": oauthUser.Email}
+		a.audit.Record(c.UserContext(), entry)
+
+		return a.listIdentities(c, state.LinkUserId)
 	}
 
-	// Create token and encrypt it
-	args := core.CreateTokenArgs{
-		Username: user.Username,
-		UserId:   user.ID,
-		Plan:     db.PlanFree,
+	user, authErr := a.identities.SignIn(c.UserContext(), *oauthUser)
+	if authErr != nil {
+		metrics.OAuthCallbackFailures.WithLabelValues(provider.name, "sign_in").Inc()
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
 	}
 
-	pasetoToken, err := a.pasetoVerifier.CreateToken(args, time.Hour*24*30)
-	if err != nil {
-		return err
+	return a.signIn(c, user, provider.name)
+}
+
+func providerUnavailableError(provider *oauthProvider) *fiber.Error {
+	return &fiber.Error{
+		Code:    fiber.StatusServiceUnavailable,
+		Message: fmt.Sprintf("Sign in with %s is currently unavailable. Please try again later.", provider.name),
+	}
+}
+
+// Starts a new session for the user and responds with its tokens.
+func (a *AuthHandler) signIn(c *fiber.Ctx, user db.User, method string) error {
+	tokens, authErr := a.sessions.CreateSession(c.UserContext(), user, c.Get(fiber.HeaderUserAgent), c.IP())
+	if authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
 	}
 
-	res := AuthResponse{Token: pasetoToken}
+	a.audit.Record(c.UserContext(), loginEntry(c, tokens, method))
+
+	res := AuthResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+		Name:         user.Name,
+		Username:     user.Username,
+		Email:        user.Email,
+		AvatarUrl:    user.AvatarUrl,
+	}
 	return c.JSON(res)
 }
 
-func (a *AuthHandler) exchangeGoogleCodeForUser(c *fiber.Ctx, code string) (*OAuthUser, error) {
-	slog.Info("Exchanging Google code for user")
+// Exchanges a refresh token, passed either in the body or as a cookie, for a new token pair.
+func (a *AuthHandler) RefreshHandler(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.ErrBadRequest
+		}
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken = c.Cookies("refresh_token", "")
+	}
+
+	tokens, authErr := a.sessions.Refresh(c.UserContext(), req.RefreshToken, c.Get(fiber.HeaderUserAgent), c.IP())
+	if authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
+	}
+
+	entry := audit.FromRequest(c, audit.ActionTokenRefresh, audit.SessionTarget(tokens.SessionId))
+	entry.ActorId = tokens.UserId
+	a.audit.Record(c.UserContext(), entry)
+
+	res := AuthResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+	}
+	return c.JSON(res)
+}
+
+// Revokes the current session, or every session of the user when all=true.
+func (a *AuthHandler) LogoutHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	sessionId := c.Locals("sessionId").(string)
+
+	var authErr *AuthError
+	all := c.QueryBool("all")
+	if all {
+		slog.InfoContext(c.UserContext(), "Signing out everywhere", "userId", userId)
+		authErr = a.sessions.RevokeAllSessions(c.UserContext(), userId)
+	} else {
+		slog.InfoContext(c.UserContext(), "Signing out", "userId", userId, "sessionId", sessionId)
+		authErr = a.sessions.RevokeSession(c.UserContext(), userId, sessionId)
+	}
+
+	if authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
+	}
+
+	entry := audit.FromRequest(c, audit.ActionLogout, audit.SessionTarget(sessionId))
+	entry.After = map[string]bool{"all": all}
+	a.audit.Record(c.UserContext(), entry)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (a *AuthHandler) ListIdentitiesHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	return a.listIdentities(c, userId)
+}
+
+// Starts the OAuth flow of a provider that should be linked to the signed in user.
+func (a *AuthHandler) LinkHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	provider, ok := a.providers[c.Params("provider")]
+	if !ok {
+		return fiber.ErrNotFound
+	}
+
+	slog.InfoContext(c.UserContext(), "Received link request", "userId", userId, "provider", provider.name)
+	return a.authorize(c, provider, userId)
+}
+
+func (a *AuthHandler) UnlinkHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	provider := c.Params("provider")
+
+	slog.InfoContext(c.UserContext(), "Received unlink request", "userId", userId, "provider", provider)
+	if authErr := a.identities.Unlink(c.UserContext(), userId, provider); authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
+	}
+
+	entry := audit.FromRequest(c, audit.ActionIdentityUnlink, provider)
+	entry.Before = map[string]string{"provider": provider}
+	a.audit.Record(c.UserContext(), entry)
+	return a.listIdentities(c, userId)
+}
+
+func (a *AuthHandler) listIdentities(c *fiber.Ctx, userId int64) error {
+	identities, authErr := a.identities.ListIdentities(c.UserContext(), userId)
+	if authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
+	}
+	return c.JSON(identities)
+}
+
+// The session is the token that was created. Tokens themselves are never recorded.
+func loginEntry(c *fiber.Ctx, tokens Tokens, method string) audit.Entry {
+	entry := audit.FromRequest(c, audit.ActionLogin, audit.SessionTarget(tokens.SessionId))
+	entry.ActorId = tokens.UserId
+	entry.After = map[string]string{"method": method, "session_id": tokens.SessionId}
+	return entry
+}
+
+func (a *AuthHandler) exchangeCodeForUser(ctx context.Context, provider *oauthProvider, code string, state OAuthState) (*OAuthUser, error) {
+	slog.InfoContext(ctx, "Exchanging code for user", "provider", provider.name)
+
+	oauthConfig, err := provider.oauthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	token, err := a.googleOAuthConfig.Exchange(c.Context(), code)
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(state.Verifier))
 	if err != nil {
-		slog.Error("unable to exchange google callback code for token", "err", err)
 		return nil, err
 	}
 
+	oauthUser, err := provider.fetchUser(ctx, token, state.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	oauthUser.Provider = provider.name
+	return oauthUser, nil
+}
+
+func fetchGoogleUser(ctx context.Context, token *oauth2.Token, _ string) (*OAuthUser, error) {
 	baseUrl, err := url.Parse("https://www.googleapis.com/oauth2/v1/userinfo")
 	if err != nil {
 		return nil, err
 	}
 
 	// Fetch basic user information
-	userReq, err := http.NewRequestWithContext(c.Context(), http.MethodGet, baseUrl.String(), nil)
+	userReq, err := http.NewRequestWithContext(ctx, http.MethodGet, baseUrl.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -237,6 +555,10 @@ func (a *AuthHandler) exchangeGoogleCodeForUser(c *fiber.Ctx, code string) (*OAu
 
 	defer userRes.Body.Close()
 
+	if userRes.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("google userinfo returned %d", userRes.StatusCode)
+	}
+
 	userBody, _ := io.ReadAll(userRes.Body)
 
 	var googleUser struct {
@@ -253,30 +575,25 @@ func (a *AuthHandler) exchangeGoogleCodeForUser(c *fiber.Ctx, code string) (*OAu
 	}
 
 	oauthUser := OAuthUser{
-		Name:      googleUser.Name,
-		Email:     googleUser.Email,
-		AvatarUrl: googleUser.Picture,
-		Username:  googleUser.Email,
+		Name:          googleUser.Name,
+		Email:         googleUser.Email,
+		AvatarUrl:     googleUser.Picture,
+		Username:      googleUser.Email,
+		Subject:       googleUser.Id,
+		EmailVerified: googleUser.VerifiedEmail,
 	}
 
 	return &oauthUser, nil
 }
 
-// exchange the auth code that retrieved from github via URL query parameter into an access token.
-func (a *AuthHandler) exchangeGithubCodeForUser(c *fiber.Ctx, code string) (*OAuthUser, error) {
-	slog.Info("Exchanging Github code for user")
-	token, err := a.githubOAuthConfig.Exchange(c.Context(), code)
-	if err != nil {
-		return nil, err
-	}
-
+func fetchGithubUser(ctx context.Context, token *oauth2.Token, _ string) (*OAuthUser, error) {
 	baseUrl, err := url.Parse("https://api.github.com/user")
 	if err != nil {
 		return nil, err
 	}
 
 	// Fetch basic user information
-	userReq, err := http.NewRequestWithContext(c.Context(), http.MethodGet, baseUrl.String(), nil)
+	userReq, err := http.NewRequestWithContext(ctx, http.MethodGet, baseUrl.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -294,7 +611,7 @@ func (a *AuthHandler) exchangeGithubCodeForUser(c *fiber.Ctx, code string) (*OAu
 		return nil, err
 	}
 
-	emailReq, err := http.NewRequestWithContext(c.Context(), http.MethodGet, emailUrl.String(), nil)
+	emailReq, err := http.NewRequestWithContext(ctx, http.MethodGet, emailUrl.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -308,6 +625,10 @@ func (a *AuthHandler) exchangeGithubCodeForUser(c *fiber.Ctx, code string) (*OAu
 	defer userRes.Body.Close()
 	defer emailRes.Body.Close()
 
+	if userRes.StatusCode != http.StatusOK || emailRes.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("github returned %d for user and %d for emails", userRes.StatusCode, emailRes.StatusCode)
+	}
+
 	userBody, err := io.ReadAll(userRes.Body)
 	if err != nil {
 		return nil, err
@@ -318,14 +639,20 @@ func (a *AuthHandler) exchangeGithubCodeForUser(c *fiber.Ctx, code string) (*OAu
 		return nil, err
 	}
 
-	var githubUser OAuthUser
+	var githubUser struct {
+		OAuthUser
+		Id int64 `json:"id"`
+	}
 	err = json.Unmarshal(userBody, &githubUser)
 	if err != nil {
 		return nil, err
 	}
 
-	if githubUser.Name == "" {
-		githubUser.Name = githubUser.Username
+	oauthUser := githubUser.OAuthUser
+	oauthUser.Subject = strconv.FormatInt(githubUser.Id, 10)
+
+	if oauthUser.Name == "" {
+		oauthUser.Name = oauthUser.Username
 	}
 
 	var userEmails []MailResponseItem
@@ -334,12 +661,28 @@ func (a *AuthHandler) exchangeGithubCodeForUser(c *fiber.Ctx, code string) (*OAu
 		return nil, err
 	}
 
-	for _, email := range userEmails {
+	oauthUser.Email, oauthUser.EmailVerified = selectGithubEmail(userEmails)
+	return &oauthUser, nil
+}
+
+// Prefers the primary email, but only if it is verified. Falls back to any other verified email.
+// An unverified primary email is returned only when the account has no verified email at all.
+func selectGithubEmail(emails []MailResponseItem) (string, bool) {
+	var primary string
+	for _, email := range emails {
 		if email.Primary {
-			githubUser.Email = email.Email
-			break
+			if email.Verified {
+				return email.Email, true
+			}
+			primary = email.Email
+		}
+	}
+
+	for _, email := range emails {
+		if email.Verified {
+			return email.Email, true
 		}
 	}
 
-	return &githubUser, nil
+	return primary, false
 }
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"errors"
+	"html/template"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/humanbeeng/checkpost/server/config"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/audit"
+)
+
+const ProviderDev = "dev"
+
+var devUsernameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,38}$`)
+
+var devLoginPage = template.Must(template.New("dev").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>Checkpost dev sign in</title></head>
+<body style="font-family: sans-serif; max-width: 32rem; margin: 2rem auto;">
+	<h1>Dev sign in</h1>
+	<p>Development auth mode is enabled. Do not use in production.</p>
+	<h2>Existing users</h2>
+	{{range .}}
+	<form method="post" action="/auth/dev/login">
+		<input type="hidden" name="username" value="{{.Username}}">
+		<input type="hidden" name="email" value="{{.Email}}">
+		<button type="submit">{{.Username}}</button> {{.Email}} ({{.Plan}})
+	</form>
+	{{else}}
+	<p>No users yet.</p>
+	{{end}}
+	<h2>New user</h2>
+	<form method="post" action="/auth/dev/login">
+		<input name="username" placeholder="username" required>
+		<input name="email" placeholder="email (optional)">
+		<button type="submit">Sign in</button>
+	</form>
+</body>
+</html>
+`))
+
+// Signs in as any local user without an identity provider.
+// Tokens are issued through regular sessions, so protected routes behave exactly as in production.
+type DevAuthHandler struct {
+	devq       DevQuerier
+	identities *IdentityService
+	sessions   *SessionService
+	audit      *audit.AuditService
+}
+
+func NewDevAuthHandler(config *config.AppConfig, devq DevQuerier, identities *IdentityService, sessions *SessionService, audit *audit.AuditService) (*DevAuthHandler, error) {
+	if config.Production {
+		return nil, errors.New("dev auth cannot be enabled in production")
+	}
+
+	slog.Warn("Dev auth is enabled. Anyone can sign in as any user at /auth/dev")
+	return &DevAuthHandler{
+		devq:       devq,
+		identities: identities,
+		sessions:   sessions,
+		audit:      audit,
+	}, nil
+}
+
+func (dh *DevAuthHandler) RegisterRoutes(app *fiber.App) {
+	app.Get("/auth/dev", dh.LoginPageHandler)
+	app.Post("/auth/dev/login", dh.LoginHandler)
+}
+
+type DevLoginRequest struct {
+	Username string `json:"username" form:"username"`
+	Email    string `json:"email" form:"email"`
+}
+
+func (dh *DevAuthHandler) LoginPageHandler(c *fiber.Ctx) error {
+	users, err := dh.devq.ListUsers(c.UserContext(), db.ListUsersParams{Limit: 50, Offset: 0})
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "unable to list users", "err", err)
+		return fiber.ErrInternalServerError
+	}
+
+	c.Type("html")
+	return devLoginPage.Execute(c, users)
+}
+
+// Signs in as the user with the username, creating it when missing.
+// The access token is also set as cookie, so the API can be used straight from the browser.
+func (dh *DevAuthHandler) LoginHandler(c *fiber.Ctx) error {
+	var req DevLoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	req.Username = strings.ToLower(strings.TrimSpace(req.Username))
+	if !devUsernameRegex.MatchString(req.Username) {
+		return &fiber.Error{
+			Code:    fiber.StatusBadRequest,
+			Message: "Username should be lowercase alphanumeric and at most 39 chars.",
+		}
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		email = req.Username + "@checkpost.local"
+	}
+	email, ok := normalizeEmail(email)
+	if !ok {
+		return &fiber.Error{
+			Code:    fiber.StatusBadRequest,
+			Message: "Invalid email address.",
+		}
+	}
+
+	slog.InfoContext(c.UserContext(), "Received dev login request", "username", req.Username)
+
+	user, authErr := dh.identities.SignIn(c.UserContext(), OAuthUser{
+		Name:          req.Username,
+		Username:      req.Username,
+		Email:         email,
+		Provider:      ProviderDev,
+		Subject:       req.Username,
+		EmailVerified: true,
+	})
+	if authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
+	}
+
+	tokens, authErr := dh.sessions.CreateSession(c.UserContext(), user, c.Get(fiber.HeaderUserAgent), c.IP())
+	if authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
+	}
+
+	dh.audit.Record(c.UserContext(), loginEntry(c, tokens, ProviderDev))
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "token",
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		Expires:  tokens.ExpiresAt,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return c.JSON(AuthResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+		Name:         user.Name,
+		Username:     user.Username,
+		Email:        user.Email,
+		AvatarUrl:    user.AvatarUrl,
+	})
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/humanbeeng/checkpost/server/config"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/audit"
+	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/humanbeeng/checkpost/server/internal/core/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockDevStore struct {
+	*MockIdentityStore
+}
+
+func (ds MockDevStore) ListUsers(ctx context.Context, params db.ListUsersParams) ([]db.User, error) {
+	var users []db.User
+	for _, u := range ds.users {
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+type MockAuditStore struct {
+	entries []db.InsertAuditLogParams
+}
+
+func (as *MockAuditStore) InsertAuditLog(ctx context.Context, params db.InsertAuditLogParams) error {
+	as.entries = append(as.entries, params)
+	return nil
+}
+
+func (as *MockAuditStore) ListUserAuditLog(ctx context.Context, params db.ListUserAuditLogParams) ([]db.AuditLog, error) {
+	return []db.AuditLog{}, nil
+}
+
+func (as *MockAuditStore) ListAuditLog(ctx context.Context, params db.ListAuditLogParams) ([]db.AuditLog, error) {
+	return []db.AuditLog{}, nil
+}
+
+func TestDevAuthRefusedInProduction(t *testing.T) {
+	_, err := NewDevAuthHandler(&config.AppConfig{Production: true}, nil, nil, nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestDevLoginReachesProtectedRoutes(t *testing.T) {
+	pv, err := core.NewPasetoVerifier("01234567890123456789012345678901")
+	assert.Nil(t, err)
+
+	identityStore := newMockIdentityStore()
+	sessions := NewSessionService(newMockSessionStore(), pv, "01234567890123456789012345678901")
+	auditStore := &MockAuditStore{}
+	dh, err := NewDevAuthHandler(&config.AppConfig{}, MockDevStore{identityStore}, NewIdentityService(identityStore), sessions, audit.NewAuditService(auditStore))
+	assert.Nil(t, err)
+
+	app := fiber.New()
+	dh.RegisterRoutes(app)
+	app.Get("/protected", middleware.NewAuthRequiredMiddleware(pv, sessions), func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("username").(string))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/dev/login", strings.NewReader("username=alice"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var authRes AuthResponse
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&authRes))
+	assert.Equal(t, "alice@checkpost.local", authRes.Email)
+
+	req = httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: authRes.Token})
+	res, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// The sign in is audited without recording any token
+	assert.Len(t, auditStore.entries, 1)
+	assert.Equal(t, string(audit.ActionLogin), auditStore.entries[0].Action)
+	assert.True(t, auditStore.entries[0].ActorID.Valid)
+	assert.NotContains(t, string(auditStore.entries[0].After), authRes.Token)
+	assert.NotContains(t, string(auditStore.entries[0].After), authRes.RefreshToken)
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/dev", nil)
+	res, err = app.Test(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// Signing in again picks the same user
+	req = httptest.NewRequest(http.MethodPost, "/auth/dev/login", strings.NewReader(`{"username":"alice"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, _ = app.Test(req)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, identityStore.users, 1)
+}
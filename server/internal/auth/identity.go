@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/jackc/pgx/v5"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const (
+	maxUsernameAttempts    = 5
+	usernameSuffixAlphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+	usernameSuffixLength   = 4
+	// Leaves room for the suffix within the 60 characters of a username
+	maxUsernameBaseLength = 55
+)
+
+type IdentityInfo struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Maps provider accounts to users. A user can sign in with any of their linked providers.
+type IdentityService struct {
+	identityq IdentityQuerier
+}
+
+func NewIdentityService(identityq IdentityQuerier) *IdentityService {
+	return &IdentityService{
+		identityq: identityq,
+	}
+}
+
+// Resolves the user for a provider account, creating one on first sign in.
+// Accounts without a linked identity are matched by email, but only if the provider verified it.
+func (s *IdentityService) SignIn(ctx context.Context, oauthUser OAuthUser) (db.User, *AuthError) {
+	identity, err := s.identityq.GetIdentity(ctx, db.GetIdentityParams{
+		Provider: oauthUser.Provider,
+		Subject:  oauthUser.Subject,
+	})
+	if err == nil {
+		user, err := s.identityq.GetUser(ctx, identity.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "unable to get user of identity", "provider", identity.Provider, "userId", identity.UserID, "err", err)
+			return db.User{}, NewInternalServerError()
+		}
+		slog.InfoContext(ctx, "Logging in existing user", "username", user.Username, "provider", oauthUser.Provider)
+		return user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		slog.ErrorContext(ctx, "unable to get identity", "provider", oauthUser.Provider, "err", err)
+		return db.User{}, NewInternalServerError()
+	}
+
+	if oauthUser.Email == "" || !oauthUser.EmailVerified {
+		slog.WarnContext(ctx, "Sign in without verified email", "provider", oauthUser.Provider, "username", oauthUser.Username)
+		return db.User{}, &AuthError{
+			Code:    http.StatusForbidden,
+			Message: fmt.Sprintf("Please verify your email address with %s before signing in.", oauthUser.Provider),
+		}
+	}
+
+	var user db.User
+	err = s.identityq.WithTx(ctx, func(q IdentityQuerier) error {
+		var err error
+		user, err = q.GetUserFromEmail(ctx, oauthUser.Email)
+		if err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return err
+			}
+			slog.InfoContext(ctx, "Creating new user", "username", oauthUser.Username, "email", oauthUser.Email)
+			user, err = createUser(ctx, q, oauthUser)
+			if err != nil {
+				return err
+			}
+		} else {
+			slog.InfoContext(ctx, "Linking provider to existing user by email", "username", user.Username, "provider", oauthUser.Provider)
+		}
+
+		_, err = q.CreateIdentity(ctx, db.CreateIdentityParams{
+			UserID:   user.ID,
+			Provider: oauthUser.Provider,
+			Subject:  oauthUser.Subject,
+			Email:    oauthUser.Email,
+		})
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to sign in user", "provider", oauthUser.Provider, "err", err)
+		return db.User{}, NewInternalServerError()
+	}
+
+	return user, nil
+}
+
+// Creates the user with the username of the provider account. When that is taken, e.g. by another user
+// of the same name on another provider, a random suffix is appended to it.
+func createUser(ctx context.Context, q IdentityQuerier, oauthUser OAuthUser) (db.User, error) {
+	for attempt := 0; attempt < maxUsernameAttempts; attempt++ {
+		username, err := usernameCandidate(oauthUser.Username, attempt)
+		if err != nil {
+			return db.User{}, err
+		}
+
+		user, err := q.CreateUser(ctx, db.CreateUserParams{
+			Name:      oauthUser.Name,
+			AvatarUrl: oauthUser.AvatarUrl,
+			Username:  username,
+			Plan:      db.PlanFree,
+			Email:     oauthUser.Email,
+		})
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return db.User{}, err
+		}
+		slog.InfoContext(ctx, "Username taken. Trying another one", "username", username)
+	}
+	return db.User{}, fmt.Errorf("no free username for %s after %d attempts", oauthUser.Username, maxUsernameAttempts)
+}
+
+// The first candidate is the username itself. Later ones append a random suffix, to the local part of
+// email addresses so that no other address is taken.
+func usernameCandidate(username string, attempt int) (string, error) {
+	if attempt == 0 {
+		return username, nil
+	}
+
+	base, _, _ := strings.Cut(username, "@")
+	if len(base) > maxUsernameBaseLength {
+		base = base[:maxUsernameBaseLength]
+	}
+	suffix, err := gonanoid.Generate(usernameSuffixAlphabet, usernameSuffixLength)
+	if err != nil {
+		return "", err
+	}
+	return base + "-" + suffix, nil
+}
+
+// Links a provider account to an already signed in user.
+func (s *IdentityService) Link(ctx context.Context, userId int64, oauthUser OAuthUser) *AuthError {
+	identity, err := s.identityq.GetIdentity(ctx, db.GetIdentityParams{
+		Provider: oauthUser.Provider,
+		Subject:  oauthUser.Subject,
+	})
+	if err == nil {
+		if identity.UserID == userId {
+			return nil
+		}
+		slog.WarnContext(ctx, "Provider account already linked to another user", "provider", oauthUser.Provider, "userId", userId)
+		return &AuthError{
+			Code:    http.StatusConflict,
+			Message: fmt.Sprintf("This %s account is already linked to another user.", oauthUser.Provider),
+		}
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		slog.ErrorContext(ctx, "unable to get identity", "provider", oauthUser.Provider, "err", err)
+		return NewInternalServerError()
+	}
+
+	identities, err := s.identityq.ListUserIdentities(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list identities", "userId", userId, "err", err)
+		return NewInternalServerError()
+	}
+	for _, identity := range identities {
+		if identity.Provider == oauthUser.Provider {
+			return &AuthError{
+				Code:    http.StatusConflict,
+				Message: fmt.Sprintf("Another %s account is already linked. Unlink it first.", oauthUser.Provider),
+			}
+		}
+	}
+
+	_, err = s.identityq.CreateIdentity(ctx, db.CreateIdentityParams{
+		UserID:   userId,
+		Provider: oauthUser.Provider,
+		Subject:  oauthUser.Subject,
+		Email:    oauthUser.Email,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to link identity", "userId", userId, "provider", oauthUser.Provider, "err", err)
+		return NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Linked provider", "userId", userId, "provider", oauthUser.Provider)
+	return nil
+}
+
+// Unlinks a provider. The last linked provider cannot be removed, as the user would be locked out.
+func (s *IdentityService) Unlink(ctx context.Context, userId int64, provider string) *AuthError {
+	identities, err := s.identityq.ListUserIdentities(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list identities", "userId", userId, "err", err)
+		return NewInternalServerError()
+	}
+
+	linked := false
+	for _, identity := range identities {
+		if identity.Provider == provider {
+			linked = true
+			break
+		}
+	}
+	if !linked {
+		return &AuthError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("%s is not linked to your account.", provider),
+		}
+	}
+
+	if len(identities) == 1 {
+		return &AuthError{
+			Code:    http.StatusBadRequest,
+			Message: "Cannot unlink the only sign in method of your account.",
+		}
+	}
+
+	if _, err := s.identityq.DeleteIdentity(ctx, db.DeleteIdentityParams{UserID: userId, Provider: provider}); err != nil {
+		slog.ErrorContext(ctx, "unable to unlink identity", "userId", userId, "provider", provider, "err", err)
+		return NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Unlinked provider", "userId", userId, "provider", provider)
+	return nil
+}
+
+func (s *IdentityService) ListIdentities(ctx context.Context, userId int64) ([]IdentityInfo, *AuthError) {
+	identities, err := s.identityq.ListUserIdentities(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list identities", "userId", userId, "err", err)
+		return nil, NewInternalServerError()
+	}
+
+	infos := make([]IdentityInfo, 0, len(identities))
+	for _, identity := range identities {
+		infos = append(infos, IdentityInfo{
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt.Time,
+		})
+	}
+	return infos, nil
+}
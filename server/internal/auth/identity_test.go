@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockIdentityStore struct {
+	users      map[int64]db.User
+	identities []db.Identity
+}
+
+func newMockIdentityStore() *MockIdentityStore {
+	return &MockIdentityStore{users: map[int64]db.User{}}
+}
+
+func (is *MockIdentityStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	u, ok := is.users[userId]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	return u, nil
+}
+
+func (is *MockIdentityStore) GetUserFromEmail(ctx context.Context, email string) (db.User, error) {
+	for _, u := range is.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return db.User{}, pgx.ErrNoRows
+}
+
+func (is *MockIdentityStore) CreateUser(ctx context.Context, params db.CreateUserParams) (db.User, error) {
+	for _, u := range is.users {
+		if u.Username == params.Username {
+			return db.User{}, pgx.ErrNoRows
+		}
+	}
+	u := db.User{
+		ID:       int64(len(is.users) + 1),
+		Name:     params.Name,
+		Username: params.Username,
+		Email:    params.Email,
+		Plan:     params.Plan,
+	}
+	is.users[u.ID] = u
+	return u, nil
+}
+
+func (is *MockIdentityStore) CreateIdentity(ctx context.Context, params db.CreateIdentityParams) (db.Identity, error) {
+	identity := db.Identity{
+		ID:       int64(len(is.identities) + 1),
+		UserID:   params.UserID,
+		Provider: params.Provider,
+		Subject:  params.Subject,
+		Email:    params.Email,
+	}
+	is.identities = append(is.identities, identity)
+	return identity, nil
+}
+
+func (is *MockIdentityStore) GetIdentity(ctx context.Context, params db.GetIdentityParams) (db.Identity, error) {
+	for _, identity := range is.identities {
+		if identity.Provider == params.Provider && identity.Subject == params.Subject {
+			return identity, nil
+		}
+	}
+	return db.Identity{}, pgx.ErrNoRows
+}
+
+func (is *MockIdentityStore) ListUserIdentities(ctx context.Context, userId int64) ([]db.Identity, error) {
+	var identities []db.Identity
+	for _, identity := range is.identities {
+		if identity.UserID == userId {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (is *MockIdentityStore) DeleteIdentity(ctx context.Context, params db.DeleteIdentityParams) (int64, error) {
+	for i, identity := range is.identities {
+		if identity.UserID == params.UserID && identity.Provider == params.Provider {
+			is.identities = append(is.identities[:i], is.identities[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (is *MockIdentityStore) WithTx(ctx context.Context, fn func(IdentityQuerier) error) error {
+	return fn(is)
+}
+
+var (
+	githubUser = OAuthUser{Provider: ProviderGithub, Subject: "42", Username: "octocat", Email: "octo@example.com", EmailVerified: true}
+	googleUser = OAuthUser{Provider: ProviderGoogle, Subject: "g-1", Username: "other@example.com", Email: "other@example.com", EmailVerified: true}
+)
+
+func TestSignInCreatesUserOnce(t *testing.T) {
+	store := newMockIdentityStore()
+	s := NewIdentityService(store)
+
+	user, authErr := s.SignIn(context.TODO(), githubUser)
+	assert.Nil(t, authErr)
+	assert.Equal(t, "octocat", user.Username)
+
+	// Email changed at the provider, the identity still resolves to the same user
+	renamed := githubUser
+	renamed.Email = "new@example.com"
+	again, authErr := s.SignIn(context.TODO(), renamed)
+	assert.Nil(t, authErr)
+	assert.Equal(t, user.ID, again.ID)
+	assert.Len(t, store.users, 1)
+}
+
+func TestSignInWithTakenUsername(t *testing.T) {
+	store := newMockIdentityStore()
+	s := NewIdentityService(store)
+
+	_, authErr := s.SignIn(context.TODO(), githubUser)
+	assert.Nil(t, authErr)
+
+	// Another person with the same username on another provider
+	oidcUser := OAuthUser{Provider: "keycloak", Subject: "k-1", Username: "octocat", Email: "cat@corp.example.com", EmailVerified: true}
+	user, authErr := s.SignIn(context.TODO(), oidcUser)
+	assert.Nil(t, authErr)
+	assert.Regexp(t, `^octocat-[0-9a-z]{4}$`, user.Username)
+
+	// Someone named after the address of a later email sign up
+	store.users[99] = db.User{ID: 99, Username: "late@example.com", Email: "first@example.com"}
+	emailUser := OAuthUser{Provider: ProviderEmail, Subject: "late@example.com", Username: "late@example.com", Email: "late@example.com", EmailVerified: true}
+	user, authErr = s.SignIn(context.TODO(), emailUser)
+	assert.Nil(t, authErr)
+	assert.Regexp(t, `^late-[0-9a-z]{4}$`, user.Username)
+}
+
+func TestSignInMatchesVerifiedEmailOnly(t *testing.T) {
+	store := newMockIdentityStore()
+	s := NewIdentityService(store)
+	store.users[1] = db.User{ID: 1, Username: "existing", Email: "octo@example.com"}
+
+	unverified := githubUser
+	unverified.EmailVerified = false
+	_, authErr := s.SignIn(context.TODO(), unverified)
+	assert.Equal(t, http.StatusForbidden, authErr.Code)
+	assert.Empty(t, store.identities)
+
+	user, authErr := s.SignIn(context.TODO(), githubUser)
+	assert.Nil(t, authErr)
+	assert.Equal(t, int64(1), user.ID)
+	assert.Len(t, store.identities, 1)
+}
+
+func TestLinkAndUnlink(t *testing.T) {
+	store := newMockIdentityStore()
+	s := NewIdentityService(store)
+
+	user, _ := s.SignIn(context.TODO(), githubUser)
+
+	authErr := s.Unlink(context.TODO(), user.ID, ProviderGithub)
+	assert.Equal(t, http.StatusBadRequest, authErr.Code)
+
+	assert.Nil(t, s.Link(context.TODO(), user.ID, googleUser))
+
+	// Google account with a different email now signs in to the same user
+	linked, authErr := s.SignIn(context.TODO(), googleUser)
+	assert.Nil(t, authErr)
+	assert.Equal(t, user.ID, linked.ID)
+
+	other, _ := s.SignIn(context.TODO(), OAuthUser{Provider: ProviderGithub, Subject: "7", Username: "x", Email: "x@example.com", EmailVerified: true})
+	authErr = s.Link(context.TODO(), other.ID, googleUser)
+	assert.Equal(t, http.StatusConflict, authErr.Code)
+
+	assert.Nil(t, s.Unlink(context.TODO(), user.ID, ProviderGithub))
+	identities, _ := s.ListIdentities(context.TODO(), user.ID)
+	assert.Len(t, identities, 1)
+	assert.Equal(t, ProviderGoogle, identities[0].Provider)
+}
+
+func TestSelectGithubEmail(t *testing.T) {
+	email, verified := selectGithubEmail([]MailResponseItem{
+		{Email: "primary@example.com", Primary: true, Verified: false},
+		{Email: "work@example.com", Verified: true},
+	})
+	assert.Equal(t, "work@example.com", email)
+	assert.True(t, verified)
+
+	email, verified = selectGithubEmail([]MailResponseItem{
+		{Email: "primary@example.com", Primary: true, Verified: false},
+	})
+	assert.Equal(t, "primary@example.com", email)
+	assert.False(t, verified)
+}
+
+func TestOAuthState(t *testing.T) {
+	key := "01234567890123456789012345678901"
+	signer := newStateSigner(key)
+
+	token, err := signer.Create(OAuthState{Provider: ProviderGithub, Nonce: "n", Verifier: "v", LinkUserId: 3})
+	assert.Nil(t, err)
+
+	state, err := signer.Verify(token)
+	assert.Nil(t, err)
+	assert.Equal(t, OAuthState{Provider: ProviderGithub, Nonce: "n", Verifier: "v", LinkUserId: 3}, state)
+
+	_, err = signer.Verify(token[:len(token)-2])
+	assert.NotNil(t, err)
+
+	// A state signed with another key is rejected
+	_, err = newStateSigner("abcdefghijabcdefghijabcdefghijab").Verify(token)
+	assert.NotNil(t, err)
+}
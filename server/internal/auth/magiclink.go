@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	checkpostmail "github.com/humanbeeng/checkpost/server/internal/mail"
+	"github.com/jackc/pgx/v5"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/o1egl/paseto"
+)
+
+const (
+	ProviderEmail = "email"
+
+	MagicLinkDuration = 15 * time.Minute
+	// Links that can be requested per email address and per source IP within magicLinkWindow
+	magicLinksPerEmail = 5
+	magicLinksPerIp    = 20
+	magicLinkWindow    = time.Hour
+	// Matches the size of the email column of user
+	maxEmailLength = 60
+)
+
+// Passwordless sign in through single use links sent by mail.
+type MagicLinkService struct {
+	linkq      MagicLinkQuerier
+	identities *IdentityService
+	mailer     checkpostmail.Mailer
+	linkUrl    string
+	key        []byte
+	paseto     *paseto.V2
+	now        func() time.Time
+}
+
+func NewMagicLinkService(linkq MagicLinkQuerier, identities *IdentityService, mailer checkpostmail.Mailer, linkUrl string, tokenKey string) *MagicLinkService {
+	return &MagicLinkService{
+		linkq:      linkq,
+		identities: identities,
+		mailer:     mailer,
+		linkUrl:    linkUrl,
+		key:        deriveKey("magic-link", tokenKey),
+		paseto:     paseto.NewV2(),
+		now:        time.Now,
+	}
+}
+
+// Mails a sign in link to the address. Whether an account exists for it is never revealed.
+func (s *MagicLinkService) SendLink(ctx context.Context, email string, ip string) *AuthError {
+	email, ok := normalizeEmail(email)
+	if !ok {
+		return &AuthError{
+			Code:    http.StatusBadRequest,
+			Message: "Please enter a valid email address.",
+		}
+	}
+
+	now := s.now()
+	counts, err := s.linkq.CountRecentMagicLinks(ctx, db.CountRecentMagicLinksParams{
+		Email: email,
+		Ip:    ip,
+		Since: timestamptz(now.Add(-magicLinkWindow)),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to count recent magic links", "err", err)
+		return NewInternalServerError()
+	}
+	if counts.EmailCount >= magicLinksPerEmail || counts.IpCount >= magicLinksPerIp {
+		slog.WarnContext(ctx, "Magic link rate limit exceeded", "ip", ip, "email_count", counts.EmailCount, "ip_count", counts.IpCount)
+		return &AuthError{
+			Code:    http.StatusTooManyRequests,
+			Message: "Too many sign in links requested. Please try again later.",
+		}
+	}
+
+	id, err := gonanoid.New()
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to generate magic link id", "err", err)
+		return NewInternalServerError()
+	}
+
+	expiresAt := now.Add(MagicLinkDuration)
+	jt := paseto.JSONToken{
+		Issuer:     "checkpost",
+		Audience:   "magic_link",
+		Jti:        id,
+		Subject:    email,
+		IssuedAt:   now,
+		Expiration: expiresAt,
+	}
+	token, err := s.paseto.Encrypt(s.key, jt, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to create magic link token", "err", err)
+		return NewInternalServerError()
+	}
+
+	err = s.linkq.CreateMagicLink(ctx, db.CreateMagicLinkParams{
+		ID:        id,
+		Email:     email,
+		Ip:        ip,
+		ExpiresAt: timestamptz(expiresAt),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to store magic link", "err", err)
+		return NewInternalServerError()
+	}
+
+	link, err := url.Parse(s.linkUrl)
+	if err != nil {
+		slog.ErrorContext(ctx, "invalid magic link url", "err", err)
+		return NewInternalServerError()
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	err = s.mailer.Send(ctx, checkpostmail.Message{
+		To:      email,
+		Subject: "Sign in to Checkpost",
+		Body: fmt.Sprintf("Click the link below to sign in to Checkpost. It expires in %d minutes and can be used once.\n\n%s\n\nIf you did not request this, you can ignore this email.\n",
+			int(MagicLinkDuration.Minutes()), link.String()),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to send magic link", "err", err)
+		return NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Sent magic link", "linkId", id)
+	return nil
+}
+
+// Redeems a link and returns the user it signs in, creating one on first sign in.
+func (s *MagicLinkService) Redeem(ctx context.Context, token string) (db.User, *AuthError) {
+	invalid := &AuthError{
+		Code:    http.StatusUnauthorized,
+		Message: "Sign in link is invalid or has expired. Please request a new one.",
+	}
+
+	var jt paseto.JSONToken
+	if err := s.paseto.Decrypt(token, s.key, &jt, nil); err != nil {
+		slog.WarnContext(ctx, "Invalid magic link token", "err", err)
+		return db.User{}, invalid
+	}
+	if jt.Audience != "magic_link" || s.now().After(jt.Expiration) {
+		return db.User{}, invalid
+	}
+
+	email, err := s.linkq.UseMagicLink(ctx, jt.Jti)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.WarnContext(ctx, "Magic link already used or expired", "linkId", jt.Jti)
+			return db.User{}, invalid
+		}
+		slog.ErrorContext(ctx, "unable to use magic link", "err", err)
+		return db.User{}, NewInternalServerError()
+	}
+
+	name, _, _ := strings.Cut(email, "@")
+	return s.identities.SignIn(ctx, OAuthUser{
+		Name:          name,
+		Username:      email,
+		Email:         email,
+		Provider:      ProviderEmail,
+		Subject:       email,
+		EmailVerified: true,
+	})
+}
+
+func (s *MagicLinkService) RemoveExpiredLinks(ctx context.Context) (int64, error) {
+	return s.linkq.DeleteExpiredMagicLinks(ctx)
+}
+
+func normalizeEmail(email string) (string, bool) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Name != "" || len(addr.Address) > maxEmailLength {
+		return "", false
+	}
+	return strings.ToLower(addr.Address), true
+}
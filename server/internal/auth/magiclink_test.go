@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/mail"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockMagicLinkStore struct {
+	links map[string]db.CreateMagicLinkParams
+	used  map[string]bool
+}
+
+func (ms *MockMagicLinkStore) CreateMagicLink(ctx context.Context, params db.CreateMagicLinkParams) error {
+	ms.links[params.ID] = params
+	return nil
+}
+
+func (ms *MockMagicLinkStore) CountRecentMagicLinks(ctx context.Context, params db.CountRecentMagicLinksParams) (db.CountRecentMagicLinksRow, error) {
+	var row db.CountRecentMagicLinksRow
+	for _, link := range ms.links {
+		if link.Email == params.Email {
+			row.EmailCount++
+		}
+		if link.Ip == params.Ip {
+			row.IpCount++
+		}
+	}
+	return row, nil
+}
+
+func (ms *MockMagicLinkStore) UseMagicLink(ctx context.Context, id string) (string, error) {
+	link, ok := ms.links[id]
+	if !ok || ms.used[id] || link.ExpiresAt.Time.Before(time.Now()) {
+		return "", pgx.ErrNoRows
+	}
+	ms.used[id] = true
+	return link.Email, nil
+}
+
+func (ms *MockMagicLinkStore) DeleteExpiredMagicLinks(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+type capturingMailer struct {
+	sent []mail.Message
+}
+
+func (m *capturingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newTestMagicLinkService() (*MagicLinkService, *capturingMailer) {
+	mailer := &capturingMailer{}
+	store := &MockMagicLinkStore{links: map[string]db.CreateMagicLinkParams{}, used: map[string]bool{}}
+	identities := NewIdentityService(newMockIdentityStore())
+	return NewMagicLinkService(store, identities, mailer, "http://localhost:5173/auth/email/callback", "01234567890123456789012345678901"), mailer
+}
+
+func tokenFromMail(t *testing.T, msg mail.Message) string {
+	link := regexp.MustCompile(`http\S+`).FindString(msg.Body)
+	u, err := url.Parse(link)
+	assert.Nil(t, err)
+	return u.Query().Get("token")
+}
+
+func TestMagicLinkIsSingleUse(t *testing.T) {
+	s, mailer := newTestMagicLinkService()
+
+	assert.Nil(t, s.SendLink(context.TODO(), " Contractor@Example.com ", "10.0.0.1"))
+	assert.Len(t, mailer.sent, 1)
+	assert.Equal(t, "contractor@example.com", mailer.sent[0].To)
+
+	token := tokenFromMail(t, mailer.sent[0])
+	user, authErr := s.Redeem(context.TODO(), token)
+	assert.Nil(t, authErr)
+	assert.Equal(t, "contractor@example.com", user.Email)
+
+	_, authErr = s.Redeem(context.TODO(), token)
+	assert.Equal(t, http.StatusUnauthorized, authErr.Code)
+}
+
+func TestMagicLinkExpires(t *testing.T) {
+	s, mailer := newTestMagicLinkService()
+
+	assert.Nil(t, s.SendLink(context.TODO(), "contractor@example.com", "10.0.0.1"))
+	token := tokenFromMail(t, mailer.sent[0])
+
+	s.now = func() time.Time { return time.Now().Add(MagicLinkDuration + time.Second) }
+	_, authErr := s.Redeem(context.TODO(), token)
+	assert.Equal(t, http.StatusUnauthorized, authErr.Code)
+}
+
+func TestMagicLinkRateLimit(t *testing.T) {
+	s, mailer := newTestMagicLinkService()
+
+	for i := 0; i < magicLinksPerEmail; i++ {
+		assert.Nil(t, s.SendLink(context.TODO(), "contractor@example.com", "10.0.0.1"))
+	}
+	authErr := s.SendLink(context.TODO(), "contractor@example.com", "10.0.0.2")
+	assert.Equal(t, http.StatusTooManyRequests, authErr.Code)
+	assert.Len(t, mailer.sent, magicLinksPerEmail)
+}
+
+func TestMagicLinkRejectsInvalidEmail(t *testing.T) {
+	s, _ := newTestMagicLinkService()
+
+	for _, email := range []string{"", "not-an-email", "Name <a@example.com>"} {
+		authErr := s.SendLink(context.TODO(), email, "10.0.0.1")
+		assert.Equal(t, http.StatusBadRequest, authErr.Code, email)
+	}
+}
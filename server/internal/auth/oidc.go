@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/humanbeeng/checkpost/server/config"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcDiscoveryTimeout = 10 * time.Second
+	// Failed discoveries are retried by the next sign in after this interval.
+	oidcDiscoveryRetryInterval = 30 * time.Second
+)
+
+var ErrProviderUnavailable = errors.New("oauth provider is unavailable")
+
+// Discovers an OpenID Connect provider on first use. Until discovery succeeds only this provider is
+// unavailable, it is retried by later sign ins.
+type oidcDiscovery struct {
+	name   string
+	issuer string
+	scopes []string
+	config oauth2.Config
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	failedAt time.Time
+	err      error
+}
+
+func (d *oidcDiscovery) discover() (*oidc.Provider, *oidc.IDTokenVerifier, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.provider != nil {
+		return d.provider, d.verifier, nil
+	}
+	if !d.failedAt.IsZero() && time.Since(d.failedAt) < oidcDiscoveryRetryInterval {
+		return nil, nil, d.err
+	}
+
+	// The context is kept by the provider to fetch signing keys later on, so it must not be cancelled.
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: oidcDiscoveryTimeout})
+	provider, err := oidc.NewProvider(ctx, d.issuer)
+	if err != nil {
+		slog.Warn("unable to discover oidc provider", "provider", d.name, "issuer", d.issuer, "err", err)
+		d.failedAt = time.Now()
+		d.err = fmt.Errorf("%w: unable to discover oidc provider %s: %w", ErrProviderUnavailable, d.name, err)
+		return nil, nil, d.err
+	}
+
+	d.provider = provider
+	d.verifier = provider.Verifier(&oidc.Config{ClientID: d.config.ClientID})
+	d.config.Endpoint = provider.Endpoint()
+	d.failedAt, d.err = time.Time{}, nil
+	slog.Info("Discovered oidc provider", "provider", d.name, "issuer", d.issuer)
+	return d.provider, d.verifier, nil
+}
+
+func (d *oidcDiscovery) oauthConfig(ctx context.Context) (*oauth2.Config, error) {
+	if _, _, err := d.discover(); err != nil {
+		return nil, err
+	}
+	return &d.config, nil
+}
+
+// Sets up an OpenID Connect provider. Its discovery document is fetched on first use and
+// ID tokens are validated against the keys published by the issuer.
+func newOidcProvider(name string, cfg config.OidcProvider) (*oauthProvider, error) {
+	if cfg.Issuer == "" || cfg.ClientId == "" {
+		return nil, fmt.Errorf("oidc provider %s requires an issuer and a client id", name)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+
+	d := &oidcDiscovery{
+		name:   name,
+		issuer: cfg.Issuer,
+		config: oauth2.Config{
+			ClientID:     cfg.ClientId,
+			ClientSecret: cfg.Secret,
+			RedirectURL:  cfg.RedirectUrl,
+			Scopes:       scopes,
+		},
+	}
+
+	fetchUser := func(ctx context.Context, token *oauth2.Token, nonce string) (*OAuthUser, error) {
+		provider, verifier, err := d.discover()
+		if err != nil {
+			return nil, err
+		}
+
+		rawIdToken, ok := token.Extra("id_token").(string)
+		if !ok {
+			return nil, fmt.Errorf("token response of %s has no id_token", name)
+		}
+
+		idToken, err := verifier.Verify(ctx, rawIdToken)
+		if err != nil {
+			return nil, err
+		}
+
+		if idToken.Nonce != nonce {
+			return nil, fmt.Errorf("id token nonce mismatch")
+		}
+
+		claims := make(map[string]any)
+		if err := idToken.Claims(&claims); err != nil {
+			return nil, err
+		}
+
+		// Some providers only put profile claims in the userinfo response
+		if claimString(claims, claimOrDefault(cfg.EmailClaim, "email")) == "" {
+			mergeUserInfoClaims(ctx, name, provider, token, idToken.Subject, claims)
+		}
+
+		oauthUser := mapOidcClaims(claims, cfg)
+		oauthUser.Subject = idToken.Subject
+		return &oauthUser, nil
+	}
+
+	return &oauthProvider{
+		name:        name,
+		oidc:        true,
+		oauthConfig: d.oauthConfig,
+		fetchUser:   fetchUser,
+	}, nil
+}
+
+// Adds the userinfo claims missing from the ID token. The response is only used if it is about the
+// subject of the ID token.
+func mergeUserInfoClaims(ctx context.Context, name string, provider *oidc.Provider, token *oauth2.Token, subject string, claims map[string]any) {
+	userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+	if err != nil {
+		slog.WarnContext(ctx, "unable to fetch oidc userinfo", "provider", name, "err", err)
+		return
+	}
+
+	if userInfo.Subject != subject {
+		slog.WarnContext(ctx, "Ignoring oidc userinfo of another subject", "provider", name)
+		return
+	}
+
+	userInfoClaims := make(map[string]any)
+	if err := userInfo.Claims(&userInfoClaims); err != nil {
+		slog.WarnContext(ctx, "unable to parse oidc userinfo", "provider", name, "err", err)
+		return
+	}
+	for k, v := range userInfoClaims {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+}
+
+func mapOidcClaims(claims map[string]any, cfg config.OidcProvider) OAuthUser {
+	user := OAuthUser{
+		Username:  claimString(claims, claimOrDefault(cfg.UsernameClaim, "preferred_username")),
+		Email:     claimString(claims, claimOrDefault(cfg.EmailClaim, "email")),
+		Name:      claimString(claims, claimOrDefault(cfg.NameClaim, "name")),
+		AvatarUrl: claimString(claims, claimOrDefault(cfg.AvatarClaim, "picture")),
+	}
+
+	if verified, ok := claims["email_verified"]; ok {
+		user.EmailVerified = claimBool(verified)
+	} else {
+		user.EmailVerified = cfg.TrustEmail
+	}
+
+	if user.Username == "" {
+		user.Username = user.Email
+	}
+	if user.Name == "" {
+		user.Name = user.Username
+	}
+	return user
+}
+
+func claimOrDefault(claim string, def string) string {
+	if claim == "" {
+		return def
+	}
+	return claim
+}
+
+func claimString(claims map[string]any, claim string) string {
+	if v, ok := claims[claim].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// Some providers send booleans as strings.
+func claimBool(v any) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		parsed, _ := strconv.ParseBool(b)
+		return parsed
+	}
+	return false
+}
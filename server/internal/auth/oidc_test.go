@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/gofiber/fiber/v2"
+	"github.com/humanbeeng/checkpost/server/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// Minimal OpenID Connect provider serving discovery, keys, token and userinfo endpoints.
+type mockOidcServer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	claims   map[string]any
+	userInfo map[string]any
+	// Fails discovery while set
+	down bool
+}
+
+func newMockOidcServer(t *testing.T) *mockOidcServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	m := &mockOidcServer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		if m.down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/auth",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/keys",
+			"userinfo_endpoint":                     m.URL + "/userinfo",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code_verifier") == "" {
+			http.Error(w, "missing code_verifier", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     m.sign(t),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.userInfo)
+	})
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockOidcServer) sign(t *testing.T) string {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: m.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"),
+	)
+	assert.Nil(t, err)
+
+	claims := map[string]any{
+		"iss": m.URL,
+		"aud": "checkpost",
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"iat": time.Now().Unix(),
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	payload, _ := json.Marshal(claims)
+
+	jws, err := signer.Sign(payload)
+	assert.Nil(t, err)
+	token, err := jws.CompactSerialize()
+	assert.Nil(t, err)
+	return token
+}
+
+func TestOidcSignIn(t *testing.T) {
+	srv := newMockOidcServer(t)
+	defer srv.Close()
+
+	srv.claims = map[string]any{
+		"sub":                "user-1",
+		"nonce":              "nonce-1",
+		"preferred_username": "jdoe",
+		"email":              "jdoe@example.com",
+		"email_verified":     true,
+		"name":               "Jane Doe",
+	}
+
+	provider, err := newOidcProvider("keycloak", config.OidcProvider{Issuer: srv.URL, ClientId: "checkpost"})
+	assert.Nil(t, err)
+
+	a := &AuthHandler{}
+	user, err := a.exchangeCodeForUser(context.TODO(), provider, "code", OAuthState{Nonce: "nonce-1", Verifier: "verifier"})
+	assert.Nil(t, err)
+	assert.Equal(t, OAuthUser{
+		Name:          "Jane Doe",
+		Username:      "jdoe",
+		Email:         "jdoe@example.com",
+		Provider:      "keycloak",
+		Subject:       "user-1",
+		EmailVerified: true,
+	}, *user)
+
+	_, err = a.exchangeCodeForUser(context.TODO(), provider, "code", OAuthState{Nonce: "replayed", Verifier: "verifier"})
+	assert.NotNil(t, err)
+}
+
+func TestOidcClaimMapping(t *testing.T) {
+	srv := newMockOidcServer(t)
+	defer srv.Close()
+
+	// Email is only available from userinfo and the provider does not send email_verified
+	srv.claims = map[string]any{"sub": "user-2", "nonce": "n", "upn": "corp\\jdoe"}
+	srv.userInfo = map[string]any{"sub": "user-2", "mail": "jdoe@corp.example.com"}
+
+	provider, err := newOidcProvider("corp", config.OidcProvider{
+		Issuer:        srv.URL,
+		ClientId:      "checkpost",
+		UsernameClaim: "upn",
+		EmailClaim:    "mail",
+		TrustEmail:    true,
+	})
+	assert.Nil(t, err)
+
+	a := &AuthHandler{}
+	user, err := a.exchangeCodeForUser(context.TODO(), provider, "code", OAuthState{Nonce: "n", Verifier: "verifier"})
+	assert.Nil(t, err)
+	assert.Equal(t, "corp\\jdoe", user.Username)
+	assert.Equal(t, "jdoe@corp.example.com", user.Email)
+	assert.True(t, user.EmailVerified)
+}
+
+func TestOidcRejectsTokenForOtherClient(t *testing.T) {
+	srv := newMockOidcServer(t)
+	defer srv.Close()
+
+	srv.claims = map[string]any{"sub": "user-1", "nonce": "n", "aud": "another-client"}
+
+	provider, err := newOidcProvider("keycloak", config.OidcProvider{Issuer: srv.URL, ClientId: "checkpost"})
+	assert.Nil(t, err)
+
+	a := &AuthHandler{}
+	_, err = a.exchangeCodeForUser(context.TODO(), provider, "code", OAuthState{Nonce: "n", Verifier: "verifier"})
+	assert.NotNil(t, err)
+}
+
+func TestOidcProviderNameIsReserved(t *testing.T) {
+	_, err := NewAuthHandler(&config.AppConfig{
+		Oidc: map[string]config.OidcProvider{ProviderGithub: {Issuer: "http://localhost", ClientId: "x"}},
+	}, nil, nil, nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestOidcIgnoresUserInfoOfOtherSubject(t *testing.T) {
+	srv := newMockOidcServer(t)
+	defer srv.Close()
+
+	srv.claims = map[string]any{"sub": "user-2", "nonce": "n", "preferred_username": "jdoe"}
+	srv.userInfo = map[string]any{"sub": "user-3", "email": "victim@example.com", "email_verified": true}
+
+	provider, err := newOidcProvider("corp", config.OidcProvider{Issuer: srv.URL, ClientId: "checkpost"})
+	assert.Nil(t, err)
+
+	a := &AuthHandler{}
+	user, err := a.exchangeCodeForUser(context.TODO(), provider, "code", OAuthState{Nonce: "n", Verifier: "verifier"})
+	assert.Nil(t, err)
+	assert.Equal(t, "user-2", user.Subject)
+	assert.Equal(t, "", user.Email)
+	assert.False(t, user.EmailVerified)
+}
+
+func TestOidcDiscoveryIsRetried(t *testing.T) {
+	srv := newMockOidcServer(t)
+	defer srv.Close()
+	srv.down = true
+
+	d := &oidcDiscovery{name: "corp", issuer: srv.URL, config: oauth2.Config{ClientID: "checkpost"}}
+	_, err := d.oauthConfig(context.TODO())
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+
+	// Not retried before the interval has passed
+	srv.down = false
+	_, err = d.oauthConfig(context.TODO())
+	assert.ErrorIs(t, err, ErrProviderUnavailable)
+
+	d.failedAt = time.Now().Add(-oidcDiscoveryRetryInterval)
+	oauthConfig, err := d.oauthConfig(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, srv.URL+"/token", oauthConfig.Endpoint.TokenURL)
+}
+
+func TestUnavailableOidcProviderIsDisabled(t *testing.T) {
+	srv := newMockOidcServer(t)
+	defer srv.Close()
+	srv.down = true
+
+	ac, err := NewAuthHandler(&config.AppConfig{
+		Oidc: map[string]config.OidcProvider{"corp": {Issuer: srv.URL, ClientId: "checkpost"}},
+	}, nil, nil, nil, nil)
+	assert.Nil(t, err)
+
+	app := fiber.New()
+	app.Get("/auth/oidc/:provider", ac.OidcLoginHandler)
+	app.Get("/auth/github", ac.GithubLoginHandler)
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/auth/oidc/corp", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, fiber.StatusServiceUnavailable, res.StatusCode)
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/auth/github", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, fiber.StatusFound, res.StatusCode)
+	location, err := url.Parse(res.Header.Get(fiber.HeaderLocation))
+	assert.Nil(t, err)
+	assert.Equal(t, "github.com", location.Host)
+}
@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const (
+	AccessTokenDuration  = 15 * time.Minute
+	RefreshTokenDuration = 30 * 24 * time.Hour
+	// How long a session lookup is trusted before it is checked against db again.
+	// Revocations on this instance take effect immediately.
+	sessionCacheTTL = 30 * time.Second
+	// Parallel requests of a client refresh with the same token. For this long after a rotation the
+	// replaced token yields the current pair instead of being treated as reuse.
+	refreshReuseGrace = 10 * time.Second
+)
+
+type AuthError struct {
+	Code    int
+	Message string
+}
+
+func (a *AuthError) Error() string {
+	return a.Message
+}
+
+func NewInternalServerError() *AuthError {
+	return &AuthError{
+		Code:    http.StatusInternalServerError,
+		Message: "Oops! Something went wrong :(",
+	}
+}
+
+func NewUnauthorizedError() *AuthError {
+	return &AuthError{
+		Code:    http.StatusUnauthorized,
+		Message: "Session has expired. Please sign in again.",
+	}
+}
+
+type Tokens struct {
+	UserId       int64
+	SessionId    string
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+type SessionInfo struct {
+	Id         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type cachedSession struct {
+	userId    int64
+	active    bool
+	checkedAt time.Time
+}
+
+// Issues short lived access tokens backed by a server side session.
+// Sessions are extended by rotating refresh tokens and can be revoked at any time.
+type SessionService struct {
+	sessionq SessionQuerier
+	pv       *core.PasetoVerifier
+	// Rotated refresh tokens are derived from the replaced token with this key, see nextRefreshToken.
+	refreshKey []byte
+	now        func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedSession
+}
+
+func NewSessionService(sessionq SessionQuerier, pv *core.PasetoVerifier, tokenKey string) *SessionService {
+	return &SessionService{
+		sessionq:   sessionq,
+		pv:         pv,
+		refreshKey: deriveKey("refresh-token", tokenKey),
+		now:        time.Now,
+		cache:      make(map[string]cachedSession),
+	}
+}
+
+func NewSuspendedError() *AuthError {
+	return &AuthError{
+		Code:    http.StatusForbidden,
+		Message: "Your account has been suspended.",
+	}
+}
+
+func (s *SessionService) CreateSession(ctx context.Context, user db.User, userAgent string, ip string) (Tokens, *AuthError) {
+	if user.SuspendedAt.Valid {
+		slog.WarnContext(ctx, "Refused session for suspended user", "userId", user.ID)
+		return Tokens{}, NewSuspendedError()
+	}
+
+	sessionId, err := gonanoid.New()
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to generate session id", "err", err)
+		return Tokens{}, NewInternalServerError()
+	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to generate refresh token", "err", err)
+		return Tokens{}, NewInternalServerError()
+	}
+
+	_, err = s.sessionq.CreateSession(ctx, db.CreateSessionParams{
+		ID:               sessionId,
+		UserID:           user.ID,
+		RefreshTokenHash: hashRefreshToken(refreshToken),
+		UserAgent:        userAgent,
+		Ip:               ip,
+		ExpiresAt:        timestamptz(s.now().Add(RefreshTokenDuration)),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to create session", "userId", user.ID, "err", err)
+		return Tokens{}, NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Created new session", "userId", user.ID, "sessionId", sessionId)
+	return s.issueTokens(sessionId, refreshToken, user)
+}
+
+// Exchanges a refresh token for a new access and refresh token pair.
+// Presenting an already rotated refresh token revokes the session, as the token was likely leaked, unless it
+// was rotated within refreshReuseGrace. Then the current pair is returned, as parallel requests raced.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string, userAgent string, ip string) (Tokens, *AuthError) {
+	if refreshToken == "" {
+		return Tokens{}, NewUnauthorizedError()
+	}
+
+	hash := hashRefreshToken(refreshToken)
+	session, err := s.sessionq.GetSessionFromRefreshToken(ctx, hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.WarnContext(ctx, "Refresh token not found")
+			return Tokens{}, NewUnauthorizedError()
+		}
+		slog.ErrorContext(ctx, "unable to get session from refresh token", "err", err)
+		return Tokens{}, NewInternalServerError()
+	}
+
+	if session.RevokedAt.Valid || !session.ExpiresAt.Time.After(s.now()) {
+		slog.InfoContext(ctx, "Refresh attempted on inactive session", "sessionId", session.ID)
+		return Tokens{}, NewUnauthorizedError()
+	}
+
+	reused := session.RefreshTokenHash != hash
+	if reused && !s.withinReuseGrace(session, hash) {
+		slog.WarnContext(ctx, "Rotated refresh token reused. Revoking session", "sessionId", session.ID, "userId", session.UserID)
+		if authErr := s.RevokeSession(ctx, session.UserID, session.ID); authErr != nil {
+			return Tokens{}, authErr
+		}
+		return Tokens{}, NewUnauthorizedError()
+	}
+
+	// Plan, role and username are read again so that refreshed tokens never carry stale claims.
+	user, err := s.sessionq.GetUser(ctx, session.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to get user for session", "sessionId", session.ID, "err", err)
+		return Tokens{}, NewInternalServerError()
+	}
+	if user.SuspendedAt.Valid {
+		slog.WarnContext(ctx, "Refused refresh for suspended user", "userId", user.ID, "sessionId", session.ID)
+		return Tokens{}, NewSuspendedError()
+	}
+
+	newRefreshToken := s.nextRefreshToken(refreshToken)
+	if reused {
+		slog.InfoContext(ctx, "Refresh token rotated by a parallel request. Returning current pair", "sessionId", session.ID)
+		return s.issueTokens(session.ID, newRefreshToken, user)
+	}
+
+	_, err = s.sessionq.RotateSession(ctx, db.RotateSessionParams{
+		ID:                  session.ID,
+		RefreshTokenHash:    hash,
+		NewRefreshTokenHash: hashRefreshToken(newRefreshToken),
+		UserAgent:           userAgent,
+		Ip:                  ip,
+		ExpiresAt:           timestamptz(s.now().Add(RefreshTokenDuration)),
+		RotatedAt:           timestamptz(s.now()),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Lost a race against a concurrent refresh or revocation. The winner rotated to the same token.
+			current, err := s.sessionq.GetSessionFromRefreshToken(ctx, hash)
+			if err == nil && current.ID == session.ID && !current.RevokedAt.Valid && s.withinReuseGrace(current, hash) {
+				return s.issueTokens(session.ID, newRefreshToken, user)
+			}
+			return Tokens{}, NewUnauthorizedError()
+		}
+		slog.ErrorContext(ctx, "unable to rotate session", "sessionId", session.ID, "err", err)
+		return Tokens{}, NewInternalServerError()
+	}
+
+	return s.issueTokens(session.ID, newRefreshToken, user)
+}
+
+func (s *SessionService) ListSessions(ctx context.Context, userId int64, currentSessionId string) ([]SessionInfo, *AuthError) {
+	sessions, err := s.sessionq.ListUserSessions(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list sessions", "userId", userId, "err", err)
+		return nil, NewInternalServerError()
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, SessionInfo{
+			Id:         session.ID,
+			UserAgent:  session.UserAgent,
+			Ip:         session.Ip,
+			CreatedAt:  session.CreatedAt.Time,
+			LastUsedAt: session.LastUsedAt.Time,
+			ExpiresAt:  session.ExpiresAt.Time,
+			Current:    session.ID == currentSessionId,
+		})
+	}
+	return infos, nil
+}
+
+func (s *SessionService) RevokeSession(ctx context.Context, userId int64, sessionId string) *AuthError {
+	revoked, err := s.sessionq.RevokeSession(ctx, db.RevokeSessionParams{ID: sessionId, UserID: userId})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to revoke session", "sessionId", sessionId, "err", err)
+		return NewInternalServerError()
+	}
+
+	if revoked == 0 {
+		return &AuthError{
+			Code:    http.StatusNotFound,
+			Message: "Session not found",
+		}
+	}
+
+	s.mu.Lock()
+	s.cache[sessionId] = cachedSession{userId: userId, active: false, checkedAt: s.now()}
+	s.mu.Unlock()
+
+	slog.InfoContext(ctx, "Revoked session", "userId", userId, "sessionId", sessionId)
+	return nil
+}
+
+// Signs the user out everywhere.
+func (s *SessionService) RevokeAllSessions(ctx context.Context, userId int64) *AuthError {
+	revoked, err := s.sessionq.RevokeUserSessions(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to revoke user sessions", "userId", userId, "err", err)
+		return NewInternalServerError()
+	}
+
+	s.mu.Lock()
+	for id, cached := range s.cache {
+		if cached.userId == userId {
+			cached.active = false
+			s.cache[id] = cached
+		}
+	}
+	s.mu.Unlock()
+
+	slog.InfoContext(ctx, "Revoked all sessions", "userId", userId, "num_revoked", revoked)
+	return nil
+}
+
+func (s *SessionService) SessionActive(ctx context.Context, sessionId string) (bool, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	cached, ok := s.cache[sessionId]
+	s.mu.Unlock()
+	if ok && now.Sub(cached.checkedAt) < sessionCacheTTL {
+		return cached.active, nil
+	}
+
+	session, err := s.sessionq.GetSession(ctx, sessionId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	active := !session.RevokedAt.Valid && session.ExpiresAt.Time.After(now)
+
+	s.mu.Lock()
+	s.cache[sessionId] = cachedSession{userId: session.UserID, active: active, checkedAt: now}
+	s.mu.Unlock()
+
+	return active, nil
+}
+
+// Deletes expired sessions from db and drops stale entries from the cache.
+func (s *SessionService) RemoveExpiredSessions(ctx context.Context) (int64, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	for id, cached := range s.cache {
+		if now.Sub(cached.checkedAt) >= sessionCacheTTL {
+			delete(s.cache, id)
+		}
+	}
+	s.mu.Unlock()
+
+	return s.sessionq.DeleteExpiredSessions(ctx)
+}
+
+func (s *SessionService) issueTokens(sessionId string, refreshToken string, user db.User) (Tokens, *AuthError) {
+	args := core.CreateTokenArgs{
+		SessionId: sessionId,
+		Username:  user.Username,
+		UserId:    user.ID,
+		Plan:      user.Plan,
+		Role:      user.Role,
+	}
+
+	accessToken, err := s.pv.CreateToken(args, AccessTokenDuration)
+	if err != nil {
+		slog.Error("unable to create access token", "sessionId", sessionId, "err", err)
+		return Tokens{}, NewInternalServerError()
+	}
+
+	return Tokens{
+		UserId:       user.ID,
+		SessionId:    sessionId,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    s.now().Add(AccessTokenDuration),
+	}, nil
+}
+
+func timestamptz(t time.Time) pgtype.Timestamptz {
+	return pgtype.Timestamptz{Time: t, InfinityModifier: pgtype.Finite, Valid: true}
+}
+
+// Whether hash is the refresh token replaced by the last rotation of session, and the rotation is recent
+// enough for it to come from a parallel request.
+func (s *SessionService) withinReuseGrace(session db.Session, hash string) bool {
+	return session.PreviousRefreshHash.String == hash &&
+		session.RotatedAt.Valid &&
+		s.now().Sub(session.RotatedAt.Time) < refreshReuseGrace
+}
+
+// Rotated refresh tokens are derived from the token they replace, so that a parallel refresh with the
+// replaced token can be answered with the current token without storing it.
+func (s *SessionService) nextRefreshToken(refreshToken string) string {
+	mac := hmac.New(sha256.New, s.refreshKey)
+	mac.Write([]byte(refreshToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Only hashes of refresh tokens are stored.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
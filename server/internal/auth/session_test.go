@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockSessionStore struct {
+	users    map[int64]db.User
+	sessions map[string]db.Session
+}
+
+func newMockSessionStore() *MockSessionStore {
+	return &MockSessionStore{
+		users: map[int64]db.User{
+			1: {ID: 1, Username: "user", Plan: db.PlanFree},
+		},
+		sessions: map[string]db.Session{},
+	}
+}
+
+func (ss *MockSessionStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	u, ok := ss.users[userId]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	return u, nil
+}
+
+func (ss *MockSessionStore) CreateSession(ctx context.Context, params db.CreateSessionParams) (db.Session, error) {
+	session := db.Session{
+		ID:               params.ID,
+		UserID:           params.UserID,
+		RefreshTokenHash: params.RefreshTokenHash,
+		UserAgent:        params.UserAgent,
+		Ip:               params.Ip,
+		ExpiresAt:        params.ExpiresAt,
+	}
+	ss.sessions[params.ID] = session
+	return session, nil
+}
+
+func (ss *MockSessionStore) GetSession(ctx context.Context, id string) (db.Session, error) {
+	session, ok := ss.sessions[id]
+	if !ok {
+		return db.Session{}, pgx.ErrNoRows
+	}
+	return session, nil
+}
+
+func (ss *MockSessionStore) GetSessionFromRefreshToken(ctx context.Context, refreshTokenHash string) (db.Session, error) {
+	for _, session := range ss.sessions {
+		if session.RefreshTokenHash == refreshTokenHash || session.PreviousRefreshHash.String == refreshTokenHash {
+			return session, nil
+		}
+	}
+	return db.Session{}, pgx.ErrNoRows
+}
+
+func (ss *MockSessionStore) RotateSession(ctx context.Context, params db.RotateSessionParams) (db.Session, error) {
+	session, ok := ss.sessions[params.ID]
+	if !ok || session.RefreshTokenHash != params.RefreshTokenHash || session.RevokedAt.Valid {
+		return db.Session{}, pgx.ErrNoRows
+	}
+	session.PreviousRefreshHash = pgtype.Text{String: session.RefreshTokenHash, Valid: true}
+	session.RefreshTokenHash = params.NewRefreshTokenHash
+	session.ExpiresAt = params.ExpiresAt
+	session.RotatedAt = params.RotatedAt
+	ss.sessions[params.ID] = session
+	return session, nil
+}
+
+func (ss *MockSessionStore) ListUserSessions(ctx context.Context, userId int64) ([]db.Session, error) {
+	var sessions []db.Session
+	for _, session := range ss.sessions {
+		if session.UserID == userId && !session.RevokedAt.Valid {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (ss *MockSessionStore) RevokeSession(ctx context.Context, params db.RevokeSessionParams) (int64, error) {
+	session, ok := ss.sessions[params.ID]
+	if !ok || session.UserID != params.UserID || session.RevokedAt.Valid {
+		return 0, nil
+	}
+	session.RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	ss.sessions[params.ID] = session
+	return 1, nil
+}
+
+func (ss *MockSessionStore) RevokeUserSessions(ctx context.Context, userId int64) (int64, error) {
+	var revoked int64
+	for id, session := range ss.sessions {
+		if session.UserID == userId && !session.RevokedAt.Valid {
+			session.RevokedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+			ss.sessions[id] = session
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (ss *MockSessionStore) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func newTestSessionService(t *testing.T) (*SessionService, *MockSessionStore) {
+	pv, err := core.NewPasetoVerifier("01234567890123456789012345678901")
+	assert.Nil(t, err)
+	store := newMockSessionStore()
+	return NewSessionService(store, pv, "01234567890123456789012345678901"), store
+}
+
+func TestRefreshRotatesTokenAndReadsCurrentPlan(t *testing.T) {
+	s, store := newTestSessionService(t)
+	ctx := context.TODO()
+
+	tokens, authErr := s.CreateSession(ctx, store.users[1], "test-agent", "127.0.0.1")
+	assert.Nil(t, authErr)
+
+	payload, err := s.pv.VerifyToken(tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, tokens.SessionId, payload.Jti)
+	assert.Equal(t, string(db.PlanFree), payload.Get("plan"))
+
+	user := store.users[1]
+	user.Plan = db.PlanPro
+	store.users[1] = user
+
+	refreshed, authErr := s.Refresh(ctx, tokens.RefreshToken, "test-agent", "127.0.0.1")
+	assert.Nil(t, authErr)
+	assert.Equal(t, tokens.SessionId, refreshed.SessionId)
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+	payload, err = s.pv.VerifyToken(refreshed.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, string(db.PlanPro), payload.Get("plan"))
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	s, store := newTestSessionService(t)
+	ctx := context.TODO()
+
+	tokens, _ := s.CreateSession(ctx, store.users[1], "", "")
+	refreshed, authErr := s.Refresh(ctx, tokens.RefreshToken, "", "")
+	assert.Nil(t, authErr)
+
+	s.now = func() time.Time { return time.Now().Add(refreshReuseGrace) }
+	_, authErr = s.Refresh(ctx, tokens.RefreshToken, "", "")
+	assert.NotNil(t, authErr)
+	assert.Equal(t, http.StatusUnauthorized, authErr.Code)
+
+	active, err := s.SessionActive(ctx, tokens.SessionId)
+	assert.Nil(t, err)
+	assert.False(t, active)
+
+	_, authErr = s.Refresh(ctx, refreshed.RefreshToken, "", "")
+	assert.NotNil(t, authErr)
+}
+
+func TestParallelRefreshReturnsCurrentPair(t *testing.T) {
+	s, store := newTestSessionService(t)
+	ctx := context.TODO()
+
+	tokens, _ := s.CreateSession(ctx, store.users[1], "", "")
+	first, authErr := s.Refresh(ctx, tokens.RefreshToken, "", "")
+	assert.Nil(t, authErr)
+
+	// A slower request of the same client presents the replaced token
+	second, authErr := s.Refresh(ctx, tokens.RefreshToken, "", "")
+	assert.Nil(t, authErr)
+	assert.Equal(t, first.RefreshToken, second.RefreshToken)
+	assert.Equal(t, tokens.SessionId, second.SessionId)
+
+	active, err := s.SessionActive(ctx, tokens.SessionId)
+	assert.Nil(t, err)
+	assert.True(t, active)
+
+	_, authErr = s.Refresh(ctx, second.RefreshToken, "", "")
+	assert.Nil(t, authErr)
+}
+
+func TestRevokeSessions(t *testing.T) {
+	s, store := newTestSessionService(t)
+	ctx := context.TODO()
+
+	laptop, _ := s.CreateSession(ctx, store.users[1], "laptop", "")
+	phone, _ := s.CreateSession(ctx, store.users[1], "phone", "")
+
+	active, _ := s.SessionActive(ctx, laptop.SessionId)
+	assert.True(t, active)
+
+	sessions, authErr := s.ListSessions(ctx, 1, phone.SessionId)
+	assert.Nil(t, authErr)
+	assert.Len(t, sessions, 2)
+
+	assert.Nil(t, s.RevokeSession(ctx, 1, laptop.SessionId))
+
+	active, _ = s.SessionActive(ctx, laptop.SessionId)
+	assert.False(t, active)
+	active, _ = s.SessionActive(ctx, phone.SessionId)
+	assert.True(t, active)
+
+	authErr = s.RevokeSession(ctx, 2, phone.SessionId)
+	assert.Equal(t, http.StatusNotFound, authErr.Code)
+	active, _ = s.SessionActive(ctx, phone.SessionId)
+	assert.True(t, active)
+
+	assert.Nil(t, s.RevokeAllSessions(ctx, 1))
+	active, _ = s.SessionActive(ctx, phone.SessionId)
+	assert.False(t, active)
+}
+
+func TestSuspendedUserCannotSignInOrRefresh(t *testing.T) {
+	s, store := newTestSessionService(t)
+	ctx := context.TODO()
+
+	tokens, authErr := s.CreateSession(ctx, store.users[1], "", "")
+	assert.Nil(t, authErr)
+
+	user := store.users[1]
+	user.SuspendedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	store.users[1] = user
+
+	_, authErr = s.Refresh(ctx, tokens.RefreshToken, "", "")
+	assert.NotNil(t, authErr)
+	assert.Equal(t, http.StatusForbidden, authErr.Code)
+
+	_, authErr = s.CreateSession(ctx, user, "", "")
+	assert.NotNil(t, authErr)
+	assert.Equal(t, http.StatusForbidden, authErr.Code)
+}
+
+func TestAccessTokenCarriesRole(t *testing.T) {
+	s, store := newTestSessionService(t)
+
+	user := store.users[1]
+	user.Role = core.RoleAdmin
+	tokens, authErr := s.CreateSession(context.TODO(), user, "", "")
+	assert.Nil(t, authErr)
+
+	payload, err := s.pv.VerifyToken(tokens.AccessToken)
+	assert.Nil(t, err)
+	assert.Equal(t, core.RoleAdmin, payload.Get("role"))
+}
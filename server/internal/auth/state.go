@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/o1egl/paseto"
+)
+
+// How long a user has to complete the provider consent screen.
+const StateDuration = 10 * time.Minute
+
+// Round-tripped through the OAuth provider as the state parameter.
+// The token is encrypted, so the PKCE verifier never leaves the server in clear text.
+type OAuthState struct {
+	Provider string
+	Nonce    string
+	Verifier string
+	// Set when an authenticated user links a new provider instead of signing in
+	LinkUserId int64
+}
+
+type stateSigner struct {
+	key    []byte
+	paseto *paseto.V2
+	now    func() time.Time
+}
+
+func newStateSigner(tokenKey string) *stateSigner {
+	return &stateSigner{
+		key:    deriveKey("oauth-state", tokenKey),
+		paseto: paseto.NewV2(),
+		now:    time.Now,
+	}
+}
+
+func (s *stateSigner) Create(state OAuthState) (string, error) {
+	now := s.now()
+	jt := paseto.JSONToken{
+		Issuer:     "checkpost",
+		Audience:   "oauth_state",
+		IssuedAt:   now,
+		Expiration: now.Add(StateDuration),
+	}
+	jt.Set("provider", state.Provider)
+	jt.Set("nonce", state.Nonce)
+	jt.Set("verifier", state.Verifier)
+	jt.Set("link_user_id", strconv.FormatInt(state.LinkUserId, 10))
+
+	return s.paseto.Encrypt(s.key, jt, nil)
+}
+
+func (s *stateSigner) Verify(token string) (OAuthState, error) {
+	var jt paseto.JSONToken
+	if err := s.paseto.Decrypt(token, s.key, &jt, nil); err != nil {
+		return OAuthState{}, err
+	}
+
+	if jt.Audience != "oauth_state" {
+		return OAuthState{}, fmt.Errorf("not an oauth state")
+	}
+
+	if s.now().After(jt.Expiration) {
+		return OAuthState{}, fmt.Errorf("state has expired")
+	}
+
+	linkUserId, err := strconv.ParseInt(jt.Get("link_user_id"), 10, 64)
+	if err != nil {
+		return OAuthState{}, fmt.Errorf("invalid link user id")
+	}
+
+	return OAuthState{
+		Provider:   jt.Get("provider"),
+		Nonce:      jt.Get("nonce"),
+		Verifier:   jt.Get("verifier"),
+		LinkUserId: linkUserId,
+	}, nil
+}
+
+// Derives a purpose specific key from the token key,
+// so that access tokens, states and sign in links can never be swapped.
+func deriveKey(purpose string, tokenKey string) []byte {
+	key := sha256.Sum256([]byte("checkpost-" + purpose + ":" + tokenKey))
+	return key[:]
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SessionQuerier interface {
+	GetUser(ctx context.Context, userId int64) (db.User, error)
+
+	CreateSession(ctx context.Context, params db.CreateSessionParams) (db.Session, error)
+	GetSession(ctx context.Context, id string) (db.Session, error)
+	GetSessionFromRefreshToken(ctx context.Context, refreshTokenHash string) (db.Session, error)
+	RotateSession(ctx context.Context, params db.RotateSessionParams) (db.Session, error)
+	ListUserSessions(ctx context.Context, userId int64) ([]db.Session, error)
+	RevokeSession(ctx context.Context, params db.RevokeSessionParams) (int64, error)
+	RevokeUserSessions(ctx context.Context, userId int64) (int64, error)
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+}
+
+type SessionStore struct {
+	q db.Querier
+}
+
+func NewSessionStore(q db.Querier) *SessionStore {
+	return &SessionStore{
+		q: q,
+	}
+}
+
+func (ss SessionStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	return ss.q.GetUser(ctx, userId)
+}
+
+func (ss SessionStore) CreateSession(ctx context.Context, params db.CreateSessionParams) (db.Session, error) {
+	return ss.q.CreateSession(ctx, params)
+}
+
+func (ss SessionStore) GetSession(ctx context.Context, id string) (db.Session, error) {
+	return ss.q.GetSession(ctx, id)
+}
+
+func (ss SessionStore) GetSessionFromRefreshToken(ctx context.Context, refreshTokenHash string) (db.Session, error) {
+	return ss.q.GetSessionFromRefreshToken(ctx, refreshTokenHash)
+}
+
+func (ss SessionStore) RotateSession(ctx context.Context, params db.RotateSessionParams) (db.Session, error) {
+	return ss.q.RotateSession(ctx, params)
+}
+
+func (ss SessionStore) ListUserSessions(ctx context.Context, userId int64) ([]db.Session, error) {
+	return ss.q.ListUserSessions(ctx, userId)
+}
+
+func (ss SessionStore) RevokeSession(ctx context.Context, params db.RevokeSessionParams) (int64, error) {
+	return ss.q.RevokeSession(ctx, params)
+}
+
+func (ss SessionStore) RevokeUserSessions(ctx context.Context, userId int64) (int64, error) {
+	return ss.q.RevokeUserSessions(ctx, userId)
+}
+
+func (ss SessionStore) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	return ss.q.DeleteExpiredSessions(ctx)
+}
+
+type IdentityQuerier interface {
+	GetUser(ctx context.Context, userId int64) (db.User, error)
+	GetUserFromEmail(ctx context.Context, email string) (db.User, error)
+	CreateUser(ctx context.Context, params db.CreateUserParams) (db.User, error)
+
+	CreateIdentity(ctx context.Context, params db.CreateIdentityParams) (db.Identity, error)
+	GetIdentity(ctx context.Context, params db.GetIdentityParams) (db.Identity, error)
+	ListUserIdentities(ctx context.Context, userId int64) ([]db.Identity, error)
+	DeleteIdentity(ctx context.Context, params db.DeleteIdentityParams) (int64, error)
+
+	// Runs fn within a transaction. The querier passed to fn is bound to the transaction.
+	WithTx(ctx context.Context, fn func(IdentityQuerier) error) error
+}
+
+type IdentityStore struct {
+	pool *pgxpool.Pool
+	q    *db.Queries
+}
+
+func NewIdentityStore(pool *pgxpool.Pool) *IdentityStore {
+	return &IdentityStore{
+		pool: pool,
+		q:    db.New(pool),
+	}
+}
+
+func (is IdentityStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	return is.q.GetUser(ctx, userId)
+}
+
+func (is IdentityStore) GetUserFromEmail(ctx context.Context, email string) (db.User, error) {
+	return is.q.GetUserFromEmail(ctx, email)
+}
+
+func (is IdentityStore) CreateUser(ctx context.Context, params db.CreateUserParams) (db.User, error) {
+	return is.q.CreateUser(ctx, params)
+}
+
+func (is IdentityStore) CreateIdentity(ctx context.Context, params db.CreateIdentityParams) (db.Identity, error) {
+	return is.q.CreateIdentity(ctx, params)
+}
+
+func (is IdentityStore) GetIdentity(ctx context.Context, params db.GetIdentityParams) (db.Identity, error) {
+	return is.q.GetIdentity(ctx, params)
+}
+
+func (is IdentityStore) ListUserIdentities(ctx context.Context, userId int64) ([]db.Identity, error) {
+	return is.q.ListUserIdentities(ctx, userId)
+}
+
+func (is IdentityStore) DeleteIdentity(ctx context.Context, params db.DeleteIdentityParams) (int64, error) {
+	return is.q.DeleteIdentity(ctx, params)
+}
+
+func (is IdentityStore) WithTx(ctx context.Context, fn func(IdentityQuerier) error) error {
+	tx, err := is.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(IdentityStore{pool: is.pool, q: is.q.WithTx(tx)}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+type MagicLinkQuerier interface {
+	CreateMagicLink(ctx context.Context, params db.CreateMagicLinkParams) error
+	CountRecentMagicLinks(ctx context.Context, params db.CountRecentMagicLinksParams) (db.CountRecentMagicLinksRow, error)
+	UseMagicLink(ctx context.Context, id string) (string, error)
+	DeleteExpiredMagicLinks(ctx context.Context) (int64, error)
+}
+
+type MagicLinkStore struct {
+	q db.Querier
+}
+
+func NewMagicLinkStore(q db.Querier) *MagicLinkStore {
+	return &MagicLinkStore{
+		q: q,
+	}
+}
+
+func (ms MagicLinkStore) CreateMagicLink(ctx context.Context, params db.CreateMagicLinkParams) error {
+	return ms.q.CreateMagicLink(ctx, params)
+}
+
+func (ms MagicLinkStore) CountRecentMagicLinks(ctx context.Context, params db.CountRecentMagicLinksParams) (db.CountRecentMagicLinksRow, error) {
+	return ms.q.CountRecentMagicLinks(ctx, params)
+}
+
+func (ms MagicLinkStore) UseMagicLink(ctx context.Context, id string) (string, error) {
+	return ms.q.UseMagicLink(ctx, id)
+}
+
+func (ms MagicLinkStore) DeleteExpiredMagicLinks(ctx context.Context) (int64, error) {
+	return ms.q.DeleteExpiredMagicLinks(ctx)
+}
+
+type DevQuerier interface {
+	ListUsers(ctx context.Context, params db.ListUsersParams) ([]db.User, error)
+}
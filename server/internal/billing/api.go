@@ -0,0 +1,32 @@
+package billing
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type BillingController struct {
+	service *BillingService
+}
+
+func NewBillingController(service *BillingService) *BillingController {
+	return &BillingController{
+		service: service,
+	}
+}
+
+func (bc *BillingController) RegisterRoutes(app *fiber.App) {
+	billingGroup := app.Group("/billing")
+
+	billingGroup.Post("/webhook", bc.WebhookHandler)
+}
+
+func (bc *BillingController) WebhookHandler(c *fiber.Ctx) error {
+	err := bc.service.HandleWebhook(c.UserContext(), c.Body(), c.Get("Stripe-Signature"))
+	if err != nil {
+		return &fiber.Error{
+			Code:    err.Code,
+			Message: err.Message,
+		}
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
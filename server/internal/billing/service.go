@@ -0,0 +1,340 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/humanbeeng/checkpost/server/config"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type BillingError struct {
+	Code    int
+	Message string
+}
+
+func (b *BillingError) Error() string {
+	return b.Message
+}
+
+func NewInternalServerError() *BillingError {
+	return &BillingError{
+		Code:    http.StatusInternalServerError,
+		Message: "Oops! Something went wrong :(",
+	}
+}
+
+// Moves users between plans based on subscription webhooks of the billing provider.
+type BillingService struct {
+	billingq BillingQuerier
+	plans    *plan.Catalog
+	config   config.Billing
+	now      func() time.Time
+}
+
+func NewBillingService(billingq BillingQuerier, plans *plan.Catalog, config config.Billing) *BillingService {
+	return &BillingService{
+		billingq: billingq,
+		plans:    plans,
+		config:   config,
+		now:      time.Now,
+	}
+}
+
+func (s *BillingService) HandleWebhook(ctx context.Context, payload []byte, signature string) *BillingError {
+	if s.config.WebhookSecret == "" {
+		slog.WarnContext(ctx, "Received billing webhook but no webhook secret is configured")
+		return &BillingError{
+			Code:    http.StatusNotFound,
+			Message: "Billing is not enabled",
+		}
+	}
+
+	if err := VerifySignature(payload, signature, s.config.WebhookSecret, s.now()); err != nil {
+		slog.WarnContext(ctx, "Rejected billing webhook", "err", err)
+		return &BillingError{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil || event.Id == "" {
+		slog.ErrorContext(ctx, "unable to parse billing event", "err", err)
+		return &BillingError{
+			Code:    http.StatusBadRequest,
+			Message: "Malformed event",
+		}
+	}
+
+	slog.InfoContext(ctx, "Received billing event", "event_id", event.Id, "type", event.Type)
+
+	var err error
+	switch event.Type {
+	case EventCheckoutCompleted:
+		err = s.handleCheckoutCompleted(ctx, event)
+	case EventSubscriptionCreated, EventSubscriptionUpdated, EventSubscriptionDeleted:
+		err = s.handleSubscription(ctx, event)
+	default:
+		slog.InfoContext(ctx, "Ignoring billing event", "event_id", event.Id, "type", event.Type)
+		return nil
+	}
+
+	if err != nil {
+		var billingErr *BillingError
+		if errors.As(err, &billingErr) {
+			return billingErr
+		}
+		slog.ErrorContext(ctx, "unable to process billing event", "event_id", event.Id, "type", event.Type, "err", err)
+		return NewInternalServerError()
+	}
+	return nil
+}
+
+// Links the billing customer to the user that started the checkout.
+func (s *BillingService) handleCheckoutCompleted(ctx context.Context, event Event) error {
+	var session CheckoutSession
+	if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+		return &BillingError{Code: http.StatusBadRequest, Message: "Malformed checkout session"}
+	}
+
+	userId, err := strconv.ParseInt(session.ClientReferenceId, 10, 64)
+	if err != nil || session.Customer == "" {
+		slog.WarnContext(ctx, "Checkout session without user reference", "event_id", event.Id, "session_id", session.Id)
+		return nil
+	}
+
+	return s.billingq.WithTx(ctx, func(q BillingQuerier) error {
+		if processed, err := markProcessed(ctx, q, event, userId); err != nil || processed {
+			return err
+		}
+
+		if _, err := q.GetUser(ctx, userId); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				slog.WarnContext(ctx, "Checkout session references unknown user", "event_id", event.Id, "userId", userId)
+				return nil
+			}
+			return err
+		}
+
+		slog.InfoContext(ctx, "Linking billing customer", "userId", userId, "customer", session.Customer)
+		return q.SetUserBillingCustomer(ctx, db.SetUserBillingCustomerParams{
+			ID:                userId,
+			BillingCustomerID: pgtype.Text{String: session.Customer, Valid: true},
+		})
+	})
+}
+
+func (s *BillingService) handleSubscription(ctx context.Context, event Event) error {
+	var sub Subscription
+	if err := json.Unmarshal(event.Data.Object, &sub); err != nil {
+		return &BillingError{Code: http.StatusBadRequest, Message: "Malformed subscription"}
+	}
+
+	newPlan := db.PlanFree
+	if event.Type != EventSubscriptionDeleted && sub.IsActive() {
+		p, ok := s.planForSubscription(sub)
+		if !ok {
+			slog.WarnContext(ctx, "Subscription has no known price", "event_id", event.Id, "subscription_id", sub.Id)
+			return &BillingError{Code: http.StatusBadRequest, Message: "Unknown subscription price"}
+		}
+		newPlan = p
+	}
+
+	return s.billingq.WithTx(ctx, func(q BillingQuerier) error {
+		user, err := s.findUser(ctx, q, sub)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				slog.WarnContext(ctx, "Subscription for unknown user", "event_id", event.Id, "customer", sub.Customer)
+				return nil
+			}
+			return err
+		}
+
+		if processed, err := markProcessed(ctx, q, event, user.ID); err != nil || processed {
+			return err
+		}
+
+		if sub.Id != "" {
+			advanced, err := q.AdvanceBillingSubscription(ctx, db.AdvanceBillingSubscriptionParams{
+				ID:          sub.Id,
+				UserID:      user.ID,
+				LastEventAt: pgtype.Timestamptz{Time: time.Unix(event.Created, 0), Valid: true},
+				Deleted:     event.Type == EventSubscriptionDeleted,
+			})
+			if err != nil {
+				return err
+			}
+			if advanced == 0 {
+				slog.InfoContext(ctx, "Ignoring subscription event older than the last applied one", "event_id", event.Id, "subscription_id", sub.Id)
+				return nil
+			}
+		}
+
+		if !user.BillingCustomerID.Valid && sub.Customer != "" {
+			err := q.SetUserBillingCustomer(ctx, db.SetUserBillingCustomerParams{
+				ID:                user.ID,
+				BillingCustomerID: pgtype.Text{String: sub.Customer, Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return s.changePlan(ctx, q, user, newPlan)
+	})
+}
+
+// Moves the user to the given plan outside of a subscription, e.g. by an admin.
+func (s *BillingService) ChangePlan(ctx context.Context, userId int64, newPlan db.Plan) (db.User, *BillingError) {
+	if _, ok := s.plans.Get(newPlan); !ok {
+		return db.User{}, &BillingError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Unknown plan %s", newPlan),
+		}
+	}
+
+	var user db.User
+	err := s.billingq.WithTx(ctx, func(q BillingQuerier) error {
+		var err error
+		user, err = q.GetUser(ctx, userId)
+		if err != nil {
+			return err
+		}
+		if err := s.changePlan(ctx, q, user, newPlan); err != nil {
+			return err
+		}
+		user.Plan = newPlan
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.User{}, &BillingError{
+				Code:    http.StatusNotFound,
+				Message: "User not found",
+			}
+		}
+		slog.ErrorContext(ctx, "unable to change plan", "userId", userId, "plan", newPlan, "err", err)
+		return db.User{}, NewInternalServerError()
+	}
+	return user, nil
+}
+
+// Updates the plan of the user and cascades it to their endpoints.
+// Endpoints and requests above the limits of the new plan are expired. Endpoints expired by an earlier
+// downgrade are restored as far as the new plan allows, requests are not.
+func (s *BillingService) changePlan(ctx context.Context, q BillingQuerier, user db.User, newPlan db.Plan) error {
+	limits, ok := s.plans.Get(newPlan)
+	if !ok {
+		return fmt.Errorf("plan %s not found in catalog", newPlan)
+	}
+
+	if _, err := q.UpdateUserPlan(ctx, db.UpdateUserPlanParams{ID: user.ID, Plan: newPlan}); err != nil {
+		return err
+	}
+
+	userId := pgtype.Int8{Int64: user.ID, Valid: true}
+	if err := q.UpdateUserEndpointsPlan(ctx, db.UpdateUserEndpointsPlanParams{UserID: userId, Plan: newPlan}); err != nil {
+		return err
+	}
+
+	maxEndpoints := int32(math.MaxInt32)
+	if limits.MaxEndpoints > 0 {
+		maxEndpoints = int32(limits.MaxEndpoints)
+	}
+	restored, err := q.RestoreDowngradedEndpoints(ctx, db.RestoreDowngradedEndpointsParams{
+		UserID:       userId,
+		MaxEndpoints: maxEndpoints,
+	})
+	if err != nil {
+		return err
+	}
+	if restored > 0 {
+		slog.InfoContext(ctx, "Restored endpoints expired by a downgrade", "userId", user.ID, "plan", newPlan, "num_restored", restored)
+	}
+
+	if limits.MaxEndpoints > 0 {
+		expired, err := q.ExpireEndpointsBeyondLimit(ctx, db.ExpireEndpointsBeyondLimitParams{
+			UserID: userId,
+			Offset: int32(limits.MaxEndpoints),
+		})
+		if err != nil {
+			return err
+		}
+		if expired > 0 {
+			slog.InfoContext(ctx, "Expired endpoints above plan limit", "userId", user.ID, "plan", newPlan, "num_expired", expired)
+		}
+	}
+
+	if limits.RetentionHours > 0 {
+		capped, err := q.CapUserRequestsExpiry(ctx, db.CapUserRequestsExpiryParams{
+			UserID: userId,
+			ExpiresAt: pgtype.Timestamptz{
+				Time:             s.now().Add(time.Hour * time.Duration(limits.RetentionHours)),
+				InfinityModifier: pgtype.Finite,
+				Valid:            true,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if capped > 0 {
+			slog.InfoContext(ctx, "Applied plan retention to stored requests", "userId", user.ID, "plan", newPlan, "num_requests", capped)
+		}
+	}
+
+	slog.InfoContext(ctx, "User plan changed", "userId", user.ID, "from", user.Plan, "to", newPlan)
+	return nil
+}
+
+func (s *BillingService) planForSubscription(sub Subscription) (db.Plan, bool) {
+	for _, item := range sub.Items.Data {
+		if name, ok := s.config.Prices[item.Price.Id]; ok {
+			p := db.Plan(name)
+			if _, ok := s.plans.Get(p); ok {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Resolves the user from subscription metadata, falling back to the linked billing customer.
+func (s *BillingService) findUser(ctx context.Context, q BillingQuerier, sub Subscription) (db.User, error) {
+	if userIdStr, ok := sub.Metadata["user_id"]; ok {
+		if userId, err := strconv.ParseInt(userIdStr, 10, 64); err == nil {
+			return q.GetUser(ctx, userId)
+		}
+	}
+	if sub.Customer == "" {
+		return db.User{}, pgx.ErrNoRows
+	}
+	return q.GetUserFromBillingCustomer(ctx, sub.Customer)
+}
+
+// Records the event. Returns true if the event was already processed.
+func markProcessed(ctx context.Context, q BillingQuerier, event Event, userId int64) (bool, error) {
+	inserted, err := q.InsertBillingEvent(ctx, db.InsertBillingEventParams{
+		ID:     event.Id,
+		Type:   event.Type,
+		UserID: pgtype.Int8{Int64: userId, Valid: true},
+	})
+	if err != nil {
+		return false, err
+	}
+	if inserted == 0 {
+		slog.InfoContext(ctx, "Skipping already processed billing event", "event_id", event.Id)
+		return true, nil
+	}
+	return false, nil
+}
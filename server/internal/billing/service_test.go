@@ -0,0 +1,248 @@
+package billing
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/humanbeeng/checkpost/server/config"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "whsec_test_secret"
+
+type MockBillingStore struct {
+	users            map[int64]db.User
+	endpointPlans    map[int64]db.Plan
+	events           map[string]bool
+	subscriptions    map[string]db.AdvanceBillingSubscriptionParams
+	expiredOffset    int32
+	restoredUpTo     int32
+	requestsCappedAt time.Time
+}
+
+func newMockBillingStore() *MockBillingStore {
+	return &MockBillingStore{
+		users: map[int64]db.User{
+			1: {ID: 1, Username: "free_user", Plan: db.PlanFree},
+		},
+		endpointPlans: map[int64]db.Plan{},
+		events:        map[string]bool{},
+		subscriptions: map[string]db.AdvanceBillingSubscriptionParams{},
+	}
+}
+
+func (bs *MockBillingStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	u, ok := bs.users[userId]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	return u, nil
+}
+
+func (bs *MockBillingStore) GetUserFromBillingCustomer(ctx context.Context, customerId string) (db.User, error) {
+	for _, u := range bs.users {
+		if u.BillingCustomerID.String == customerId {
+			return u, nil
+		}
+	}
+	return db.User{}, pgx.ErrNoRows
+}
+
+func (bs *MockBillingStore) SetUserBillingCustomer(ctx context.Context, params db.SetUserBillingCustomerParams) error {
+	u := bs.users[params.ID]
+	u.BillingCustomerID = params.BillingCustomerID
+	bs.users[params.ID] = u
+	return nil
+}
+
+func (bs *MockBillingStore) UpdateUserPlan(ctx context.Context, params db.UpdateUserPlanParams) (db.User, error) {
+	u := bs.users[params.ID]
+	u.Plan = params.Plan
+	bs.users[params.ID] = u
+	return u, nil
+}
+
+func (bs *MockBillingStore) UpdateUserEndpointsPlan(ctx context.Context, params db.UpdateUserEndpointsPlanParams) error {
+	bs.endpointPlans[params.UserID.Int64] = params.Plan
+	return nil
+}
+
+func (bs *MockBillingStore) ExpireEndpointsBeyondLimit(ctx context.Context, params db.ExpireEndpointsBeyondLimitParams) (int64, error) {
+	bs.expiredOffset = params.Offset
+	return 0, nil
+}
+
+func (bs *MockBillingStore) RestoreDowngradedEndpoints(ctx context.Context, params db.RestoreDowngradedEndpointsParams) (int64, error) {
+	bs.restoredUpTo = params.MaxEndpoints
+	return 0, nil
+}
+
+func (bs *MockBillingStore) CapUserRequestsExpiry(ctx context.Context, params db.CapUserRequestsExpiryParams) (int64, error) {
+	bs.requestsCappedAt = params.ExpiresAt.Time
+	return 0, nil
+}
+
+func (bs *MockBillingStore) InsertBillingEvent(ctx context.Context, params db.InsertBillingEventParams) (int64, error) {
+	if bs.events[params.ID] {
+		return 0, nil
+	}
+	bs.events[params.ID] = true
+	return 1, nil
+}
+
+func (bs *MockBillingStore) AdvanceBillingSubscription(ctx context.Context, params db.AdvanceBillingSubscriptionParams) (int64, error) {
+	last, ok := bs.subscriptions[params.ID]
+	if ok {
+		lastAt, at := last.LastEventAt.Time, params.LastEventAt.Time
+		if at.Before(lastAt) || (at.Equal(lastAt) && last.Deleted) {
+			return 0, nil
+		}
+	}
+	bs.subscriptions[params.ID] = params
+	return 1, nil
+}
+
+func (bs *MockBillingStore) WithTx(ctx context.Context, fn func(BillingQuerier) error) error {
+	return fn(bs)
+}
+
+var now = time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestService(store *MockBillingStore) *BillingService {
+	s := NewBillingService(store, plan.NewCatalog(plan.Defaults), config.Billing{
+		WebhookSecret: testSecret,
+		Prices: map[string]string{
+			"price_basic_monthly": "basic",
+			"price_pro_monthly":   "pro",
+		},
+	})
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func fixture(t *testing.T, name string) ([]byte, string) {
+	payload, err := os.ReadFile(filepath.Join("testdata", name))
+	assert.Nil(t, err)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	return payload, "t=" + ts + ",v1=" + ComputeSignature(payload, ts, testSecret)
+}
+
+func TestWebhookRejectsInvalidSignature(t *testing.T) {
+	s := newTestService(newMockBillingStore())
+	payload, _ := fixture(t, "subscription_updated_pro.json")
+
+	err := s.HandleWebhook(context.TODO(), payload, "t=1,v1=deadbeef")
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Code)
+
+	err = s.HandleWebhook(context.TODO(), payload, "")
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Code)
+}
+
+func TestVerifySignatureTolerance(t *testing.T) {
+	payload := []byte(`{}`)
+	ts := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+	header := "t=" + ts + ",v1=" + ComputeSignature(payload, ts, testSecret)
+	assert.ErrorIs(t, VerifySignature(payload, header, testSecret, now), ErrExpiredSignature)
+}
+
+func TestUpgradeAndDowngrade(t *testing.T) {
+	store := newMockBillingStore()
+	s := newTestService(store)
+
+	payload, sig := fixture(t, "checkout_session_completed.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+	assert.Equal(t, pgtype.Text{String: "cus_test_1", Valid: true}, store.users[1].BillingCustomerID)
+
+	payload, sig = fixture(t, "subscription_updated_pro.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+	assert.Equal(t, db.PlanPro, store.users[1].Plan)
+	assert.Equal(t, db.PlanPro, store.endpointPlans[1])
+
+	payload, sig = fixture(t, "subscription_updated_basic.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+	assert.Equal(t, db.PlanBasic, store.users[1].Plan)
+	assert.Equal(t, int32(plan.Defaults[db.PlanBasic].MaxEndpoints), store.expiredOffset)
+	assert.Equal(t, int32(plan.Defaults[db.PlanBasic].MaxEndpoints), store.restoredUpTo)
+
+	payload, sig = fixture(t, "subscription_deleted.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+	assert.Equal(t, db.PlanFree, store.users[1].Plan)
+	assert.Equal(t, db.PlanFree, store.endpointPlans[1])
+	assert.Equal(t, now.Add(time.Hour*time.Duration(plan.Defaults[db.PlanFree].RetentionHours)), store.requestsCappedAt)
+}
+
+func TestRedeliveredEventIsSkipped(t *testing.T) {
+	store := newMockBillingStore()
+	s := newTestService(store)
+
+	payload, sig := fixture(t, "subscription_updated_basic.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+	assert.Equal(t, db.PlanBasic, store.users[1].Plan)
+
+	// Plan changed out of band. A redelivery must not apply the event again.
+	u := store.users[1]
+	u.Plan = db.PlanPro
+	store.users[1] = u
+
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+	assert.Equal(t, db.PlanPro, store.users[1].Plan)
+}
+
+func TestSubscriptionForUnknownCustomerIsIgnored(t *testing.T) {
+	store := newMockBillingStore()
+	s := newTestService(store)
+
+	payload, sig := fixture(t, "subscription_updated_pro.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+	assert.Equal(t, db.PlanFree, store.users[1].Plan)
+}
+
+func TestOutOfOrderSubscriptionEventIsIgnored(t *testing.T) {
+	store := newMockBillingStore()
+	s := newTestService(store)
+
+	payload, sig := fixture(t, "checkout_session_completed.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+
+	payload, sig = fixture(t, "subscription_deleted.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+	assert.Equal(t, db.PlanFree, store.users[1].Plan)
+
+	// Created before the deletion but delivered after it.
+	payload, sig = fixture(t, "subscription_updated_pro.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+	assert.Equal(t, db.PlanFree, store.users[1].Plan)
+	assert.Equal(t, db.PlanFree, store.endpointPlans[1])
+}
+
+func TestUpgradeRestoresDowngradedEndpoints(t *testing.T) {
+	store := newMockBillingStore()
+	s := newTestService(store)
+
+	payload, sig := fixture(t, "checkout_session_completed.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+
+	payload, sig = fixture(t, "subscription_updated_basic.json")
+	assert.Nil(t, s.HandleWebhook(context.TODO(), payload, sig))
+	assert.Equal(t, int32(plan.Defaults[db.PlanBasic].MaxEndpoints), store.restoredUpTo)
+
+	_, err := s.ChangePlan(context.TODO(), 1, db.PlanPro)
+	assert.Nil(t, err)
+	expected := int32(plan.Defaults[db.PlanPro].MaxEndpoints)
+	if expected == 0 {
+		expected = math.MaxInt32
+	}
+	assert.Equal(t, expected, store.restoredUpTo)
+}
@@ -0,0 +1,93 @@
+package billing
+
+import (
+	"context"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type BillingQuerier interface {
+	GetUser(ctx context.Context, userId int64) (db.User, error)
+	GetUserFromBillingCustomer(ctx context.Context, customerId string) (db.User, error)
+	SetUserBillingCustomer(ctx context.Context, params db.SetUserBillingCustomerParams) error
+	UpdateUserPlan(ctx context.Context, params db.UpdateUserPlanParams) (db.User, error)
+
+	UpdateUserEndpointsPlan(ctx context.Context, params db.UpdateUserEndpointsPlanParams) error
+	ExpireEndpointsBeyondLimit(ctx context.Context, params db.ExpireEndpointsBeyondLimitParams) (int64, error)
+	RestoreDowngradedEndpoints(ctx context.Context, params db.RestoreDowngradedEndpointsParams) (int64, error)
+	CapUserRequestsExpiry(ctx context.Context, params db.CapUserRequestsExpiryParams) (int64, error)
+
+	InsertBillingEvent(ctx context.Context, params db.InsertBillingEventParams) (int64, error)
+	// Returns 0 if a newer event of the subscription was applied already.
+	AdvanceBillingSubscription(ctx context.Context, params db.AdvanceBillingSubscriptionParams) (int64, error)
+
+	// Runs fn within a transaction. The querier passed to fn is bound to the transaction.
+	WithTx(ctx context.Context, fn func(BillingQuerier) error) error
+}
+
+type BillingStore struct {
+	pool *pgxpool.Pool
+	q    *db.Queries
+}
+
+func NewBillingStore(pool *pgxpool.Pool) *BillingStore {
+	return &BillingStore{
+		pool: pool,
+		q:    db.New(pool),
+	}
+}
+
+func (bs BillingStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	return bs.q.GetUser(ctx, userId)
+}
+
+func (bs BillingStore) GetUserFromBillingCustomer(ctx context.Context, customerId string) (db.User, error) {
+	return bs.q.GetUserFromBillingCustomer(ctx, pgtype.Text{String: customerId, Valid: true})
+}
+
+func (bs BillingStore) SetUserBillingCustomer(ctx context.Context, params db.SetUserBillingCustomerParams) error {
+	return bs.q.SetUserBillingCustomer(ctx, params)
+}
+
+func (bs BillingStore) UpdateUserPlan(ctx context.Context, params db.UpdateUserPlanParams) (db.User, error) {
+	return bs.q.UpdateUserPlan(ctx, params)
+}
+
+func (bs BillingStore) UpdateUserEndpointsPlan(ctx context.Context, params db.UpdateUserEndpointsPlanParams) error {
+	return bs.q.UpdateUserEndpointsPlan(ctx, params)
+}
+
+func (bs BillingStore) ExpireEndpointsBeyondLimit(ctx context.Context, params db.ExpireEndpointsBeyondLimitParams) (int64, error) {
+	return bs.q.ExpireEndpointsBeyondLimit(ctx, params)
+}
+
+func (bs BillingStore) RestoreDowngradedEndpoints(ctx context.Context, params db.RestoreDowngradedEndpointsParams) (int64, error) {
+	return bs.q.RestoreDowngradedEndpoints(ctx, params)
+}
+
+func (bs BillingStore) CapUserRequestsExpiry(ctx context.Context, params db.CapUserRequestsExpiryParams) (int64, error) {
+	return bs.q.CapUserRequestsExpiry(ctx, params)
+}
+
+func (bs BillingStore) InsertBillingEvent(ctx context.Context, params db.InsertBillingEventParams) (int64, error) {
+	return bs.q.InsertBillingEvent(ctx, params)
+}
+
+func (bs BillingStore) AdvanceBillingSubscription(ctx context.Context, params db.AdvanceBillingSubscriptionParams) (int64, error) {
+	return bs.q.AdvanceBillingSubscription(ctx, params)
+}
+
+func (bs BillingStore) WithTx(ctx context.Context, fn func(BillingQuerier) error) error {
+	tx, err := bs.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(BillingStore{pool: bs.pool, q: bs.q.WithTx(tx)}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Client certificate modes of the TLS listener.
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+)
+
+// Certificate files are often replaced in several steps, so reloads wait for changes to settle.
+const certReloadDelay = 500 * time.Millisecond
+
+type CertFiles struct {
+	CertFile string
+	KeyFile  string
+	// Found in the certificate dir rather than configured. These are skipped when they fail to load.
+	fromDir bool
+}
+
+// Certificates served by the TLS listener, picked by SNI. Reloading swaps the whole set, so
+// established connections are unaffected and new handshakes use the new certificates.
+type CertStore struct {
+	sync.RWMutex
+	files []CertFiles
+	dir   string
+	// The first certificate is served when no name matches
+	certs  []*tls.Certificate
+	byName map[string]*tls.Certificate
+}
+
+// Loads the certificate files and every <name>.crt with a matching <name>.key in dir.
+func NewCertStore(files []CertFiles, dir string) (*CertStore, error) {
+	s := &CertStore{
+		files: files,
+		dir:   dir,
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reloads all certificates. A broken certificate in the dir is skipped, a broken configured certificate
+// fails the reload. On failure the current certificates are kept.
+func (s *CertStore) Reload() error {
+	files, err := s.allFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no tls certificates configured")
+	}
+
+	certs := make([]*tls.Certificate, 0, len(files))
+	byName := make(map[string]*tls.Certificate)
+	for _, f := range files {
+		cert, err := loadCert(f)
+		if err != nil {
+			if f.fromDir {
+				slog.Warn("Skipping certificate that failed to load", "cert", f.CertFile, "err", err)
+				continue
+			}
+			return err
+		}
+		leaf := cert.Leaf
+
+		certs = append(certs, &cert)
+		for _, name := range leaf.DNSNames {
+			name = strings.ToLower(name)
+			// Earlier certificates win, so configured certificates take precedence over the directory
+			if _, ok := byName[name]; !ok {
+				byName[name] = &cert
+			}
+		}
+	}
+
+	if len(certs) == 0 {
+		return errors.New("none of the tls certificates could be loaded")
+	}
+
+	s.Lock()
+	s.certs = certs
+	s.byName = byName
+	s.Unlock()
+
+	slog.Info("TLS certificates loaded", "count", len(certs), "names", len(byName))
+	return nil
+}
+
+func loadCert(f CertFiles) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to load certificate %s: %w", f.CertFile, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to parse certificate %s: %w", f.CertFile, err)
+	}
+	cert.Leaf = leaf
+	return cert, nil
+}
+
+// Picks the certificate for the requested server name, exact names first, then wildcards.
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if cert, ok := s.byName[name]; ok {
+		return cert, nil
+	}
+	if _, rest, ok := strings.Cut(name, "."); ok {
+		if cert, ok := s.byName["*."+rest]; ok {
+			return cert, nil
+		}
+	}
+	return s.certs[0], nil
+}
+
+func (s *CertStore) TLSConfig(clientAuth string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: s.GetCertificate,
+	}
+	switch clientAuth {
+	case "", ClientAuthNone:
+		cfg.ClientAuth = tls.NoClientCert
+	case ClientAuthRequest:
+		cfg.ClientAuth = tls.RequestClientCert
+	default:
+		return nil, fmt.Errorf("invalid client auth %q. Must be %s or %s", clientAuth, ClientAuthNone, ClientAuthRequest)
+	}
+	return cfg, nil
+}
+
+// Reloads certificates whenever their files change until ctx is done. Directories are watched rather
+// than files, so certificates replaced by rename, e.g. by certbot or mounted secrets, are picked up.
+func (s *CertStore) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	dirs := make(map[string]bool)
+	for _, f := range s.files {
+		dirs[filepath.Dir(f.CertFile)] = true
+		dirs[filepath.Dir(f.KeyFile)] = true
+	}
+	if s.dir != "" {
+		dirs[s.dir] = true
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("unable to watch %s: %w", dir, err)
+		}
+	}
+
+	reload := time.NewTimer(certReloadDelay)
+	reload.Stop()
+	defer reload.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			reload.Reset(certReloadDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.ErrorContext(ctx, "tls certificate watcher error", "err", err)
+		case <-reload.C:
+			if err := s.Reload(); err != nil {
+				slog.ErrorContext(ctx, "unable to reload tls certificates. Keeping current certificates", "err", err)
+			}
+		}
+	}
+}
+
+func (s *CertStore) allFiles() ([]CertFiles, error) {
+	files := append([]CertFiles{}, s.files...)
+	if s.dir == "" {
+		return files, nil
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read certificate dir: %w", err)
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".crt")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		keyFile := filepath.Join(s.dir, name+".key")
+		if _, err := os.Stat(keyFile); err != nil {
+			slog.Warn("Skipping certificate without key", "cert", entry.Name())
+			continue
+		}
+		files = append(files, CertFiles{CertFile: filepath.Join(s.dir, entry.Name()), KeyFile: keyFile, fromDir: true})
+	}
+	return files, nil
+}
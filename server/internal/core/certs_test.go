@@ -0,0 +1,124 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCert(t *testing.T, dir string, name string, dnsNames ...string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), certPem, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), keyPem, 0o600))
+}
+
+func servedName(t *testing.T, s *CertStore, serverName string) string {
+	t.Helper()
+
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	assert.NoError(t, err)
+	return cert.Leaf.DNSNames[0]
+}
+
+func TestCertStoreSelectsBySNI(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "checkpost", "*.checkpost.io", "checkpost.io")
+	writeCert(t, dir, "acme", "webhooks.acme.dev")
+
+	s, err := NewCertStore([]CertFiles{{
+		CertFile: filepath.Join(dir, "checkpost.crt"),
+		KeyFile:  filepath.Join(dir, "checkpost.key"),
+	}}, dir)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "*.checkpost.io", servedName(t, s, "acme.checkpost.io"))
+	assert.Equal(t, "*.checkpost.io", servedName(t, s, "checkpost.io"))
+	assert.Equal(t, "webhooks.acme.dev", servedName(t, s, "Webhooks.Acme.dev."))
+	// Unknown names and clients without SNI get the first configured certificate
+	assert.Equal(t, "*.checkpost.io", servedName(t, s, "unknown.example.com"))
+	assert.Equal(t, "*.checkpost.io", servedName(t, s, ""))
+}
+
+func TestCertStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "acme", "webhooks.acme.dev")
+
+	s, err := NewCertStore(nil, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "webhooks.acme.dev", servedName(t, s, "webhooks.acme.dev"))
+
+	writeCert(t, dir, "acme", "hooks.acme.dev")
+	assert.NoError(t, s.Reload())
+	assert.Equal(t, "hooks.acme.dev", servedName(t, s, "webhooks.acme.dev"))
+
+	// A broken certificate keeps the current ones in place
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "acme.crt"), []byte("garbage"), 0o600))
+	assert.Error(t, s.Reload())
+	assert.Equal(t, "hooks.acme.dev", servedName(t, s, "hooks.acme.dev"))
+}
+
+func TestCertStoreSkipsBrokenDirCertificates(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "checkpost", "*.checkpost.io")
+	writeCert(t, dir, "acme", "webhooks.acme.dev")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.crt"), []byte("garbage"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.key"), []byte("garbage"), 0o600))
+
+	s, err := NewCertStore(nil, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "webhooks.acme.dev", servedName(t, s, "webhooks.acme.dev"))
+
+	// Configured certificates must load
+	_, err = NewCertStore([]CertFiles{{
+		CertFile: filepath.Join(dir, "broken.crt"),
+		KeyFile:  filepath.Join(dir, "broken.key"),
+	}}, dir)
+	assert.Error(t, err)
+}
+
+func TestCertStoreRequiresCertificates(t *testing.T) {
+	_, err := NewCertStore(nil, t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestTLSConfigClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "acme", "webhooks.acme.dev")
+	s, err := NewCertStore(nil, dir)
+	assert.NoError(t, err)
+
+	cfg, err := s.TLSConfig(ClientAuthRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequestClientCert, cfg.ClientAuth)
+
+	_, err = s.TLSConfig("require")
+	assert.Error(t, err)
+}
@@ -1,107 +0,0 @@
-package core
-
-var ReservedSubdomains = map[string]bool{
-	"api":       true,
-	"hook":      true,
-	"blog":      true,
-	"dash":      true,
-	"dashboard": true,
-	"uat":       true,
-	"qa":        true,
-	"user":      true,
-	"client":    true,
-	"prod":      true,
-	"staging":   true,
-	"jobs":      true,
-	"career":    true,
-	"auth":      true,
-	"cdn":       true,
-	"files":     true,
-	"file":      true,
-	"free":      true,
-	"secure":    true,
-	"media":     true,
-	"portal":    true,
-	"forum":     true,
-	"support":   true,
-	"www":       true,
-	"help":      true,
-	"console":   true,
-	"app":       true,
-	"share":     true,
-	"dev":       true,
-	"community": true,
-	"payment":   true,
-	"endpoint":  true,
-	"http":      true,
-	"https":     true,
-	"request":   true,
-	"payments":  true,
-	"url":       true,
-	"link":      true,
-	"demo":      true,
-	"shop":      true,
-	"about":     true,
-}
-
-var ReservedCompanies = map[string]bool{
-	"google":      true,
-	"figma":       true,
-	"github":      true,
-	"checkpost":   true,
-	"microsoft":   true,
-	"cloudflare":  true,
-	"ford":        true,
-	"intel":       true,
-	"xerox":       true,
-	"cocacola":    true,
-	"jpmorgan":    true,
-	"apple":       true,
-	"nvidia":      true,
-	"alphabet":    true,
-	"amazon":      true,
-	"netflix":     true,
-	"meta":        true,
-	"tesla":       true,
-	"samsung":     true,
-	"tencent":     true,
-	"oracle":      true,
-	"salesforce":  true,
-	"amd":         true,
-	"adobe":       true,
-	"qualcomm":    true,
-	"cisco":       true,
-	"intuit":      true,
-	"uber":        true,
-	"dell":        true,
-	"sony":        true,
-	"airbnb":      true,
-	"linkedin":    true,
-	"paypal":      true,
-	"xiaomi":      true,
-	"spotify":     true,
-	"snowflake":   true,
-	"instagram":   true,
-	"hotstar":     true,
-	"adidas":      true,
-	"brave":       true,
-	"cred":        true,
-	"flipkart":    true,
-	"notion":      true,
-	"nike":        true,
-	"slack":       true,
-	"twitch":      true,
-	"whatsapp":    true,
-	"youtube":     true,
-	"coinbase":    true,
-	"atlassian":   true,
-	"palantir":    true,
-	"datadog":     true,
-	"hubspot":     true,
-	"snap":        true,
-	"mongodb":     true,
-	"zscaler":     true,
-	"sourcegraph": true,
-	"eraser":      true,
-	"supabase":    true,
-}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+const (
+	DefaultScheme  = "https"
+	DefaultApiHost = "api.checkpost.io"
+	DefaultDomain  = "checkpost.io"
+)
+
+// How endpoints are addressed on a base domain.
+const (
+	// https://<endpoint>.<domain>, needs wildcard DNS and certificates
+	AddressingSubdomain = "subdomain"
+	// https://<domain>/h/<endpoint>
+	AddressingPath = "path"
+)
+
+// Prefix of endpoint paths when addressed by path.
+const PathPrefix = "/h"
+
+// Base domains endpoints are served on and the host serving the API.
+type Hosts struct {
+	scheme     string
+	apiHost    string
+	addressing string
+	domains    []string
+}
+
+// Defaults to https://<endpoint>.checkpost.io with the API at api.checkpost.io. The first domain is
+// the default for new endpoints.
+func NewHosts(scheme string, apiHost string, addressing string, domains []string) (*Hosts, error) {
+	h := &Hosts{
+		scheme:     strings.ToLower(scheme),
+		apiHost:    normalizeHost(apiHost),
+		addressing: strings.ToLower(addressing),
+	}
+	if h.addressing == "" {
+		h.addressing = AddressingSubdomain
+	}
+	if h.addressing != AddressingSubdomain && h.addressing != AddressingPath {
+		return nil, fmt.Errorf("invalid addressing %q. Must be %s or %s", addressing, AddressingSubdomain, AddressingPath)
+	}
+	if h.scheme == "" {
+		h.scheme = DefaultScheme
+	}
+	if h.scheme != "http" && h.scheme != "https" {
+		return nil, fmt.Errorf("invalid scheme %q. Must be http or https", scheme)
+	}
+	if h.apiHost == "" {
+		h.apiHost = DefaultApiHost
+	}
+
+	for _, d := range domains {
+		d = normalizeHost(d)
+		if d == "" || strings.HasPrefix(d, ".") {
+			return nil, fmt.Errorf("invalid domain %q", d)
+		}
+		if !slices.Contains(h.domains, d) {
+			h.domains = append(h.domains, d)
+		}
+	}
+	if len(h.domains) == 0 {
+		h.domains = []string{DefaultDomain}
+	}
+	return h, nil
+}
+
+func (h *Hosts) Primary() string {
+	return h.domains[0]
+}
+
+func (h *Hosts) Domains() []string {
+	return slices.Clone(h.domains)
+}
+
+func (h *Hosts) IsPathAddressing() bool {
+	return h.addressing == AddressingPath
+}
+
+func (h *Hosts) IsDomain(domain string) bool {
+	return slices.Contains(h.domains, normalizeHost(domain))
+}
+
+func (h *Hosts) IsApiHost(host string) bool {
+	host = normalizeHost(host)
+	return host == h.apiHost || stripPort(host) == h.apiHost
+}
+
+// Public URL of an endpoint in the active addressing mode. An empty domain is the primary domain.
+func (h *Hosts) EndpointURL(domain string, endpoint string) string {
+	if domain == "" {
+		domain = h.Primary()
+	}
+	if h.IsPathAddressing() {
+		return fmt.Sprintf("%s://%s%s/%s", h.scheme, domain, PathPrefix, endpoint)
+	}
+	return fmt.Sprintf("%s://%s.%s", h.scheme, endpoint, domain)
+}
+
+// Host serving an endpoint without the port, e.g. to point a CNAME record at.
+func (h *Hosts) EndpointHost(domain string, endpoint string) string {
+	if domain == "" {
+		domain = h.Primary()
+	}
+	if h.IsPathAddressing() {
+		return stripPort(domain)
+	}
+	return stripPort(endpoint + "." + domain)
+}
+
+// Base domain the host is, if any. Used to scope endpoints addressed by path.
+func (h *Hosts) DomainOf(host string) (string, bool) {
+	host = normalizeHost(host)
+	for _, d := range h.domains {
+		if host == d || stripPort(host) == d {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+// Reports whether the host is the API host, a base domain or under one.
+func (h *Hosts) IsManaged(host string) bool {
+	host = stripPort(normalizeHost(host))
+	if host == stripPort(h.apiHost) {
+		return true
+	}
+	for _, d := range h.domains {
+		d = stripPort(d)
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Splits a request host like acme.checkpost.io into the endpoint and the base domain it was
+// addressed on. Only single label endpoints on configured domains match, and only when endpoints
+// are addressed by subdomain.
+func (h *Hosts) Resolve(host string) (endpoint string, domain string, ok bool) {
+	if h.IsPathAddressing() {
+		return "", "", false
+	}
+	host = normalizeHost(host)
+	for _, candidate := range []string{host, stripPort(host)} {
+		for _, d := range h.domains {
+			label, found := strings.CutSuffix(candidate, "."+d)
+			if found && label != "" && !strings.Contains(label, ".") {
+				return label, d, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveHost(t *testing.T) {
+	hosts, err := NewHosts("", "", "", []string{"checkpost.io", "Hooks.Internal.Example.com.", "localhost:3000"})
+	assert.NoError(t, err)
+
+	cases := []struct {
+		host     string
+		endpoint string
+		domain   string
+		ok       bool
+	}{
+		{"acme.checkpost.io", "acme", "checkpost.io", true},
+		{"ACME.checkpost.io:443", "acme", "checkpost.io", true},
+		{"acme.hooks.internal.example.com", "acme", "hooks.internal.example.com", true},
+		{"acme.localhost:3000", "acme", "localhost:3000", true},
+		{"checkpost.io", "", "", false},
+		{"a.b.checkpost.io", "", "", false},
+		{"acme.evilcheckpost.io", "", "", false},
+		{"acme.checkpost.io.evil.com", "", "", false},
+	}
+	for _, tc := range cases {
+		endpoint, domain, ok := hosts.Resolve(tc.host)
+		assert.Equal(t, tc.ok, ok, tc.host)
+		assert.Equal(t, tc.endpoint, endpoint, tc.host)
+		assert.Equal(t, tc.domain, domain, tc.host)
+	}
+
+	assert.True(t, hosts.IsApiHost("api.checkpost.io:443"))
+	assert.Equal(t, "https://acme.checkpost.io", hosts.EndpointURL("", "acme"))
+}
+
+func TestNewHostsRejectsUnknownScheme(t *testing.T) {
+	_, err := NewHosts("ftp", "", "", nil)
+	assert.Error(t, err)
+}
+
+func TestPathAddressing(t *testing.T) {
+	hosts, err := NewHosts("http", "", AddressingPath, []string{"hooks.internal.example.com", "localhost:3000"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "http://hooks.internal.example.com/h/acme", hosts.EndpointURL("", "acme"))
+	assert.Equal(t, "http://localhost:3000/h/acme", hosts.EndpointURL("localhost:3000", "acme"))
+	assert.Equal(t, "hooks.internal.example.com", hosts.EndpointHost("", "acme"))
+
+	// Subdomains are not parsed, so no wildcard DNS is needed
+	_, _, ok := hosts.Resolve("acme.hooks.internal.example.com")
+	assert.False(t, ok)
+
+	domain, ok := hosts.DomainOf("localhost:3000")
+	assert.True(t, ok)
+	assert.Equal(t, "localhost:3000", domain)
+}
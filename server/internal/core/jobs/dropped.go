@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/humanbeeng/checkpost/server/internal/endpoint"
+	"github.com/robfig/cron/v3"
+)
+
+// Periodically persists the number of hook requests dropped by the rate limiter.
+type DroppedRequestsFlusher struct {
+	cron            *cron.Cron
+	endpointService *endpoint.EndpointService
+}
+
+func NewDroppedRequestsFlusher(cron *cron.Cron, endpointService *endpoint.EndpointService) *DroppedRequestsFlusher {
+	return &DroppedRequestsFlusher{
+		cron:            cron,
+		endpointService: endpointService,
+	}
+}
+
+func (df *DroppedRequestsFlusher) Start() error {
+	slog.Info("Starting dropped requests flusher")
+
+	_, err := df.cron.AddFunc("@every 30s", df.flush)
+	if err != nil {
+		slog.Error("unable to register dropped requests flusher", "err", err)
+		return err
+	}
+
+	df.cron.Start()
+	return nil
+}
+
+func (df *DroppedRequestsFlusher) flush() {
+	df.endpointService.FlushDroppedCounts(context.Background())
+}
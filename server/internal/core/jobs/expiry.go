@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/humanbeeng/checkpost/server/internal/endpoint"
+	"github.com/humanbeeng/checkpost/server/internal/metrics"
 	"github.com/robfig/cron/v3"
 )
 
@@ -41,5 +42,13 @@ func (re *ExpiredRequestsRemover) Stop() context.Context {
 
 func (re *ExpiredRequestsRemover) deleteExpiredRequests() {
 	slog.Info("Deleting expired requests", "date", time.Now().Local().String())
-	re.endpointStore.ExpireRequests(context.Background())
+	start := time.Now()
+	deleted, err := re.endpointStore.ExpireRequests(context.Background())
+	metrics.JobDuration.WithLabelValues("expire_requests").Observe(time.Since(start).Seconds())
+	if err != nil {
+		slog.Error("unable to delete expired requests", "err", err)
+		return
+	}
+	metrics.ExpiredRequestsDeleted.Add(float64(deleted))
+	slog.Info("Deleted expired requests", "count", deleted)
 }
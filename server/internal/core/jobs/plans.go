@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/robfig/cron/v3"
+)
+
+// Periodically reloads plan overrides from the plan_limit table.
+type PlanCatalogRefresher struct {
+	cron    *cron.Cron
+	catalog *plan.Catalog
+	planq   plan.PlanQuerier
+}
+
+func NewPlanCatalogRefresher(cron *cron.Cron, catalog *plan.Catalog, planq plan.PlanQuerier) *PlanCatalogRefresher {
+	return &PlanCatalogRefresher{
+		cron:    cron,
+		catalog: catalog,
+		planq:   planq,
+	}
+}
+
+func (pr *PlanCatalogRefresher) Start() error {
+	slog.Info("Starting plan catalog refresher")
+
+	_, err := pr.cron.AddFunc("@every 5m", pr.refresh)
+	if err != nil {
+		slog.Error("unable to register plan catalog refresher", "err", err)
+		return err
+	}
+
+	pr.cron.Start()
+	return nil
+}
+
+func (pr *PlanCatalogRefresher) refresh() {
+	pr.catalog.Load(context.Background(), pr.planq)
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/humanbeeng/checkpost/server/internal/reserved"
+	"github.com/robfig/cron/v3"
+)
+
+// Periodically reloads reserved names so that changes made on other instances are picked up.
+type ReservedNamesRefresher struct {
+	cron      *cron.Cron
+	names     *reserved.Names
+	reservedq reserved.ReservedQuerier
+}
+
+func NewReservedNamesRefresher(cron *cron.Cron, names *reserved.Names, reservedq reserved.ReservedQuerier) *ReservedNamesRefresher {
+	return &ReservedNamesRefresher{
+		cron:      cron,
+		names:     names,
+		reservedq: reservedq,
+	}
+}
+
+func (rr *ReservedNamesRefresher) Start() error {
+	slog.Info("Starting reserved names refresher")
+
+	_, err := rr.cron.AddFunc("@every 5m", rr.refresh)
+	if err != nil {
+		slog.Error("unable to register reserved names refresher", "err", err)
+		return err
+	}
+
+	rr.cron.Start()
+	return nil
+}
+
+func (rr *ReservedNamesRefresher) refresh() {
+	rr.names.Load(context.Background(), rr.reservedq)
+}
@@ -0,0 +1,53 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/humanbeeng/checkpost/server/internal/auth"
+	"github.com/robfig/cron/v3"
+)
+
+// Deletes sessions whose refresh tokens have expired, along with expired sign in links.
+type ExpiredSessionsRemover struct {
+	cron       *cron.Cron
+	sessions   *auth.SessionService
+	magicLinks *auth.MagicLinkService
+}
+
+func NewExpiredSessionsRemover(cron *cron.Cron, sessions *auth.SessionService, magicLinks *auth.MagicLinkService) *ExpiredSessionsRemover {
+	return &ExpiredSessionsRemover{
+		cron:       cron,
+		sessions:   sessions,
+		magicLinks: magicLinks,
+	}
+}
+
+func (sr *ExpiredSessionsRemover) Start() error {
+	slog.Info("Starting expired sessions remover")
+
+	_, err := sr.cron.AddFunc("@hourly", sr.removeExpiredSessions)
+	if err != nil {
+		slog.Error("unable to register expired sessions remover", "err", err)
+		return err
+	}
+
+	sr.cron.Start()
+	return nil
+}
+
+func (sr *ExpiredSessionsRemover) removeExpiredSessions() {
+	removed, err := sr.sessions.RemoveExpiredSessions(context.Background())
+	if err != nil {
+		slog.Error("unable to remove expired sessions", "err", err)
+		return
+	}
+	slog.Info("Removed expired sessions", "num_removed", removed)
+
+	removed, err = sr.magicLinks.RemoveExpiredLinks(context.Background())
+	if err != nil {
+		slog.Error("unable to remove expired magic links", "err", err)
+		return
+	}
+	slog.Info("Removed expired magic links", "num_removed", removed)
+}
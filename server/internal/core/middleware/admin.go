@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/humanbeeng/checkpost/server/internal/core"
+)
+
+// Allows only admins to access a given API. Must run after the auth required middleware.
+func NewAdminRequiredMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if role != core.RoleAdmin {
+			slog.WarnContext(c.UserContext(), "Rejected non admin access to admin API", "userId", c.Locals("userId"), "path", c.Path())
+			return fiber.ErrForbidden
+		}
+		return c.Next()
+	}
+}
@@ -6,20 +6,21 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/humanbeeng/checkpost/server/internal/logging"
 )
 
-// Allows only signed in users to access a given API
-func NewAuthRequiredMiddleware(pv *core.PasetoVerifier) fiber.Handler {
+// Allows only signed in users with an active session to access a given API
+func NewAuthRequiredMiddleware(pv *core.PasetoVerifier, sessions core.SessionChecker) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		token := c.Cookies("token", "")
 		if token == "" {
-			slog.Info("Received empty token")
+			slog.InfoContext(c.UserContext(), "Received empty token")
 			return fiber.ErrUnauthorized
 		}
 
 		payload, err := pv.VerifyToken(token)
 		if err != nil {
-			slog.Error("unable to verify token", "err", err)
+			slog.ErrorContext(c.UserContext(), "unable to verify token", "err", err)
 			return fiber.ErrUnauthorized
 		}
 		userId, err := strconv.ParseInt(payload.Subject, 10, 64)
@@ -27,7 +28,19 @@ func NewAuthRequiredMiddleware(pv *core.PasetoVerifier) fiber.Handler {
 			return fiber.ErrUnauthorized
 		}
 
+		active, err := sessions.SessionActive(c.UserContext(), payload.Jti)
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "unable to check session", "err", err)
+			return fiber.ErrInternalServerError
+		}
+		if !active {
+			slog.InfoContext(c.UserContext(), "Rejected token of revoked session", "userId", userId, "sessionId", payload.Jti)
+			return fiber.ErrUnauthorized
+		}
+
 		c.Locals("userId", userId)
+		c.Locals("sessionId", payload.Jti)
+		c.SetUserContext(logging.With(c.UserContext(), "userId", userId, "sessionId", payload.Jti))
 		c.Locals("username", payload.Get("username"))
 		c.Locals("plan", payload.Get("plan"))
 		c.Locals("role", payload.Get("role"))
@@ -5,11 +5,16 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cache"
+	"github.com/gofiber/fiber/v2/utils"
 )
 
 func NewCacheMiddleware() fiber.Handler {
 	return cache.New(cache.Config{
 		Expiration:   30 * time.Minute,
 		CacheControl: true,
+		// Responses vary by query, e.g. the base domain an endpoint name is checked on
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return utils.CopyString(c.OriginalURL())
+		},
 	})
 }
@@ -1,32 +1,37 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
-	"log/slog"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/humanbeeng/checkpost/server/internal/core"
 )
 
-func NewSubdomainRouterMiddleware() fiber.Handler {
+// Maps hostnames owned by users to the endpoint they serve.
+type CustomDomainResolver interface {
+	ResolveCustomDomain(ctx context.Context, host string) (endpoint string, domain string, ok bool)
+}
+
+// Routes requests addressed to a custom domain or to <endpoint>.<domain> to the hook handler of that
+// endpoint. The API host and any other host are served as is.
+func NewSubdomainRouterMiddleware(hosts *core.Hosts, custom CustomDomainResolver) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		subdomains := c.Subdomains()
-		if len(subdomains) == 0 {
-			slog.Error("No subdomains found")
+		host := c.Hostname()
+		if hosts.IsApiHost(host) {
 			return c.Next()
 		}
-		subdomain := subdomains[0]
-		switch subdomain {
-		// TODO: Add reserved subdomain routing
-		case "api", "localhost:3000":
-			{
-				return c.Next()
-			}
-		default:
-			{
-				hook := fmt.Sprintf("/endpoint/hook/%s%s", subdomain, c.Path())
-				c.Path(hook)
-			}
+
+		endpoint, domain, ok := custom.ResolveCustomDomain(c.UserContext(), host)
+		if !ok {
+			endpoint, domain, ok = hosts.Resolve(host)
+		}
+		if !ok {
+			return c.Next()
 		}
+
+		c.Locals("domain", domain)
+		c.Path(fmt.Sprintf("/endpoint/hook/%s%s", endpoint, c.Path()))
 		return c.Next()
 	}
 }
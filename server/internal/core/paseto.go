@@ -28,18 +28,30 @@ func NewPasetoVerifier(symmetricKey string) (*PasetoVerifier, error) {
 	}, nil
 }
 
+// Roles carried in the role claim of access tokens.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type CreateTokenArgs struct {
-	Username string
-	UserId   int64
-	Plan     db.Plan
-	Role     string
+	// Embedded as jti. A random id is generated when empty.
+	SessionId string
+	Username  string
+	UserId    int64
+	Plan      db.Plan
+	Role      string
 }
 
 func (p *PasetoVerifier) CreateToken(args CreateTokenArgs, duration time.Duration) (string, error) {
 	slog.Info("Creating new paseto token")
-	id, err := gonanoid.New()
-	if err != nil {
-		return "", err
+	id := args.SessionId
+	if id == "" {
+		var err error
+		id, err = gonanoid.New()
+		if err != nil {
+			return "", err
+		}
 	}
 
 	jt := paseto.JSONToken{
@@ -0,0 +1,9 @@
+package core
+
+import "context"
+
+// Reports whether the session a token was issued for is still active.
+// Implemented by the auth session service, used wherever tokens are verified.
+type SessionChecker interface {
+	SessionActive(ctx context.Context, sessionId string) (bool, error)
+}
@@ -0,0 +1,97 @@
+package customdomain
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/humanbeeng/checkpost/server/internal/audit"
+)
+
+type CustomDomainController struct {
+	service *CustomDomainService
+	audit   *audit.AuditService
+}
+
+func NewCustomDomainController(service *CustomDomainService, audit *audit.AuditService) *CustomDomainController {
+	return &CustomDomainController{
+		service: service,
+		audit:   audit,
+	}
+}
+
+func (cc *CustomDomainController) RegisterRoutes(app *fiber.App, authmw fiber.Handler) {
+	domainGroup := app.Group("/endpoint/domains", authmw)
+
+	domainGroup.Get("/:endpoint", cc.ListDomainsHandler)
+	domainGroup.Post("/:endpoint", cc.AddDomainHandler)
+	domainGroup.Post("/:endpoint/:hostname/verify", cc.VerifyDomainHandler)
+	domainGroup.Delete("/:endpoint/:hostname", cc.RemoveDomainHandler)
+}
+
+func (cc *CustomDomainController) ListDomainsHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+
+	domains, domainErr := cc.service.ListDomains(c.UserContext(), userId, c.Params("endpoint"), c.Query("domain"))
+	if domainErr != nil {
+		return toFiberError(domainErr)
+	}
+	return c.JSON(domains)
+}
+
+type AddDomainRequest struct {
+	Hostname string `json:"hostname"`
+}
+
+// Responds with the TXT record proving ownership and the CNAME target.
+func (cc *CustomDomainController) AddDomainHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+
+	var req AddDomainRequest
+	if err := c.BodyParser(&req); err != nil || req.Hostname == "" {
+		return fiber.ErrBadRequest
+	}
+
+	domain, domainErr := cc.service.AddDomain(c.UserContext(), userId, c.Params("endpoint"), c.Query("domain"), req.Hostname)
+	if domainErr != nil {
+		return toFiberError(domainErr)
+	}
+
+	cc.record(c, audit.ActionCustomDomainAdd, domain.Hostname)
+	return c.Status(fiber.StatusCreated).JSON(domain)
+}
+
+func (cc *CustomDomainController) VerifyDomainHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+
+	domain, domainErr := cc.service.VerifyDomain(c.UserContext(), userId, c.Params("endpoint"), c.Query("domain"), c.Params("hostname"))
+	if domainErr != nil {
+		return toFiberError(domainErr)
+	}
+
+	cc.record(c, audit.ActionCustomDomainVerify, domain.Hostname)
+	return c.JSON(domain)
+}
+
+func (cc *CustomDomainController) RemoveDomainHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+
+	if domainErr := cc.service.RemoveDomain(c.UserContext(), userId, c.Params("endpoint"), c.Query("domain"), c.Params("hostname")); domainErr != nil {
+		return toFiberError(domainErr)
+	}
+
+	cc.record(c, audit.ActionCustomDomainRemove, normalizeHostname(c.Params("hostname")))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (cc *CustomDomainController) record(c *fiber.Ctx, action audit.Action, hostname string) {
+	entry := audit.FromRequest(c, action, audit.EndpointTarget(strings.ToLower(c.Params("endpoint"))))
+	entry.After = map[string]string{"hostname": hostname}
+	cc.audit.Record(c.UserContext(), entry)
+}
+
+func toFiberError(domainErr *CustomDomainError) *fiber.Error {
+	return &fiber.Error{
+		Code:    domainErr.Code,
+		Message: domainErr.Message,
+	}
+}
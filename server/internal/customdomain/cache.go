@@ -0,0 +1,60 @@
+package customdomain
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// How long a resolved host is served before it is looked up again. Changes made on other
+	// instances take up to this long to apply.
+	hostCacheTTL = time.Minute
+	// Caps memory spent on hosts that are not custom domains, e.g. scanners probing random names
+	maxCachedHosts = 10_000
+)
+
+type hostEntry struct {
+	endpoint string
+	domain   string
+	found    bool
+	expires  time.Time
+}
+
+type hostCache struct {
+	sync.RWMutex
+	ttl     time.Duration
+	entries map[string]hostEntry
+}
+
+func newHostCache(ttl time.Duration) *hostCache {
+	return &hostCache{
+		ttl:     ttl,
+		entries: make(map[string]hostEntry),
+	}
+}
+
+func (c *hostCache) get(hostname string) (hostEntry, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	entry, ok := c.entries[hostname]
+	if !ok || time.Now().After(entry.expires) {
+		return hostEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *hostCache) set(hostname string, entry hostEntry) {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.entries) >= maxCachedHosts {
+		c.entries = make(map[string]hostEntry)
+	}
+	entry.expires = time.Now().Add(c.ttl)
+	c.entries[hostname] = entry
+}
+
+func (c *hostCache) forget(hostname string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, hostname)
+}
@@ -0,0 +1,347 @@
+package customdomain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// The TXT record proving control of webhooks.acme.dev is set on _checkpost-challenge.webhooks.acme.dev
+	ChallengeRecordPrefix = "_checkpost-challenge."
+	ChallengeValuePrefix  = "checkpost-verification="
+)
+
+var hostnameRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// Looks up TXT records. Satisfied by *net.Resolver, faked in tests.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+type CustomDomainError struct {
+	Code    int
+	Message string
+}
+
+func (c *CustomDomainError) Error() string {
+	return c.Message
+}
+
+func NewInternalServerError() *CustomDomainError {
+	return &CustomDomainError{
+		Code:    http.StatusInternalServerError,
+		Message: "Oops! Something went wrong :(",
+	}
+}
+
+func NewDomainNotFoundError() *CustomDomainError {
+	return &CustomDomainError{
+		Code:    http.StatusNotFound,
+		Message: "Domain not found",
+	}
+}
+
+type CustomDomain struct {
+	Hostname   string     `json:"hostname"`
+	Verified   bool       `json:"verified"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	// CNAME the hostname should point to
+	Target string `json:"target"`
+	// TXT record to create to prove ownership. Only set while the domain is unverified.
+	RecordName  string `json:"record_name,omitempty"`
+	RecordValue string `json:"record_value,omitempty"`
+}
+
+// Serves endpoints on hostnames owned by their users, e.g. webhooks.acme.dev.
+type CustomDomainService struct {
+	domainq  CustomDomainQuerier
+	resolver TXTResolver
+	plans    *plan.Catalog
+	hosts    *core.Hosts
+	cache    *hostCache
+}
+
+func NewCustomDomainService(domainq CustomDomainQuerier, resolver TXTResolver, plans *plan.Catalog, hosts *core.Hosts) *CustomDomainService {
+	return &CustomDomainService{
+		domainq:  domainq,
+		resolver: resolver,
+		plans:    plans,
+		hosts:    hosts,
+		cache:    newHostCache(hostCacheTTL),
+	}
+}
+
+func (s *CustomDomainService) ListDomains(ctx context.Context, userId int64, endpoint string, domain string) ([]CustomDomain, *CustomDomainError) {
+	endpointRecord, domainErr := s.getOwnedEndpoint(ctx, endpoint, domain, userId)
+	if domainErr != nil {
+		return nil, domainErr
+	}
+
+	records, err := s.domainq.ListCustomDomains(ctx, endpointRecord.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list custom domains", "endpoint", endpoint, "err", err)
+		return nil, NewInternalServerError()
+	}
+
+	domains := make([]CustomDomain, 0, len(records))
+	for _, rec := range records {
+		domains = append(domains, s.domainFromRecord(endpointRecord, rec))
+	}
+	return domains, nil
+}
+
+// Claims a hostname for the endpoint. It serves the endpoint once the TXT challenge is verified.
+func (s *CustomDomainService) AddDomain(ctx context.Context, userId int64, endpoint string, domain string, hostname string) (CustomDomain, *CustomDomainError) {
+	endpointRecord, domainErr := s.getOwnedEndpoint(ctx, endpoint, domain, userId)
+	if domainErr != nil {
+		return CustomDomain{}, domainErr
+	}
+	if domainErr := s.checkPlan(ctx, userId); domainErr != nil {
+		return CustomDomain{}, domainErr
+	}
+
+	hostname, domainErr = s.parseHostname(hostname)
+	if domainErr != nil {
+		return CustomDomain{}, domainErr
+	}
+
+	token, err := gonanoid.New(32)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to generate custom domain token", "err", err)
+		return CustomDomain{}, NewInternalServerError()
+	}
+
+	rec, err := s.domainq.CreateCustomDomain(ctx, db.CreateCustomDomainParams{
+		EndpointID: endpointRecord.ID,
+		Hostname:   hostname,
+		Token:      token,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return CustomDomain{}, &CustomDomainError{
+				Code:    http.StatusConflict,
+				Message: fmt.Sprintf("%s is already added to this endpoint.", hostname),
+			}
+		}
+		slog.ErrorContext(ctx, "unable to create custom domain", "endpoint", endpoint, "hostname", hostname, "err", err)
+		return CustomDomain{}, NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Custom domain added", "endpoint", endpoint, "hostname", hostname, "userId", userId)
+	return s.domainFromRecord(endpointRecord, rec), nil
+}
+
+func (s *CustomDomainService) VerifyDomain(ctx context.Context, userId int64, endpoint string, domain string, hostname string) (CustomDomain, *CustomDomainError) {
+	endpointRecord, domainErr := s.getOwnedEndpoint(ctx, endpoint, domain, userId)
+	if domainErr != nil {
+		return CustomDomain{}, domainErr
+	}
+	if domainErr := s.checkPlan(ctx, userId); domainErr != nil {
+		return CustomDomain{}, domainErr
+	}
+
+	hostname = normalizeHostname(hostname)
+	rec, err := s.domainq.GetCustomDomain(ctx, db.GetCustomDomainParams{EndpointID: endpointRecord.ID, Hostname: hostname})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return CustomDomain{}, NewDomainNotFoundError()
+		}
+		slog.ErrorContext(ctx, "unable to get custom domain", "endpoint", endpoint, "hostname", hostname, "err", err)
+		return CustomDomain{}, NewInternalServerError()
+	}
+	if rec.VerifiedAt.Valid {
+		return s.domainFromRecord(endpointRecord, rec), nil
+	}
+
+	records, err := s.resolver.LookupTXT(ctx, ChallengeRecordPrefix+hostname)
+	if err != nil {
+		// Missing records surface as lookup errors, which just mean the challenge is not in place yet
+		slog.InfoContext(ctx, "TXT lookup failed", "hostname", hostname, "err", err)
+	}
+	if !slices.Contains(records, ChallengeValuePrefix+rec.Token) {
+		return CustomDomain{}, &CustomDomainError{
+			Code:    http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("TXT record %s%s with value %s%s was not found. DNS changes can take a while to propagate.", ChallengeRecordPrefix, hostname, ChallengeValuePrefix, rec.Token),
+		}
+	}
+
+	verified, err := s.domainq.VerifyCustomDomain(ctx, db.VerifyCustomDomainParams{EndpointID: endpointRecord.ID, Hostname: hostname})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return CustomDomain{}, &CustomDomainError{
+				Code:    http.StatusConflict,
+				Message: fmt.Sprintf("%s already serves another endpoint.", hostname),
+			}
+		}
+		slog.ErrorContext(ctx, "unable to verify custom domain", "endpoint", endpoint, "hostname", hostname, "err", err)
+		return CustomDomain{}, NewInternalServerError()
+	}
+	s.cache.forget(hostname)
+
+	slog.InfoContext(ctx, "Custom domain verified", "endpoint", endpoint, "hostname", hostname, "userId", userId)
+	return s.domainFromRecord(endpointRecord, verified), nil
+}
+
+func (s *CustomDomainService) RemoveDomain(ctx context.Context, userId int64, endpoint string, domain string, hostname string) *CustomDomainError {
+	endpointRecord, domainErr := s.getOwnedEndpoint(ctx, endpoint, domain, userId)
+	if domainErr != nil {
+		return domainErr
+	}
+
+	hostname = normalizeHostname(hostname)
+	removed, err := s.domainq.DeleteCustomDomain(ctx, db.DeleteCustomDomainParams{EndpointID: endpointRecord.ID, Hostname: hostname})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to delete custom domain", "endpoint", endpoint, "hostname", hostname, "err", err)
+		return NewInternalServerError()
+	}
+	if removed == 0 {
+		return NewDomainNotFoundError()
+	}
+	s.cache.forget(hostname)
+
+	slog.InfoContext(ctx, "Custom domain removed", "endpoint", endpoint, "hostname", hostname, "userId", userId)
+	return nil
+}
+
+// Endpoint served on the host and the base domain it belongs to. Hosts under our own domains are
+// never custom domains. Lookups are cached, including misses.
+func (s *CustomDomainService) ResolveCustomDomain(ctx context.Context, host string) (string, string, bool) {
+	if s.hosts.IsManaged(host) {
+		return "", "", false
+	}
+
+	hostname := normalizeHostname(host)
+	if entry, ok := s.cache.get(hostname); ok {
+		return entry.endpoint, entry.domain, entry.found
+	}
+
+	row, err := s.domainq.ResolveCustomDomain(ctx, hostname)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		// Not cached, so the next request retries
+		slog.ErrorContext(ctx, "unable to resolve custom domain", "hostname", hostname, "err", err)
+		return "", "", false
+	}
+
+	entry := hostEntry{}
+	if err == nil {
+		// Downgraded users keep their domains but they stop serving
+		limits, ok := s.plans.Get(row.Plan)
+		if ok && limits.HasFeature(plan.FeatureCustomDomains) {
+			entry = hostEntry{endpoint: row.Endpoint, domain: row.Domain, found: true}
+		}
+	}
+	s.cache.set(hostname, entry)
+	return entry.endpoint, entry.domain, entry.found
+}
+
+// Endpoints are looked up on the given base domain, or on the primary domain when empty.
+func (s *CustomDomainService) getOwnedEndpoint(ctx context.Context, endpoint string, domain string, userId int64) (db.Endpoint, *CustomDomainError) {
+	endpoint = strings.ToLower(endpoint)
+	domain = strings.ToLower(domain)
+	if domain == "" {
+		domain = s.hosts.Primary()
+	}
+
+	endpointRecord, err := s.domainq.GetEndpoint(ctx, db.GetEndpointDetailsParams{Endpoint: endpoint, Domain: domain})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.Endpoint{}, &CustomDomainError{
+				Code:    http.StatusNotFound,
+				Message: fmt.Sprintf("Endpoint %v not found", endpoint),
+			}
+		}
+		slog.ErrorContext(ctx, "unable to fetch endpoint details", "endpoint", endpoint, "err", err)
+		return db.Endpoint{}, NewInternalServerError()
+	}
+
+	if !endpointRecord.UserID.Valid || endpointRecord.UserID.Int64 != userId {
+		return db.Endpoint{}, &CustomDomainError{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("Endpoint %v not found", endpoint),
+		}
+	}
+	return endpointRecord, nil
+}
+
+func (s *CustomDomainService) checkPlan(ctx context.Context, userId int64) *CustomDomainError {
+	user, err := s.domainq.GetUser(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to get user", "userId", userId, "err", err)
+		return NewInternalServerError()
+	}
+
+	limits, ok := s.plans.Get(user.Plan)
+	if !ok || !limits.HasFeature(plan.FeatureCustomDomains) {
+		return &CustomDomainError{
+			Code:    http.StatusForbidden,
+			Message: "Custom domains are not available on your current plan. Consider upgrading.",
+		}
+	}
+	return nil
+}
+
+func (s *CustomDomainService) parseHostname(hostname string) (string, *CustomDomainError) {
+	hostname = normalizeHostname(hostname)
+	if len(hostname) > 253 || !hostnameRegex.MatchString(hostname) {
+		return "", &CustomDomainError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid hostname.",
+		}
+	}
+	if _, err := publicsuffix.EffectiveTLDPlusOne(hostname); err != nil {
+		return "", &CustomDomainError{
+			Code:    http.StatusBadRequest,
+			Message: "Hostname should not be a public suffix.",
+		}
+	}
+	if s.hosts.IsManaged(hostname) {
+		return "", &CustomDomainError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("%s is not a custom domain.", hostname),
+		}
+	}
+	return hostname, nil
+}
+
+func (s *CustomDomainService) domainFromRecord(endpoint db.Endpoint, rec db.CustomDomain) CustomDomain {
+	d := CustomDomain{
+		Hostname: rec.Hostname,
+		Verified: rec.VerifiedAt.Valid,
+		Target:   s.hosts.EndpointHost(endpoint.Domain, endpoint.Endpoint),
+	}
+	if rec.VerifiedAt.Valid {
+		verifiedAt := rec.VerifiedAt.Time
+		d.VerifiedAt = &verifiedAt
+	} else {
+		d.RecordName = ChallengeRecordPrefix + rec.Hostname
+		d.RecordValue = ChallengeValuePrefix + rec.Token
+	}
+	return d
+}
+
+// Lowercases and drops the trailing dot and port.
+func normalizeHostname(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
@@ -0,0 +1,217 @@
+package customdomain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	ProUserId  int64 = 1
+	FreeUserId int64 = 2
+)
+
+type MockCustomDomainStore struct {
+	users     map[int64]db.User
+	endpoints map[string]db.Endpoint
+	domains   map[string]db.CustomDomain
+	resolves  int
+}
+
+func newMockCustomDomainStore() *MockCustomDomainStore {
+	return &MockCustomDomainStore{
+		users: map[int64]db.User{
+			ProUserId:  {ID: ProUserId, Plan: db.PlanPro},
+			FreeUserId: {ID: FreeUserId, Plan: db.PlanFree},
+		},
+		endpoints: map[string]db.Endpoint{
+			"acme": {ID: 10, Endpoint: "acme", Domain: "checkpost.io", UserID: pgtype.Int8{Int64: ProUserId, Valid: true}},
+			"free": {ID: 11, Endpoint: "free", Domain: "checkpost.io", UserID: pgtype.Int8{Int64: FreeUserId, Valid: true}},
+		},
+		domains: map[string]db.CustomDomain{},
+	}
+}
+
+func (ms *MockCustomDomainStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	u, ok := ms.users[userId]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	return u, nil
+}
+
+func (ms *MockCustomDomainStore) GetEndpoint(ctx context.Context, params db.GetEndpointDetailsParams) (db.Endpoint, error) {
+	e, ok := ms.endpoints[params.Endpoint]
+	if !ok || e.Domain != params.Domain {
+		return db.Endpoint{}, pgx.ErrNoRows
+	}
+	return e, nil
+}
+
+func (ms *MockCustomDomainStore) CreateCustomDomain(ctx context.Context, params db.CreateCustomDomainParams) (db.CustomDomain, error) {
+	d := db.CustomDomain{EndpointID: params.EndpointID, Hostname: params.Hostname, Token: params.Token}
+	ms.domains[params.Hostname] = d
+	return d, nil
+}
+
+func (ms *MockCustomDomainStore) GetCustomDomain(ctx context.Context, params db.GetCustomDomainParams) (db.CustomDomain, error) {
+	d, ok := ms.domains[params.Hostname]
+	if !ok || d.EndpointID != params.EndpointID {
+		return db.CustomDomain{}, pgx.ErrNoRows
+	}
+	return d, nil
+}
+
+func (ms *MockCustomDomainStore) ListCustomDomains(ctx context.Context, endpointId int64) ([]db.CustomDomain, error) {
+	domains := []db.CustomDomain{}
+	for _, d := range ms.domains {
+		if d.EndpointID == endpointId {
+			domains = append(domains, d)
+		}
+	}
+	return domains, nil
+}
+
+func (ms *MockCustomDomainStore) VerifyCustomDomain(ctx context.Context, params db.VerifyCustomDomainParams) (db.CustomDomain, error) {
+	d := ms.domains[params.Hostname]
+	d.VerifiedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	ms.domains[params.Hostname] = d
+	return d, nil
+}
+
+func (ms *MockCustomDomainStore) DeleteCustomDomain(ctx context.Context, params db.DeleteCustomDomainParams) (int64, error) {
+	if _, ok := ms.domains[params.Hostname]; !ok {
+		return 0, nil
+	}
+	delete(ms.domains, params.Hostname)
+	return 1, nil
+}
+
+func (ms *MockCustomDomainStore) ResolveCustomDomain(ctx context.Context, hostname string) (db.ResolveCustomDomainRow, error) {
+	ms.resolves++
+	d, ok := ms.domains[hostname]
+	if !ok || !d.VerifiedAt.Valid {
+		return db.ResolveCustomDomainRow{}, pgx.ErrNoRows
+	}
+	for _, e := range ms.endpoints {
+		if e.ID == d.EndpointID {
+			return db.ResolveCustomDomainRow{Endpoint: e.Endpoint, Domain: e.Domain, Plan: ms.users[e.UserID.Int64].Plan}, nil
+		}
+	}
+	return db.ResolveCustomDomainRow{}, pgx.ErrNoRows
+}
+
+type MockResolver struct {
+	records map[string][]string
+}
+
+func (r MockResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := r.records[name]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return records, nil
+}
+
+func newService(store *MockCustomDomainStore, resolver MockResolver) *CustomDomainService {
+	hosts, _ := core.NewHosts("https", "api.checkpost.io", core.AddressingSubdomain, []string{"checkpost.io"})
+	return NewCustomDomainService(store, resolver, plan.NewCatalog(plan.Defaults), hosts)
+}
+
+func TestAddDomainRequiresPlanFeature(t *testing.T) {
+	s := newService(newMockCustomDomainStore(), MockResolver{})
+
+	_, domainErr := s.AddDomain(context.TODO(), FreeUserId, "free", "", "webhooks.acme.dev")
+	assert.NotNil(t, domainErr)
+	assert.Equal(t, http.StatusForbidden, domainErr.Code)
+}
+
+func TestAddDomainRejectsOwnHosts(t *testing.T) {
+	s := newService(newMockCustomDomainStore(), MockResolver{})
+
+	for _, hostname := range []string{"other.checkpost.io", "api.checkpost.io", "checkpost.io", "co.uk", "not a host"} {
+		_, domainErr := s.AddDomain(context.TODO(), ProUserId, "acme", "", hostname)
+		assert.NotNil(t, domainErr, hostname)
+		assert.Equal(t, http.StatusBadRequest, domainErr.Code, hostname)
+	}
+}
+
+func TestAddDomainOfEndpointOwnedByAnotherUser(t *testing.T) {
+	s := newService(newMockCustomDomainStore(), MockResolver{})
+
+	_, domainErr := s.AddDomain(context.TODO(), ProUserId, "free", "", "webhooks.acme.dev")
+	assert.NotNil(t, domainErr)
+	assert.Equal(t, http.StatusNotFound, domainErr.Code)
+}
+
+func TestVerifyAndResolveDomain(t *testing.T) {
+	store := newMockCustomDomainStore()
+	resolver := MockResolver{records: map[string][]string{}}
+	s := newService(store, resolver)
+
+	d, domainErr := s.AddDomain(context.TODO(), ProUserId, "acme", "", "Webhooks.Acme.dev")
+	assert.Nil(t, domainErr)
+	assert.Equal(t, "webhooks.acme.dev", d.Hostname)
+	assert.Equal(t, "acme.checkpost.io", d.Target)
+	assert.Equal(t, "_checkpost-challenge.webhooks.acme.dev", d.RecordName)
+
+	// Unverified domains do not serve the endpoint
+	_, _, ok := s.ResolveCustomDomain(context.TODO(), "webhooks.acme.dev")
+	assert.False(t, ok)
+
+	_, domainErr = s.VerifyDomain(context.TODO(), ProUserId, "acme", "", "webhooks.acme.dev")
+	assert.NotNil(t, domainErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, domainErr.Code)
+
+	resolver.records[d.RecordName] = []string{d.RecordValue}
+	verified, domainErr := s.VerifyDomain(context.TODO(), ProUserId, "acme", "", "webhooks.acme.dev")
+	assert.Nil(t, domainErr)
+	assert.True(t, verified.Verified)
+
+	// Verification invalidates the cached miss
+	endpoint, domain, ok := s.ResolveCustomDomain(context.TODO(), "WEBHOOKS.acme.dev:443")
+	assert.True(t, ok)
+	assert.Equal(t, "acme", endpoint)
+	assert.Equal(t, "checkpost.io", domain)
+
+	resolves := store.resolves
+	_, _, ok = s.ResolveCustomDomain(context.TODO(), "webhooks.acme.dev")
+	assert.True(t, ok)
+	assert.Equal(t, resolves, store.resolves)
+
+	assert.Nil(t, s.RemoveDomain(context.TODO(), ProUserId, "acme", "", "webhooks.acme.dev"))
+	_, _, ok = s.ResolveCustomDomain(context.TODO(), "webhooks.acme.dev")
+	assert.False(t, ok)
+}
+
+func TestResolveDomainAfterDowngrade(t *testing.T) {
+	store := newMockCustomDomainStore()
+	store.domains["webhooks.acme.dev"] = db.CustomDomain{
+		EndpointID: 10,
+		Hostname:   "webhooks.acme.dev",
+		VerifiedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true},
+	}
+	store.users[ProUserId] = db.User{ID: ProUserId, Plan: db.PlanFree}
+	s := newService(store, MockResolver{})
+
+	_, _, ok := s.ResolveCustomDomain(context.TODO(), "webhooks.acme.dev")
+	assert.False(t, ok)
+}
+
+func TestResolveManagedHostSkipsLookup(t *testing.T) {
+	store := newMockCustomDomainStore()
+	s := newService(store, MockResolver{})
+
+	_, _, ok := s.ResolveCustomDomain(context.TODO(), "acme.checkpost.io")
+	assert.False(t, ok)
+	assert.Zero(t, store.resolves)
+}
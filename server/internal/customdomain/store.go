@@ -0,0 +1,61 @@
+package customdomain
+
+import (
+	"context"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+)
+
+type CustomDomainQuerier interface {
+	GetUser(ctx context.Context, userId int64) (db.User, error)
+	GetEndpoint(ctx context.Context, params db.GetEndpointDetailsParams) (db.Endpoint, error)
+
+	CreateCustomDomain(ctx context.Context, params db.CreateCustomDomainParams) (db.CustomDomain, error)
+	GetCustomDomain(ctx context.Context, params db.GetCustomDomainParams) (db.CustomDomain, error)
+	ListCustomDomains(ctx context.Context, endpointId int64) ([]db.CustomDomain, error)
+	VerifyCustomDomain(ctx context.Context, params db.VerifyCustomDomainParams) (db.CustomDomain, error)
+	DeleteCustomDomain(ctx context.Context, params db.DeleteCustomDomainParams) (int64, error)
+	ResolveCustomDomain(ctx context.Context, hostname string) (db.ResolveCustomDomainRow, error)
+}
+
+type CustomDomainStore struct {
+	q db.Querier
+}
+
+func NewCustomDomainStore(q db.Querier) *CustomDomainStore {
+	return &CustomDomainStore{
+		q: q,
+	}
+}
+
+func (cs CustomDomainStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	return cs.q.GetUser(ctx, userId)
+}
+
+func (cs CustomDomainStore) GetEndpoint(ctx context.Context, params db.GetEndpointDetailsParams) (db.Endpoint, error) {
+	return cs.q.GetEndpointDetails(ctx, params)
+}
+
+func (cs CustomDomainStore) CreateCustomDomain(ctx context.Context, params db.CreateCustomDomainParams) (db.CustomDomain, error) {
+	return cs.q.CreateCustomDomain(ctx, params)
+}
+
+func (cs CustomDomainStore) GetCustomDomain(ctx context.Context, params db.GetCustomDomainParams) (db.CustomDomain, error) {
+	return cs.q.GetCustomDomain(ctx, params)
+}
+
+func (cs CustomDomainStore) ListCustomDomains(ctx context.Context, endpointId int64) ([]db.CustomDomain, error) {
+	return cs.q.ListCustomDomains(ctx, endpointId)
+}
+
+func (cs CustomDomainStore) VerifyCustomDomain(ctx context.Context, params db.VerifyCustomDomainParams) (db.CustomDomain, error) {
+	return cs.q.VerifyCustomDomain(ctx, params)
+}
+
+func (cs CustomDomainStore) DeleteCustomDomain(ctx context.Context, params db.DeleteCustomDomainParams) (int64, error) {
+	return cs.q.DeleteCustomDomain(ctx, params)
+}
+
+func (cs CustomDomainStore) ResolveCustomDomain(ctx context.Context, hostname string) (db.ResolveCustomDomainRow, error) {
+	return cs.q.ResolveCustomDomain(ctx, hostname)
+}
@@ -0,0 +1,268 @@
+package endpoint
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const DefaultRejectCode int = http.StatusForbidden
+
+// Access rules configured by the owner of an endpoint. Every rule that is set must match
+// for a hook request to be accepted. Client certificates are only presented to the in process
+// TLS listener with client auth requested, behind a proxy terminating TLS their allowlist rejects every request.
+type AccessRules struct {
+	AllowedIps             []string `json:"allowed_ips"`
+	BasicUsername          string   `json:"basic_username"`
+	BasicPassword          string   `json:"basic_password,omitempty"`
+	HeaderName             string   `json:"header_name"`
+	HeaderValue            string   `json:"header_value,omitempty"`
+	QueryParam             string   `json:"query_param"`
+	QueryValue             string   `json:"query_value,omitempty"`
+	ClientCertFingerprints []string `json:"client_cert_fingerprints"`
+	RejectCode             int      `json:"reject_code"`
+}
+
+// Credentials presented by an incoming hook request.
+type AccessAttempt struct {
+	SourceIp              string
+	Headers               map[string][]string
+	QueryParams           map[string]string
+	Authorization         string
+	ClientCertFingerprint string
+}
+
+// Verified basic auth credentials are remembered up to this many entries, see verifyBasicPassword.
+const maxVerifiedPasswords = 10_000
+
+var verifiedPasswords = struct {
+	sync.Mutex
+	keys map[string]struct{}
+}{keys: make(map[string]struct{})}
+
+func HashBasicPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Hook senders present the same credentials on every request and bcrypt is slow by design, so credentials
+// are verified once and remembered in memory by a digest of the stored hash and the password.
+func verifyBasicPassword(hash string, password string) bool {
+	sum := sha256.Sum256([]byte(hash + "\x00" + password))
+	key := string(sum[:])
+
+	verifiedPasswords.Lock()
+	_, ok := verifiedPasswords.keys[key]
+	verifiedPasswords.Unlock()
+	if ok {
+		return true
+	}
+
+	if !strings.HasPrefix(hash, "$2") {
+		// Unsalted SHA-256 of rules stored before bcrypt was used. Replaced when the owner saves the rules again.
+		legacy := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(legacy[:])), []byte(hash)) == 1
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+
+	verifiedPasswords.Lock()
+	if len(verifiedPasswords.keys) >= maxVerifiedPasswords {
+		clear(verifiedPasswords.keys)
+	}
+	verifiedPasswords.keys[key] = struct{}{}
+	verifiedPasswords.Unlock()
+	return true
+}
+
+func FingerprintCert(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Secrets left out are kept from the stored rules, as they are never returned to be sent back.
+func (r AccessRules) Validate(stored db.EndpointAccess) *EndpointError {
+	for _, ip := range r.AllowedIps {
+		if _, err := parsePrefix(ip); err != nil {
+			return &EndpointError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid IP or CIDR: %s", ip),
+			}
+		}
+	}
+
+	if r.BasicUsername == "" && r.BasicPassword != "" {
+		return &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: "Basic auth username is required when password is set.",
+		}
+	}
+	if r.BasicUsername != "" && r.BasicPassword == "" && stored.BasicPasswordHash == "" {
+		return &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: "Basic auth password is required when username is set.",
+		}
+	}
+
+	if (r.HeaderName == "" && r.HeaderValue != "") || (r.HeaderName != "" && r.HeaderValue == "" && stored.HeaderValue == "") {
+		return &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: "Both header name and value are required.",
+		}
+	}
+
+	if (r.QueryParam == "" && r.QueryValue != "") || (r.QueryParam != "" && r.QueryValue == "" && stored.QueryValue == "") {
+		return &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: "Both query param and value are required.",
+		}
+	}
+
+	for _, fp := range r.ClientCertFingerprints {
+		if b, err := hex.DecodeString(normalizeFingerprint(fp)); err != nil || len(b) != sha256.Size {
+			return &EndpointError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid SHA-256 certificate fingerprint: %s", fp),
+			}
+		}
+	}
+
+	if r.RejectCode != 0 && (r.RejectCode < 400 || r.RejectCode > 599) {
+		return &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: "Reject code should be between 400 and 599.",
+		}
+	}
+	return nil
+}
+
+// Converts stored access rules to their API representation. Secrets are never returned.
+func accessRulesFromRecord(rec db.EndpointAccess) AccessRules {
+	return AccessRules{
+		AllowedIps:             rec.AllowedIps,
+		BasicUsername:          rec.BasicUsername,
+		HeaderName:             rec.HeaderName,
+		QueryParam:             rec.QueryParam,
+		ClientCertFingerprints: rec.ClientCertFingerprints,
+		RejectCode:             int(rec.RejectCode),
+	}
+}
+
+// Checks the attempt against the stored rules. Returns the reason for rejection, if any.
+func evaluateAccess(rec db.EndpointAccess, attempt AccessAttempt) (bool, string) {
+	if len(rec.AllowedIps) > 0 {
+		addr, err := netip.ParseAddr(attempt.SourceIp)
+		if err != nil {
+			return false, "invalid source ip"
+		}
+		allowed := false
+		for _, ip := range rec.AllowedIps {
+			prefix, err := parsePrefix(ip)
+			if err == nil && prefix.Contains(addr.Unmap()) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, "source ip not allowed"
+		}
+	}
+
+	if rec.BasicUsername != "" {
+		username, password, ok := parseBasicAuth(attempt.Authorization)
+		if !ok {
+			return false, "missing basic auth credentials"
+		}
+		userOk := subtle.ConstantTimeCompare([]byte(username), []byte(rec.BasicUsername)) == 1
+		passOk := verifyBasicPassword(rec.BasicPasswordHash, password)
+		if !userOk || !passOk {
+			return false, "invalid basic auth credentials"
+		}
+	}
+
+	if rec.HeaderName != "" {
+		var value string
+		for k, v := range attempt.Headers {
+			if strings.EqualFold(k, rec.HeaderName) && len(v) > 0 {
+				value = v[0]
+				break
+			}
+		}
+		if subtle.ConstantTimeCompare([]byte(value), []byte(rec.HeaderValue)) != 1 {
+			return false, "required header missing or invalid"
+		}
+	}
+
+	if rec.QueryParam != "" {
+		value := attempt.QueryParams[rec.QueryParam]
+		if subtle.ConstantTimeCompare([]byte(value), []byte(rec.QueryValue)) != 1 {
+			return false, "required query param missing or invalid"
+		}
+	}
+
+	if len(rec.ClientCertFingerprints) > 0 {
+		if attempt.ClientCertFingerprint == "" {
+			return false, "missing client certificate"
+		}
+		allowed := false
+		for _, fp := range rec.ClientCertFingerprints {
+			if normalizeFingerprint(fp) == normalizeFingerprint(attempt.ClientCertFingerprint) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false, "client certificate not allowed"
+		}
+	}
+
+	return true, ""
+}
+
+// Accepts both single addresses and CIDR ranges.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func parseBasicAuth(authorization string) (string, string, bool) {
+	const prefix = "Basic "
+	if len(authorization) < len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(authorization[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	return username, password, ok
+}
+
+// Fingerprints are commonly copied with colons, e.g. from openssl output.
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+}
@@ -0,0 +1,166 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateAccessAllowsWhenNoRules(t *testing.T) {
+	allowed, _ := evaluateAccess(db.EndpointAccess{}, AccessAttempt{SourceIp: "1.1.1.1"})
+	assert.True(t, allowed)
+}
+
+func TestEvaluateAccessIpAllowlist(t *testing.T) {
+	rules := db.EndpointAccess{AllowedIps: []string{"10.0.0.0/8", "192.168.1.7"}}
+
+	allowed, _ := evaluateAccess(rules, AccessAttempt{SourceIp: "10.20.30.40"})
+	assert.True(t, allowed)
+
+	allowed, _ = evaluateAccess(rules, AccessAttempt{SourceIp: "192.168.1.7"})
+	assert.True(t, allowed)
+
+	allowed, _ = evaluateAccess(rules, AccessAttempt{SourceIp: "::ffff:10.1.1.1"})
+	assert.True(t, allowed)
+
+	allowed, reason := evaluateAccess(rules, AccessAttempt{SourceIp: "192.168.1.8"})
+	assert.False(t, allowed)
+	assert.Equal(t, "source ip not allowed", reason)
+}
+
+func TestEvaluateAccessBasicAuth(t *testing.T) {
+	hash, err := HashBasicPassword("s3cret")
+	assert.NoError(t, err)
+	assert.NotContains(t, hash, "s3cret")
+	rules := db.EndpointAccess{BasicUsername: "vendor", BasicPasswordHash: hash}
+	basic := func(userpass string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(userpass))
+	}
+
+	allowed, _ := evaluateAccess(rules, AccessAttempt{Authorization: basic("vendor:s3cret")})
+	assert.True(t, allowed)
+
+	allowed, _ = evaluateAccess(rules, AccessAttempt{Authorization: basic("vendor:wrong")})
+	assert.False(t, allowed)
+
+	allowed, _ = evaluateAccess(rules, AccessAttempt{})
+	assert.False(t, allowed)
+}
+
+func TestEvaluateAccessHeaderAndQuerySecret(t *testing.T) {
+	rules := db.EndpointAccess{HeaderName: "X-Vendor-Token", HeaderValue: "abc", QueryParam: "key", QueryValue: "xyz"}
+
+	allowed, _ := evaluateAccess(rules, AccessAttempt{
+		Headers:     map[string][]string{"X-Vendor-Token": {"abc"}},
+		QueryParams: map[string]string{"key": "xyz"},
+	})
+	assert.True(t, allowed)
+
+	allowed, reason := evaluateAccess(rules, AccessAttempt{
+		Headers:     map[string][]string{"X-Vendor-Token": {"abc"}},
+		QueryParams: map[string]string{"key": "nope"},
+	})
+	assert.False(t, allowed)
+	assert.Equal(t, "required query param missing or invalid", reason)
+
+	allowed, _ = evaluateAccess(rules, AccessAttempt{QueryParams: map[string]string{"key": "xyz"}})
+	assert.False(t, allowed)
+}
+
+func TestEvaluateAccessClientCert(t *testing.T) {
+	fp := FingerprintCert([]byte("certificate"))
+	rules := db.EndpointAccess{ClientCertFingerprints: []string{fp}}
+
+	allowed, _ := evaluateAccess(rules, AccessAttempt{ClientCertFingerprint: fp})
+	assert.True(t, allowed)
+
+	allowed, _ = evaluateAccess(rules, AccessAttempt{})
+	assert.False(t, allowed)
+}
+
+func TestValidateAccessRules(t *testing.T) {
+	none := db.EndpointAccess{}
+	assert.Nil(t, AccessRules{AllowedIps: []string{"10.0.0.1", "fd00::/8"}}.Validate(none))
+	assert.NotNil(t, AccessRules{AllowedIps: []string{"not-an-ip"}}.Validate(none))
+	assert.NotNil(t, AccessRules{BasicUsername: "vendor"}.Validate(none))
+	assert.NotNil(t, AccessRules{HeaderName: "X-Token"}.Validate(none))
+	assert.NotNil(t, AccessRules{ClientCertFingerprints: []string{"abcd"}}.Validate(none))
+	assert.NotNil(t, AccessRules{RejectCode: 200}.Validate(none))
+
+	// Stored secrets are kept when left out
+	stored := db.EndpointAccess{BasicPasswordHash: "$2a$10$hash", HeaderValue: "abc"}
+	assert.Nil(t, AccessRules{BasicUsername: "vendor", HeaderName: "X-Token"}.Validate(stored))
+	assert.NotNil(t, AccessRules{QueryParam: "key"}.Validate(stored))
+}
+
+// Serves stored access rules with secrets and records the rules written.
+type AccessEndpointStore struct {
+	MockEndpointStore
+	stored   db.EndpointAccess
+	upserted *db.UpsertEndpointAccessParams
+}
+
+func (as AccessEndpointStore) GetEndpointAccess(ctx context.Context, params db.GetEndpointAccessParams) (db.EndpointAccess, error) {
+	return as.stored, nil
+}
+
+func (as AccessEndpointStore) UpsertEndpointAccess(ctx context.Context, params db.UpsertEndpointAccessParams) (db.EndpointAccess, error) {
+	*as.upserted = params
+	return as.MockEndpointStore.UpsertEndpointAccess(ctx, params)
+}
+
+func TestSetEndpointAccessKeepsSecrets(t *testing.T) {
+	hash, err := HashBasicPassword("s3cret")
+	assert.NoError(t, err)
+	var upserted db.UpsertEndpointAccessParams
+	s := &EndpointService{endpointq: AccessEndpointStore{
+		stored:   db.EndpointAccess{BasicUsername: "vendor", BasicPasswordHash: hash, HeaderName: "X-Token", HeaderValue: "abc"},
+		upserted: &upserted,
+	}, hosts: hosts}
+
+	// As returned by GET, without secrets
+	rules := AccessRules{BasicUsername: "vendor", HeaderName: "X-Token"}
+	_, endpointErr := s.SetEndpointAccess(context.TODO(), ProEndpoint, "", 1, rules)
+	assert.Nil(t, endpointErr)
+	assert.Equal(t, hash, upserted.BasicPasswordHash)
+	assert.Equal(t, "abc", upserted.HeaderValue)
+
+	rules.BasicPassword = "n3w"
+	_, endpointErr = s.SetEndpointAccess(context.TODO(), ProEndpoint, "", 1, rules)
+	assert.Nil(t, endpointErr)
+	assert.NotEqual(t, hash, upserted.BasicPasswordHash)
+	assert.True(t, verifyBasicPassword(upserted.BasicPasswordHash, "n3w"))
+}
+
+func TestAuthorizeHook(t *testing.T) {
+	code, err := service.AuthorizeHook(context.TODO(), FreeEndpoint, "", AccessAttempt{SourceIp: "1.1.1.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, code)
+
+	code, err = service.AuthorizeHook(context.TODO(), LockedEndpoint, "", AccessAttempt{SourceIp: "1.1.1.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// The rules of an endpoint do not apply to the endpoint of the same name on another domain
+	code, err = service.AuthorizeHook(context.TODO(), LockedEndpoint, "hooks.internal.example.com", AccessAttempt{SourceIp: "1.1.1.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, code)
+}
+
+func TestStoreRequestDetailsWhenBlocked(t *testing.T) {
+	hookReq := HookRequest{
+		Endpoint:     LockedEndpoint,
+		Path:         "/",
+		Method:       string(db.HttpMethodPost),
+		SourceIp:     "1.1.1.1",
+		ResponseCode: http.StatusUnauthorized,
+		Blocked:      true,
+	}
+	req, err := service.StoreRequestDetails(context.TODO(), hookReq)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(http.StatusUnauthorized), req.ResponseCode.Int32)
+}
@@ -3,6 +3,7 @@ package endpoint
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -12,17 +13,26 @@ import (
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/audit"
 	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/humanbeeng/checkpost/server/internal/logging"
+	"github.com/humanbeeng/checkpost/server/internal/metrics"
+	"github.com/humanbeeng/checkpost/server/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type EndpointController struct {
 	wsManager *WSManager
 	pv        *core.PasetoVerifier
+	sessions  core.SessionChecker
 	service   *EndpointService
+	audit     *audit.AuditService
 }
 
-func NewEndpointController(service *EndpointService, wsManager *WSManager, pv *core.PasetoVerifier) *EndpointController {
-	return &EndpointController{service: service, pv: pv, wsManager: wsManager}
+func NewEndpointController(service *EndpointService, wsManager *WSManager, pv *core.PasetoVerifier, sessions core.SessionChecker, audit *audit.AuditService) *EndpointController {
+	return &EndpointController{service: service, pv: pv, sessions: sessions, wsManager: wsManager, audit: audit}
 }
 
 func (ec *EndpointController) RegisterRoutes(app *fiber.App, authmw, cache fiber.Handler) {
@@ -41,9 +51,27 @@ func (ec *EndpointController) RegisterRoutes(app *fiber.App, authmw, cache fiber
 
 	endpointGroup.Get("/stats/:endpoint", authmw, ec.StatsHandler)
 
+	endpointGroup.Get("/access/:endpoint", authmw, ec.GetEndpointAccessHandler)
+	endpointGroup.Put("/access/:endpoint", authmw, ec.SetEndpointAccessHandler)
+	endpointGroup.Delete("/access/:endpoint", authmw, ec.DeleteEndpointAccessHandler)
+
+	endpointGroup.Get("/ratelimit/:endpoint", authmw, ec.GetEndpointRateLimitHandler)
+	endpointGroup.Put("/ratelimit/:endpoint", authmw, ec.SetEndpointRateLimitHandler)
+
 	endpointGroup.Get("/inspect/:endpoint", websocket.New(ec.InspectRequestsHandler))
 }
 
+// Serves endpoints at /h/<endpoint>/* for deployments addressing endpoints by path.
+func (ec *EndpointController) RegisterPathRoutes(app *fiber.App, hosts *core.Hosts) {
+	app.All(core.PathPrefix+"/:endpoint/*", func(c *fiber.Ctx) error {
+		// Endpoints are scoped to the base domain they are addressed on, as with subdomains
+		if domain, ok := hosts.DomainOf(c.Hostname()); ok {
+			c.Locals("domain", domain)
+		}
+		return ec.HookHandler(c)
+	})
+}
+
 func (ec *EndpointController) InspectRequestsHandler(c *websocket.Conn) {
 	endpoint := c.Params("endpoint", "")
 	if endpoint == "" {
@@ -55,9 +83,10 @@ func (ec *EndpointController) InspectRequestsHandler(c *websocket.Conn) {
 		return
 	}
 
-	slog.Info("Received inspect request", "endpoint", endpoint)
-
 	endpoint = strings.ToLower(endpoint)
+	domain := ec.service.domainOrPrimary(c.Query("domain", ""))
+
+	slog.Info("Received inspect request", "endpoint", endpoint, "domain", domain)
 
 	// Authorize websocket connection by checking token
 	token := c.Query("token", "")
@@ -81,8 +110,19 @@ func (ec *EndpointController) InspectRequestsHandler(c *websocket.Conn) {
 		return
 	}
 
+	active, err := ec.sessions.SessionActive(context.Background(), payload.Jti)
+	if err != nil || !active {
+		slog.Warn("Inspect request with inactive session", "endpoint", endpoint, "err", err)
+		c.WriteJSON(fiber.Error{
+			Code:    fiber.StatusUnauthorized,
+			Message: fiber.ErrUnauthorized.Message,
+		})
+		c.Close()
+		return
+	}
+
 	// Check if endpoint exists
-	exists, err := ec.service.endpointq.CheckEndpointExists(context.Background(), endpoint)
+	exists, err := ec.service.endpointq.CheckEndpointExists(context.Background(), db.CheckEndpointExistsParams{Endpoint: endpoint, Domain: domain})
 	if !exists {
 		slog.Warn("No endpoint found", "endpoint", endpoint)
 		c.WriteJSON(fiber.Error{
@@ -100,11 +140,30 @@ func (ec *EndpointController) InspectRequestsHandler(c *websocket.Conn) {
 		})
 		c.Close()
 	}
+	maxSessions, endpointErr := ec.service.GetMaxSessions(context.Background(), endpoint, domain)
+	if endpointErr != nil {
+		c.WriteJSON(WSMessage{
+			Code:    endpointErr.Code,
+			Message: endpointErr.Message,
+		})
+		c.Close()
+		return
+	}
+
 	c.Locals("username", payload.Get("username"))
 	c.Locals("plan", payload.Get("plan"))
 	c.Locals("role", payload.Get("role"))
 
-	ec.wsManager.AddConn(endpoint, c)
+	actorId, _ := strconv.ParseInt(payload.Subject, 10, 64)
+	ec.audit.Record(context.Background(), audit.Entry{
+		ActorId:   actorId,
+		Action:    audit.ActionEndpointInspect,
+		Target:    audit.EndpointTarget(endpoint),
+		Ip:        c.IP(),
+		UserAgent: c.Headers(fiber.HeaderUserAgent),
+	})
+
+	ec.wsManager.AddConn(endpointKey{domain: domain, endpoint: endpoint}, c, maxSessions)
 }
 
 // Returns status of a given endpoint
@@ -115,7 +174,7 @@ func (ec *EndpointController) StatsHandler(c *fiber.Ctx) error {
 		return fiber.ErrBadRequest
 	}
 
-	stats, err := ec.service.GetEndpointStats(c.Context(), endpoint)
+	stats, err := ec.service.GetEndpointStats(c.UserContext(), endpoint, c.Query("domain"))
 	if err != nil {
 		return &fiber.Error{
 			Code:    err.Code,
@@ -136,11 +195,11 @@ func (ec *EndpointController) RequestDetailsHandler(c *fiber.Ctx) error {
 
 	reqId, parseErr := strconv.ParseInt(reqIdStr, 10, 64)
 	if parseErr != nil {
-		slog.Error("unable to convert request id from path to int", "err", parseErr)
+		slog.ErrorContext(c.UserContext(), "unable to convert request id from path to int", "err", parseErr)
 		return fiber.ErrBadRequest
 	}
 
-	req, err := ec.service.GetRequestDetails(c.Context(), reqId)
+	req, err := ec.service.GetRequestDetails(c.UserContext(), reqId)
 	if err != nil {
 		return &fiber.Error{Code: err.Code, Message: err.Message}
 	}
@@ -157,20 +216,27 @@ func (ec *EndpointController) RequestDetailsUUIDHandler(c *fiber.Ctx) error {
 		)
 	}
 
-	req, err := ec.service.GetRequestByUUID(c.Context(), uuid)
+	req, err := ec.service.GetRequestByUUID(c.UserContext(), uuid)
 	if err != nil {
 		return &fiber.Error{Code: err.Code, Message: err.Message}
 	}
 
+	ec.audit.Record(c.UserContext(), audit.FromRequest(c, audit.ActionRequestRead, audit.RequestTarget(uuid)))
+
 	return c.JSON(req)
 }
 
 type GenerateEndpointRequest struct {
 	Endpoint string `json:"endpoint"`
+	// Base domain to create the endpoint on. Defaults to the primary domain.
+	Domain string `json:"domain"`
 }
 
 type GenerateEndpointResponse struct {
-	Endpoint  string    `json:"endpoint"`
+	Endpoint string `json:"endpoint"`
+	Domain   string `json:"domain"`
+	// Public URL of the endpoint in the active addressing mode
+	Url       string    `json:"url"`
 	ExpiresAt time.Time `json:"expires_at"`
 	Plan      string    `json:"plan"`
 }
@@ -179,7 +245,7 @@ func (ec *EndpointController) GenerateEndpointHandler(c *fiber.Ctx) error {
 	var req GenerateEndpointRequest
 
 	if err := c.BodyParser(&req); err != nil {
-		slog.Error("Malformed request payload", "err", err)
+		slog.ErrorContext(c.UserContext(), "Malformed request payload", "err", err)
 		return fiber.ErrBadRequest
 	}
 
@@ -188,7 +254,7 @@ func (ec *EndpointController) GenerateEndpointHandler(c *fiber.Ctx) error {
 		return fiber.ErrInternalServerError
 	}
 
-	endpoint, err := ec.service.CreateEndpoint(c.Context(), username, req.Endpoint)
+	endpoint, err := ec.service.CreateEndpoint(c.UserContext(), username, req.Endpoint, req.Domain)
 	if err != nil {
 		return &fiber.Error{
 			Code:    err.Code,
@@ -196,14 +262,37 @@ func (ec *EndpointController) GenerateEndpointHandler(c *fiber.Ctx) error {
 		}
 	}
 
+	entry := audit.FromRequest(c, audit.ActionEndpointCreate, audit.EndpointTarget(strings.ToLower(req.Endpoint)))
+	entry.After = map[string]string{"endpoint": endpoint.Endpoint, "plan": string(endpoint.Plan)}
+	ec.audit.Record(c.UserContext(), entry)
+
 	res := GenerateEndpointResponse{
 		Endpoint:  endpoint.Endpoint,
+		Domain:    endpoint.Domain,
+		Url:       ec.service.EndpointURL(endpoint.Domain, endpoint.Endpoint),
 		ExpiresAt: endpoint.ExpiresAt.Time,
+		Plan:      string(endpoint.Plan),
 	}
 	return c.JSON(res)
 }
 
 func (ec *EndpointController) HookHandler(c *fiber.Ctx) error {
+	err := ec.handleHook(c)
+
+	code := c.Response().StatusCode()
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		code = fe.Code
+	} else if err != nil {
+		code = fiber.StatusInternalServerError
+	}
+	endpoint := strings.ToLower(c.Params("endpoint"))
+	domain, _ := c.Locals("domain").(string)
+	metrics.HookRequests.WithLabelValues(ec.service.EndpointPlan(endpoint, domain), c.Method(), strconv.Itoa(code)).Inc()
+	return err
+}
+
+func (ec *EndpointController) handleHook(c *fiber.Ctx) error {
 	// TODO: return request details
 	// Get the Content-Type header from the request
 	endpoint := c.Params("endpoint", "")
@@ -214,20 +303,31 @@ func (ec *EndpointController) HookHandler(c *fiber.Ctx) error {
 		}
 	}
 	endpoint = strings.ToLower(endpoint)
-	contentType := c.Get(fiber.HeaderContentType)
-	body := c.Body()
+	// Set for endpoints addressed on a base domain, empty when addressed through the API host
+	domain, _ := c.Locals("domain").(string)
+	c.SetUserContext(logging.With(c.UserContext(), "endpoint", endpoint))
 	headers := c.GetReqHeaders()
 
-	var ip string
+	// Read from the proxy header only when the peer is a trusted proxy, see config.Proxy
+	ip := c.IP()
 
-	// Specific to railway.app deployment
-	envoyAddr, ok := headers["X-Envoy-External-Address"]
-	if ok {
-		ip = envoyAddr[0]
-	} else {
-		ip = c.IP()
+	retryAfter, endpointErr := ec.service.CheckRateLimit(c.UserContext(), endpoint, domain, ip)
+	if endpointErr != nil {
+		return &fiber.Error{
+			Code:    endpointErr.Code,
+			Message: endpointErr.Message,
+		}
+	}
+	if retryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(RetryAfterSeconds(retryAfter)))
+		return fiber.ErrTooManyRequests
 	}
-	path := c.Params("*", "/")
+
+	contentType := c.Get(fiber.HeaderContentType)
+	body := c.Body()
+	metrics.HookBodyBytes.Observe(float64(len(body)))
+	// Path below the endpoint, e.g. /github/push for /h/acme/github/push
+	path := "/" + c.Params("*")
 
 	method := c.Method()
 	query := c.Queries()
@@ -236,20 +336,21 @@ func (ec *EndpointController) HookHandler(c *fiber.Ctx) error {
 	if strings.Contains(contentType, string(MultipartForm)) {
 		f, err := c.MultipartForm()
 		if err != nil {
-			slog.Error("unable to read multipart form data from request", "endpoint", endpoint, "err", err)
+			slog.ErrorContext(c.UserContext(), "unable to read multipart form data from request", "endpoint", endpoint, "err", err)
 			return nil
 		}
 		form = f.Value
 	} else if strings.Contains(contentType, string(FormUrlEncoded)) {
 		f, err := url.ParseQuery(string(c.Body()))
 		if err != nil {
-			slog.Error("unable to parse form url encoded values", "err", err)
+			slog.ErrorContext(c.UserContext(), "unable to parse form url encoded values", "err", err)
 		}
 		form = f
 	}
 
 	hookReq := HookRequest{
 		Endpoint:     endpoint,
+		Domain:       domain,
 		UUID:         c.Locals("requestid").(string),
 		Path:         path,
 		Headers:      headers,
@@ -266,20 +367,55 @@ func (ec *EndpointController) HookHandler(c *fiber.Ctx) error {
 		hookReq.FormData = form
 	}
 
-	slog.Info("Received hook request", "endpoint", endpoint)
+	slog.InfoContext(c.UserContext(), "Received hook request", "endpoint", endpoint)
 
-	requestRecord, endpointErr := ec.service.StoreRequestDetails(c.Context(), hookReq)
+	attempt := AccessAttempt{
+		SourceIp:      ip,
+		Headers:       headers,
+		QueryParams:   query,
+		Authorization: c.Get(fiber.HeaderAuthorization),
+	}
+	// Client certificates are only available when TLS is terminated by this server
+	if cs := c.Context().TLSConnectionState(); cs != nil && len(cs.PeerCertificates) > 0 {
+		attempt.ClientCertFingerprint = FingerprintCert(cs.PeerCertificates[0].Raw)
+	}
+	hookReq.TLS = NewTLSInfo(c.Context().TLSConnectionState())
+	hookReq.TraceParent = tracing.ValidTraceParent(c.Get("traceparent"))
+
+	rejectCode, endpointErr := ec.service.AuthorizeHook(c.UserContext(), endpoint, domain, attempt)
 	if endpointErr != nil {
 		return &fiber.Error{
 			Code:    endpointErr.Code,
 			Message: endpointErr.Message,
 		}
 	}
+	if rejectCode != 0 {
+		hookReq.Blocked = true
+		hookReq.ResponseCode = int32(rejectCode)
+	}
+
+	requestRecord, endpointErr := ec.service.StoreRequestDetails(c.UserContext(), hookReq)
+	if endpointErr != nil {
+		if !endpointErr.RetryAt.IsZero() {
+			c.Set(fiber.HeaderRetryAfter, endpointErr.RetryAt.UTC().Format(http.TimeFormat))
+		}
+		return &fiber.Error{
+			Code:    endpointErr.Code,
+			Message: endpointErr.Message,
+		}
+	}
+
+	// Blocked attempts are recorded but not pushed to live sessions
+	if hookReq.Blocked {
+		return c.SendStatus(rejectCode)
+	}
 
 	hookReq.ExpiresAt = requestRecord.ExpiresAt.Time
 	hookReq.CreatedAt = requestRecord.CreatedAt.Time
 
-	ec.Broadcast(endpoint, &hookReq)
+	start := time.Now()
+	ec.Broadcast(c.UserContext(), endpoint, domain, &hookReq)
+	metrics.HookBroadcastDuration.Observe(time.Since(start).Seconds())
 	return c.SendStatus(fiber.StatusOK)
 }
 
@@ -292,9 +428,9 @@ func (ec *EndpointController) GetUserEndpointsHandler(c *fiber.Ctx) error {
 	if !ok {
 		return fiber.ErrBadRequest
 	}
-	slog.Info("Requesting user endpoints", "userId", userId)
+	slog.InfoContext(c.UserContext(), "Requesting user endpoints", "userId", userId)
 
-	endpoints, err := ec.service.GetUserEndpoints(c.Context(), userId)
+	endpoints, err := ec.service.GetUserEndpoints(c.UserContext(), userId)
 	if err != nil {
 		return &fiber.Error{
 			Code:    err.Code,
@@ -316,7 +452,7 @@ type GetEndpointsHistoryResponse struct {
 func (ec *EndpointController) GetEndpointHistoryHandler(c *fiber.Ctx) error {
 	endpoint := c.Params("endpoint", "")
 	if endpoint == "" {
-		slog.Info("No endpoint found in path params")
+		slog.InfoContext(c.UserContext(), "No endpoint found in path params")
 		return fiber.ErrBadRequest
 	}
 
@@ -333,7 +469,9 @@ func (ec *EndpointController) GetEndpointHistoryHandler(c *fiber.Ctx) error {
 	}
 	userId := c.Locals("userId").(int64)
 
-	reqs, serviceErr := ec.service.GetEndpointRequestHistory(c.Context(), endpoint, userId, int32(limit), int32(offset))
+	includeBlocked := c.QueryBool("blocked", false)
+
+	reqs, serviceErr := ec.service.GetEndpointRequestHistory(c.UserContext(), endpoint, c.Query("domain"), userId, int32(limit), int32(offset), includeBlocked)
 	if serviceErr != nil {
 		return &fiber.Error{
 			Code:    serviceErr.Code,
@@ -341,17 +479,161 @@ func (ec *EndpointController) GetEndpointHistoryHandler(c *fiber.Ctx) error {
 		}
 	}
 
+	entry := audit.FromRequest(c, audit.ActionEndpointHistoryRead, audit.EndpointTarget(strings.ToLower(endpoint)))
+	entry.After = map[string]int{"num_requests": len(reqs)}
+	ec.audit.Record(c.UserContext(), entry)
+
 	res := GetEndpointsHistoryResponse{
 		Requests: reqs,
 	}
-	slog.Info("Returning requests", "num_requests", len(res.Requests))
+	slog.InfoContext(c.UserContext(), "Returning requests", "num_requests", len(res.Requests))
 	return c.JSON(res)
 }
 
+func (ec *EndpointController) GetEndpointAccessHandler(c *fiber.Ctx) error {
+	endpoint := c.Params("endpoint", "")
+	if endpoint == "" {
+		return fiber.ErrBadRequest
+	}
+	userId := c.Locals("userId").(int64)
+
+	rules, err := ec.service.GetEndpointAccess(c.UserContext(), endpoint, c.Query("domain"), userId)
+	if err != nil {
+		return &fiber.Error{
+			Code:    err.Code,
+			Message: err.Message,
+		}
+	}
+	return c.JSON(rules)
+}
+
+func (ec *EndpointController) SetEndpointAccessHandler(c *fiber.Ctx) error {
+	endpoint := c.Params("endpoint", "")
+	if endpoint == "" {
+		return fiber.ErrBadRequest
+	}
+	userId := c.Locals("userId").(int64)
+
+	var req AccessRules
+	if err := c.BodyParser(&req); err != nil {
+		slog.ErrorContext(c.UserContext(), "Malformed request payload", "err", err)
+		return fiber.ErrBadRequest
+	}
+
+	before, err := ec.service.GetEndpointAccess(c.UserContext(), endpoint, c.Query("domain"), userId)
+	if err != nil {
+		return &fiber.Error{
+			Code:    err.Code,
+			Message: err.Message,
+		}
+	}
+
+	rules, err := ec.service.SetEndpointAccess(c.UserContext(), endpoint, c.Query("domain"), userId, req)
+	if err != nil {
+		return &fiber.Error{
+			Code:    err.Code,
+			Message: err.Message,
+		}
+	}
+
+	// Both values come from the API representation, which never contains secrets
+	entry := audit.FromRequest(c, audit.ActionEndpointAccessSet, audit.EndpointTarget(strings.ToLower(endpoint)))
+	entry.Before = before
+	entry.After = rules
+	ec.audit.Record(c.UserContext(), entry)
+
+	return c.JSON(rules)
+}
+
+func (ec *EndpointController) DeleteEndpointAccessHandler(c *fiber.Ctx) error {
+	endpoint := c.Params("endpoint", "")
+	if endpoint == "" {
+		return fiber.ErrBadRequest
+	}
+	userId := c.Locals("userId").(int64)
+
+	before, err := ec.service.GetEndpointAccess(c.UserContext(), endpoint, c.Query("domain"), userId)
+	if err != nil {
+		return &fiber.Error{
+			Code:    err.Code,
+			Message: err.Message,
+		}
+	}
+
+	if err := ec.service.DeleteEndpointAccess(c.UserContext(), endpoint, c.Query("domain"), userId); err != nil {
+		return &fiber.Error{
+			Code:    err.Code,
+			Message: err.Message,
+		}
+	}
+
+	entry := audit.FromRequest(c, audit.ActionEndpointAccessClear, audit.EndpointTarget(strings.ToLower(endpoint)))
+	entry.Before = before
+	ec.audit.Record(c.UserContext(), entry)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (ec *EndpointController) GetEndpointRateLimitHandler(c *fiber.Ctx) error {
+	endpoint := c.Params("endpoint", "")
+	if endpoint == "" {
+		return fiber.ErrBadRequest
+	}
+	userId := c.Locals("userId").(int64)
+
+	limits, err := ec.service.GetEndpointRateLimit(c.UserContext(), endpoint, c.Query("domain"), userId)
+	if err != nil {
+		return &fiber.Error{
+			Code:    err.Code,
+			Message: err.Message,
+		}
+	}
+	return c.JSON(limits)
+}
+
+func (ec *EndpointController) SetEndpointRateLimitHandler(c *fiber.Ctx) error {
+	endpoint := c.Params("endpoint", "")
+	if endpoint == "" {
+		return fiber.ErrBadRequest
+	}
+	userId := c.Locals("userId").(int64)
+
+	var req RateLimits
+	if err := c.BodyParser(&req); err != nil {
+		slog.ErrorContext(c.UserContext(), "Malformed request payload", "err", err)
+		return fiber.ErrBadRequest
+	}
+
+	before, err := ec.service.GetEndpointRateLimit(c.UserContext(), endpoint, c.Query("domain"), userId)
+	if err != nil {
+		return &fiber.Error{
+			Code:    err.Code,
+			Message: err.Message,
+		}
+	}
+
+	limits, err := ec.service.SetEndpointRateLimit(c.UserContext(), endpoint, c.Query("domain"), userId, req)
+	if err != nil {
+		return &fiber.Error{
+			Code:    err.Code,
+			Message: err.Message,
+		}
+	}
+
+	entry := audit.FromRequest(c, audit.ActionEndpointRateLimit, audit.EndpointTarget(strings.ToLower(endpoint)))
+	entry.Before = before
+	entry.After = limits
+	ec.audit.Record(c.UserContext(), entry)
+
+	return c.JSON(limits)
+}
+
 type CheckSubdomainExistsResponse struct {
 	Endpoint string `json:"endpoint"`
-	Exists   bool   `json:"exists"`
-	Message  string `json:"message"`
+	// URL the endpoint would have on the requested domain, the primary domain by default
+	Url     string `json:"url"`
+	Exists  bool   `json:"exists"`
+	Message string `json:"message"`
 }
 
 func (ec *EndpointController) CheckSubdomainExistsHandler(c *fiber.Ctx) error {
@@ -361,7 +643,8 @@ func (ec *EndpointController) CheckSubdomainExistsHandler(c *fiber.Ctx) error {
 		return fiber.ErrBadRequest
 	}
 
-	subdomainExists, err := ec.service.CheckEndpointExists(c.Context(), endpoint)
+	domain := c.Query("domain")
+	subdomainExists, err := ec.service.CheckEndpointExists(c.UserContext(), endpoint, domain)
 	if err != nil {
 		return &fiber.Error{
 			Code:    err.Code,
@@ -369,11 +652,13 @@ func (ec *EndpointController) CheckSubdomainExistsHandler(c *fiber.Ctx) error {
 		}
 	}
 
+	url := ec.service.EndpointURL(strings.ToLower(domain), strings.ToLower(endpoint))
 	switch subdomainExists {
 	case Available:
 		{
 			return c.JSON(CheckSubdomainExistsResponse{
 				Endpoint: endpoint,
+				Url:      url,
 				Exists:   false,
 				Message:  string(Available),
 			})
@@ -382,6 +667,7 @@ func (ec *EndpointController) CheckSubdomainExistsHandler(c *fiber.Ctx) error {
 		{
 			return c.JSON(CheckSubdomainExistsResponse{
 				Endpoint: endpoint,
+				Url:      url,
 				Exists:   true,
 				Message:  string(Taken),
 			})
@@ -390,6 +676,7 @@ func (ec *EndpointController) CheckSubdomainExistsHandler(c *fiber.Ctx) error {
 		{
 			return c.JSON(CheckSubdomainExistsResponse{
 				Endpoint: endpoint,
+				Url:      url,
 				Exists:   false,
 				Message:  string(ReservedCompany),
 			})
@@ -398,6 +685,7 @@ func (ec *EndpointController) CheckSubdomainExistsHandler(c *fiber.Ctx) error {
 		{
 			return c.JSON(CheckSubdomainExistsResponse{
 				Endpoint: endpoint,
+				Url:      url,
 				Exists:   true,
 				Message:  string(Error),
 			})
@@ -405,24 +693,34 @@ func (ec *EndpointController) CheckSubdomainExistsHandler(c *fiber.Ctx) error {
 	}
 }
 
-func (ec *EndpointController) Broadcast(endpoint string, req *HookRequest) {
+// Sends the request to live inspect sessions of the endpoint on the given base domain, the primary domain when empty.
+func (ec *EndpointController) Broadcast(ctx context.Context, endpoint string, domain string, req *HookRequest) {
+	_, span := tracing.Start(ctx, "EndpointController.Broadcast", trace.WithAttributes(tracing.EndpointKey.String(endpoint)))
+	defer span.End()
+
+	key := endpointKey{domain: ec.service.domainOrPrimary(domain), endpoint: endpoint}
+
 	ec.wsManager.Lock()
 	defer ec.wsManager.Unlock()
-	sessions, ok := ec.wsManager.endpointSessions[endpoint]
+	if ec.wsManager.closing {
+		return
+	}
+	sessions, ok := ec.wsManager.endpointSessions[key]
 	if !ok {
-		slog.Info("No active sessions found", "endpoint", endpoint)
+		slog.InfoContext(ctx, "No active sessions found", "endpoint", endpoint, "domain", key.domain)
 		return
 	}
 
 	data, err := json.Marshal(req)
 	if err != nil {
-		slog.Error("unable to marshal hook request", "endpoint", endpoint)
+		slog.ErrorContext(ctx, "unable to marshal hook request", "endpoint", endpoint)
 		return
 	}
 
-	slog.Info("Found active sessions", "num_sessions", len(sessions.sessionsMap))
+	slog.InfoContext(ctx, "Found active sessions", "num_sessions", len(sessions.sessionsMap))
+	span.SetAttributes(attribute.Int("checkpost.sessions", len(sessions.sessionsMap)))
 	for sid, s := range sessions.sessionsMap {
-		slog.Info("Broadcasting", "session_id", sid)
+		slog.InfoContext(ctx, "Broadcasting", "session_id", sid)
 
 		msg := EgressMessage{
 			// TODO: Replace with constant
@@ -430,6 +728,13 @@ func (ec *EndpointController) Broadcast(endpoint string, req *HookRequest) {
 			Payload: data,
 		}
 
-		s.egress <- msg
+		// A session that does not keep up must not hold up the hook or other sessions
+		select {
+		case s.egress <- msg:
+		case <-time.After(broadcastWait):
+			slog.WarnContext(ctx, "Session did not keep up. Dropping message", "session_id", sid)
+			span.AddEvent("dropped", trace.WithAttributes(attribute.String("checkpost.session_id", sid)))
+			metrics.BroadcastDrops.Inc()
+		}
 	}
 }
@@ -0,0 +1,176 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/audit"
+	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/humanbeeng/checkpost/server/internal/metrics"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/humanbeeng/checkpost/server/internal/reserved"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the paths of stored requests.
+type RecordingEndpointStore struct {
+	MockEndpointStore
+	paths *[]string
+}
+
+func (rs RecordingEndpointStore) CreateNewRequest(ctx context.Context, params db.CreateNewRequestParams) (db.Request, error) {
+	*rs.paths = append(*rs.paths, params.Path)
+	return rs.MockEndpointStore.CreateNewRequest(ctx, params)
+}
+
+func TestPathAddressedHook(t *testing.T) {
+	pathHosts, err := core.NewHosts("https", "api.checkpost.io", core.AddressingPath, []string{"checkpost.io", "hooks.internal.example.com"})
+	assert.NoError(t, err)
+
+	var paths []string
+	pathService := &EndpointService{
+		endpointq: RecordingEndpointStore{paths: &paths},
+		userq:     userStore,
+		plans:     plan.NewCatalog(plan.Defaults),
+		reserved:  reserved.NewNames(reserved.DefaultSubdomains, reserved.DefaultCompanies),
+		hosts:     pathHosts,
+	}
+	ec := NewEndpointController(pathService, NewWSManager(), nil, nil, nil)
+
+	app := fiber.New()
+	app.Use(requestid.New())
+	ec.RegisterPathRoutes(app, pathHosts)
+
+	cases := []struct {
+		target string
+		status int
+		path   string
+	}{
+		{"https://checkpost.io/h/free-url/github/push?x=1", http.StatusOK, "/github/push"},
+		{"https://checkpost.io/h/FREE-URL", http.StatusOK, "/"},
+		{"https://checkpost.io/h/free-url/", http.StatusOK, "/"},
+		// The endpoint was created on checkpost.io
+		{"https://hooks.internal.example.com/h/free-url/push", http.StatusNotFound, ""},
+	}
+	for _, tc := range cases {
+		paths = nil
+		res, err := app.Test(httptest.NewRequest(http.MethodPost, tc.target, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.status, res.StatusCode, tc.target)
+		if tc.path != "" {
+			assert.Equal(t, []string{tc.path}, paths, tc.target)
+		}
+	}
+
+	endpoint, endpointErr := pathService.CreateEndpoint(context.TODO(), ProUser, ProEndpoint, "")
+	assert.Nil(t, endpointErr)
+	assert.Equal(t, "https://checkpost.io/h/pro-url", pathService.EndpointURL(endpoint.Domain, endpoint.Endpoint))
+}
+
+func TestHookMetrics(t *testing.T) {
+	hosts, err := core.NewHosts("https", "api.checkpost.io", core.AddressingPath, []string{"checkpost.io"})
+	assert.NoError(t, err)
+
+	plans := plan.NewCatalog(plan.Defaults)
+	var paths []string
+	s := &EndpointService{
+		endpointq: RecordingEndpointStore{paths: &paths},
+		userq:     userStore,
+		plans:     plans,
+		reserved:  reserved.NewNames(reserved.DefaultSubdomains, reserved.DefaultCompanies),
+		limiter:   NewHookRateLimiter(plans),
+		hosts:     hosts,
+	}
+	ec := NewEndpointController(s, NewWSManager(), nil, nil, nil)
+
+	app := fiber.New()
+	app.Use(requestid.New())
+	ec.RegisterPathRoutes(app, hosts)
+
+	stored := metrics.HookRequests.WithLabelValues(string(db.PlanPro), http.MethodPut, "200")
+	missing := metrics.HookRequests.WithLabelValues(metrics.UnknownPlan, http.MethodPut, "404")
+	storedBefore, missingBefore := testutil.ToFloat64(stored), testutil.ToFloat64(missing)
+
+	for _, target := range []string{"https://checkpost.io/h/free-url/push", "https://checkpost.io/h/" + UnknownEndpoint + "/push"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodPut, target, nil))
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, storedBefore+1, testutil.ToFloat64(stored))
+	assert.Equal(t, missingBefore+1, testutil.ToFloat64(missing))
+}
+
+func TestHookSourceIpFromTrustedProxyOnly(t *testing.T) {
+	hosts, err := core.NewHosts("https", "api.checkpost.io", core.AddressingPath, []string{"checkpost.io"})
+	assert.NoError(t, err)
+	s := &EndpointService{
+		endpointq: MockEndpointStore{},
+		userq:     userStore,
+		plans:     plan.NewCatalog(plan.Defaults),
+		hosts:     hosts,
+	}
+	ec := NewEndpointController(s, NewWSManager(), nil, nil, nil)
+
+	// app.Test connects from 0.0.0.0. The endpoint only allows 10.0.0.0/8.
+	for trusted, status := range map[string]int{"10.9.9.9": http.StatusUnauthorized, "0.0.0.0": http.StatusOK} {
+		app := fiber.New(fiber.Config{
+			ProxyHeader:             "X-Envoy-External-Address",
+			EnableTrustedProxyCheck: true,
+			TrustedProxies:          []string{trusted},
+		})
+		app.Use(requestid.New())
+		ec.RegisterPathRoutes(app, hosts)
+
+		req := httptest.NewRequest(http.MethodPost, "https://checkpost.io/h/"+LockedEndpoint, nil)
+		req.Header.Set("X-Envoy-External-Address", "10.1.1.1")
+		res, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, status, res.StatusCode, trusted)
+	}
+}
+
+// Discards audit logs.
+type NopAuditStore struct{}
+
+func (NopAuditStore) InsertAuditLog(ctx context.Context, params db.InsertAuditLogParams) error {
+	return nil
+}
+
+func (NopAuditStore) ListUserAuditLog(ctx context.Context, params db.ListUserAuditLogParams) ([]db.AuditLog, error) {
+	return []db.AuditLog{}, nil
+}
+
+func (NopAuditStore) ListAuditLog(ctx context.Context, params db.ListAuditLogParams) ([]db.AuditLog, error) {
+	return []db.AuditLog{}, nil
+}
+
+func TestGenerateEndpointResponse(t *testing.T) {
+	ec := NewEndpointController(&service, NewWSManager(), nil, nil, audit.NewAuditService(NopAuditStore{}))
+
+	app := fiber.New()
+	app.Post("/endpoint/generate", func(c *fiber.Ctx) error {
+		c.Locals("username", ProUser)
+		return c.Next()
+	}, ec.GenerateEndpointHandler)
+
+	req := httptest.NewRequest(http.MethodPost, "/endpoint/generate", strings.NewReader(`{"endpoint": "Pro-URL", "domain": "hooks.internal.example.com"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	res, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var body GenerateEndpointResponse
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(t, "pro-url", body.Endpoint)
+	assert.Equal(t, "hooks.internal.example.com", body.Domain)
+	assert.Equal(t, "https://pro-url.hooks.internal.example.com", body.Url)
+	assert.Equal(t, string(db.PlanPro), body.Plan)
+}
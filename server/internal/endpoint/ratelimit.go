@@ -0,0 +1,314 @@
+package endpoint
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// How long cached endpoint limits are trusted before they are reloaded from the db.
+	rateLimitRefreshInterval = time.Minute
+	// Limiters that have not seen traffic for this long are evicted on flush.
+	rateLimitIdleTimeout = 10 * time.Minute
+	// Source IPs tracked per endpoint. Further IPs share a single bucket until idle ones are evicted, so
+	// senders rotating addresses neither escape the per IP limit nor grow memory.
+	maxIpsPerEndpoint = 1024
+	// How long an endpoint that does not exist is remembered, so floods of random names do not reach the db.
+	// Other instances learn about a newly created endpoint after at most this long.
+	unknownEndpointTTL  = 10 * time.Second
+	maxUnknownEndpoints = 10_000
+)
+
+// Token bucket limits for an endpoint. Rates are in requests per second, 0 means unlimited.
+type RateLimits struct {
+	Rate    float64 `json:"rate"`
+	Burst   int     `json:"burst"`
+	IpRate  float64 `json:"ip_rate"`
+	IpBurst int     `json:"ip_burst"`
+}
+
+func rateLimitsFromPlan(l plan.Limits) RateLimits {
+	return RateLimits{Rate: l.Rate, Burst: l.Burst, IpRate: l.IpRate, IpBurst: l.IpBurst}
+}
+
+// Applies the per-endpoint overrides stored in db on top of the plan defaults.
+func (l RateLimits) withOverrides(rec db.Endpoint) RateLimits {
+	if rec.RateLimit > 0 {
+		l.Rate = rec.RateLimit
+	}
+	if rec.RateBurst > 0 {
+		l.Burst = int(rec.RateBurst)
+	}
+	if rec.IpRateLimit > 0 {
+		l.IpRate = rec.IpRateLimit
+	}
+	if rec.IpRateBurst > 0 {
+		l.IpBurst = int(rec.IpRateBurst)
+	}
+	return l
+}
+
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type endpointLimiter struct {
+	plan    db.Plan
+	limits  RateLimits
+	limiter *rate.Limiter
+	ips     map[string]*ipLimiter
+	// Shared by source IPs beyond maxIpsPerEndpoint
+	overflow *rate.Limiter
+	loadedAt time.Time
+	lastSeen time.Time
+	// Dropped requests not yet flushed to db
+	dropped int64
+}
+
+// In-memory token buckets for hook requests, keyed by endpoint and by endpoint + source IP. Source IPs
+// come from the connection, or the proxy header of trusted proxies only, so they cannot be forged.
+type HookRateLimiter struct {
+	sync.Mutex
+	plans     *plan.Catalog
+	endpoints map[endpointKey]*endpointLimiter
+	// Endpoints found not to exist, by the time they were looked up
+	unknown map[endpointKey]time.Time
+	// Dropped counts that failed to flush, kept apart as their limiters may have been evicted since
+	unflushed map[endpointKey]int64
+}
+
+func NewHookRateLimiter(plans *plan.Catalog) *HookRateLimiter {
+	return &HookRateLimiter{
+		plans:     plans,
+		endpoints: make(map[endpointKey]*endpointLimiter),
+		unknown:   make(map[endpointKey]time.Time),
+		unflushed: make(map[endpointKey]int64),
+	}
+}
+
+// Reports whether the endpoint was recently found not to exist.
+func (rl *HookRateLimiter) IsUnknown(key endpointKey) bool {
+	rl.Lock()
+	defer rl.Unlock()
+
+	at, ok := rl.unknown[key]
+	if ok && time.Since(at) > unknownEndpointTTL {
+		delete(rl.unknown, key)
+		return false
+	}
+	return ok
+}
+
+func (rl *HookRateLimiter) SetUnknown(key endpointKey) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	if len(rl.unknown) >= maxUnknownEndpoints {
+		clear(rl.unknown)
+	}
+	rl.unknown[key] = time.Now()
+}
+
+// Forgets that the endpoint did not exist, e.g. once it is created.
+func (rl *HookRateLimiter) SetKnown(key endpointKey) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	delete(rl.unknown, key)
+}
+
+// Plan limits of the given plan. Unknown plans are not limited.
+func (rl *HookRateLimiter) Defaults(p db.Plan) RateLimits {
+	l, _ := rl.plans.Get(p)
+	return rateLimitsFromPlan(l)
+}
+
+// Returns cached limits for the endpoint. ok is false when limits have to be (re)loaded.
+func (rl *HookRateLimiter) Limits(key endpointKey) (RateLimits, bool) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	el, ok := rl.endpoints[key]
+	if !ok || time.Since(el.loadedAt) > rateLimitRefreshInterval {
+		return RateLimits{}, false
+	}
+	return el.limits, true
+}
+
+// Plan of the endpoint as of the last time its limits were loaded.
+func (rl *HookRateLimiter) Plan(key endpointKey) (db.Plan, bool) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	el, ok := rl.endpoints[key]
+	if !ok {
+		return "", false
+	}
+	return el.plan, true
+}
+
+func (rl *HookRateLimiter) SetLimits(key endpointKey, p db.Plan, limits RateLimits) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := time.Now()
+	el, ok := rl.endpoints[key]
+	if !ok {
+		rl.endpoints[key] = &endpointLimiter{
+			plan:     p,
+			limits:   limits,
+			limiter:  newLimiter(limits.Rate, limits.Burst),
+			ips:      make(map[string]*ipLimiter),
+			overflow: newLimiter(limits.IpRate, limits.IpBurst),
+			loadedAt: now,
+			lastSeen: now,
+		}
+		return
+	}
+
+	if el.limits != limits {
+		el.limiter.SetLimitAt(now, toLimit(limits.Rate))
+		el.limiter.SetBurstAt(now, toBurst(limits.Burst))
+		for _, il := range el.ips {
+			il.limiter.SetLimitAt(now, toLimit(limits.IpRate))
+			il.limiter.SetBurstAt(now, toBurst(limits.IpBurst))
+		}
+		el.overflow.SetLimitAt(now, toLimit(limits.IpRate))
+		el.overflow.SetBurstAt(now, toBurst(limits.IpBurst))
+		el.limits = limits
+	}
+	el.plan = p
+	el.loadedAt = now
+}
+
+// Marks cached limits as stale so that they are reloaded on the next request.
+func (rl *HookRateLimiter) Forget(key endpointKey) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	if el, ok := rl.endpoints[key]; ok {
+		el.loadedAt = time.Time{}
+	}
+}
+
+// Takes a token from both the source IP and the endpoint bucket.
+// Returns 0 if the request is allowed, otherwise how long the caller should wait before retrying.
+func (rl *HookRateLimiter) Allow(key endpointKey, ip string) time.Duration {
+	rl.Lock()
+	defer rl.Unlock()
+
+	el, ok := rl.endpoints[key]
+	if !ok {
+		// Limits were never loaded for this endpoint
+		return 0
+	}
+
+	now := time.Now()
+	el.lastSeen = now
+
+	ipLimit := el.overflow
+	if il, ok := el.ips[ip]; ok {
+		il.lastSeen = now
+		ipLimit = il.limiter
+	} else if len(el.ips) < maxIpsPerEndpoint {
+		il = &ipLimiter{limiter: newLimiter(el.limits.IpRate, el.limits.IpBurst), lastSeen: now}
+		el.ips[ip] = il
+		ipLimit = il.limiter
+	}
+
+	ipRes := ipLimit.ReserveN(now, 1)
+	if delay := ipRes.DelayFrom(now); delay > 0 {
+		ipRes.CancelAt(now)
+		el.dropped++
+		return delay
+	}
+
+	endpointRes := el.limiter.ReserveN(now, 1)
+	if delay := endpointRes.DelayFrom(now); delay > 0 {
+		endpointRes.CancelAt(now)
+		ipRes.CancelAt(now)
+		el.dropped++
+		return delay
+	}
+
+	return 0
+}
+
+// Number of dropped requests that are not yet flushed to db.
+func (rl *HookRateLimiter) PendingDropped(key endpointKey) int64 {
+	rl.Lock()
+	defer rl.Unlock()
+
+	pending := rl.unflushed[key]
+	if el, ok := rl.endpoints[key]; ok {
+		pending += el.dropped
+	}
+	return pending
+}
+
+// Returns drained counts that failed to flush, so that the next drain includes them.
+func (rl *HookRateLimiter) AddDropped(key endpointKey, count int64) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	rl.unflushed[key] += count
+}
+
+// Resets and returns pending dropped counts. Idle limiters are evicted along the way.
+func (rl *HookRateLimiter) DrainDropped() map[endpointKey]int64 {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := time.Now()
+	drained := rl.unflushed
+	rl.unflushed = make(map[endpointKey]int64)
+	for key, el := range rl.endpoints {
+		if el.dropped > 0 {
+			drained[key] += el.dropped
+			el.dropped = 0
+		}
+
+		for ip, il := range el.ips {
+			if now.Sub(il.lastSeen) > rateLimitIdleTimeout {
+				delete(el.ips, ip)
+			}
+		}
+
+		if now.Sub(el.lastSeen) > rateLimitIdleTimeout {
+			delete(rl.endpoints, key)
+		}
+	}
+
+	for key, at := range rl.unknown {
+		if now.Sub(at) > unknownEndpointTTL {
+			delete(rl.unknown, key)
+		}
+	}
+	return drained
+}
+
+func newLimiter(r float64, burst int) *rate.Limiter {
+	return rate.NewLimiter(toLimit(r), toBurst(burst))
+}
+
+func toLimit(r float64) rate.Limit {
+	if r <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(r)
+}
+
+func toBurst(burst int) int {
+	return max(burst, 1)
+}
+
+// Retry-After header value. Always at least a second.
+func RetryAfterSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
@@ -0,0 +1,172 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/stretchr/testify/assert"
+)
+
+var freeKey = endpointKey{domain: "checkpost.io", endpoint: FreeEndpoint}
+
+func TestHookRateLimiterEndpointBucket(t *testing.T) {
+	rl := NewHookRateLimiter(plan.NewCatalog(plan.Defaults))
+	rl.SetLimits(freeKey, db.PlanFree, RateLimits{Rate: 1, Burst: 2})
+
+	assert.Zero(t, rl.Allow(freeKey, "1.1.1.1"))
+	assert.Zero(t, rl.Allow(freeKey, "2.2.2.2"))
+
+	retryAfter := rl.Allow(freeKey, "3.3.3.3")
+	assert.Positive(t, retryAfter)
+	assert.Equal(t, 1, RetryAfterSeconds(retryAfter))
+	assert.Equal(t, int64(1), rl.PendingDropped(freeKey))
+}
+
+func TestHookRateLimiterScopesEndpointsByDomain(t *testing.T) {
+	rl := NewHookRateLimiter(plan.NewCatalog(plan.Defaults))
+	other := endpointKey{domain: "hooks.internal.example.com", endpoint: FreeEndpoint}
+	rl.SetLimits(freeKey, db.PlanFree, RateLimits{Rate: 1, Burst: 1})
+	rl.SetLimits(other, db.PlanFree, RateLimits{Rate: 1, Burst: 1})
+
+	assert.Zero(t, rl.Allow(freeKey, "1.1.1.1"))
+	assert.Positive(t, rl.Allow(freeKey, "1.1.1.1"))
+
+	// The endpoint of the same name on another domain has its own bucket
+	assert.Zero(t, rl.Allow(other, "1.1.1.1"))
+	assert.Zero(t, rl.PendingDropped(other))
+}
+
+func TestHookRateLimiterIpBucket(t *testing.T) {
+	rl := NewHookRateLimiter(plan.NewCatalog(plan.Defaults))
+	rl.SetLimits(freeKey, db.PlanFree, RateLimits{Rate: 100, Burst: 100, IpRate: 1, IpBurst: 1})
+
+	assert.Zero(t, rl.Allow(freeKey, "1.1.1.1"))
+	assert.Positive(t, rl.Allow(freeKey, "1.1.1.1"))
+
+	// Other sources are not affected
+	assert.Zero(t, rl.Allow(freeKey, "2.2.2.2"))
+}
+
+func TestHookRateLimiterCapsIps(t *testing.T) {
+	rl := NewHookRateLimiter(plan.NewCatalog(plan.Defaults))
+	rl.SetLimits(freeKey, db.PlanFree, RateLimits{IpRate: 1, IpBurst: 1})
+
+	for i := range maxIpsPerEndpoint {
+		assert.Zero(t, rl.Allow(freeKey, fmt.Sprintf("ip-%d", i)))
+	}
+	assert.Len(t, rl.endpoints[freeKey].ips, maxIpsPerEndpoint)
+
+	// Rotating addresses beyond the cap share a bucket
+	assert.Zero(t, rl.Allow(freeKey, "forged-1"))
+	assert.Positive(t, rl.Allow(freeKey, "forged-2"))
+	assert.Len(t, rl.endpoints[freeKey].ips, maxIpsPerEndpoint)
+}
+
+func TestHookRateLimiterDrainDropped(t *testing.T) {
+	rl := NewHookRateLimiter(plan.NewCatalog(plan.Defaults))
+	rl.SetLimits(freeKey, db.PlanFree, RateLimits{Rate: 1, Burst: 1})
+
+	rl.Allow(freeKey, "1.1.1.1")
+	rl.Allow(freeKey, "1.1.1.1")
+	rl.Allow(freeKey, "1.1.1.1")
+
+	assert.Equal(t, map[endpointKey]int64{freeKey: 2}, rl.DrainDropped())
+	assert.Zero(t, rl.PendingDropped(freeKey))
+}
+
+func TestHookRateLimiterKeepsUnflushedCountOfEvictedEndpoint(t *testing.T) {
+	rl := NewHookRateLimiter(plan.NewCatalog(plan.Defaults))
+	rl.SetLimits(freeKey, db.PlanFree, RateLimits{Rate: 1, Burst: 1})
+
+	rl.Allow(freeKey, "1.1.1.1")
+	rl.Allow(freeKey, "1.1.1.1")
+	rl.endpoints[freeKey].lastSeen = time.Now().Add(-2 * rateLimitIdleTimeout)
+
+	drained := rl.DrainDropped()
+	assert.Equal(t, map[endpointKey]int64{freeKey: 1}, drained)
+	assert.NotContains(t, rl.endpoints, freeKey)
+
+	// The flush failed after the limiter was evicted
+	rl.AddDropped(freeKey, drained[freeKey])
+	assert.Equal(t, int64(1), rl.PendingDropped(freeKey))
+	assert.Equal(t, map[endpointKey]int64{freeKey: 1}, rl.DrainDropped())
+	assert.Empty(t, rl.DrainDropped())
+}
+
+func TestCheckRateLimit(t *testing.T) {
+	plans := plan.NewCatalog(map[db.Plan]plan.Limits{
+		db.PlanPro: {Name: db.PlanPro, Rate: 1, Burst: 1},
+	})
+	limited := EndpointService{
+		endpointq: endpointStore,
+		userq:     userStore,
+		plans:     plans,
+		limiter:   NewHookRateLimiter(plans),
+		hosts:     hosts,
+	}
+
+	retryAfter, err := limited.CheckRateLimit(context.TODO(), ProEndpoint, "", "1.1.1.1")
+	assert.Nil(t, err)
+	assert.Zero(t, retryAfter)
+
+	retryAfter, err = limited.CheckRateLimit(context.TODO(), ProEndpoint, "", "1.1.1.1")
+	assert.Nil(t, err)
+	assert.Positive(t, retryAfter)
+}
+
+func TestSetEndpointRateLimitAbovePlan(t *testing.T) {
+	plans := plan.NewCatalog(plan.Defaults)
+	limited := EndpointService{
+		endpointq: endpointStore,
+		userq:     userStore,
+		plans:     plans,
+		limiter:   NewHookRateLimiter(plans),
+		hosts:     hosts,
+	}
+
+	_, err := limited.SetEndpointRateLimit(context.TODO(), ProEndpoint, "", 1, RateLimits{Rate: 10_000})
+	assert.NotNil(t, err)
+
+	limits, err := limited.SetEndpointRateLimit(context.TODO(), ProEndpoint, "", 1, RateLimits{Rate: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, float64(10), limits.Rate)
+	assert.Equal(t, plan.Defaults[db.PlanPro].Burst, limits.Burst)
+}
+
+// Counts endpoint lookups.
+type CountingEndpointStore struct {
+	MockEndpointStore
+	lookups *int
+}
+
+func (cs CountingEndpointStore) GetEndpoint(ctx context.Context, params db.GetEndpointDetailsParams) (db.Endpoint, error) {
+	*cs.lookups++
+	return cs.MockEndpointStore.GetEndpoint(ctx, params)
+}
+
+func TestCheckRateLimitCachesUnknownEndpoints(t *testing.T) {
+	plans := plan.NewCatalog(plan.Defaults)
+	var lookups int
+	limited := EndpointService{
+		endpointq: CountingEndpointStore{lookups: &lookups},
+		userq:     userStore,
+		plans:     plans,
+		limiter:   NewHookRateLimiter(plans),
+		hosts:     hosts,
+	}
+
+	for range 3 {
+		_, err := limited.CheckRateLimit(context.TODO(), UnknownEndpoint, "", "1.1.1.1")
+		assert.Equal(t, http.StatusNotFound, err.Code)
+	}
+	assert.Equal(t, 1, lookups)
+
+	limited.limiter.SetKnown(endpointKey{domain: "checkpost.io", endpoint: UnknownEndpoint})
+	limited.CheckRateLimit(context.TODO(), UnknownEndpoint, "", "1.1.1.1")
+	assert.Equal(t, 2, lookups)
+}
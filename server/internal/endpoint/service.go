@@ -14,6 +14,11 @@ import (
 
 	db "github.com/humanbeeng/checkpost/server/db/sqlc"
 	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/humanbeeng/checkpost/server/internal/metrics"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/humanbeeng/checkpost/server/internal/reserved"
+	"github.com/humanbeeng/checkpost/server/internal/tracing"
+	"github.com/humanbeeng/checkpost/server/internal/usage"
 	"github.com/humanbeeng/checkpost/server/internal/user"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -22,12 +27,22 @@ import (
 type EndpointService struct {
 	endpointq EndpointQuerier
 	userq     user.UserQuerier
+	plans     *plan.Catalog
+	reserved  *reserved.Names
+	limiter   *HookRateLimiter
+	meter     *usage.Meter
+	hosts     *core.Hosts
 }
 
-func NewEndpointService(endpointq EndpointQuerier, userq user.UserQuerier) *EndpointService {
+func NewEndpointService(endpointq EndpointQuerier, userq user.UserQuerier, plans *plan.Catalog, reserved *reserved.Names, limiter *HookRateLimiter, meter *usage.Meter, hosts *core.Hosts) *EndpointService {
 	return &EndpointService{
 		endpointq: endpointq,
 		userq:     userq,
+		plans:     plans,
+		reserved:  reserved,
+		limiter:   limiter,
+		meter:     meter,
+		hosts:     hosts,
 	}
 }
 
@@ -41,11 +56,13 @@ func NewInternalServerError() *EndpointError {
 
 const (
 	RandomEndpointLength int = 10
-	DefaultLimitNumUrl   int = 1
-	DefaultExpiryHours   int = 6
 )
 
-func (s *EndpointService) CreateEndpoint(ctx context.Context, username string, subdomain string) (db.Endpoint, *EndpointError) {
+// Creates the endpoint on the given base domain, or on the primary domain when empty.
+func (s *EndpointService) CreateEndpoint(ctx context.Context, username string, subdomain string, domain string) (db.Endpoint, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.CreateEndpoint")
+	defer span.End()
+
 	// Check endpoint length
 	if len(subdomain) < 4 || len(subdomain) > 10 {
 		return db.Endpoint{}, &EndpointError{
@@ -55,7 +72,15 @@ func (s *EndpointService) CreateEndpoint(ctx context.Context, username string, s
 	}
 	subdomain = strings.ToLower(subdomain)
 
-	endpoint := fmt.Sprintf("https://%v.checkpost.io", subdomain)
+	domain = s.domainOrPrimary(domain)
+	if !s.hosts.IsDomain(domain) {
+		return db.Endpoint{}, &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Domain should be one of %s.", strings.Join(s.hosts.Domains(), ", ")),
+		}
+	}
+
+	endpoint := s.hosts.EndpointURL(domain, subdomain)
 
 	_, err := stdurl.ParseRequestURI(endpoint)
 	if err != nil {
@@ -66,21 +91,21 @@ func (s *EndpointService) CreateEndpoint(ctx context.Context, username string, s
 	}
 
 	// Check reserved endpoints
-	if _, ok := core.ReservedSubdomains[subdomain]; ok {
+	if s.reserved.IsSubdomain(subdomain) {
 		return db.Endpoint{}, &EndpointError{
 			Code:    http.StatusBadRequest,
 			Message: fmt.Sprintf("URL %s is reserved.", endpoint),
 		}
 	}
 
-	// Check if the requested endpoint already exists
-	exists, err := s.endpointq.CheckEndpointExists(ctx, subdomain)
+	// Check if the requested endpoint already exists on the domain
+	exists, err := s.endpointq.CheckEndpointExists(ctx, db.CheckEndpointExistsParams{Endpoint: subdomain, Domain: domain})
 	if err != nil {
-		slog.Error("unable to check if endpoint already exists", "endpoint", subdomain, "username", username, "err", err)
+		slog.ErrorContext(ctx, "unable to check if endpoint already exists", "endpoint", subdomain, "username", username, "err", err)
 		return db.Endpoint{}, NewInternalServerError()
 	}
 	if exists {
-		slog.Info("Endpoint exists", "endpoint", endpoint)
+		slog.InfoContext(ctx, "Endpoint exists", "endpoint", endpoint)
 		return db.Endpoint{}, &EndpointError{
 			Code:    http.StatusConflict,
 			Message: fmt.Sprintf("Endpoint %s already exists", endpoint),
@@ -95,40 +120,55 @@ func (s *EndpointService) CreateEndpoint(ctx context.Context, username string, s
 				Message: fmt.Sprintf("No user found with username: %s", username),
 			}
 		}
-		slog.Error("unable to get user from username", "username", username, "err", err)
+		slog.ErrorContext(ctx, "unable to get user from username", "username", username, "err", err)
 		return db.Endpoint{}, NewInternalServerError()
 	}
 
 	// Check if user has exceeded number of urls that can be generated
 	urls, err := s.endpointq.GetNonExpiredEndpointsOfUser(ctx, pgtype.Int8{Int64: user.ID, Valid: true})
 	if err != nil {
-		slog.Error("unable to get non expired endpoints", "username", user.Username, "err", err)
+		slog.ErrorContext(ctx, "unable to get non expired endpoints", "username", user.Username, "err", err)
 		return db.Endpoint{}, NewInternalServerError()
 	}
 
-	if (user.Plan == db.PlanBasic || user.Plan == db.PlanFree) && len(urls) >= DefaultLimitNumUrl {
+	limits, ok := s.plans.Get(user.Plan)
+	if !ok {
+		slog.ErrorContext(ctx, "user plan not found in catalog", "username", user.Username, "plan", user.Plan)
 		return db.Endpoint{}, &EndpointError{
 			Code:    http.StatusBadRequest,
-			Message: "Cannot generate more than one endpoint for your current plan. Consider upgrading to Pro.",
+			Message: "Invalid user plan",
 		}
 	}
 
-	// Check reserved companies. If found, check if the mail is from that organisation
-	if _, ok := core.ReservedCompanies[subdomain]; ok {
-		if !strings.Contains(strings.ToLower(user.Email), subdomain) || strings.Contains(strings.ToLower(user.Email), "@gmail.com") {
+	if limits.MaxEndpoints > 0 && len(urls) >= limits.MaxEndpoints {
+		return db.Endpoint{}, &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Cannot generate more than %d endpoint(s) for your current plan. Consider upgrading.", limits.MaxEndpoints),
+		}
+	}
+
+	// Reserved company names can only be claimed by members of a team that verified a domain of that company
+	if s.reserved.IsCompany(subdomain) {
+		verified, err := s.endpointq.UserHasVerifiedCompany(ctx, db.UserHasVerifiedCompanyParams{UserID: user.ID, Company: subdomain})
+		if err != nil {
+			slog.ErrorContext(ctx, "unable to check verified company", "username", user.Username, "company", subdomain, "err", err)
+			return db.Endpoint{}, NewInternalServerError()
+		}
+		if !verified {
 			return db.Endpoint{}, &EndpointError{
 				Code:    http.StatusBadRequest,
-				Message: fmt.Sprintf("You cannot use this endpoint. Please try with mail issued by %s", subdomain),
+				Message: fmt.Sprintf("You cannot use this endpoint. Verify a domain owned by %s in your team settings first.", subdomain),
 			}
 		}
 	}
 
-	slog.Info("Create endpoint request received", "endpoint", subdomain, "username", username, "plan", user.Plan)
+	slog.InfoContext(ctx, "Create endpoint request received", "endpoint", subdomain, "username", username, "plan", user.Plan)
 
 	endpointRecord, err := s.endpointq.InsertEndpoint(ctx, db.InsertEndpointParams{
 		Endpoint: subdomain,
 		UserID:   pgtype.Int8{Int64: user.ID, Valid: true},
 		Plan:     user.Plan,
+		Domain:   domain,
 
 		// Never expires
 		ExpiresAt: pgtype.Timestamptz{
@@ -138,25 +178,30 @@ func (s *EndpointService) CreateEndpoint(ctx context.Context, username string, s
 		},
 	})
 	if err != nil {
-		slog.Error("unable to insert new endpoint into db", "endpoint", subdomain, "username", user.Username, "err", err)
+		slog.ErrorContext(ctx, "unable to insert new endpoint into db", "endpoint", subdomain, "username", user.Username, "err", err)
 		return db.Endpoint{}, NewInternalServerError()
 	}
 
-	// Send complete endpoint as response
-	endpointRecord.Endpoint = endpoint
+	if s.limiter != nil {
+		// Hooks sent before the endpoint existed must not keep it unknown
+		s.limiter.SetKnown(endpointKey{domain: domain, endpoint: subdomain})
+	}
 
-	slog.Info("Endpoint created", "endpoint", endpoint, "username", user.Username, "plan", user.Plan)
+	slog.InfoContext(ctx, "Endpoint created", "endpoint", endpoint, "username", user.Username, "plan", user.Plan)
 
 	return endpointRecord, nil
 }
 
 func (s *EndpointService) GetUserEndpoints(ctx context.Context, userId int64) ([]Endpoint, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.GetUserEndpoints")
+	defer span.End()
+
 	endpointsRec, err := s.endpointq.GetUserEndpoints(ctx, userId)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return []Endpoint{}, nil
 		}
-		slog.Error("unable to fetch user endpoints", "userId", userId, "err", err)
+		slog.ErrorContext(ctx, "unable to fetch user endpoints", "userId", userId, "err", err)
 		return []Endpoint{}, NewInternalServerError()
 	}
 	var endpoints []Endpoint
@@ -164,6 +209,8 @@ func (s *EndpointService) GetUserEndpoints(ctx context.Context, userId int64) ([
 	for _, e := range endpointsRec {
 		endpoints = append(endpoints, Endpoint{
 			Endpoint:  e.Endpoint,
+			Domain:    e.Domain,
+			Url:       s.hosts.EndpointURL(e.Domain, e.Endpoint),
 			ExpiresAt: e.ExpiresAt.Time,
 			Plan:      string(e.Plan),
 		})
@@ -171,18 +218,39 @@ func (s *EndpointService) GetUserEndpoints(ctx context.Context, userId int64) ([
 	return endpoints, nil
 }
 
+// Endpoints created before base domains were configurable belong to the primary domain.
+func (s *EndpointService) AssignPrimaryDomain(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "EndpointService.AssignPrimaryDomain")
+	defer span.End()
+
+	assigned, err := s.endpointq.AssignEndpointDomain(ctx, s.hosts.Primary())
+	if err != nil {
+		return err
+	}
+	if assigned > 0 {
+		slog.InfoContext(ctx, "Assigned primary domain to endpoints", "domain", s.hosts.Primary(), "count", assigned)
+	}
+	return nil
+}
+
 func (s *EndpointService) StoreRequestDetails(ctx context.Context, hookReq HookRequest) (db.Request, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.StoreRequestDetails")
+	defer span.End()
+
 	endpoint := hookReq.Endpoint
+	span.SetAttributes(tracing.EndpointKey.String(endpoint))
+
+	notFoundErr := &EndpointError{
+		Code:    http.StatusNotFound,
+		Message: fmt.Sprintf("%s is either not created or has expired.", s.hosts.EndpointURL(hookReq.Domain, endpoint)),
+	}
 
-	endpointRecord, err := s.endpointq.GetEndpoint(ctx, endpoint)
+	endpointRecord, err := s.endpointq.GetEndpoint(ctx, db.GetEndpointDetailsParams{Endpoint: endpoint, Domain: s.domainOrPrimary(hookReq.Domain)})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return db.Request{}, &EndpointError{
-				Code:    http.StatusNotFound,
-				Message: fmt.Sprintf("https://%s.checkpost.io is either not created or has expired.", endpoint),
-			}
+			return db.Request{}, notFoundErr
 		}
-		slog.Error("unable to get endpoint details", "endpoint", endpoint, "err", err)
+		slog.ErrorContext(ctx, "unable to get endpoint details", "endpoint", endpoint, "domain", hookReq.Domain, "err", err)
 		return db.Request{}, NewInternalServerError()
 	}
 
@@ -190,7 +258,7 @@ func (s *EndpointService) StoreRequestDetails(ctx context.Context, hookReq HookR
 
 	queryBytes, err := json.Marshal(hookReq.QueryParams)
 	if err != nil {
-		slog.Error("unable to marshal query params", "err", err)
+		slog.ErrorContext(ctx, "unable to marshal query params", "err", err)
 		return db.Request{}, &EndpointError{
 			Code:    http.StatusBadRequest,
 			Message: "unable to parse query params.",
@@ -199,62 +267,75 @@ func (s *EndpointService) StoreRequestDetails(ctx context.Context, hookReq HookR
 
 	headerBytes, err := json.Marshal(hookReq.Headers)
 	if err != nil {
-		slog.Error("unable to marshal headers", "err", err)
+		slog.ErrorContext(ctx, "unable to marshal headers", "err", err)
 		return db.Request{}, &EndpointError{
 			Code:    http.StatusBadRequest,
 			Message: "unable to parse headers",
 		}
 	}
 
-	var expiresAt pgtype.Timestamptz
-	var content pgtype.Text
-	var responseCode int
-	switch endpointRecord.Plan {
-	case db.PlanFree:
-		{
-
-			// Checking if request body exceeds 10KB
-			if hookReq.ContentSize > 10_000 {
-				slog.Warn("Received content that exceeds limit", "plan", endpointRecord.Plan, "received_size", hookReq.ContentSize, "limit", 10_000)
-				content = pgtype.Text{Valid: true, String: ""}
-				responseCode = http.StatusRequestEntityTooLarge
-			} else {
-				content = pgtype.Text{Valid: true, String: hookReq.Content}
-				responseCode = http.StatusOK
-			}
-
-			expiresAt = pgtype.Timestamptz{
-				// Use time.Duration for arithmetic operations on time.
-				Time:             time.Now().Add(time.Hour * time.Duration(DefaultExpiryHours)),
-				InfinityModifier: pgtype.Finite,
-				Valid:            true,
-			}
+	limits, ok := s.plans.Get(endpointRecord.Plan)
+	if !ok {
+		return db.Request{}, &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid user plan",
 		}
-	case db.PlanPro, db.PlanBasic:
-		{
-			// Checking if request body exceeds 512KB
-			if hookReq.ContentSize > 512_000 {
-				slog.Warn("Received content that exceeds limit", "plan", endpointRecord.Plan, "received_size", hookReq.ContentSize, "limit", 512_000)
-
-				content = pgtype.Text{Valid: true, String: ""}
-				responseCode = http.StatusRequestEntityTooLarge
-			} else {
-				content = pgtype.Text{Valid: true, String: hookReq.Content}
-				responseCode = http.StatusOK
-			}
+	}
+
+	userId := endpointRecord.UserID
+
+	// Requests rejected by access rules are neither limited by nor counted against the quota of the owner,
+	// otherwise anyone could exhaust it
+	metered := userId.Valid && s.meter != nil && !hookReq.Blocked
+
+	if metered {
+		quota, err := s.meter.Check(ctx, userId.Int64, endpointRecord.Plan)
+		if err != nil {
+			return db.Request{}, NewInternalServerError()
 		}
-	default:
-		{
+		switch quota {
+		case usage.QuotaExceeded:
+			slog.WarnContext(ctx, "Monthly quota exceeded. Dropping request", "endpoint", endpoint, "userId", userId.Int64, "plan", endpointRecord.Plan)
 			return db.Request{}, &EndpointError{
-				Code:    http.StatusBadRequest,
-				Message: "Invalid user plan",
+				Code:    http.StatusTooManyRequests,
+				Message: "Monthly quota of the endpoint owner has been exceeded.",
+				RetryAt: usage.NextPeriodStart(time.Now()),
 			}
+		case usage.QuotaWarning:
+			slog.WarnContext(ctx, "Monthly quota nearly exhausted", "endpoint", endpoint, "userId", userId.Int64, "plan", endpointRecord.Plan)
 		}
 	}
 
-	userId := endpointRecord.UserID
+	var content pgtype.Text
+	var responseCode int
+	if limits.MaxBodyBytes > 0 && int(hookReq.ContentSize) > limits.MaxBodyBytes {
+		slog.WarnContext(ctx, "Received content that exceeds limit", "plan", endpointRecord.Plan, "received_size", hookReq.ContentSize, "limit", limits.MaxBodyBytes)
+		metrics.HookOversized.WithLabelValues(string(endpointRecord.Plan)).Inc()
+		content = pgtype.Text{Valid: true, String: ""}
+		responseCode = http.StatusRequestEntityTooLarge
+	} else {
+		content = pgtype.Text{Valid: true, String: hookReq.Content}
+		responseCode = http.StatusOK
+	}
+
+	expiresAt := pgtype.Timestamptz{
+		InfinityModifier: pgtype.Infinity,
+		Valid:            true,
+	}
+	if limits.RetentionHours > 0 {
+		expiresAt = pgtype.Timestamptz{
+			// Use time.Duration for arithmetic operations on time.
+			Time:             time.Now().Add(time.Hour * time.Duration(limits.RetentionHours)),
+			InfinityModifier: pgtype.Finite,
+			Valid:            true,
+		}
+	}
 
-	slog.Info("Request code", "code", responseCode)
+	if hookReq.Blocked {
+		responseCode = int(hookReq.ResponseCode)
+	}
+
+	slog.InfoContext(ctx, "Request code", "code", responseCode)
 	requestParams := db.CreateNewRequestParams{
 		UserID:      userId,
 		EndpointID:  endpointRecord.ID,
@@ -272,12 +353,23 @@ func (s *EndpointService) StoreRequestDetails(ctx context.Context, hookReq HookR
 
 		ContentSize: int32(hookReq.ContentSize),
 		ExpiresAt:   expiresAt,
+		Blocked:     hookReq.Blocked,
+		Traceparent: hookReq.TraceParent,
+	}
+
+	if hookReq.TLS != nil {
+		tlsBytes, err := json.Marshal(hookReq.TLS)
+		if err != nil {
+			slog.ErrorContext(ctx, "unable to marshal tls info", "err", err)
+			return db.Request{}, NewInternalServerError()
+		}
+		requestParams.Tls = tlsBytes
 	}
 
 	if strings.Contains(hookReq.ContentType, string(MultipartForm)) || strings.Contains(hookReq.ContentType, string(FormUrlEncoded)) {
 		formBytes, err := json.Marshal(hookReq.FormData)
 		if err != nil {
-			slog.Error("unable to marshal form data", "err", err)
+			slog.ErrorContext(ctx, "unable to marshal form data", "err", err)
 			return db.Request{}, &EndpointError{
 				Code:    http.StatusBadRequest,
 				Message: "unable to parse form data",
@@ -286,19 +378,30 @@ func (s *EndpointService) StoreRequestDetails(ctx context.Context, hookReq HookR
 		requestParams.FormData = formBytes
 	}
 
+	start := time.Now()
 	requestRecord, err := s.endpointq.CreateNewRequest(ctx, requestParams)
+	metrics.HookStoreDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		slog.Error("unable to create new request record", "endpoint", endpoint, "userId", userId, "err", err)
+		slog.ErrorContext(ctx, "unable to create new request record", "endpoint", endpoint, "userId", userId, "err", err)
 		return db.Request{}, NewInternalServerError()
 	}
 
-	slog.Info("Endpoint record created", "endpoint", endpoint, "userId", userId.Int64, "createdAt", requestRecord.CreatedAt)
+	slog.InfoContext(ctx, "Endpoint record created", "endpoint", endpoint, "userId", userId.Int64, "createdAt", requestRecord.CreatedAt)
+
+	if metered {
+		// Usage is best effort. The request is already stored.
+		s.meter.RecordRequest(ctx, userId.Int64, int64(len(content.String)))
+	}
 
 	return requestRecord, nil
 }
 
-func (s *EndpointService) GetEndpointRequestHistory(ctx context.Context, endpoint string, userId int64, limit int32, offset int32) ([]HookRequest, *EndpointError) {
-	slog.Info("Fetch endpoint request history", "endpoint", endpoint, "userId", userId)
+func (s *EndpointService) GetEndpointRequestHistory(ctx context.Context, endpoint string, domain string, userId int64, limit int32, offset int32, includeBlocked bool) ([]HookRequest, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.GetEndpointRequestHistory")
+	defer span.End()
+
+	domain = s.domainOrPrimary(domain)
+	slog.InfoContext(ctx, "Fetch endpoint request history", "endpoint", endpoint, "domain", domain, "userId", userId)
 
 	var reqHistory []HookRequest
 
@@ -307,13 +410,10 @@ func (s *EndpointService) GetEndpointRequestHistory(ctx context.Context, endpoin
 		return nil, NewInternalServerError()
 	}
 
-	var endpoints []string
-
-	for _, e := range endpointsRec {
-		endpoints = append(endpoints, e.Endpoint)
-	}
-
-	if !slices.Contains(endpoints, endpoint) {
+	owned := slices.ContainsFunc(endpointsRec, func(e db.Endpoint) bool {
+		return e.Endpoint == endpoint && e.Domain == domain
+	})
+	if !owned {
 		return reqHistory, &EndpointError{
 			Code:    http.StatusUnauthorized,
 			Message: "Unauthorized",
@@ -323,18 +423,20 @@ func (s *EndpointService) GetEndpointRequestHistory(ctx context.Context, endpoin
 	reqs, err := s.endpointq.GetEndpointHistory(ctx,
 		db.GetEndpointHistoryParams{
 			Endpoint: endpoint,
+			Domain:   domain,
 			UserID: pgtype.Int8{
 				Int64: userId,
 				Valid: true,
 			},
-			Limit:  limit,
-			Offset: offset,
+			IncludeBlocked: includeBlocked,
+			Limit:          limit,
+			Offset:         offset,
 		})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return reqHistory, nil
 		}
-		slog.Error("unable to fetch endpoint request history", "endpoint", endpoint, "userId", userId, "err", err)
+		slog.ErrorContext(ctx, "unable to fetch endpoint request history", "endpoint", endpoint, "userId", userId, "err", err)
 		return nil, NewInternalServerError()
 	}
 
@@ -349,13 +451,16 @@ func (s *EndpointService) GetEndpointRequestHistory(ctx context.Context, endpoin
 			SourceIp:     req.SourceIp,
 			ContentSize:  req.ContentSize,
 			ResponseCode: req.ResponseCode.Int32,
+			Blocked:      req.Blocked,
 			CreatedAt:    req.CreatedAt.Time,
 			ExpiresAt:    req.ExpiresAt.Time,
+			TraceParent:  req.Traceparent,
 		}
 
 		json.Unmarshal(req.Headers, &rh.Headers)
 		json.Unmarshal(req.FormData, &rh.FormData)
 		json.Unmarshal(req.QueryParams, &rh.QueryParams)
+		rh.TLS = unmarshalTLSInfo(req.Tls)
 
 		reqHistory = append(reqHistory, rh)
 	}
@@ -364,7 +469,10 @@ func (s *EndpointService) GetEndpointRequestHistory(ctx context.Context, endpoin
 }
 
 func (s *EndpointService) GetRequestDetails(ctx context.Context, reqId int64) (HookRequest, *EndpointError) {
-	slog.Info("Request to fetch request details", "reqId", reqId)
+	ctx, span := tracing.Start(ctx, "EndpointService.GetRequestDetails")
+	defer span.End()
+
+	slog.InfoContext(ctx, "Request to fetch request details", "reqId", reqId)
 
 	reqRecord, err := s.endpointq.GetRequestById(ctx, reqId)
 	if err != nil {
@@ -374,7 +482,7 @@ func (s *EndpointService) GetRequestDetails(ctx context.Context, reqId int64) (H
 				Message: fmt.Sprintf("No request found for request id: %v", reqId),
 			}
 		} else {
-			slog.Error("unable to fetch request details", "reqId", reqId, "err", err)
+			slog.ErrorContext(ctx, "unable to fetch request details", "reqId", reqId, "err", err)
 			return HookRequest{}, NewInternalServerError()
 		}
 	}
@@ -388,22 +496,29 @@ func (s *EndpointService) GetRequestDetails(ctx context.Context, reqId int64) (H
 		ContentType:  reqRecord.ContentType,
 		ContentSize:  reqRecord.ContentSize,
 		ResponseCode: reqRecord.ResponseCode.Int32,
+		Blocked:      reqRecord.Blocked,
 		CreatedAt:    reqRecord.CreatedAt.Time,
 		ExpiresAt:    reqRecord.ExpiresAt.Time,
+		TraceParent:  reqRecord.Traceparent,
 	}
 
 	json.Unmarshal(reqRecord.Headers, &req.Headers)
 	json.Unmarshal(reqRecord.FormData, &req.FormData)
 	json.Unmarshal(reqRecord.QueryParams, &req.QueryParams)
+	req.TLS = unmarshalTLSInfo(reqRecord.Tls)
 
 	return req, nil
 }
 
-func (s *EndpointService) GetEndpointStats(ctx context.Context, endpoint string) (EndpointStats, *EndpointError) {
+func (s *EndpointService) GetEndpointStats(ctx context.Context, endpoint string, domain string) (EndpointStats, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.GetEndpointStats")
+	defer span.End()
+
 	endpoint = strings.ToLower(endpoint)
-	slog.Info("Request endpoint stats", "endpoint", endpoint)
+	domain = s.domainOrPrimary(domain)
+	slog.InfoContext(ctx, "Request endpoint stats", "endpoint", endpoint, "domain", domain)
 
-	endpointDetails, err := s.endpointq.GetEndpoint(ctx, endpoint)
+	endpointDetails, err := s.endpointq.GetEndpoint(ctx, db.GetEndpointDetailsParams{Endpoint: endpoint, Domain: domain})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return EndpointStats{}, &EndpointError{
@@ -411,40 +526,410 @@ func (s *EndpointService) GetEndpointStats(ctx context.Context, endpoint string)
 				Message: fmt.Sprintf("Endpoint %v not found", endpoint),
 			}
 		}
-		slog.Error("unable to fetch endpoint details", "endpoint", endpoint, "err", err)
+		slog.ErrorContext(ctx, "unable to fetch endpoint details", "endpoint", endpoint, "err", err)
 		return EndpointStats{}, NewInternalServerError()
 	}
 
-	stats, err := s.endpointq.GetEndpointRequestCount(ctx, endpoint)
+	stats, err := s.endpointq.GetEndpointRequestCount(ctx, db.GetEndpointRequestCountParams{Endpoint: endpoint, Domain: domain})
 	if err != nil {
-		slog.Error("unable to fetch endpoint request count", "endpoint", endpoint, "err", err)
+		slog.ErrorContext(ctx, "unable to fetch endpoint request count", "endpoint", endpoint, "err", err)
 		return EndpointStats{}, NewInternalServerError()
 	}
 
+	droppedCount := endpointDetails.DroppedCount
+	if s.limiter != nil {
+		droppedCount += s.limiter.PendingDropped(endpointKey{domain: domain, endpoint: endpoint})
+	}
+
 	return EndpointStats{
 		SuccessCount: stats.SuccessCount,
 		FailureCount: stats.FailureCount,
+		BlockedCount: stats.BlockedCount,
+		DroppedCount: droppedCount,
 		TotalCount:   stats.TotalCount,
 		ExpiresAt:    endpointDetails.ExpiresAt.Time.String(),
 		Plan:         string(endpointDetails.Plan),
 	}, nil
 }
 
+// Returns the endpoint only if it is owned by the given user.
+func (s *EndpointService) getOwnedEndpoint(ctx context.Context, endpoint string, domain string, userId int64) (db.Endpoint, *EndpointError) {
+	endpoint = strings.ToLower(endpoint)
+
+	endpointRecord, err := s.endpointq.GetEndpoint(ctx, db.GetEndpointDetailsParams{Endpoint: endpoint, Domain: s.domainOrPrimary(domain)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return db.Endpoint{}, &EndpointError{
+				Code:    http.StatusNotFound,
+				Message: fmt.Sprintf("Endpoint %v not found", endpoint),
+			}
+		}
+		slog.ErrorContext(ctx, "unable to fetch endpoint details", "endpoint", endpoint, "err", err)
+		return db.Endpoint{}, NewInternalServerError()
+	}
+
+	if !endpointRecord.UserID.Valid || endpointRecord.UserID.Int64 != userId {
+		return db.Endpoint{}, &EndpointError{
+			Code:    http.StatusUnauthorized,
+			Message: "Unauthorized",
+		}
+	}
+
+	return endpointRecord, nil
+}
+
+// Checks an incoming hook request against the access rules of the endpoint.
+// Returns the status code to reject the request with, or 0 if the request is allowed.
+func (s *EndpointService) AuthorizeHook(ctx context.Context, endpoint string, domain string, attempt AccessAttempt) (int, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.AuthorizeHook")
+	defer span.End()
+
+	rules, err := s.endpointq.GetEndpointAccess(ctx, db.GetEndpointAccessParams{Endpoint: endpoint, Domain: s.domainOrPrimary(domain)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		slog.ErrorContext(ctx, "unable to fetch endpoint access rules", "endpoint", endpoint, "err", err)
+		return 0, NewInternalServerError()
+	}
+
+	allowed, reason := evaluateAccess(rules, attempt)
+	if allowed {
+		return 0, nil
+	}
+
+	slog.InfoContext(ctx, "Hook request blocked", "endpoint", endpoint, "source_ip", attempt.SourceIp, "reason", reason)
+
+	rejectCode := int(rules.RejectCode)
+	if rejectCode == 0 {
+		rejectCode = DefaultRejectCode
+	}
+	return rejectCode, nil
+}
+
+func (s *EndpointService) GetEndpointAccess(ctx context.Context, endpoint string, domain string, userId int64) (AccessRules, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.GetEndpointAccess")
+	defer span.End()
+
+	endpointRecord, endpointErr := s.getOwnedEndpoint(ctx, endpoint, domain, userId)
+	if endpointErr != nil {
+		return AccessRules{}, endpointErr
+	}
+
+	rules, err := s.endpointq.GetEndpointAccess(ctx, db.GetEndpointAccessParams{Endpoint: endpointRecord.Endpoint, Domain: endpointRecord.Domain})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return AccessRules{
+				AllowedIps:             []string{},
+				ClientCertFingerprints: []string{},
+				RejectCode:             DefaultRejectCode,
+			}, nil
+		}
+		slog.ErrorContext(ctx, "unable to fetch endpoint access rules", "endpoint", endpoint, "err", err)
+		return AccessRules{}, NewInternalServerError()
+	}
+
+	return accessRulesFromRecord(rules), nil
+}
+
+func (s *EndpointService) SetEndpointAccess(ctx context.Context, endpoint string, domain string, userId int64, rules AccessRules) (AccessRules, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.SetEndpointAccess")
+	defer span.End()
+
+	endpointRecord, endpointErr := s.getOwnedEndpoint(ctx, endpoint, domain, userId)
+	if endpointErr != nil {
+		return AccessRules{}, endpointErr
+	}
+
+	stored, err := s.endpointq.GetEndpointAccess(ctx, db.GetEndpointAccessParams{Endpoint: endpointRecord.Endpoint, Domain: endpointRecord.Domain})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		slog.ErrorContext(ctx, "unable to fetch endpoint access rules", "endpoint", endpoint, "err", err)
+		return AccessRules{}, NewInternalServerError()
+	}
+
+	if validationErr := rules.Validate(stored); validationErr != nil {
+		return AccessRules{}, validationErr
+	}
+
+	if rules.RejectCode == 0 {
+		rules.RejectCode = DefaultRejectCode
+	}
+	if rules.AllowedIps == nil {
+		rules.AllowedIps = []string{}
+	}
+
+	fingerprints := make([]string, 0, len(rules.ClientCertFingerprints))
+	for _, fp := range rules.ClientCertFingerprints {
+		fingerprints = append(fingerprints, normalizeFingerprint(fp))
+	}
+
+	var passwordHash string
+	switch {
+	case rules.BasicUsername == "":
+	case rules.BasicPassword == "":
+		passwordHash = stored.BasicPasswordHash
+	default:
+		passwordHash, err = HashBasicPassword(rules.BasicPassword)
+		if err != nil {
+			slog.ErrorContext(ctx, "unable to hash basic auth password", "endpoint", endpoint, "err", err)
+			return AccessRules{}, NewInternalServerError()
+		}
+	}
+	if rules.HeaderName != "" && rules.HeaderValue == "" {
+		rules.HeaderValue = stored.HeaderValue
+	}
+	if rules.QueryParam != "" && rules.QueryValue == "" {
+		rules.QueryValue = stored.QueryValue
+	}
+
+	rec, err := s.endpointq.UpsertEndpointAccess(ctx, db.UpsertEndpointAccessParams{
+		EndpointID:             endpointRecord.ID,
+		AllowedIps:             rules.AllowedIps,
+		BasicUsername:          rules.BasicUsername,
+		BasicPasswordHash:      passwordHash,
+		HeaderName:             rules.HeaderName,
+		HeaderValue:            rules.HeaderValue,
+		QueryParam:             rules.QueryParam,
+		QueryValue:             rules.QueryValue,
+		ClientCertFingerprints: fingerprints,
+		RejectCode:             int32(rules.RejectCode),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to store endpoint access rules", "endpoint", endpoint, "err", err)
+		return AccessRules{}, NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Endpoint access rules updated", "endpoint", endpoint, "userId", userId)
+	return accessRulesFromRecord(rec), nil
+}
+
+func (s *EndpointService) DeleteEndpointAccess(ctx context.Context, endpoint string, domain string, userId int64) *EndpointError {
+	ctx, span := tracing.Start(ctx, "EndpointService.DeleteEndpointAccess")
+	defer span.End()
+
+	endpointRecord, endpointErr := s.getOwnedEndpoint(ctx, endpoint, domain, userId)
+	if endpointErr != nil {
+		return endpointErr
+	}
+
+	err := s.endpointq.DeleteEndpointAccess(ctx, endpointRecord.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to delete endpoint access rules", "endpoint", endpoint, "err", err)
+		return NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Endpoint access rules removed", "endpoint", endpoint, "userId", userId)
+	return nil
+}
+
+// Applies per-endpoint and per-source IP rate limits to a hook request.
+// Returns 0 if the request is allowed, otherwise the duration after which the caller may retry.
+func (s *EndpointService) CheckRateLimit(ctx context.Context, endpoint string, domain string, ip string) (time.Duration, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.CheckRateLimit")
+	defer span.End()
+
+	if s.limiter == nil {
+		return 0, nil
+	}
+
+	notFoundErr := &EndpointError{
+		Code:    http.StatusNotFound,
+		Message: "Endpoint has either expired or not created",
+	}
+	domain = s.domainOrPrimary(domain)
+	key := endpointKey{domain: domain, endpoint: endpoint}
+	if s.limiter.IsUnknown(key) {
+		return 0, notFoundErr
+	}
+
+	if _, ok := s.limiter.Limits(key); !ok {
+		endpointRecord, err := s.endpointq.GetEndpoint(ctx, db.GetEndpointDetailsParams{Endpoint: endpoint, Domain: domain})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				s.limiter.SetUnknown(key)
+				return 0, notFoundErr
+			}
+			slog.ErrorContext(ctx, "unable to get endpoint details", "endpoint", endpoint, "err", err)
+			return 0, NewInternalServerError()
+		}
+		s.limiter.SetLimits(key, endpointRecord.Plan, s.limiter.Defaults(endpointRecord.Plan).withOverrides(endpointRecord))
+	}
+
+	retryAfter := s.limiter.Allow(key, ip)
+	if retryAfter > 0 {
+		slog.WarnContext(ctx, "Hook request rate limited", "endpoint", endpoint, "source_ip", ip, "retry_after", retryAfter)
+	}
+	return retryAfter, nil
+}
+
+func (s *EndpointService) GetEndpointRateLimit(ctx context.Context, endpoint string, domain string, userId int64) (RateLimits, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.GetEndpointRateLimit")
+	defer span.End()
+
+	endpointRecord, endpointErr := s.getOwnedEndpoint(ctx, endpoint, domain, userId)
+	if endpointErr != nil {
+		return RateLimits{}, endpointErr
+	}
+
+	if s.limiter == nil {
+		return RateLimits{}, nil
+	}
+	return s.limiter.Defaults(endpointRecord.Plan).withOverrides(endpointRecord), nil
+}
+
+// Sets per-endpoint rate limits. Limits can only be tightened below the plan defaults.
+func (s *EndpointService) SetEndpointRateLimit(ctx context.Context, endpoint string, domain string, userId int64, limits RateLimits) (RateLimits, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.SetEndpointRateLimit")
+	defer span.End()
+
+	if limits.Rate < 0 || limits.Burst < 0 || limits.IpRate < 0 || limits.IpBurst < 0 {
+		return RateLimits{}, &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: "Rate limits cannot be negative.",
+		}
+	}
+
+	endpointRecord, endpointErr := s.getOwnedEndpoint(ctx, endpoint, domain, userId)
+	if endpointErr != nil {
+		return RateLimits{}, endpointErr
+	}
+
+	if s.limiter != nil {
+		defaults := s.limiter.Defaults(endpointRecord.Plan)
+		if exceedsLimit(limits.Rate, defaults.Rate) || exceedsLimit(float64(limits.Burst), float64(defaults.Burst)) ||
+			exceedsLimit(limits.IpRate, defaults.IpRate) || exceedsLimit(float64(limits.IpBurst), float64(defaults.IpBurst)) {
+			return RateLimits{}, &EndpointError{
+				Code:    http.StatusBadRequest,
+				Message: "Rate limits cannot exceed the limits of your current plan.",
+			}
+		}
+	}
+
+	endpointRecord, err := s.endpointq.UpdateEndpointRateLimit(ctx, db.UpdateEndpointRateLimitParams{
+		ID:          endpointRecord.ID,
+		RateLimit:   limits.Rate,
+		RateBurst:   int32(limits.Burst),
+		IpRateLimit: limits.IpRate,
+		IpRateBurst: int32(limits.IpBurst),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to update endpoint rate limit", "endpoint", endpoint, "err", err)
+		return RateLimits{}, NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Endpoint rate limit updated", "endpoint", endpoint, "userId", userId)
+
+	if s.limiter == nil {
+		return limits, nil
+	}
+	s.limiter.Forget(endpointKey{domain: endpointRecord.Domain, endpoint: endpointRecord.Endpoint})
+	return s.limiter.Defaults(endpointRecord.Plan).withOverrides(endpointRecord), nil
+}
+
+// Persists dropped request counters collected by the rate limiter.
+func (s *EndpointService) FlushDroppedCounts(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "EndpointService.FlushDroppedCounts")
+	defer span.End()
+
+	if s.limiter == nil {
+		return nil
+	}
+
+	var flushErr error
+	for key, count := range s.limiter.DrainDropped() {
+		err := s.endpointq.IncrementEndpointDroppedCount(ctx, db.IncrementEndpointDroppedCountParams{
+			Endpoint:     key.endpoint,
+			Domain:       key.domain,
+			DroppedCount: count,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "unable to flush dropped count", "endpoint", key.endpoint, "domain", key.domain, "count", count, "err", err)
+			// Keep the count around for the next flush
+			s.limiter.AddDropped(key, count)
+			flushErr = err
+		}
+	}
+	return flushErr
+}
+
+// Public URL of an endpoint in the active addressing mode. An empty domain is the primary domain.
+func (s *EndpointService) EndpointURL(domain string, endpoint string) string {
+	return s.hosts.EndpointURL(domain, endpoint)
+}
+
+// Each base domain has its own set of endpoints. Endpoints addressed without a domain, e.g. through
+// the API host, are on the primary domain.
+func (s *EndpointService) domainOrPrimary(domain string) string {
+	if domain == "" {
+		return s.hosts.Primary()
+	}
+	return strings.ToLower(domain)
+}
+
+// Plan of the endpoint for metrics. Known once the rate limits of the endpoint have been loaded.
+func (s *EndpointService) EndpointPlan(endpoint string, domain string) string {
+	if s.limiter == nil {
+		return metrics.UnknownPlan
+	}
+	p, ok := s.limiter.Plan(endpointKey{domain: s.domainOrPrimary(domain), endpoint: endpoint})
+	if !ok {
+		return metrics.UnknownPlan
+	}
+	return string(p)
+}
+
+// A limit of 0 is unlimited. A value of 0 falls back to the limit itself.
+func exceedsLimit(value float64, limit float64) bool {
+	return limit > 0 && value > limit
+}
+
+// Number of live inspect sessions allowed on the endpoint as per its plan.
+func (s *EndpointService) GetMaxSessions(ctx context.Context, endpoint string, domain string) (int, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.GetMaxSessions")
+	defer span.End()
+
+	endpointRecord, err := s.endpointq.GetEndpoint(ctx, db.GetEndpointDetailsParams{Endpoint: endpoint, Domain: s.domainOrPrimary(domain)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, &EndpointError{
+				Code:    http.StatusNotFound,
+				Message: "Endpoint has either expired or not yet created.",
+			}
+		}
+		slog.ErrorContext(ctx, "unable to get endpoint details", "endpoint", endpoint, "err", err)
+		return 0, NewInternalServerError()
+	}
+
+	limits, ok := s.plans.Get(endpointRecord.Plan)
+	if !ok {
+		return 0, &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid user plan",
+		}
+	}
+	return limits.MaxSessions, nil
+}
+
 type EndpointExists string
 
 const (
 	Available        EndpointExists = "Its available. Sign up and make it yours"
 	Taken            EndpointExists = "That endpoint is already taken. Try something else?"
-	ReservedCompany  EndpointExists = "Endpoint is reserved. But, you can go ahead if you're using mail issued from that organisation."
+	ReservedCompany  EndpointExists = "Endpoint is reserved. But, you can go ahead once your team verifies a domain of that organisation."
 	ReservedEndpoint EndpointExists = "Endpoint is reserved."
 	BadEndpoint      EndpointExists = "Bad endpoint."
 	Error            EndpointExists = "Something went wrong."
 )
 
-func (s *EndpointService) CheckEndpointExists(ctx context.Context, subdomain string) (EndpointExists, *EndpointError) {
+// Checks whether the name is available on the given base domain, or on the primary domain when empty.
+func (s *EndpointService) CheckEndpointExists(ctx context.Context, subdomain string, domain string) (EndpointExists, *EndpointError) {
+	ctx, span := tracing.Start(ctx, "EndpointService.CheckEndpointExists")
+	defer span.End()
+
 	subdomain = strings.ToLower(subdomain)
+	domain = s.domainOrPrimary(domain)
 
-	slog.InfoContext(ctx, "Checking if endpoint exists", "endpoint", subdomain)
+	slog.InfoContext(ctx, "Checking if endpoint exists", "endpoint", subdomain, "domain", domain)
 
 	if len(subdomain) < 4 || len(subdomain) > 10 {
 		return BadEndpoint, &EndpointError{
@@ -453,8 +938,15 @@ func (s *EndpointService) CheckEndpointExists(ctx context.Context, subdomain str
 		}
 	}
 
-	if _, ok := core.ReservedSubdomains[subdomain]; ok {
-		slog.Info("Subdomain is reserved", "subdomain", subdomain)
+	if !s.hosts.IsDomain(domain) {
+		return BadEndpoint, &EndpointError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Domain should be one of %s.", strings.Join(s.hosts.Domains(), ", ")),
+		}
+	}
+
+	if s.reserved.IsSubdomain(subdomain) {
+		slog.InfoContext(ctx, "Subdomain is reserved", "subdomain", subdomain)
 		return ReservedEndpoint, &EndpointError{
 			Code:    http.StatusBadRequest,
 			Message: fmt.Sprintf("Subdomain %s is reserved.", subdomain),
@@ -462,29 +954,32 @@ func (s *EndpointService) CheckEndpointExists(ctx context.Context, subdomain str
 	}
 
 	// Check reserved companies.
-	if _, ok := core.ReservedCompanies[subdomain]; ok {
-		slog.Info("Subdomain is reserved company", "subdomain", subdomain)
+	if s.reserved.IsCompany(subdomain) {
+		slog.InfoContext(ctx, "Subdomain is reserved company", "subdomain", subdomain)
 		return ReservedCompany, nil
 	}
 
-	exists, err := s.endpointq.CheckEndpointExists(ctx, subdomain)
+	exists, err := s.endpointq.CheckEndpointExists(ctx, db.CheckEndpointExistsParams{Endpoint: subdomain, Domain: domain})
 	if err != nil {
-		slog.Error("unable to check if subdomain exists", "subdomain", subdomain, "err", err)
+		slog.ErrorContext(ctx, "unable to check if subdomain exists", "subdomain", subdomain, "domain", domain, "err", err)
 		return Error, NewInternalServerError()
 	}
 
 	if exists {
 		return Taken, nil
 	} else {
-		slog.Info("Subdomain is taken", "subdomain", subdomain)
+		slog.InfoContext(ctx, "Subdomain is taken", "subdomain", subdomain)
 	}
 
-	slog.Info("Subdomain available", "subdomain", subdomain)
+	slog.InfoContext(ctx, "Subdomain available", "subdomain", subdomain)
 	return Available, nil
 }
 
 func (s *EndpointService) GetRequestByUUID(ctx context.Context, uuid string) (HookRequest, *EndpointError) {
-	slog.Info("Request to fetch request details by uuid", "uuid", uuid)
+	ctx, span := tracing.Start(ctx, "EndpointService.GetRequestByUUID")
+	defer span.End()
+
+	slog.InfoContext(ctx, "Request to fetch request details by uuid", "uuid", uuid)
 	reqRecord, err := s.endpointq.GetRequestByUUID(ctx, uuid)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -493,7 +988,7 @@ func (s *EndpointService) GetRequestByUUID(ctx context.Context, uuid string) (Ho
 				Message: fmt.Sprintf("No request found for uuid: %v", uuid),
 			}
 		} else {
-			slog.Error("unable to fetch request details", "uuid", uuid, "err", err)
+			slog.ErrorContext(ctx, "unable to fetch request details", "uuid", uuid, "err", err)
 			return HookRequest{}, NewInternalServerError()
 		}
 	}
@@ -506,23 +1001,29 @@ func (s *EndpointService) GetRequestByUUID(ctx context.Context, uuid string) (Ho
 		Content:      reqRecord.Content.String,
 		ContentSize:  reqRecord.ContentSize,
 		ResponseCode: reqRecord.ResponseCode.Int32,
+		Blocked:      reqRecord.Blocked,
 		CreatedAt:    reqRecord.CreatedAt.Time,
 		ExpiresAt:    reqRecord.ExpiresAt.Time,
+		TraceParent:  reqRecord.Traceparent,
 	}
 
 	json.Unmarshal(reqRecord.Headers, &req.Headers)
 	json.Unmarshal(reqRecord.QueryParams, &req.QueryParams)
+	req.TLS = unmarshalTLSInfo(reqRecord.Tls)
 
 	return req, nil
 }
 
-func (s *EndpointService) ExpireRequests(ctx context.Context) error {
-	slog.Info("Deleting expired requests", "date", time.Now().Local().String())
-	err := s.endpointq.ExpireRequests(ctx)
+func (s *EndpointService) ExpireRequests(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "EndpointService.ExpireRequests")
+	defer span.End()
+
+	slog.InfoContext(ctx, "Deleting expired requests", "date", time.Now().Local().String())
+	deleted, err := s.endpointq.ExpireRequests(ctx)
 	if err != nil {
-		slog.Error("unable to delete expired requests", "date", time.Now().Local().String(), "err", err)
-		return err
+		slog.ErrorContext(ctx, "unable to delete expired requests", "date", time.Now().Local().String(), "err", err)
+		return 0, err
 	}
 
-	return nil
+	return deleted, nil
 }
@@ -8,6 +8,10 @@ import (
 	"time"
 
 	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/core"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/humanbeeng/checkpost/server/internal/reserved"
+	"github.com/humanbeeng/checkpost/server/internal/usage"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
@@ -28,11 +32,15 @@ const (
 	ProUser     string = "pro_user"
 	BasicUser   string = "basic_user"
 
+	// Member of a team that verified checkpost.io
+	BasicUserId int64 = 3
+
 	FreeEndpoint     string = "free-url"
 	ProEndpoint      string = "pro-url"
 	BasicEndpoint    string = "basic-url"
 	UnknownEndpoint  string = "unknown-url"
 	ExistingEndpoint string = "nonexist"
+	LockedEndpoint   string = "locked-url"
 )
 
 func (es MockUserStore) GetUserFromUsername(ctx context.Context, username string) (db.User, error) {
@@ -52,6 +60,7 @@ func (es MockUserStore) GetUserFromUsername(ctx context.Context, username string
 		}, nil
 	} else if username == BasicUser {
 		return db.User{
+			ID:       BasicUserId,
 			Username: username,
 			Plan:     db.PlanBasic,
 			Email:    "basicuser@checkpost.io",
@@ -65,16 +74,22 @@ var _ EndpointQuerier = (*MockEndpointStore)(nil)
 var userStore = MockUserStore{}
 var endpointStore = MockEndpointStore{}
 
+var hosts, _ = core.NewHosts("https", "api.checkpost.io", core.AddressingSubdomain, []string{"checkpost.io", "hooks.internal.example.com"})
+
 var service = EndpointService{
 	endpointq: endpointStore,
 	userq:     userStore,
+	plans:     plan.NewCatalog(plan.Defaults),
+	reserved:  reserved.NewNames(reserved.DefaultSubdomains, reserved.DefaultCompanies),
+	hosts:     hosts,
 }
 
 func (es MockEndpointStore) GetUserEndpoints(ctx context.Context, userId int64) ([]db.Endpoint, error) {
 	return []db.Endpoint{}, nil
 }
 
-func (es MockEndpointStore) GetEndpointRequestCount(ctx context.Context, endpoint string) (db.GetEndpointRequestCountRow, error) {
+func (es MockEndpointStore) GetEndpointRequestCount(ctx context.Context, params db.GetEndpointRequestCountParams) (db.GetEndpointRequestCountRow, error) {
+	endpoint := params.Endpoint
 	if endpoint == BasicEndpoint || endpoint == ProEndpoint || endpoint == FreeEndpoint {
 		return db.GetEndpointRequestCountRow{
 			SuccessCount: 100,
@@ -88,10 +103,12 @@ func (es MockEndpointStore) GetEndpointRequestCount(ctx context.Context, endpoin
 	}
 }
 
-func (es MockEndpointStore) GetEndpoint(ctx context.Context, endpoint string) (db.Endpoint, error) {
-	if endpoint != UnknownEndpoint {
+// Endpoints only exist on the primary domain
+func (es MockEndpointStore) GetEndpoint(ctx context.Context, params db.GetEndpointDetailsParams) (db.Endpoint, error) {
+	if params.Endpoint != UnknownEndpoint && params.Domain == "checkpost.io" {
 		return db.Endpoint{
-			Endpoint: endpoint,
+			Endpoint: params.Endpoint,
+			Domain:   params.Domain,
 			ExpiresAt: pgtype.Timestamptz{
 				Time:             time.Now().Add(time.Hour),
 				Valid:            true,
@@ -104,8 +121,8 @@ func (es MockEndpointStore) GetEndpoint(ctx context.Context, endpoint string) (d
 	return db.Endpoint{}, pgx.ErrNoRows
 }
 
-func (es MockEndpointStore) ExpireRequests(ctx context.Context) error {
-	return nil
+func (es MockEndpointStore) ExpireRequests(ctx context.Context) (int64, error) {
+	return 0, nil
 }
 
 func (es MockEndpointStore) GetEndpointHistory(ctx context.Context, params db.GetEndpointHistoryParams) ([]db.GetEndpointHistoryRow, error) {
@@ -131,17 +148,66 @@ func (es MockEndpointStore) InsertFreeEndpoint(ctx context.Context, params db.In
 	return db.Endpoint{
 		Endpoint: params.Endpoint,
 		ExpiresAt: pgtype.Timestamptz{
-			Time: time.Now().Add(time.Hour * time.Duration(DefaultExpiryHours)),
+			Time: time.Now().Add(time.Hour * time.Duration(plan.Defaults[db.PlanFree].RetentionHours)),
 		},
 	}, nil
 }
 
 func (es MockEndpointStore) InsertEndpoint(ctx context.Context, arg db.InsertEndpointParams) (db.Endpoint, error) {
-	return db.Endpoint{Endpoint: arg.Endpoint}, nil
+	return db.Endpoint{Endpoint: arg.Endpoint, Domain: arg.Domain, Plan: arg.Plan}, nil
+}
+
+func (es MockEndpointStore) AssignEndpointDomain(ctx context.Context, domain string) (int64, error) {
+	return 0, nil
+}
+
+func (es MockEndpointStore) UserHasVerifiedCompany(ctx context.Context, params db.UserHasVerifiedCompanyParams) (bool, error) {
+	return params.UserID == BasicUserId && params.Company == "checkpost", nil
+}
+
+func (es MockEndpointStore) CheckEndpointExists(ctx context.Context, params db.CheckEndpointExistsParams) (bool, error) {
+	return params.Endpoint == ExistingEndpoint && params.Domain == "checkpost.io", nil
 }
 
-func (es MockEndpointStore) CheckEndpointExists(ctx context.Context, endpoint string) (bool, error) {
-	return endpoint == ExistingEndpoint, nil
+func (es MockEndpointStore) GetEndpointAccess(ctx context.Context, params db.GetEndpointAccessParams) (db.EndpointAccess, error) {
+	if params.Endpoint == LockedEndpoint && params.Domain == "checkpost.io" {
+		return db.EndpointAccess{
+			AllowedIps: []string{"10.0.0.0/8"},
+			RejectCode: http.StatusUnauthorized,
+		}, nil
+	}
+	return db.EndpointAccess{}, pgx.ErrNoRows
+}
+
+func (es MockEndpointStore) UpsertEndpointAccess(ctx context.Context, params db.UpsertEndpointAccessParams) (db.EndpointAccess, error) {
+	return db.EndpointAccess{
+		EndpointID:             params.EndpointID,
+		AllowedIps:             params.AllowedIps,
+		BasicUsername:          params.BasicUsername,
+		BasicPasswordHash:      params.BasicPasswordHash,
+		ClientCertFingerprints: params.ClientCertFingerprints,
+		RejectCode:             params.RejectCode,
+	}, nil
+}
+
+func (es MockEndpointStore) DeleteEndpointAccess(ctx context.Context, endpointId int64) error {
+	return nil
+}
+
+func (es MockEndpointStore) UpdateEndpointRateLimit(ctx context.Context, params db.UpdateEndpointRateLimitParams) (db.Endpoint, error) {
+	return db.Endpoint{
+		ID:          params.ID,
+		Endpoint:    ProEndpoint,
+		Plan:        db.PlanPro,
+		RateLimit:   params.RateLimit,
+		RateBurst:   params.RateBurst,
+		IpRateLimit: params.IpRateLimit,
+		IpRateBurst: params.IpRateBurst,
+	}, nil
+}
+
+func (es MockEndpointStore) IncrementEndpointDroppedCount(ctx context.Context, params db.IncrementEndpointDroppedCountParams) error {
+	return nil
 }
 
 // TODO: Move below mocks to request tests
@@ -166,13 +232,22 @@ func (es MockEndpointStore) GetRequestByUUID(ctx context.Context, uuid string) (
 }
 
 func TestCheckEndpointExists(t *testing.T) {
-	exists, err := service.CheckEndpointExists(context.Background(), ExistingEndpoint)
+	exists, err := service.CheckEndpointExists(context.Background(), ExistingEndpoint, "")
 	assert.Nil(t, err)
 	assert.Equal(t, Taken, exists)
+
+	// Each base domain has its own set of endpoints
+	exists, err = service.CheckEndpointExists(context.Background(), ExistingEndpoint, "hooks.internal.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, Available, exists)
+
+	_, err = service.CheckEndpointExists(context.Background(), ExistingEndpoint, "evil.com")
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Code)
 }
 
 func TestCreateEndpointForFreeUserWhenUserNotFound(t *testing.T) {
-	endpoint, err := service.CreateEndpoint(context.TODO(), UnknownUser, FreeEndpoint)
+	endpoint, err := service.CreateEndpoint(context.TODO(), UnknownUser, FreeEndpoint, "")
 	assert.NotNil(t, err)
 	assert.Equal(t, err, &EndpointError{
 		Code:    http.StatusNotFound,
@@ -183,83 +258,109 @@ func TestCreateEndpointForFreeUserWhenUserNotFound(t *testing.T) {
 
 func TestCreateEndpointForFreeUser(t *testing.T) {
 	ctx := context.WithValue(context.TODO(), NumEndpoints, 0)
-	endpoint, err := service.CreateEndpoint(ctx, FreeUser, FreeEndpoint)
+	endpoint, err := service.CreateEndpoint(ctx, FreeUser, FreeEndpoint, "")
 	assert.Nil(t, err)
 	assert.NotEmpty(t, endpoint)
-	assert.Equal(t, "https://free-url.checkpost.io", endpoint.Endpoint)
+	assert.Equal(t, "https://free-url.checkpost.io", service.EndpointURL(endpoint.Domain, endpoint.Endpoint))
 }
 
 func TestCreateEndpointWhenAlreadyExists(t *testing.T) {
-	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, ExistingEndpoint)
+	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, ExistingEndpoint, "")
 	assert.NotNil(t, err)
 	assert.Equal(t, http.StatusConflict, err.Code)
 	assert.Empty(t, endpoint)
+
+	// A name taken on the primary domain is still available on another domain
+	endpoint, err = service.CreateEndpoint(context.TODO(), ProUser, ExistingEndpoint, "hooks.internal.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "hooks.internal.example.com", endpoint.Domain)
 }
 
 func TestCreateEndpointForProUser(t *testing.T) {
-	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, ProEndpoint)
+	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, ProEndpoint, "")
 	assert.Nil(t, err)
 	assert.NotEmpty(t, endpoint)
-	assert.Equal(t, "https://pro-url.checkpost.io", endpoint.Endpoint)
+	assert.Equal(t, "https://pro-url.checkpost.io", service.EndpointURL(endpoint.Domain, endpoint.Endpoint))
+}
+
+func TestCreateEndpointOnSecondaryDomain(t *testing.T) {
+	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, ProEndpoint, "Hooks.Internal.Example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://pro-url.hooks.internal.example.com", service.EndpointURL(endpoint.Domain, endpoint.Endpoint))
+}
+
+func TestCreateEndpointOnUnknownDomain(t *testing.T) {
+	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, ProEndpoint, "evil.com")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Code)
+	assert.Empty(t, endpoint)
 }
 
 func TestCreateEndpointForBasicUser(t *testing.T) {
-	endpoint, err := service.CreateEndpoint(context.TODO(), BasicUser, BasicEndpoint)
+	endpoint, err := service.CreateEndpoint(context.TODO(), BasicUser, BasicEndpoint, "")
 	assert.Nil(t, err)
 	assert.NotEmpty(t, endpoint)
-	assert.Equal(t, "https://basic-url.checkpost.io", endpoint.Endpoint)
+	assert.Equal(t, "https://basic-url.checkpost.io", service.EndpointURL(endpoint.Domain, endpoint.Endpoint))
 }
 
 func TestCreateEndpointWhenFreeUserHasExistingEndpoint(t *testing.T) {
 	ctx := context.WithValue(context.TODO(), NumEndpoints, 1)
-	endpoint, err := service.CreateEndpoint(ctx, FreeUser, FreeEndpoint)
+	endpoint, err := service.CreateEndpoint(ctx, FreeUser, FreeEndpoint, "")
 	assert.Equal(t, http.StatusBadRequest, err.Code)
 	assert.Empty(t, endpoint)
 }
 
 func TestCreateEndpointWhenBasicUserHasExistingEndpoint(t *testing.T) {
 	ctx := context.WithValue(context.TODO(), NumEndpoints, 1)
-	endpoint, err := service.CreateEndpoint(ctx, BasicUser, FreeEndpoint)
+	endpoint, err := service.CreateEndpoint(ctx, BasicUser, FreeEndpoint, "")
 	assert.Error(t, err)
 	assert.Equal(t, http.StatusBadRequest, err.Code)
 	assert.Empty(t, endpoint)
 }
 
 func TestCreateEndpointForReservedDomains(t *testing.T) {
-	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, "dash")
+	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, "dash", "")
 	assert.Error(t, err)
 	assert.Equal(t, http.StatusBadRequest, err.Code)
 	assert.Empty(t, endpoint)
 }
 
 func TestCreateEndpointForReservedCompany(t *testing.T) {
-	endpoint, err := service.CreateEndpoint(context.TODO(), BasicUser, "google")
+	endpoint, err := service.CreateEndpoint(context.TODO(), BasicUser, "google", "")
 	assert.Error(t, err)
 	assert.Equal(t, http.StatusBadRequest, err.Code)
 	assert.Empty(t, endpoint)
 }
 
 func TestCreateEndpointForReservedCompanyWhenUserFromSameOrg(t *testing.T) {
-	endpoint, err := service.CreateEndpoint(context.TODO(), BasicUser, "checkpost")
+	endpoint, err := service.CreateEndpoint(context.TODO(), BasicUser, "checkpost", "")
 	assert.Nil(t, err)
-	assert.Equal(t, endpoint.Endpoint, "https://checkpost.checkpost.io")
+	assert.Equal(t, "https://checkpost.checkpost.io", service.EndpointURL(endpoint.Domain, endpoint.Endpoint))
+}
+
+// An email containing the company name is not proof of belonging to it
+func TestCreateEndpointForReservedCompanyWithoutVerifiedDomain(t *testing.T) {
+	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, "checkpost", "")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.Code)
+	assert.Empty(t, endpoint)
 }
 
 func TestCreateEndpointWhenEndpointLessThanFourChars(t *testing.T) {
-	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, "a")
+	endpoint, err := service.CreateEndpoint(context.TODO(), ProUser, "a", "")
 	assert.Error(t, err)
 	assert.Equal(t, http.StatusBadRequest, err.Code)
 	assert.Empty(t, endpoint)
 }
 
 func TestGetBasicEndpointStats(t *testing.T) {
-	stats, err := service.GetEndpointStats(context.TODO(), BasicEndpoint)
+	stats, err := service.GetEndpointStats(context.TODO(), BasicEndpoint, "")
 	assert.Nil(t, err)
 	assert.NotEmpty(t, stats)
 }
 
 func TestGetEndpointStatsUnknownEndpoint(t *testing.T) {
-	stats, err := service.GetEndpointStats(context.TODO(), UnknownEndpoint)
+	stats, err := service.GetEndpointStats(context.TODO(), UnknownEndpoint, "")
 	assert.NotNil(t, err)
 	assert.Equal(t, http.StatusNotFound, err.Code)
 	assert.Empty(t, stats)
@@ -312,3 +413,68 @@ func TestStoreRequestDetailsWhenEndpointNotFound(t *testing.T) {
 	assert.Equal(t, err.Code, http.StatusNotFound)
 	assert.Empty(t, req)
 }
+
+// Endpoints on one base domain are not reachable through another
+func TestStoreRequestDetailsOnAnotherDomain(t *testing.T) {
+	hookReq := HookRequest{
+		Endpoint: FreeEndpoint,
+		Domain:   "hooks.internal.example.com",
+		Path:     "/",
+		Method:   string(db.HttpMethodPost),
+	}
+	req, err := service.StoreRequestDetails(context.TODO(), hookReq)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, err.Code)
+	assert.Contains(t, err.Message, "https://free-url.hooks.internal.example.com")
+	assert.Empty(t, req)
+}
+
+// Keeps the usage of the current period in memory.
+type MockUsageStore struct {
+	usage *db.Usage
+}
+
+func (us MockUsageStore) IncrementUsage(ctx context.Context, params db.IncrementUsageParams) (db.Usage, error) {
+	us.usage.RequestCount += params.RequestCount
+	us.usage.StoredBytes += params.StoredBytes
+	return *us.usage, nil
+}
+
+func (us MockUsageStore) GetUsage(ctx context.Context, params db.GetUsageParams) (db.Usage, error) {
+	return *us.usage, nil
+}
+
+func (us MockUsageStore) ListUsage(ctx context.Context, params db.ListUsageParams) ([]db.Usage, error) {
+	return []db.Usage{*us.usage}, nil
+}
+
+func TestStoreRequestDetailsMetering(t *testing.T) {
+	plans := plan.NewCatalog(map[db.Plan]plan.Limits{db.PlanPro: {Name: db.PlanPro, MonthlyRequests: 1}})
+	var used db.Usage
+	metered := &EndpointService{
+		endpointq: endpointStore,
+		userq:     userStore,
+		plans:     plans,
+		meter:     usage.NewMeter(MockUsageStore{usage: &used}, plans),
+		hosts:     hosts,
+	}
+	hookReq := HookRequest{Endpoint: ProEndpoint, Path: "/", Method: string(db.HttpMethodPost), ResponseCode: http.StatusOK}
+
+	// Rejected by access rules
+	blocked := hookReq
+	blocked.Blocked = true
+	blocked.ResponseCode = http.StatusUnauthorized
+	for range 3 {
+		_, err := metered.StoreRequestDetails(context.TODO(), blocked)
+		assert.Nil(t, err)
+	}
+	assert.Zero(t, used.RequestCount)
+
+	_, err := metered.StoreRequestDetails(context.TODO(), hookReq)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), used.RequestCount)
+
+	_, err = metered.StoreRequestDetails(context.TODO(), hookReq)
+	assert.Equal(t, http.StatusTooManyRequests, err.Code)
+	assert.Equal(t, usage.NextPeriodStart(time.Now()), err.RetryAt)
+}
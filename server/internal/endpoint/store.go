@@ -9,16 +9,26 @@ import (
 )
 
 type EndpointQuerier interface {
-	CheckEndpointExists(ctx context.Context, endpoint string) (bool, error)
+	CheckEndpointExists(ctx context.Context, params db.CheckEndpointExistsParams) (bool, error)
 
-	GetEndpointRequestCount(ctx context.Context, endpoint string) (db.GetEndpointRequestCountRow, error)
-	GetEndpoint(ctx context.Context, endpoint string) (db.Endpoint, error)
+	GetEndpointRequestCount(ctx context.Context, params db.GetEndpointRequestCountParams) (db.GetEndpointRequestCountRow, error)
+	GetEndpoint(ctx context.Context, params db.GetEndpointDetailsParams) (db.Endpoint, error)
 	GetUserEndpoints(ctx context.Context, userId int64) ([]db.Endpoint, error)
 	GetEndpointHistory(ctx context.Context, params db.GetEndpointHistoryParams) ([]db.GetEndpointHistoryRow, error)
 	GetNonExpiredEndpointsOfUser(ctx context.Context, userId pgtype.Int8) ([]db.Endpoint, error)
 
 	InsertFreeEndpoint(ctx context.Context, params db.InsertFreeEndpointParams) (db.Endpoint, error)
 	InsertEndpoint(ctx context.Context, params db.InsertEndpointParams) (db.Endpoint, error)
+	AssignEndpointDomain(ctx context.Context, domain string) (int64, error)
+
+	GetEndpointAccess(ctx context.Context, params db.GetEndpointAccessParams) (db.EndpointAccess, error)
+	UpsertEndpointAccess(ctx context.Context, params db.UpsertEndpointAccessParams) (db.EndpointAccess, error)
+	DeleteEndpointAccess(ctx context.Context, endpointId int64) error
+
+	UpdateEndpointRateLimit(ctx context.Context, params db.UpdateEndpointRateLimitParams) (db.Endpoint, error)
+	IncrementEndpointDroppedCount(ctx context.Context, params db.IncrementEndpointDroppedCountParams) error
+
+	UserHasVerifiedCompany(ctx context.Context, params db.UserHasVerifiedCompanyParams) (bool, error)
 
 	// TODO: Move these to requests querier
 	CreateNewRequest(ctx context.Context, params db.CreateNewRequestParams) (db.Request, error)
@@ -26,7 +36,7 @@ type EndpointQuerier interface {
 	GetRequestById(ctx context.Context, reqId int64) (db.Request, error)
 	GetRequestByUUID(ctx context.Context, uuid string) (db.Request, error)
 
-	ExpireRequests(ctx context.Context) error
+	ExpireRequests(ctx context.Context) (int64, error)
 }
 
 type EndpointStore struct {
@@ -39,16 +49,24 @@ func NewEndpointStore(q db.Querier) *EndpointStore {
 	}
 }
 
-func (us EndpointStore) GetEndpointRequestCount(ctx context.Context, endpoint string) (db.GetEndpointRequestCountRow, error) {
-	return us.q.GetEndpointRequestCount(ctx, endpoint)
+func (us EndpointStore) GetEndpointRequestCount(ctx context.Context, params db.GetEndpointRequestCountParams) (db.GetEndpointRequestCountRow, error) {
+	return us.q.GetEndpointRequestCount(ctx, params)
+}
+
+func (us EndpointStore) CheckEndpointExists(ctx context.Context, params db.CheckEndpointExistsParams) (bool, error) {
+	return us.q.CheckEndpointExists(ctx, params)
 }
 
-func (us EndpointStore) CheckEndpointExists(ctx context.Context, endpoint string) (bool, error) {
-	return us.q.CheckEndpointExists(ctx, endpoint)
+func (us EndpointStore) AssignEndpointDomain(ctx context.Context, domain string) (int64, error) {
+	return us.q.AssignEndpointDomain(ctx, domain)
 }
 
-func (us EndpointStore) GetEndpoint(ctx context.Context, endpoint string) (db.Endpoint, error) {
-	return us.q.GetEndpointDetails(ctx, endpoint)
+func (us EndpointStore) UserHasVerifiedCompany(ctx context.Context, params db.UserHasVerifiedCompanyParams) (bool, error) {
+	return us.q.UserHasVerifiedCompany(ctx, params)
+}
+
+func (us EndpointStore) GetEndpoint(ctx context.Context, params db.GetEndpointDetailsParams) (db.Endpoint, error) {
+	return us.q.GetEndpointDetails(ctx, params)
 }
 
 func (us EndpointStore) GetUserEndpoints(ctx context.Context, userId int64) ([]db.Endpoint, error) {
@@ -73,6 +91,26 @@ func (us EndpointStore) InsertEndpoint(ctx context.Context, params db.InsertEndp
 	return us.q.InsertEndpoint(ctx, params)
 }
 
+func (us EndpointStore) GetEndpointAccess(ctx context.Context, params db.GetEndpointAccessParams) (db.EndpointAccess, error) {
+	return us.q.GetEndpointAccess(ctx, params)
+}
+
+func (us EndpointStore) UpsertEndpointAccess(ctx context.Context, params db.UpsertEndpointAccessParams) (db.EndpointAccess, error) {
+	return us.q.UpsertEndpointAccess(ctx, params)
+}
+
+func (us EndpointStore) DeleteEndpointAccess(ctx context.Context, endpointId int64) error {
+	return us.q.DeleteEndpointAccess(ctx, endpointId)
+}
+
+func (us EndpointStore) UpdateEndpointRateLimit(ctx context.Context, params db.UpdateEndpointRateLimitParams) (db.Endpoint, error) {
+	return us.q.UpdateEndpointRateLimit(ctx, params)
+}
+
+func (us EndpointStore) IncrementEndpointDroppedCount(ctx context.Context, params db.IncrementEndpointDroppedCountParams) error {
+	return us.q.IncrementEndpointDroppedCount(ctx, params)
+}
+
 // TODO: Move this
 func (us EndpointStore) CreateNewRequest(ctx context.Context, params db.CreateNewRequestParams) (db.Request, error) {
 	return us.q.CreateNewRequest(ctx, params)
@@ -86,6 +124,6 @@ func (us EndpointStore) GetRequestByUUID(ctx context.Context, uuid string) (db.R
 	return us.q.GetRequestByUUID(ctx, uuid)
 }
 
-func (us EndpointStore) ExpireRequests(ctx context.Context) error {
+func (us EndpointStore) ExpireRequests(ctx context.Context) (int64, error) {
 	return us.q.DeleteExpiredRequests(ctx)
 }
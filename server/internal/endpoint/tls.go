@@ -0,0 +1,44 @@
+package endpoint
+
+import (
+	"crypto/tls"
+	"encoding/json"
+)
+
+// TLS details of a request received over in process TLS.
+type TLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	ServerName  string `json:"server_name"`
+	// Subject of the certificate presented by the client, if any
+	ClientCertSubject string `json:"client_cert_subject,omitempty"`
+}
+
+// Returns nil for plain HTTP and TLS terminated by a proxy.
+func NewTLSInfo(cs *tls.ConnectionState) *TLSInfo {
+	if cs == nil {
+		return nil
+	}
+
+	info := &TLSInfo{
+		Version:     tls.VersionName(cs.Version),
+		CipherSuite: tls.CipherSuiteName(cs.CipherSuite),
+		ServerName:  cs.ServerName,
+	}
+	if len(cs.PeerCertificates) > 0 {
+		info.ClientCertSubject = cs.PeerCertificates[0].Subject.String()
+	}
+	return info
+}
+
+func unmarshalTLSInfo(raw []byte) *TLSInfo {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var info TLSInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil
+	}
+	return &info
+}
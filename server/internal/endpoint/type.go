@@ -9,6 +9,8 @@ type EndpointStats struct {
 	TotalCount   int64  `json:"total_count"`
 	SuccessCount int64  `json:"success_count"`
 	FailureCount int64  `json:"failure_count"`
+	BlockedCount int64  `json:"blocked_count"`
+	DroppedCount int64  `json:"dropped_count"`
 	ExpiresAt    string `json:"expires_at"`
 	Plan         string `json:"plan"`
 }
@@ -16,6 +18,8 @@ type EndpointStats struct {
 type EndpointError struct {
 	Code    int
 	Message string
+	// When set, sent as Retry-After with the error
+	RetryAt time.Time
 }
 
 func (u *EndpointError) Error() string {
@@ -44,12 +48,29 @@ type HookRequest struct {
 	ContentType  string              `json:"content_type"`
 	ContentSize  int32               `json:"content_size"`
 	ResponseCode int32               `json:"response_code"`
+	Blocked      bool                `json:"blocked"`
 	CreatedAt    time.Time           `json:"created_at"`
 	ExpiresAt    time.Time           `json:"expires_at"`
+	TLS          *TLSInfo            `json:"tls,omitempty"`
+	// W3C traceparent of the sender, links the request to the trace that sent it
+	TraceParent string `json:"traceparent,omitempty"`
+
+	// Base domain the request was addressed to. Empty when addressed through the API host, which
+	// serves the endpoints of the primary domain.
+	Domain string `json:"-"`
+}
+
+// Identifies an endpoint in memory. Each base domain has its own set of endpoints, so the name alone
+// is ambiguous.
+type endpointKey struct {
+	domain   string
+	endpoint string
 }
 
 type Endpoint struct {
 	Endpoint  string    `json:"endpoint"`
+	Domain    string    `json:"domain"`
+	Url       string    `json:"url"`
 	ExpiresAt time.Time `json:"expires_at"`
 	Plan      string    `json:"plan"`
 }
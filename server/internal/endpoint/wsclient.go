@@ -1,12 +1,14 @@
 package endpoint
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/gofiber/contrib/websocket"
+	"github.com/humanbeeng/checkpost/server/internal/metrics"
 )
 
 const (
@@ -15,8 +17,15 @@ const (
 	// so if ping fails to receive a pong, deadline wont be pushed further and deadline will be reached.
 	// So ping-pong timeout would be 35 - 30 = 5 seconds.
 	nextPongWait = 10 * time.Second
+	// Time allowed to write a close frame to a peer
+	closeWriteWait = time.Second
+	// Time a session is given to take a broadcast message before it is dropped
+	broadcastWait = 250 * time.Millisecond
 )
 
+// Sent with CloseServiceRestart on shutdown. Clients reconnect, e.g. to another instance during a deploy.
+const ReconnectReason = "server restarting. reconnect"
+
 type EndpointSession struct {
 	sync.RWMutex
 	sessionsMap map[string]*WSClient
@@ -24,16 +33,16 @@ type EndpointSession struct {
 
 type WSClient struct {
 	sessionId string
-	endpoint  string
+	key       endpointKey
 	conn      *websocket.Conn
 	manager   *WSManager
 	egress    chan EgressMessage
 }
 
-func NewWSClient(sessionId string, endpoint string, conn *websocket.Conn, manager *WSManager) *WSClient {
+func NewWSClient(sessionId string, key endpointKey, conn *websocket.Conn, manager *WSManager) *WSClient {
 	return &WSClient{
 		sessionId: sessionId,
-		endpoint:  endpoint,
+		key:       key,
 		conn:      conn,
 		manager:   manager,
 		egress:    make(chan EgressMessage),
@@ -41,10 +50,10 @@ func NewWSClient(sessionId string, endpoint string, conn *websocket.Conn, manage
 }
 
 func (c *WSClient) readMessages(wg *sync.WaitGroup) {
-	slog.Info("Reading from conn", "endpoint", c.endpoint, "session_id", c.sessionId)
+	slog.Info("Reading from conn", "endpoint", c.key.endpoint, "domain", c.key.domain, "session_id", c.sessionId)
 	// Cleanup function
 	defer func() {
-		c.manager.RemoveConn(c.endpoint, c.sessionId)
+		c.manager.RemoveConn(c.key, c.sessionId)
 		wg.Done()
 	}()
 
@@ -66,7 +75,7 @@ func (c *WSClient) writeMessage(wg *sync.WaitGroup) {
 	defer func(t *time.Ticker) {
 		t.Stop()
 		wg.Done()
-		c.manager.RemoveConn(c.endpoint, c.sessionId)
+		c.manager.RemoveConn(c.key, c.sessionId)
 	}(t)
 
 	for {
@@ -76,7 +85,7 @@ func (c *WSClient) writeMessage(wg *sync.WaitGroup) {
 				if !ok {
 					// Connection has been closed
 					if err := c.conn.WriteMessage(websocket.CloseMessage, nil); err != nil {
-						slog.Error("unable to write close message", "endpoint", c.endpoint, "session_id", c.sessionId)
+						slog.Error("unable to write close message", "endpoint", c.key.endpoint, "domain", c.key.domain, "session_id", c.sessionId)
 						return
 					}
 				}
@@ -88,7 +97,7 @@ func (c *WSClient) writeMessage(wg *sync.WaitGroup) {
 
 				err := c.conn.WriteJSON(wm)
 				if err != nil {
-					slog.Error("unable to write json to connection", "endpoint", c.endpoint, "session_id", c.sessionId)
+					slog.Error("unable to write json to connection", "endpoint", c.key.endpoint, "domain", c.key.domain, "session_id", c.sessionId)
 					return
 				}
 
@@ -113,39 +122,47 @@ func (c *WSClient) pongHandler(data string) error {
 
 type WSManager struct {
 	sync.RWMutex
-	endpointSessions map[string]*EndpointSession
+	endpointSessions map[endpointKey]*EndpointSession
+	// Set on shutdown. New sessions are refused and hooks are no longer broadcast.
+	closing bool
 }
 
 func NewWSManager() *WSManager {
 	return &WSManager{
-		endpointSessions: make(map[string]*EndpointSession),
+		endpointSessions: make(map[endpointKey]*EndpointSession),
 	}
 }
 
-func (m *WSManager) AddConn(endpoint string, conn *websocket.Conn) error {
+// Registers the connection and blocks until it is closed. maxSessions of 0 allows unlimited sessions.
+func (m *WSManager) AddConn(key endpointKey, conn *websocket.Conn, maxSessions int) error {
 	// Reuse requestId as sessionId
 	sessionId := conn.Locals("requestid").(string)
 
+	if m.isClosing() {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseServiceRestart, ReconnectReason), time.Now().Add(closeWriteWait))
+		conn.Close()
+		return nil
+	}
+
 	// Check if there are any existing listeners. No, then create a new sessions map, else just store in existing map
 	client := WSClient{
 		sessionId: sessionId,
 		conn:      conn,
 		manager:   m,
-		endpoint:  endpoint,
+		key:       key,
 		egress:    make(chan EgressMessage),
 	}
 
-	sessions, ok := m.endpointSessions[endpoint]
+	sessions, ok := m.endpointSessions[key]
 	if !ok {
-		slog.Info("No sessions found", "endpoint", endpoint)
+		slog.Info("No sessions found", "endpoint", key.endpoint, "domain", key.domain)
 		// No sessions found. Create a new sessions map
 		s := EndpointSession{sessionsMap: make(map[string]*WSClient)}
 		s.sessionsMap[sessionId] = &client
-		m.endpointSessions[endpoint] = &s
+		m.endpointSessions[key] = &s
 	} else {
-		// TODO: Plan based limit
-		if len(sessions.sessionsMap) >= 5 {
-			slog.Warn("Number of sessions limit exceeded 5. Closing connection.", "endpoint", endpoint)
+		if maxSessions > 0 && len(sessions.sessionsMap) >= maxSessions {
+			slog.Warn("Number of sessions limit exceeded. Closing connection.", "endpoint", key.endpoint, "domain", key.domain, "limit", maxSessions)
 			conn.WriteJSON(WSMessage{Code: 409, Message: "too many connections"})
 			conn.Close()
 			return nil
@@ -156,14 +173,15 @@ func (m *WSManager) AddConn(endpoint string, conn *websocket.Conn) error {
 		sessions.Lock()
 		m.Lock()
 		sessions.sessionsMap[sessionId] = &client
-		m.endpointSessions[endpoint] = sessions
+		m.endpointSessions[key] = sessions
 		sessions.Unlock()
 		m.Unlock()
 	}
 
+	metrics.WebsocketSessions.Inc()
 	conn.SetPongHandler(client.pongHandler)
 
-	slog.Info("Connection added to manager", "endpoint", endpoint, "session_id", sessionId)
+	slog.Info("Connection added to manager", "endpoint", key.endpoint, "domain", key.domain, "session_id", sessionId)
 
 	wg := sync.WaitGroup{}
 	wg.Add(2)
@@ -173,10 +191,10 @@ func (m *WSManager) AddConn(endpoint string, conn *websocket.Conn) error {
 	return nil
 }
 
-func (m *WSManager) RemoveConn(endpoint string, sessionId string) error {
-	sessions, ok := m.endpointSessions[endpoint]
+func (m *WSManager) RemoveConn(key endpointKey, sessionId string) error {
+	sessions, ok := m.endpointSessions[key]
 	if !ok {
-		slog.Warn("No sessions found", "endpoint", endpoint)
+		slog.Warn("No sessions found", "endpoint", key.endpoint, "domain", key.domain)
 		return nil
 	}
 
@@ -190,21 +208,80 @@ func (m *WSManager) RemoveConn(endpoint string, sessionId string) error {
 		sessions.Lock()
 		defer sessions.Unlock()
 		delete(sessions.sessionsMap, sessionId)
+		metrics.WebsocketSessions.Dec()
 
 		if len(sessions.sessionsMap) == 0 {
 			// Remove sessions object itself from endpointSessions
 			m.Lock()
 			defer m.Unlock()
-			delete(m.endpointSessions, endpoint)
+			delete(m.endpointSessions, key)
 		}
 
-		slog.Info("Connection removed", "endpoint", endpoint, "session_id", sessionId, "num_sessions", len(sessions.sessionsMap))
+		slog.Info("Connection removed", "endpoint", key.endpoint, "domain", key.domain, "session_id", sessionId, "num_sessions", len(sessions.sessionsMap))
 	} else {
 		slog.Warn("No session found", "session_id", sessionId)
 	}
 	return nil
 }
 
+func (m *WSManager) isClosing() bool {
+	m.RLock()
+	defer m.RUnlock()
+	return m.closing
+}
+
+func (m *WSManager) numSessions() int {
+	m.RLock()
+	defer m.RUnlock()
+	n := 0
+	for _, sessions := range m.endpointSessions {
+		sessions.RLock()
+		n += len(sessions.sessionsMap)
+		sessions.RUnlock()
+	}
+	return n
+}
+
+// Sends a close frame with a reconnect hint to every session and waits for the sessions to end. Sessions
+// still open when ctx is done are closed without waiting for the peer.
+func (m *WSManager) Shutdown(ctx context.Context) error {
+	m.Lock()
+	m.closing = true
+	clients := make([]*WSClient, 0)
+	for _, sessions := range m.endpointSessions {
+		sessions.RLock()
+		for _, c := range sessions.sessionsMap {
+			clients = append(clients, c)
+		}
+		sessions.RUnlock()
+	}
+	m.Unlock()
+
+	slog.InfoContext(ctx, "Closing websocket sessions", "num_sessions", len(clients))
+	msg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, ReconnectReason)
+	for _, c := range clients {
+		// WriteControl is safe to call concurrently with the writer of the session
+		if err := c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeWriteWait)); err != nil {
+			slog.WarnContext(ctx, "unable to send close message", "endpoint", c.key.endpoint, "domain", c.key.domain, "session_id", c.sessionId, "err", err)
+		}
+	}
+
+	// Sessions end once the peer echoes the close frame
+	t := time.NewTicker(100 * time.Millisecond)
+	defer t.Stop()
+	for m.numSessions() > 0 {
+		select {
+		case <-ctx.Done():
+			for _, c := range clients {
+				c.conn.Close()
+			}
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	return nil
+}
+
 type EgressEvent string
 
 const (
@@ -0,0 +1,67 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWSManagerShutdown(t *testing.T) {
+	m := NewWSManager()
+
+	app := fiber.New()
+	app.Use(requestid.New())
+	app.Get("/inspect/:endpoint", websocket.New(func(c *websocket.Conn) {
+		m.AddConn(endpointKey{domain: "checkpost.io", endpoint: c.Params("endpoint")}, c, 0)
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+
+	url := "ws://" + ln.Addr().String() + "/inspect/acme"
+	client, _, err := fastws.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	assert.Eventually(t, func() bool { return m.numSessions() == 1 }, time.Second, 10*time.Millisecond)
+
+	// Reading lets the client echo the close frame
+	closeErr := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				closeErr <- err
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, m.Shutdown(ctx))
+	assert.Zero(t, m.numSessions())
+
+	err = <-closeErr
+	var ce *fastws.CloseError
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, websocket.CloseServiceRestart, ce.Code)
+	assert.Equal(t, ReconnectReason, ce.Text)
+
+	// New sessions are turned away with the same hint
+	late, _, err := fastws.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	defer late.Close()
+	_, _, err = late.ReadMessage()
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, websocket.CloseServiceRestart, ce.Code)
+}
@@ -0,0 +1,48 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type HealthController struct {
+	service *HealthService
+}
+
+func NewHealthController(service *HealthService) *HealthController {
+	return &HealthController{
+		service: service,
+	}
+}
+
+func (hc *HealthController) RegisterRoutes(app *fiber.App, authmw fiber.Handler, adminmw fiber.Handler) {
+	app.Get("/healthz", hc.LivenessHandler)
+	app.Get("/readyz", hc.ReadinessHandler)
+	app.Get("/version", hc.VersionHandler)
+	app.Get("/admin/build", authmw, adminmw, hc.BuildHandler)
+}
+
+// The process is able to serve requests. Dependencies are not checked, so a database outage does not
+// restart every instance.
+func (hc *HealthController) LivenessHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": StatusUp})
+}
+
+func (hc *HealthController) ReadinessHandler(c *fiber.Ctx) error {
+	report := hc.service.Ready(c.UserContext())
+	if report.Status != StatusUp {
+		c.Status(http.StatusServiceUnavailable)
+	}
+	return c.JSON(report)
+}
+
+// Served without authentication, so it only carries the version and commit.
+func (hc *HealthController) VersionHandler(c *fiber.Ctx) error {
+	return c.JSON(hc.service.Version())
+}
+
+// Build details and the features enabled by configuration, for admins.
+func (hc *HealthController) BuildHandler(c *fiber.Ctx) error {
+	return c.JSON(hc.service.Build())
+}
@@ -0,0 +1,214 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/humanbeeng/checkpost/server/config"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+const (
+	// Time allowed for each readiness check
+	checkTimeout = 2 * time.Second
+	// Jobs overdue by more than this mean the scheduler is not running
+	schedulerGrace = time.Minute
+)
+
+// Set at build time with -ldflags "-X github.com/humanbeeng/checkpost/server/internal/health.Version=v1.2.0".
+// Commit falls back to the revision stamped by the go toolchain.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Scheduled background jobs, satisfied by *cron.Cron.
+type Scheduler interface {
+	Entries() []cron.Entry
+}
+
+type ComponentReport struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+type ReadinessReport struct {
+	Status     string            `json:"status"`
+	Components []ComponentReport `json:"components"`
+}
+
+// Features enabled by configuration. Secrets are never reported.
+type Features struct {
+	Addressing string   `json:"addressing"`
+	Domains    []string `json:"domains"`
+	TLS        bool     `json:"tls"`
+	DevAuth    bool     `json:"dev_auth"`
+	Github     bool     `json:"github"`
+	Google     bool     `json:"google"`
+	Oidc       []string `json:"oidc"`
+	Mail       string   `json:"mail"`
+	Billing    bool     `json:"billing"`
+}
+
+func FeaturesFromConfig(cfg *config.AppConfig) Features {
+	oidc := make([]string, 0, len(cfg.Oidc))
+	for name := range cfg.Oidc {
+		oidc = append(oidc, name)
+	}
+	return Features{
+		Addressing: cfg.Hosting.Addressing,
+		Domains:    cfg.Hosting.Domains,
+		TLS:        cfg.TLS.Enabled,
+		DevAuth:    cfg.DevAuth.Enabled,
+		Github:     cfg.Github.ClientId != "",
+		Google:     cfg.Google.ClientId != "",
+		Oidc:       oidc,
+		Mail:       cfg.Mail.Transport,
+		Billing:    cfg.Billing.WebhookSecret != "",
+	}
+}
+
+type VersionInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+}
+
+type BuildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	Modified  bool     `json:"modified"`
+	GoVersion string   `json:"go_version"`
+	Features  Features `json:"features"`
+}
+
+func NewBuildInfo(features Features) BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		GoVersion: runtime.Version(),
+		Features:  features,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+type HealthService struct {
+	healthq   HealthQuerier
+	scheduler Scheduler
+	// Schema version this build was made for
+	schemaVersion int64
+	build         BuildInfo
+}
+
+func NewHealthService(healthq HealthQuerier, scheduler Scheduler, schemaVersion int64, build BuildInfo) *HealthService {
+	return &HealthService{
+		healthq:       healthq,
+		scheduler:     scheduler,
+		schemaVersion: schemaVersion,
+		build:         build,
+	}
+}
+
+func (s *HealthService) Build() BuildInfo {
+	return s.build
+}
+
+func (s *HealthService) Version() VersionInfo {
+	return VersionInfo{Version: s.build.Version, Commit: s.build.Commit}
+}
+
+// Checks every component the server needs to serve traffic. Failure details are logged, the report only
+// carries a short message as it is served without authentication.
+func (s *HealthService) Ready(ctx context.Context) ReadinessReport {
+	report := ReadinessReport{Status: StatusUp}
+	report.Components = append(report.Components,
+		s.check(ctx, "postgres", s.checkPostgres),
+		s.check(ctx, "migrations", s.checkMigrations),
+		s.check(ctx, "scheduler", s.checkScheduler),
+	)
+	for _, c := range report.Components {
+		if c.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (s *HealthService) check(ctx context.Context, name string, fn func(ctx context.Context) (string, error)) ComponentReport {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	msg, err := fn(ctx)
+	report := ComponentReport{
+		Name:      name,
+		Status:    StatusUp,
+		Message:   msg,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "readiness check failed", "component", name, "err", err)
+		report.Status = StatusDown
+	}
+	return report
+}
+
+func (s *HealthService) checkPostgres(ctx context.Context) (string, error) {
+	if err := s.healthq.Ping(ctx); err != nil {
+		return "unreachable", err
+	}
+	return "", nil
+}
+
+// Newer schemas are accepted, so instances of the previous release stay ready while a rollout migrates.
+func (s *HealthService) checkMigrations(ctx context.Context) (string, error) {
+	version, dirty, err := s.healthq.SchemaVersion(ctx)
+	if err != nil {
+		return "unable to read schema version", err
+	}
+	msg := fmt.Sprintf("version %d, want %d", version, s.schemaVersion)
+	if dirty {
+		return msg + ", dirty", fmt.Errorf("schema version %d is dirty", version)
+	}
+	if version < s.schemaVersion {
+		return msg, fmt.Errorf("schema version %d is behind %d", version, s.schemaVersion)
+	}
+	return msg, nil
+}
+
+func (s *HealthService) checkScheduler(ctx context.Context) (string, error) {
+	entries := s.scheduler.Entries()
+	if len(entries) == 0 {
+		return "no jobs scheduled", fmt.Errorf("no jobs scheduled")
+	}
+	overdue := time.Now().Add(-schedulerGrace)
+	for _, e := range entries {
+		// Next is zero until the scheduler is started
+		if e.Next.IsZero() || e.Next.Before(overdue) {
+			return "not running", fmt.Errorf("job %d due at %s has not run", e.ID, e.Next)
+		}
+	}
+	return fmt.Sprintf("%d jobs", len(entries)), nil
+}
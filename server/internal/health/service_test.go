@@ -0,0 +1,105 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockHealthStore struct {
+	pingErr error
+	version int64
+	dirty   bool
+}
+
+func (ms MockHealthStore) Ping(ctx context.Context) error {
+	return ms.pingErr
+}
+
+func (ms MockHealthStore) SchemaVersion(ctx context.Context) (int64, bool, error) {
+	return ms.version, ms.dirty, nil
+}
+
+type MockScheduler struct {
+	entries []cron.Entry
+}
+
+func (ms MockScheduler) Entries() []cron.Entry {
+	return ms.entries
+}
+
+var runningScheduler = MockScheduler{entries: []cron.Entry{{ID: 1, Next: time.Now().Add(time.Minute)}}}
+
+func componentStatus(report ReadinessReport, name string) string {
+	for _, c := range report.Components {
+		if c.Name == name {
+			return c.Status
+		}
+	}
+	return ""
+}
+
+func TestReady(t *testing.T) {
+	s := NewHealthService(MockHealthStore{version: 16}, runningScheduler, 16, BuildInfo{})
+
+	report := s.Ready(context.TODO())
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Len(t, report.Components, 3)
+}
+
+func TestReadyWithNewerSchema(t *testing.T) {
+	s := NewHealthService(MockHealthStore{version: 17}, runningScheduler, 16, BuildInfo{})
+
+	assert.Equal(t, StatusUp, s.Ready(context.TODO()).Status)
+}
+
+func TestNotReady(t *testing.T) {
+	cases := []struct {
+		name      string
+		store     MockHealthStore
+		scheduler MockScheduler
+		component string
+	}{
+		{"postgres down", MockHealthStore{pingErr: errors.New("connection refused"), version: 16}, runningScheduler, "postgres"},
+		{"schema behind", MockHealthStore{version: 15}, runningScheduler, "migrations"},
+		{"schema dirty", MockHealthStore{version: 16, dirty: true}, runningScheduler, "migrations"},
+		{"scheduler not started", MockHealthStore{version: 16}, MockScheduler{entries: []cron.Entry{{ID: 1}}}, "scheduler"},
+		{"scheduler stopped", MockHealthStore{version: 16}, MockScheduler{entries: []cron.Entry{{ID: 1, Next: time.Now().Add(-time.Hour)}}}, "scheduler"},
+		{"no jobs", MockHealthStore{version: 16}, MockScheduler{}, "scheduler"},
+	}
+	for _, tc := range cases {
+		s := NewHealthService(tc.store, tc.scheduler, 16, BuildInfo{})
+
+		report := s.Ready(context.TODO())
+		assert.Equal(t, StatusDown, report.Status, tc.name)
+		assert.Equal(t, StatusDown, componentStatus(report, tc.component), tc.name)
+	}
+}
+
+func TestVersionHidesFeatures(t *testing.T) {
+	build := BuildInfo{Version: "v1.2.0", Commit: "abc", Features: Features{DevAuth: true, Mail: "smtp", Oidc: []string{"corp"}}}
+	hc := NewHealthController(NewHealthService(MockHealthStore{}, runningScheduler, 16, build))
+
+	deny := func(c *fiber.Ctx) error { return fiber.ErrForbidden }
+	app := fiber.New()
+	hc.RegisterRoutes(app, deny, deny)
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/version", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var body map[string]any
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(t, map[string]any{"version": "v1.2.0", "commit": "abc"}, body)
+
+	res, err = app.Test(httptest.NewRequest(http.MethodGet, "/admin/build", nil))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
@@ -0,0 +1,35 @@
+package health
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type HealthQuerier interface {
+	Ping(ctx context.Context) error
+	// Version and dirty flag recorded by golang-migrate
+	SchemaVersion(ctx context.Context) (int64, bool, error)
+}
+
+type HealthStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewHealthStore(pool *pgxpool.Pool) *HealthStore {
+	return &HealthStore{
+		pool: pool,
+	}
+}
+
+func (hs HealthStore) Ping(ctx context.Context) error {
+	return hs.pool.Ping(ctx)
+}
+
+// schema_migrations is owned by the migration tool, so it is not part of the sqlc schema.
+func (hs HealthStore) SchemaVersion(ctx context.Context) (int64, bool, error) {
+	var version int64
+	var dirty bool
+	err := hs.pool.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	return version, dirty, err
+}
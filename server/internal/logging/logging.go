@@ -0,0 +1,185 @@
+// Package logging configures slog. Records carry the attributes stored in their context, e.g. the request id,
+// endpoint and user of the request they were logged for, along with the id of the active trace.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/humanbeeng/checkpost/server/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+type attrsCtxKey struct{}
+
+// Returns a copy of ctx whose log records carry the given attributes, as key value pairs or slog.Attr.
+func With(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(attrsCtxKey{}).([]slog.Attr)
+	// A record turns key value pairs into attributes the same way the slog functions do
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.AddAttrs(attrs...)
+	r.Add(args...)
+
+	merged := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		merged = append(merged, a)
+		return true
+	})
+	return context.WithValue(ctx, attrsCtxKey{}, merged)
+}
+
+// Logger scoped to the request of ctx, for code that keeps a logger around instead of passing ctx.
+func FromContext(ctx context.Context) *slog.Logger {
+	attrs, _ := ctx.Value(attrsCtxKey{}).([]slog.Attr)
+	args := make([]any, len(attrs))
+	for i, a := range attrs {
+		args[i] = a
+	}
+	return slog.Default().With(args...)
+}
+
+// Builds the logger described by cfg. Format defaults to json and level to info.
+func New(cfg config.Log, w io.Writer) (*slog.Logger, error) {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	packages := make(map[string]slog.Level, len(cfg.Packages))
+	minLevel := level
+	for pkg, l := range cfg.Packages {
+		pl, err := parseLevel(l)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", pkg, err)
+		}
+		packages[pkg] = pl
+		minLevel = min(minLevel, pl)
+	}
+
+	// Filtering by level is done by Handler, so the inner handler passes everything
+	opts := &slog.HandlerOptions{Level: slog.Level(-100), ReplaceAttr: redact}
+	var inner slog.Handler
+	switch cfg.Format {
+	case "", FormatJSON:
+		inner = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		inner = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q. Must be %s or %s", cfg.Format, FormatJSON, FormatText)
+	}
+
+	return slog.New(&Handler{
+		inner:    inner,
+		level:    level,
+		packages: packages,
+		minLevel: minLevel,
+		pcs:      &sync.Map{},
+	}), nil
+}
+
+// Installs the logger described by cfg as the default.
+func Setup(cfg config.Log, w io.Writer) error {
+	logger, err := New(cfg, w)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return level, nil
+}
+
+// Applies per package levels and adds the attributes of the record context.
+type Handler struct {
+	inner    slog.Handler
+	level    slog.Level
+	packages map[string]slog.Level
+	// Lowest of all levels, anything below is dropped without resolving the package
+	minLevel slog.Level
+	// Package name by program counter of the logging call
+	pcs *sync.Map
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.minLevel
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < h.levelOf(r.PC) {
+		return nil
+	}
+
+	if attrs, ok := ctx.Value(attrsCtxKey{}).([]slog.Attr); ok {
+		// Attributes passed to the call win over the ones of the context
+		logged := make(map[string]bool, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			logged[a.Key] = true
+			return true
+		})
+		for _, a := range attrs {
+			if !logged[a.Key] {
+				r.AddAttrs(a)
+			}
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.inner = h.inner.WithAttrs(attrs)
+	return &c
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.inner = h.inner.WithGroup(name)
+	return &c
+}
+
+func (h *Handler) levelOf(pc uintptr) slog.Level {
+	if len(h.packages) == 0 || pc == 0 {
+		return h.level
+	}
+
+	pkg, ok := h.pcs.Load(pc)
+	if !ok {
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		pkg = packageName(frame.Function)
+		h.pcs.Store(pc, pkg)
+	}
+	if level, ok := h.packages[pkg.(string)]; ok {
+		return level
+	}
+	return h.level
+}
+
+// Package name of a function, e.g. endpoint for
+// github.com/humanbeeng/checkpost/server/internal/endpoint.(*EndpointService).StoreRequestDetails.
+func packageName(function string) string {
+	name := function[strings.LastIndex(function, "/")+1:]
+	name, _, _ = strings.Cut(name, ".")
+	return name
+}
@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/humanbeeng/checkpost/server/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var r map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &r))
+		out = append(out, r)
+	}
+	return out
+}
+
+func TestContextAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(config.Log{}, &buf)
+	assert.NoError(t, err)
+
+	ctx := With(context.Background(), "requestid", "req-1", "endpoint", "acme")
+	ctx = With(ctx, "userId", int64(7))
+	logger.InfoContext(ctx, "Storing request details", "endpoint", "other")
+	logger.Info("No context")
+
+	rs := records(t, &buf)
+	assert.Len(t, rs, 2)
+	assert.Equal(t, "req-1", rs[0]["requestid"])
+	assert.Equal(t, float64(7), rs[0]["userId"])
+	// Attributes of the call win
+	assert.Equal(t, "other", rs[0]["endpoint"])
+	assert.NotContains(t, rs[1], "requestid")
+}
+
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(config.Log{}, &buf)
+	assert.NoError(t, err)
+
+	logger.Info("Signing in",
+		"refresh_token", "r3fr3sh",
+		"AccessToken", "acc3ss",
+		"body", "card=4242",
+		"headers", map[string][]string{"Authorization": {"Bearer abc"}, "Content-Type": {"application/json"}},
+		"code", 200,
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"r3fr3sh", "acc3ss", "4242", "Bearer abc"} {
+		assert.NotContains(t, out, secret)
+	}
+	r := records(t, &buf)[0]
+	assert.Equal(t, redacted, r["refresh_token"])
+	assert.Equal(t, float64(200), r["code"])
+	assert.Equal(t, []any{"application/json"}, r["headers"].(map[string]any)["Content-Type"])
+}
+
+func TestPackageLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(config.Log{Level: "warn", Packages: map[string]string{"logging": "debug"}}, &buf)
+	assert.NoError(t, err)
+
+	// Logged from package logging
+	logger.Debug("Debug of an overridden package")
+	assert.Len(t, records(t, &buf), 1)
+
+	buf.Reset()
+	logger, err = New(config.Log{Level: "warn", Packages: map[string]string{"endpoint": "debug"}}, &buf)
+	assert.NoError(t, err)
+	logger.Info("Info of a package at the default level")
+	assert.Empty(t, buf.String())
+}
+
+func TestInvalidConfig(t *testing.T) {
+	_, err := New(config.Log{Format: "xml"}, &bytes.Buffer{})
+	assert.Error(t, err)
+	_, err = New(config.Log{Level: "loud"}, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(config.Log{}, &buf)
+	assert.NoError(t, err)
+	defaultLogger := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(defaultLogger)
+
+	app := fiber.New()
+	app.Use(requestid.New())
+	app.Use(NewRequestLogger())
+	app.Get("/user/:id", func(c *fiber.Ctx) error {
+		c.SetUserContext(With(c.UserContext(), "userId", 7))
+		slog.InfoContext(c.UserContext(), "Fetching user")
+		return fiber.ErrNotFound
+	})
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/user/7", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	rs := records(t, &buf)
+	assert.Len(t, rs, 2)
+	requestId := res.Header.Get(fiber.HeaderXRequestID)
+	for _, r := range rs {
+		assert.Equal(t, requestId, r["requestid"])
+		assert.Equal(t, float64(7), r["userId"])
+	}
+	assert.Equal(t, float64(http.StatusNotFound), rs[1]["status"])
+	assert.Equal(t, "/user/:id", rs[1]["route"])
+}
@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Logs every request once it is handled and scopes the logs of its handlers to the request id. Must run after
+// the requestid middleware.
+func NewRequestLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		if id, ok := c.Locals("requestid").(string); ok {
+			c.SetUserContext(With(c.UserContext(), "requestid", id))
+		}
+
+		err := c.Next()
+		if err != nil {
+			// Let the error handler set the response, so the logged status is the one sent
+			if herr := c.App().ErrorHandler(c, err); herr != nil {
+				c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		// The context carries whatever later middlewares and handlers added, e.g. the user id
+		slog.Log(c.UserContext(), level, "Request handled",
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"latency", time.Since(start),
+			"ip", c.IP(),
+		)
+		return nil
+	}
+}
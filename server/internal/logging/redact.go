@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// Attribute keys whose values are never logged, compared in lower case. Keys ending in token or secret
+// are redacted as well.
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"authorization": true,
+	"cookie":        true,
+	"set-cookie":    true,
+	"body":          true,
+	"content":       true,
+	"key":           true,
+	"nonce":         true,
+	"x-api-key":     true,
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	return sensitiveKeys[key] || strings.HasSuffix(key, "token") || strings.HasSuffix(key, "secret")
+}
+
+// Redacts sensitive attributes, along with sensitive entries of logged headers.
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if isSensitive(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	if a.Value.Kind() != slog.KindAny {
+		return a
+	}
+
+	switch v := a.Value.Any().(type) {
+	case http.Header:
+		return slog.Any(a.Key, redactHeaders(v))
+	case map[string][]string:
+		return slog.Any(a.Key, redactHeaders(v))
+	}
+	return a
+}
+
+func redactHeaders(headers map[string][]string) map[string][]string {
+	clean := make(map[string][]string, len(headers))
+	for k, v := range headers {
+		if isSensitive(k) {
+			v = []string{redacted}
+		}
+		clean[k] = v
+	}
+	return clean
+}
@@ -0,0 +1,127 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/humanbeeng/checkpost/server/config"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const (
+	TransportSmtp = "smtp"
+	TransportFile = "file"
+	TransportLog  = "log"
+	TransportNone = "none"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Creates the mailer for the configured transport. Mail is dropped when no transport is set.
+func NewMailer(cfg config.Mail) (Mailer, error) {
+	switch cfg.Transport {
+	case TransportSmtp:
+		if cfg.Smtp.Host == "" || cfg.From == "" {
+			return nil, fmt.Errorf("smtp transport requires a host and a from address")
+		}
+		return NewSmtpMailer(cfg.From, cfg.Smtp), nil
+	case TransportFile:
+		return NewFileMailer(cfg.From, cfg.Dir)
+	case TransportLog:
+		return NewLogMailer(cfg.From), nil
+	case TransportNone, "":
+		return NopMailer{}, nil
+	}
+	return nil, fmt.Errorf("unknown mail transport %s", cfg.Transport)
+}
+
+// Reports whether mail of the transport reaches its recipient. The log transport prints messages, sign in
+// links included, for anyone who can read the logs.
+func Delivers(transport string) bool {
+	return transport == TransportSmtp || transport == TransportFile
+}
+
+// Renders the message in RFC 5322 format.
+func format(from string, msg Message, now time.Time) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// Drops every message, for deployments that sign in through OAuth providers only.
+type NopMailer struct{}
+
+func (NopMailer) Send(ctx context.Context, msg Message) error {
+	slog.DebugContext(ctx, "Mail disabled. Dropping message", "subject", msg.Subject)
+	return nil
+}
+
+// Writes mail to the log. Meant for local development.
+type LogMailer struct {
+	from string
+}
+
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	// Printing the mail, sign in links included, is the point of this transport, so it is not logged as a
+	// redacted body
+	slog.InfoContext(ctx, "Sending mail", "from", m.from, "to", msg.To, "subject", msg.Subject, "message", msg.Body)
+	return nil
+}
+
+// Writes every message as an .eml file into a directory.
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+func NewFileMailer(from string, dir string) (*FileMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("file transport requires a directory")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileMailer{from: from, dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	id, err := gonanoid.New()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := strconv.FormatInt(now.UnixNano(), 10) + "-" + id + ".eml"
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg, now), 0o600); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Wrote mail to file", "to", msg.To, "path", path)
+	return nil
+}
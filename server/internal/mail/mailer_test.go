@@ -0,0 +1,44 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/humanbeeng/checkpost/server/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := NewMailer(config.Mail{Transport: TransportFile, From: "Checkpost <no-reply@checkpost.io>", Dir: dir})
+	assert.Nil(t, err)
+
+	err = mailer.Send(context.TODO(), Message{To: "user@example.com", Subject: "Hello", Body: "line 1\nline 2"})
+	assert.Nil(t, err)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Len(t, files, 1)
+
+	content, _ := os.ReadFile(files[0])
+	assert.True(t, strings.HasPrefix(string(content), "From: Checkpost <no-reply@checkpost.io>\r\nTo: user@example.com\r\nSubject: Hello\r\n"))
+	assert.True(t, strings.HasSuffix(string(content), "\r\n\r\nline 1\r\nline 2"))
+}
+
+func TestUnknownTransport(t *testing.T) {
+	_, err := NewMailer(config.Mail{Transport: "pigeon"})
+	assert.NotNil(t, err)
+
+	_, err = NewMailer(config.Mail{Transport: TransportSmtp})
+	assert.NotNil(t, err)
+}
+
+func TestDelivers(t *testing.T) {
+	assert.True(t, Delivers(TransportSmtp))
+	assert.True(t, Delivers(TransportFile))
+	assert.False(t, Delivers(TransportLog))
+	assert.False(t, Delivers(TransportNone))
+	assert.False(t, Delivers(""))
+}
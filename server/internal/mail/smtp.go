@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/humanbeeng/checkpost/server/config"
+)
+
+// Sends mail through an SMTP relay. STARTTLS is used when the server supports it.
+type SmtpMailer struct {
+	from string
+	cfg  config.Smtp
+}
+
+func NewSmtpMailer(from string, cfg config.Smtp) *SmtpMailer {
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	return &SmtpMailer{from: from, cfg: cfg}
+}
+
+func (m *SmtpMailer) Send(ctx context.Context, msg Message) error {
+	fromAddr, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+
+	// net/smtp does not take a context, so the send is abandoned instead when ctx is done.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- smtp.SendMail(addr, auth, fromAddr.Address, []string{msg.To}, format(m.from, msg, time.Now()))
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,112 @@
+// Package metrics holds the Prometheus collectors of the server. Labels are kept to a bounded set, e.g. plans
+// rather than endpoints, so the series count does not grow with the number of users.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "checkpost"
+
+// Plan label of hooks to endpoints whose plan is not known, e.g. endpoints that do not exist.
+const UnknownPlan = "unknown"
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	HookRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hook_requests_total",
+		Help:      "Hook requests by plan of the endpoint, method and response code.",
+	}, []string{"plan", "method", "code"})
+
+	HookStoreDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "hook_store_duration_seconds",
+		Help:      "Time taken to write a hook request to the database.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	HookBroadcastDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "hook_broadcast_duration_seconds",
+		Help:      "Time taken to hand a hook request to the live sessions of its endpoint.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .25, .5, 1},
+	})
+
+	HookBodyBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "hook_body_bytes",
+		Help:      "Size of hook request bodies.",
+		// 256B to 16MiB
+		Buckets: prometheus.ExponentialBuckets(256, 4, 9),
+	})
+
+	HookOversized = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hook_oversized_total",
+		Help:      "Hook requests rejected with 413 for exceeding the body size limit of the plan.",
+	}, []string{"plan"})
+
+	WebsocketSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_sessions",
+		Help:      "Live inspect sessions.",
+	})
+
+	BroadcastDrops = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_broadcast_drops_total",
+		Help:      "Hook requests not delivered to a live session because it did not keep up.",
+	})
+
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of background job runs.",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"job"})
+
+	ExpiredRequestsDeleted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "expired_requests_deleted_total",
+		Help:      "Requests deleted by the expiry job.",
+	})
+
+	OAuthCallbackFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "oauth_callback_failures_total",
+		Help:      "Failed OAuth and OIDC sign in callbacks by provider and reason.",
+	}, []string{"provider", "reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HookRequests,
+		HookStoreDuration,
+		HookBroadcastDuration,
+		HookBodyBytes,
+		HookOversized,
+		WebsocketSessions,
+		BroadcastDrops,
+		JobDuration,
+		ExpiredRequestsDeleted,
+		OAuthCallbackFailures,
+	)
+}
+
+func HTTPHandler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(HTTPHandler())
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolAcquiredConns = prometheus.NewDesc(namespace+"_pgx_pool_acquired_conns", "Connections currently in use.", nil, nil)
+	poolIdleConns     = prometheus.NewDesc(namespace+"_pgx_pool_idle_conns", "Idle connections.", nil, nil)
+	poolTotalConns    = prometheus.NewDesc(namespace+"_pgx_pool_total_conns", "Open connections, including ones being established.", nil, nil)
+	poolMaxConns      = prometheus.NewDesc(namespace+"_pgx_pool_max_conns", "Maximum size of the pool.", nil, nil)
+	poolAcquires      = prometheus.NewDesc(namespace+"_pgx_pool_acquires_total", "Successful acquires.", nil, nil)
+	poolEmptyAcquires = prometheus.NewDesc(namespace+"_pgx_pool_empty_acquires_total", "Acquires that had to wait for a connection.", nil, nil)
+	poolCanceled      = prometheus.NewDesc(namespace+"_pgx_pool_canceled_acquires_total", "Acquires canceled by their context.", nil, nil)
+	poolAcquireTime   = prometheus.NewDesc(namespace+"_pgx_pool_acquire_duration_seconds_total", "Time spent acquiring connections.", nil, nil)
+	poolNewConns      = prometheus.NewDesc(namespace+"_pgx_pool_new_conns_total", "Connections opened.", nil, nil)
+)
+
+// Reports pgx pool statistics at scrape time.
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func RegisterPool(pool *pgxpool.Pool) error {
+	return Registry.Register(poolCollector{pool: pool})
+}
+
+func (pc poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(pc, ch)
+}
+
+func (pc poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := pc.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceled, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireTime, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(poolNewConns, prometheus.CounterValue, float64(stat.NewConnsCount()))
+}
@@ -0,0 +1,215 @@
+package plan
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/humanbeeng/checkpost/server/config"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+)
+
+// Limits and features of a subscription plan. A zero value for a count or duration means unlimited.
+type Limits struct {
+	Name           db.Plan `json:"name"`
+	MaxBodyBytes   int     `json:"max_body_bytes"`
+	RetentionHours int     `json:"retention_hours"`
+	MaxEndpoints   int     `json:"max_endpoints"`
+	MaxSessions    int     `json:"max_sessions"`
+	Rate           float64 `json:"rate"`
+	Burst          int     `json:"burst"`
+	IpRate         float64 `json:"ip_rate"`
+	IpBurst        int     `json:"ip_burst"`
+	// Monthly quotas per user. Usage above QuotaWarnPercent of a quota triggers a warning.
+	MonthlyRequests  int64    `json:"monthly_requests"`
+	MonthlyBytes     int64    `json:"monthly_bytes"`
+	QuotaWarnPercent int      `json:"quota_warn_percent"`
+	Features         []string `json:"features"`
+}
+
+// Features a plan can grant.
+const (
+	// Serving endpoints on hostnames owned by the user
+	FeatureCustomDomains = "custom_domains"
+)
+
+func (l Limits) HasFeature(feature string) bool {
+	return slices.Contains(l.Features, feature)
+}
+
+// Built in plans. Used when neither config nor the plan_limit table define a plan.
+var Defaults = map[db.Plan]Limits{
+	db.PlanFree: {
+		Name:             db.PlanFree,
+		MaxBodyBytes:     10_000,
+		RetentionHours:   6,
+		MaxEndpoints:     1,
+		MaxSessions:      5,
+		Rate:             5,
+		Burst:            10,
+		IpRate:           2,
+		IpBurst:          5,
+		MonthlyRequests:  10_000,
+		MonthlyBytes:     50_000_000,
+		QuotaWarnPercent: 80,
+		Features:         []string{},
+	},
+	db.PlanBasic: {
+		Name:             db.PlanBasic,
+		MaxBodyBytes:     128_000,
+		RetentionHours:   24 * 7,
+		MaxEndpoints:     1,
+		MaxSessions:      10,
+		Rate:             20,
+		Burst:            40,
+		IpRate:           10,
+		IpBurst:          20,
+		MonthlyRequests:  100_000,
+		MonthlyBytes:     2_000_000_000,
+		QuotaWarnPercent: 80,
+		Features:         []string{},
+	},
+	db.PlanPro: {
+		Name:             db.PlanPro,
+		MaxBodyBytes:     512_000,
+		RetentionHours:   0,
+		MaxEndpoints:     0,
+		MaxSessions:      25,
+		Rate:             100,
+		Burst:            200,
+		IpRate:           50,
+		IpBurst:          100,
+		MonthlyRequests:  0,
+		MonthlyBytes:     0,
+		QuotaWarnPercent: 80,
+		Features:         []string{FeatureCustomDomains},
+	},
+}
+
+type PlanQuerier interface {
+	ListPlanLimits(ctx context.Context) ([]db.PlanLimit, error)
+	// Adds the names to plan_catalog, so that users and endpoints can be assigned those plans.
+	RegisterPlans(ctx context.Context, names []string) error
+}
+
+// Catalog of plans consulted by every subsystem that enforces a limit.
+// Plans are resolved from the built in defaults, then config, then the plan_limit table.
+type Catalog struct {
+	sync.RWMutex
+	configured map[db.Plan]Limits
+	plans      map[db.Plan]Limits
+}
+
+func NewCatalog(plans map[db.Plan]Limits) *Catalog {
+	configured := make(map[db.Plan]Limits, len(plans))
+	for name, l := range plans {
+		configured[name] = l
+	}
+	return &Catalog{
+		configured: configured,
+		plans:      configured,
+	}
+}
+
+// Builds a catalog from the built in defaults and the plans defined in config.
+func NewCatalogFromConfig(cfg map[string]config.PlanLimits) *Catalog {
+	plans := make(map[db.Plan]Limits, len(Defaults)+len(cfg))
+	for name, l := range Defaults {
+		plans[name] = l
+	}
+
+	for name, l := range cfg {
+		features := l.Features
+		if features == nil {
+			features = []string{}
+		}
+		plans[db.Plan(name)] = Limits{
+			Name:             db.Plan(name),
+			MaxBodyBytes:     l.MaxBodyBytes,
+			RetentionHours:   l.RetentionHours,
+			MaxEndpoints:     l.MaxEndpoints,
+			MaxSessions:      l.MaxSessions,
+			Rate:             l.Rate,
+			Burst:            l.Burst,
+			IpRate:           l.IpRate,
+			IpBurst:          l.IpBurst,
+			MonthlyRequests:  l.MonthlyRequests,
+			MonthlyBytes:     l.MonthlyBytes,
+			QuotaWarnPercent: l.QuotaWarnPercent,
+			Features:         features,
+		}
+	}
+	return NewCatalog(plans)
+}
+
+func (c *Catalog) Get(plan db.Plan) (Limits, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	l, ok := c.plans[plan]
+	return l, ok
+}
+
+func (c *Catalog) List() []Limits {
+	c.RLock()
+	defer c.RUnlock()
+
+	plans := make([]Limits, 0, len(c.plans))
+	for _, l := range c.plans {
+		plans = append(plans, l)
+	}
+	slices.SortFunc(plans, func(a, b Limits) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return plans
+}
+
+// Registers the configured plans in db and reloads plan overrides from db. Plans removed from db fall back to
+// their configured limits.
+func (c *Catalog) Load(ctx context.Context, q PlanQuerier) error {
+	names := make([]string, 0, len(c.configured))
+	for name := range c.configured {
+		names = append(names, string(name))
+	}
+	if err := q.RegisterPlans(ctx, names); err != nil {
+		slog.ErrorContext(ctx, "unable to register plans", "err", err)
+		return err
+	}
+
+	rows, err := q.ListPlanLimits(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to load plan limits", "err", err)
+		return err
+	}
+
+	plans := make(map[db.Plan]Limits, len(c.configured)+len(rows))
+	for name, l := range c.configured {
+		plans[name] = l
+	}
+	for _, row := range rows {
+		plans[db.Plan(row.Name)] = Limits{
+			Name:             db.Plan(row.Name),
+			MaxBodyBytes:     int(row.MaxBodyBytes),
+			RetentionHours:   int(row.RetentionHours),
+			MaxEndpoints:     int(row.MaxEndpoints),
+			MaxSessions:      int(row.MaxSessions),
+			Rate:             row.RateLimit,
+			Burst:            int(row.RateBurst),
+			IpRate:           row.IpRateLimit,
+			IpBurst:          int(row.IpRateBurst),
+			MonthlyRequests:  row.MonthlyRequests,
+			MonthlyBytes:     row.MonthlyBytes,
+			QuotaWarnPercent: int(row.QuotaWarnPercent),
+			Features:         row.Features,
+		}
+	}
+
+	c.Lock()
+	c.plans = plans
+	c.Unlock()
+
+	slog.InfoContext(ctx, "Plan catalog loaded", "num_plans", len(plans), "num_overrides", len(rows))
+	return nil
+}
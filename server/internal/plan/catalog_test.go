@@ -0,0 +1,83 @@
+package plan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/humanbeeng/checkpost/server/config"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockPlanStore struct {
+	rows       []db.PlanLimit
+	registered *[]string
+}
+
+func (ps MockPlanStore) ListPlanLimits(ctx context.Context) ([]db.PlanLimit, error) {
+	return ps.rows, nil
+}
+
+func (ps MockPlanStore) RegisterPlans(ctx context.Context, names []string) error {
+	if ps.registered != nil {
+		*ps.registered = append(*ps.registered, names...)
+	}
+	return nil
+}
+
+func TestCatalogDefaultsDistinguishPlans(t *testing.T) {
+	c := NewCatalog(Defaults)
+
+	basic, ok := c.Get(db.PlanBasic)
+	assert.True(t, ok)
+	pro, ok := c.Get(db.PlanPro)
+	assert.True(t, ok)
+
+	assert.Less(t, basic.MaxBodyBytes, pro.MaxBodyBytes)
+	assert.Less(t, basic.MaxSessions, pro.MaxSessions)
+}
+
+func TestCatalogFromConfig(t *testing.T) {
+	c := NewCatalogFromConfig(map[string]config.PlanLimits{
+		"free": {MaxBodyBytes: 1_000, RetentionHours: 1, MaxEndpoints: 1, MaxSessions: 1},
+	})
+
+	free, ok := c.Get(db.PlanFree)
+	assert.True(t, ok)
+	assert.Equal(t, 1_000, free.MaxBodyBytes)
+	assert.Equal(t, []string{}, free.Features)
+
+	pro, ok := c.Get(db.PlanPro)
+	assert.True(t, ok)
+	assert.Equal(t, Defaults[db.PlanPro], pro)
+}
+
+func TestCatalogLoadFromDb(t *testing.T) {
+	c := NewCatalog(Defaults)
+	err := c.Load(context.TODO(), MockPlanStore{rows: []db.PlanLimit{
+		{Name: "team", MaxBodyBytes: 1_000_000, MaxEndpoints: 20, MaxSessions: 50, Features: []string{"shared"}},
+	}})
+	assert.Nil(t, err)
+
+	team, ok := c.Get("team")
+	assert.True(t, ok)
+	assert.Equal(t, 20, team.MaxEndpoints)
+	assert.True(t, team.HasFeature("shared"))
+	assert.Len(t, c.List(), 4)
+
+	// Removing the row falls back to the configured plans
+	err = c.Load(context.TODO(), MockPlanStore{})
+	assert.Nil(t, err)
+	_, ok = c.Get("team")
+	assert.False(t, ok)
+}
+
+func TestCatalogLoadRegistersConfiguredPlans(t *testing.T) {
+	c := NewCatalogFromConfig(map[string]config.PlanLimits{
+		"team": {MaxBodyBytes: 1_000_000, MaxSessions: 50},
+	})
+
+	var registered []string
+	assert.Nil(t, c.Load(context.TODO(), MockPlanStore{registered: &registered}))
+	assert.ElementsMatch(t, []string{"free", "basic", "pro", "team"}, registered)
+}
@@ -0,0 +1,260 @@
+package reserved
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+)
+
+type Kind string
+
+const (
+	KindSubdomain Kind = "subdomain"
+	KindCompany   Kind = "company"
+)
+
+func ParseKind(s string) (Kind, error) {
+	switch Kind(s) {
+	case KindSubdomain, KindCompany:
+		return Kind(s), nil
+	}
+	return "", fmt.Errorf("unknown reserved name kind %q", s)
+}
+
+// Built in reserved names. Used until the reserved_name table is loaded.
+var DefaultSubdomains = map[string]bool{
+	"api":       true,
+	"hook":      true,
+	"blog":      true,
+	"dash":      true,
+	"dashboard": true,
+	"uat":       true,
+	"qa":        true,
+	"user":      true,
+	"client":    true,
+	"prod":      true,
+	"staging":   true,
+	"jobs":      true,
+	"career":    true,
+	"auth":      true,
+	"cdn":       true,
+	"files":     true,
+	"file":      true,
+	"free":      true,
+	"secure":    true,
+	"media":     true,
+	"portal":    true,
+	"forum":     true,
+	"support":   true,
+	"www":       true,
+	"help":      true,
+	"console":   true,
+	"app":       true,
+	"share":     true,
+	"dev":       true,
+	"community": true,
+	"payment":   true,
+	"endpoint":  true,
+	"http":      true,
+	"https":     true,
+	"request":   true,
+	"payments":  true,
+	"url":       true,
+	"link":      true,
+	"demo":      true,
+	"shop":      true,
+	"about":     true,
+}
+
+// Companies whose name can only be claimed with a mail issued by that organisation.
+var DefaultCompanies = map[string]bool{
+	"google":      true,
+	"figma":       true,
+	"github":      true,
+	"checkpost":   true,
+	"microsoft":   true,
+	"cloudflare":  true,
+	"ford":        true,
+	"intel":       true,
+	"xerox":       true,
+	"cocacola":    true,
+	"jpmorgan":    true,
+	"apple":       true,
+	"nvidia":      true,
+	"alphabet":    true,
+	"amazon":      true,
+	"netflix":     true,
+	"meta":        true,
+	"tesla":       true,
+	"samsung":     true,
+	"tencent":     true,
+	"oracle":      true,
+	"salesforce":  true,
+	"amd":         true,
+	"adobe":       true,
+	"qualcomm":    true,
+	"cisco":       true,
+	"intuit":      true,
+	"uber":        true,
+	"dell":        true,
+	"sony":        true,
+	"airbnb":      true,
+	"linkedin":    true,
+	"paypal":      true,
+	"xiaomi":      true,
+	"spotify":     true,
+	"snowflake":   true,
+	"instagram":   true,
+	"hotstar":     true,
+	"adidas":      true,
+	"brave":       true,
+	"cred":        true,
+	"flipkart":    true,
+	"notion":      true,
+	"nike":        true,
+	"slack":       true,
+	"twitch":      true,
+	"whatsapp":    true,
+	"youtube":     true,
+	"coinbase":    true,
+	"atlassian":   true,
+	"palantir":    true,
+	"datadog":     true,
+	"hubspot":     true,
+	"snap":        true,
+	"mongodb":     true,
+	"zscaler":     true,
+	"sourcegraph": true,
+	"eraser":      true,
+	"supabase":    true,
+}
+
+type ReservedQuerier interface {
+	ListReservedNames(ctx context.Context) ([]db.ReservedName, error)
+	UpsertReservedName(ctx context.Context, params db.UpsertReservedNameParams) (db.ReservedName, error)
+	DeleteReservedName(ctx context.Context, params db.DeleteReservedNameParams) (int64, error)
+}
+
+// Names that cannot be claimed as endpoints. The reserved_name table is authoritative once loaded,
+// so that names can be managed at runtime.
+type Names struct {
+	sync.RWMutex
+	subdomains map[string]bool
+	companies  map[string]bool
+}
+
+func NewNames(subdomains map[string]bool, companies map[string]bool) *Names {
+	return &Names{
+		subdomains: copyNames(subdomains),
+		companies:  copyNames(companies),
+	}
+}
+
+func (n *Names) IsSubdomain(name string) bool {
+	n.RLock()
+	defer n.RUnlock()
+	return n.subdomains[strings.ToLower(name)]
+}
+
+func (n *Names) IsCompany(name string) bool {
+	n.RLock()
+	defer n.RUnlock()
+	return n.companies[strings.ToLower(name)]
+}
+
+// Sorted names of the given kind.
+func (n *Names) List(kind Kind) []string {
+	n.RLock()
+	defer n.RUnlock()
+
+	set := n.subdomains
+	if kind == KindCompany {
+		set = n.companies
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Replaces the reserved names with the contents of the reserved_name table.
+func (n *Names) Load(ctx context.Context, q ReservedQuerier) error {
+	rows, err := q.ListReservedNames(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to load reserved names", "err", err)
+		return err
+	}
+
+	subdomains := make(map[string]bool)
+	companies := make(map[string]bool)
+	for _, row := range rows {
+		switch Kind(row.Kind) {
+		case KindSubdomain:
+			subdomains[row.Name] = true
+		case KindCompany:
+			companies[row.Name] = true
+		}
+	}
+
+	n.Lock()
+	n.subdomains = subdomains
+	n.companies = companies
+	n.Unlock()
+
+	slog.InfoContext(ctx, "Reserved names loaded", "num_subdomains", len(subdomains), "num_companies", len(companies))
+	return nil
+}
+
+// Persists the name and applies it immediately. A name is either a subdomain or a company, never both.
+func (n *Names) Add(ctx context.Context, q ReservedQuerier, kind Kind, name string) error {
+	name = strings.ToLower(name)
+	if _, err := q.UpsertReservedName(ctx, db.UpsertReservedNameParams{Name: name, Kind: string(kind)}); err != nil {
+		return err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	delete(n.subdomains, name)
+	delete(n.companies, name)
+	if kind == KindCompany {
+		n.companies[name] = true
+	} else {
+		n.subdomains[name] = true
+	}
+	return nil
+}
+
+// Returns false if the name was not reserved as the given kind.
+func (n *Names) Remove(ctx context.Context, q ReservedQuerier, kind Kind, name string) (bool, error) {
+	name = strings.ToLower(name)
+	removed, err := q.DeleteReservedName(ctx, db.DeleteReservedNameParams{Name: name, Kind: string(kind)})
+	if err != nil {
+		return false, err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	if kind == KindCompany {
+		delete(n.companies, name)
+	} else {
+		delete(n.subdomains, name)
+	}
+	return removed > 0, nil
+}
+
+func copyNames(names map[string]bool) map[string]bool {
+	c := make(map[string]bool, len(names))
+	for name, ok := range names {
+		if ok {
+			c[name] = true
+		}
+	}
+	return c
+}
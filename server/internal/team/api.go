@@ -0,0 +1,262 @@
+package team
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/humanbeeng/checkpost/server/internal/audit"
+)
+
+type TeamController struct {
+	service *TeamService
+	audit   *audit.AuditService
+}
+
+func NewTeamController(service *TeamService, audit *audit.AuditService) *TeamController {
+	return &TeamController{
+		service: service,
+		audit:   audit,
+	}
+}
+
+func (tc *TeamController) RegisterRoutes(app *fiber.App, authmw fiber.Handler) {
+	teamGroup := app.Group("/teams", authmw)
+
+	teamGroup.Get("/", tc.ListTeamsHandler)
+	teamGroup.Post("/", tc.CreateTeamHandler)
+	teamGroup.Get("/invitations", tc.ListInvitationsHandler)
+	teamGroup.Post("/invitations/:id/accept", tc.AcceptInvitationHandler)
+	teamGroup.Delete("/invitations/:id", tc.DeclineInvitationHandler)
+	teamGroup.Post("/:id/members", tc.InviteMemberHandler)
+	teamGroup.Delete("/:id/members/:userId", tc.RemoveMemberHandler)
+	teamGroup.Delete("/:id/invitations/:userId", tc.RevokeInvitationHandler)
+	teamGroup.Post("/:id/domains", tc.AddDomainHandler)
+	teamGroup.Post("/:id/domains/:domain/verify", tc.VerifyDomainHandler)
+	teamGroup.Delete("/:id/domains/:domain", tc.RemoveDomainHandler)
+}
+
+func (tc *TeamController) ListTeamsHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+
+	teams, teamErr := tc.service.ListTeams(c.UserContext(), userId)
+	if teamErr != nil {
+		return toFiberError(teamErr)
+	}
+	return c.JSON(teams)
+}
+
+type CreateTeamRequest struct {
+	Name string `json:"name"`
+}
+
+func (tc *TeamController) CreateTeamHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+
+	var req CreateTeamRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	team, teamErr := tc.service.CreateTeam(c.UserContext(), userId, req.Name)
+	if teamErr != nil {
+		return toFiberError(teamErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionTeamCreate, audit.TeamTarget(team.Id))
+	entry.After = map[string]string{"name": team.Name}
+	tc.audit.Record(c.UserContext(), entry)
+	return c.Status(fiber.StatusCreated).JSON(team)
+}
+
+type InviteMemberRequest struct {
+	Username string `json:"username"`
+}
+
+// Invites the user, who joins once they accept.
+func (tc *TeamController) InviteMemberHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	teamId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	var req InviteMemberRequest
+	if err := c.BodyParser(&req); err != nil || req.Username == "" {
+		return fiber.ErrBadRequest
+	}
+
+	invitation, teamErr := tc.service.InviteMember(c.UserContext(), userId, int64(teamId), req.Username)
+	if teamErr != nil {
+		return toFiberError(teamErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionTeamMemberInvite, audit.TeamTarget(int64(teamId)))
+	entry.After = invitation
+	tc.audit.Record(c.UserContext(), entry)
+	return c.Status(fiber.StatusCreated).JSON(invitation)
+}
+
+func (tc *TeamController) RevokeInvitationHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	teamId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+	inviteeId, err := c.ParamsInt("userId")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	if teamErr := tc.service.RevokeInvitation(c.UserContext(), userId, int64(teamId), int64(inviteeId)); teamErr != nil {
+		return toFiberError(teamErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionTeamInvitationDelete, audit.TeamTarget(int64(teamId)))
+	entry.Before = map[string]int64{"user_id": int64(inviteeId)}
+	tc.audit.Record(c.UserContext(), entry)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (tc *TeamController) ListInvitationsHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+
+	invitations, teamErr := tc.service.ListInvitations(c.UserContext(), userId)
+	if teamErr != nil {
+		return toFiberError(teamErr)
+	}
+	return c.JSON(invitations)
+}
+
+// Responds with the team joined.
+func (tc *TeamController) AcceptInvitationHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	teamId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	team, teamErr := tc.service.AcceptInvitation(c.UserContext(), userId, int64(teamId))
+	if teamErr != nil {
+		return toFiberError(teamErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionTeamMemberAdd, audit.TeamTarget(team.Id))
+	entry.After = Member{UserId: userId, Role: RoleMember}
+	tc.audit.Record(c.UserContext(), entry)
+	return c.JSON(team)
+}
+
+func (tc *TeamController) DeclineInvitationHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	teamId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	if teamErr := tc.service.DeclineInvitation(c.UserContext(), userId, int64(teamId)); teamErr != nil {
+		return toFiberError(teamErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionTeamInvitationDelete, audit.TeamTarget(int64(teamId)))
+	entry.Before = map[string]int64{"user_id": userId}
+	tc.audit.Record(c.UserContext(), entry)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (tc *TeamController) RemoveMemberHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	teamId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+	memberId, err := c.ParamsInt("userId")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	if teamErr := tc.service.RemoveMember(c.UserContext(), userId, int64(teamId), int64(memberId)); teamErr != nil {
+		return toFiberError(teamErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionTeamMemberRemove, audit.TeamTarget(int64(teamId)))
+	entry.Before = map[string]int64{"user_id": int64(memberId)}
+	tc.audit.Record(c.UserContext(), entry)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+type AddDomainRequest struct {
+	Domain string `json:"domain"`
+}
+
+// Responds with the TXT record to create for DNS verification.
+func (tc *TeamController) AddDomainHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	teamId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	var req AddDomainRequest
+	if err := c.BodyParser(&req); err != nil || req.Domain == "" {
+		return fiber.ErrBadRequest
+	}
+
+	domain, teamErr := tc.service.AddDomain(c.UserContext(), userId, int64(teamId), req.Domain)
+	if teamErr != nil {
+		return toFiberError(teamErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionTeamDomainAdd, audit.TeamTarget(int64(teamId)))
+	entry.After = map[string]string{"domain": domain.Domain, "company": domain.Company}
+	tc.audit.Record(c.UserContext(), entry)
+	return c.Status(fiber.StatusCreated).JSON(domain)
+}
+
+type VerifyDomainRequest struct {
+	Method string `json:"method"`
+}
+
+func (tc *TeamController) VerifyDomainHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	teamId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	var req VerifyDomainRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	domain, teamErr := tc.service.VerifyDomain(c.UserContext(), userId, int64(teamId), c.Params("domain"), req.Method)
+	if teamErr != nil {
+		return toFiberError(teamErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionTeamDomainVerify, audit.TeamTarget(int64(teamId)))
+	entry.After = map[string]string{"domain": domain.Domain, "company": domain.Company, "method": domain.Method}
+	tc.audit.Record(c.UserContext(), entry)
+	return c.JSON(domain)
+}
+
+func (tc *TeamController) RemoveDomainHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	teamId, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	if teamErr := tc.service.RemoveDomain(c.UserContext(), userId, int64(teamId), c.Params("domain")); teamErr != nil {
+		return toFiberError(teamErr)
+	}
+
+	entry := audit.FromRequest(c, audit.ActionTeamDomainRemove, audit.TeamTarget(int64(teamId)))
+	entry.Before = map[string]string{"domain": normalizeDomain(c.Params("domain"))}
+	tc.audit.Record(c.UserContext(), entry)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func toFiberError(teamErr *TeamError) *fiber.Error {
+	return &fiber.Error{
+		Code:    teamErr.Code,
+		Message: teamErr.Message,
+	}
+}
@@ -0,0 +1,595 @@
+package team
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+
+	MethodDns   = "dns"
+	MethodEmail = "email"
+
+	// The TXT record proving control of example.com is set on _checkpost-challenge.example.com
+	ChallengeRecordPrefix = "_checkpost-challenge."
+	ChallengeValuePrefix  = "checkpost-verification="
+
+	maxTeamNameLength = 60
+)
+
+var domainRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// Anyone can get an address on these, so they never prove control of a domain.
+var freeMailDomains = []string{
+	"gmail.com",
+	"googlemail.com",
+	"outlook.com",
+	"hotmail.com",
+	"live.com",
+	"yahoo.com",
+	"icloud.com",
+	"me.com",
+	"proton.me",
+	"protonmail.com",
+	"aol.com",
+	"gmx.com",
+	"zoho.com",
+}
+
+// Looks up TXT records. Satisfied by *net.Resolver, faked in tests.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+type TeamError struct {
+	Code    int
+	Message string
+}
+
+func (t *TeamError) Error() string {
+	return t.Message
+}
+
+func NewInternalServerError() *TeamError {
+	return &TeamError{
+		Code:    http.StatusInternalServerError,
+		Message: "Oops! Something went wrong :(",
+	}
+}
+
+func NewTeamNotFoundError() *TeamError {
+	return &TeamError{
+		Code:    http.StatusNotFound,
+		Message: "Team not found",
+	}
+}
+
+func NewInvitationNotFoundError() *TeamError {
+	return &TeamError{
+		Code:    http.StatusNotFound,
+		Message: "Invitation not found",
+	}
+}
+
+type Member struct {
+	UserId   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type Domain struct {
+	Domain     string     `json:"domain"`
+	Company    string     `json:"company"`
+	Verified   bool       `json:"verified"`
+	Method     string     `json:"method,omitempty"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	// TXT record to create for DNS verification. Only set while the domain is unverified.
+	RecordName  string `json:"record_name,omitempty"`
+	RecordValue string `json:"record_value,omitempty"`
+}
+
+// Pending invitation to join a team. Users only become members once they accept.
+type Invitation struct {
+	TeamId    int64     `json:"team_id"`
+	TeamName  string    `json:"team_name,omitempty"`
+	UserId    int64     `json:"user_id,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	InvitedBy string    `json:"invited_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Team struct {
+	Id          int64        `json:"id"`
+	Name        string       `json:"name"`
+	Role        string       `json:"role"`
+	Members     []Member     `json:"members"`
+	Invitations []Invitation `json:"invitations"`
+	Domains     []Domain     `json:"domains"`
+}
+
+// Teams prove control of company domains. Members of a team that verified a domain on the allowlist of a
+// reserved company can claim that company subdomain.
+type TeamService struct {
+	teamq    TeamQuerier
+	resolver TXTResolver
+}
+
+func NewTeamService(teamq TeamQuerier, resolver TXTResolver) *TeamService {
+	return &TeamService{
+		teamq:    teamq,
+		resolver: resolver,
+	}
+}
+
+func (s *TeamService) CreateTeam(ctx context.Context, userId int64, name string) (Team, *TeamError) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxTeamNameLength {
+		return Team{}, &TeamError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Team name should be 1 to %d characters.", maxTeamNameLength),
+		}
+	}
+
+	var team db.Team
+	err := s.teamq.WithTx(ctx, func(q TeamQuerier) error {
+		var err error
+		team, err = q.CreateTeam(ctx, name)
+		if err != nil {
+			return err
+		}
+		_, err = q.AddTeamMember(ctx, db.AddTeamMemberParams{TeamID: team.ID, UserID: userId, Role: RoleOwner})
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to create team", "userId", userId, "err", err)
+		return Team{}, NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Team created", "teamId", team.ID, "userId", userId)
+	return s.getTeam(ctx, team.ID, team.Name, RoleOwner)
+}
+
+func (s *TeamService) ListTeams(ctx context.Context, userId int64) ([]Team, *TeamError) {
+	rows, err := s.teamq.ListUserTeams(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list user teams", "userId", userId, "err", err)
+		return nil, NewInternalServerError()
+	}
+
+	teams := make([]Team, 0, len(rows))
+	for _, row := range rows {
+		team, teamErr := s.getTeam(ctx, row.ID, row.Name, row.Role)
+		if teamErr != nil {
+			return nil, teamErr
+		}
+		teams = append(teams, team)
+	}
+	return teams, nil
+}
+
+// Invites the user to the team. Nobody is added to a team without accepting, since members can claim the
+// company subdomains of the team.
+func (s *TeamService) InviteMember(ctx context.Context, actorId int64, teamId int64, username string) (Invitation, *TeamError) {
+	if teamErr := s.checkOwner(ctx, actorId, teamId); teamErr != nil {
+		return Invitation{}, teamErr
+	}
+
+	user, err := s.teamq.GetUserFromUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Invitation{}, &TeamError{
+				Code:    http.StatusNotFound,
+				Message: fmt.Sprintf("No user found with username: %s", username),
+			}
+		}
+		slog.ErrorContext(ctx, "unable to get user from username", "username", username, "err", err)
+		return Invitation{}, NewInternalServerError()
+	}
+
+	if _, err := s.teamq.GetTeamMember(ctx, db.GetTeamMemberParams{TeamID: teamId, UserID: user.ID}); err == nil {
+		return Invitation{}, &TeamError{
+			Code:    http.StatusConflict,
+			Message: fmt.Sprintf("%s is already a member of this team.", username),
+		}
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		slog.ErrorContext(ctx, "unable to get team member", "teamId", teamId, "userId", user.ID, "err", err)
+		return Invitation{}, NewInternalServerError()
+	}
+
+	rec, err := s.teamq.CreateTeamInvitation(ctx, db.CreateTeamInvitationParams{
+		TeamID:    teamId,
+		UserID:    user.ID,
+		InvitedBy: pgtype.Int8{Int64: actorId, Valid: true},
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return Invitation{}, &TeamError{
+				Code:    http.StatusConflict,
+				Message: fmt.Sprintf("%s is already invited to this team.", username),
+			}
+		}
+		slog.ErrorContext(ctx, "unable to create team invitation", "teamId", teamId, "userId", user.ID, "err", err)
+		return Invitation{}, NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Team member invited", "teamId", teamId, "userId", user.ID, "actorId", actorId)
+	return Invitation{TeamId: teamId, UserId: user.ID, Username: user.Username, CreatedAt: rec.CreatedAt.Time}, nil
+}
+
+// Withdraws an invitation that was not accepted yet.
+func (s *TeamService) RevokeInvitation(ctx context.Context, actorId int64, teamId int64, userId int64) *TeamError {
+	if teamErr := s.checkOwner(ctx, actorId, teamId); teamErr != nil {
+		return teamErr
+	}
+	return s.deleteInvitation(ctx, teamId, userId)
+}
+
+// Pending invitations of the user.
+func (s *TeamService) ListInvitations(ctx context.Context, userId int64) ([]Invitation, *TeamError) {
+	rows, err := s.teamq.ListUserInvitations(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list user invitations", "userId", userId, "err", err)
+		return nil, NewInternalServerError()
+	}
+
+	invitations := make([]Invitation, 0, len(rows))
+	for _, row := range rows {
+		invitations = append(invitations, Invitation{
+			TeamId:    row.TeamID,
+			TeamName:  row.TeamName,
+			InvitedBy: row.InvitedBy.String,
+			CreatedAt: row.CreatedAt.Time,
+		})
+	}
+	return invitations, nil
+}
+
+// Joins the team the user was invited to.
+func (s *TeamService) AcceptInvitation(ctx context.Context, userId int64, teamId int64) (Team, *TeamError) {
+	var team db.Team
+	err := s.teamq.WithTx(ctx, func(q TeamQuerier) error {
+		removed, err := q.DeleteTeamInvitation(ctx, db.DeleteTeamInvitationParams{TeamID: teamId, UserID: userId})
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			return pgx.ErrNoRows
+		}
+		if _, err := q.AddTeamMember(ctx, db.AddTeamMemberParams{TeamID: teamId, UserID: userId, Role: RoleMember}); err != nil {
+			return err
+		}
+		team, err = q.GetTeam(ctx, teamId)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Team{}, NewInvitationNotFoundError()
+		}
+		slog.ErrorContext(ctx, "unable to accept team invitation", "teamId", teamId, "userId", userId, "err", err)
+		return Team{}, NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Team invitation accepted", "teamId", teamId, "userId", userId)
+	return s.getTeam(ctx, team.ID, team.Name, RoleMember)
+}
+
+func (s *TeamService) DeclineInvitation(ctx context.Context, userId int64, teamId int64) *TeamError {
+	return s.deleteInvitation(ctx, teamId, userId)
+}
+
+func (s *TeamService) deleteInvitation(ctx context.Context, teamId int64, userId int64) *TeamError {
+	removed, err := s.teamq.DeleteTeamInvitation(ctx, db.DeleteTeamInvitationParams{TeamID: teamId, UserID: userId})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to delete team invitation", "teamId", teamId, "userId", userId, "err", err)
+		return NewInternalServerError()
+	}
+	if removed == 0 {
+		return NewInvitationNotFoundError()
+	}
+
+	slog.InfoContext(ctx, "Team invitation deleted", "teamId", teamId, "userId", userId)
+	return nil
+}
+
+// Owners cannot be removed, so a team always keeps its owner.
+func (s *TeamService) RemoveMember(ctx context.Context, actorId int64, teamId int64, userId int64) *TeamError {
+	if teamErr := s.checkOwner(ctx, actorId, teamId); teamErr != nil {
+		return teamErr
+	}
+
+	removed, err := s.teamq.RemoveTeamMember(ctx, db.RemoveTeamMemberParams{TeamID: teamId, UserID: userId})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to remove team member", "teamId", teamId, "userId", userId, "err", err)
+		return NewInternalServerError()
+	}
+	if removed == 0 {
+		return &TeamError{
+			Code:    http.StatusNotFound,
+			Message: "Member not found",
+		}
+	}
+
+	slog.InfoContext(ctx, "Team member removed", "teamId", teamId, "userId", userId, "actorId", actorId)
+	return nil
+}
+
+// Claims a domain for the team. The domain has to be verified before it grants anything.
+func (s *TeamService) AddDomain(ctx context.Context, actorId int64, teamId int64, domain string) (Domain, *TeamError) {
+	if teamErr := s.checkOwner(ctx, actorId, teamId); teamErr != nil {
+		return Domain{}, teamErr
+	}
+
+	domain, teamErr := parseDomain(domain)
+	if teamErr != nil {
+		return Domain{}, teamErr
+	}
+
+	// Only domains on the allowlist of a company stand for it, look alikes such as ford.ninja do not
+	company, err := s.teamq.GetCompanyOfDomain(ctx, domain)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		slog.ErrorContext(ctx, "unable to get company of domain", "domain", domain, "err", err)
+		return Domain{}, NewInternalServerError()
+	}
+
+	token, err := gonanoid.New(32)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to generate domain verification token", "err", err)
+		return Domain{}, NewInternalServerError()
+	}
+
+	rec, err := s.teamq.CreateTeamDomain(ctx, db.CreateTeamDomainParams{
+		TeamID:  teamId,
+		Domain:  domain,
+		Company: company,
+		Token:   token,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return Domain{}, &TeamError{
+				Code:    http.StatusConflict,
+				Message: fmt.Sprintf("%s is already added to this team.", domain),
+			}
+		}
+		slog.ErrorContext(ctx, "unable to create team domain", "teamId", teamId, "domain", domain, "err", err)
+		return Domain{}, NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Team domain added", "teamId", teamId, "domain", domain, "actorId", actorId)
+	return domainFromRecord(rec), nil
+}
+
+// Verifies control of the domain, either through the challenge TXT record or through the verified
+// account email of the actor being on that domain.
+func (s *TeamService) VerifyDomain(ctx context.Context, actorId int64, teamId int64, domain string, method string) (Domain, *TeamError) {
+	if teamErr := s.checkOwner(ctx, actorId, teamId); teamErr != nil {
+		return Domain{}, teamErr
+	}
+
+	domain = normalizeDomain(domain)
+	rec, err := s.teamq.GetTeamDomain(ctx, db.GetTeamDomainParams{TeamID: teamId, Domain: domain})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Domain{}, &TeamError{
+				Code:    http.StatusNotFound,
+				Message: "Domain not found",
+			}
+		}
+		slog.ErrorContext(ctx, "unable to get team domain", "teamId", teamId, "domain", domain, "err", err)
+		return Domain{}, NewInternalServerError()
+	}
+	if rec.VerifiedAt.Valid {
+		return domainFromRecord(rec), nil
+	}
+
+	var ok bool
+	var teamErr *TeamError
+	switch method {
+	case MethodDns:
+		ok, teamErr = s.checkTXTRecord(ctx, rec)
+	case MethodEmail:
+		ok, teamErr = s.checkEmail(ctx, actorId, rec)
+	default:
+		return Domain{}, &TeamError{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Method should be one of %s, %s.", MethodDns, MethodEmail),
+		}
+	}
+	if teamErr != nil {
+		return Domain{}, teamErr
+	}
+	if !ok {
+		slog.InfoContext(ctx, "Domain verification failed", "teamId", teamId, "domain", domain, "method", method)
+		return Domain{}, &TeamError{
+			Code:    http.StatusUnprocessableEntity,
+			Message: verificationFailedMessage(method, rec),
+		}
+	}
+
+	verified, err := s.teamq.VerifyTeamDomain(ctx, db.VerifyTeamDomainParams{
+		TeamID: teamId,
+		Domain: domain,
+		Method: pgtype.Text{String: method, Valid: true},
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return Domain{}, &TeamError{
+				Code:    http.StatusConflict,
+				Message: fmt.Sprintf("%s is already verified by another team. Ask one of its owners to add you.", domain),
+			}
+		}
+		slog.ErrorContext(ctx, "unable to verify team domain", "teamId", teamId, "domain", domain, "err", err)
+		return Domain{}, NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Team domain verified", "teamId", teamId, "domain", domain, "method", method, "actorId", actorId)
+	return domainFromRecord(verified), nil
+}
+
+func (s *TeamService) RemoveDomain(ctx context.Context, actorId int64, teamId int64, domain string) *TeamError {
+	if teamErr := s.checkOwner(ctx, actorId, teamId); teamErr != nil {
+		return teamErr
+	}
+
+	domain = normalizeDomain(domain)
+	removed, err := s.teamq.DeleteTeamDomain(ctx, db.DeleteTeamDomainParams{TeamID: teamId, Domain: domain})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to delete team domain", "teamId", teamId, "domain", domain, "err", err)
+		return NewInternalServerError()
+	}
+	if removed == 0 {
+		return &TeamError{
+			Code:    http.StatusNotFound,
+			Message: "Domain not found",
+		}
+	}
+
+	slog.InfoContext(ctx, "Team domain removed", "teamId", teamId, "domain", domain, "actorId", actorId)
+	return nil
+}
+
+func (s *TeamService) checkTXTRecord(ctx context.Context, rec db.TeamDomain) (bool, *TeamError) {
+	records, err := s.resolver.LookupTXT(ctx, ChallengeRecordPrefix+rec.Domain)
+	if err != nil {
+		// Missing records surface as lookup errors, which just mean the challenge is not in place yet
+		slog.InfoContext(ctx, "TXT lookup failed", "domain", rec.Domain, "err", err)
+		return false, nil
+	}
+	return slices.Contains(records, ChallengeValuePrefix+rec.Token), nil
+}
+
+// Account emails are verified by the identity provider or a magic link on sign in.
+func (s *TeamService) checkEmail(ctx context.Context, actorId int64, rec db.TeamDomain) (bool, *TeamError) {
+	user, err := s.teamq.GetUser(ctx, actorId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to get user", "userId", actorId, "err", err)
+		return false, NewInternalServerError()
+	}
+
+	_, emailDomain, ok := strings.Cut(strings.ToLower(user.Email), "@")
+	if !ok || slices.Contains(freeMailDomains, emailDomain) {
+		return false, nil
+	}
+	return emailDomain == rec.Domain || strings.HasSuffix(emailDomain, "."+rec.Domain), nil
+}
+
+func (s *TeamService) checkOwner(ctx context.Context, userId int64, teamId int64) *TeamError {
+	member, err := s.teamq.GetTeamMember(ctx, db.GetTeamMemberParams{TeamID: teamId, UserID: userId})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return NewTeamNotFoundError()
+		}
+		slog.ErrorContext(ctx, "unable to get team member", "teamId", teamId, "userId", userId, "err", err)
+		return NewInternalServerError()
+	}
+	if member.Role != RoleOwner {
+		return &TeamError{
+			Code:    http.StatusForbidden,
+			Message: "Only team owners can do this.",
+		}
+	}
+	return nil
+}
+
+func (s *TeamService) getTeam(ctx context.Context, teamId int64, name string, role string) (Team, *TeamError) {
+	members, err := s.teamq.ListTeamMembers(ctx, teamId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list team members", "teamId", teamId, "err", err)
+		return Team{}, NewInternalServerError()
+	}
+	invitations, err := s.teamq.ListTeamInvitations(ctx, teamId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list team invitations", "teamId", teamId, "err", err)
+		return Team{}, NewInternalServerError()
+	}
+	domains, err := s.teamq.ListTeamDomains(ctx, teamId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list team domains", "teamId", teamId, "err", err)
+		return Team{}, NewInternalServerError()
+	}
+
+	team := Team{
+		Id:          teamId,
+		Name:        name,
+		Role:        role,
+		Members:     make([]Member, 0, len(members)),
+		Invitations: make([]Invitation, 0, len(invitations)),
+		Domains:     make([]Domain, 0, len(domains)),
+	}
+	for _, m := range members {
+		team.Members = append(team.Members, Member{UserId: m.UserID, Username: m.Username, Role: m.Role})
+	}
+	for _, i := range invitations {
+		team.Invitations = append(team.Invitations, Invitation{TeamId: teamId, UserId: i.UserID, Username: i.Username, CreatedAt: i.CreatedAt.Time})
+	}
+	for _, d := range domains {
+		team.Domains = append(team.Domains, domainFromRecord(d))
+	}
+	return team, nil
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// Returns the normalized domain.
+func parseDomain(domain string) (string, *TeamError) {
+	domain = normalizeDomain(domain)
+	if len(domain) > 253 || !domainRegex.MatchString(domain) {
+		return "", &TeamError{
+			Code:    http.StatusBadRequest,
+			Message: "Invalid domain.",
+		}
+	}
+
+	if _, err := publicsuffix.EffectiveTLDPlusOne(domain); err != nil {
+		return "", &TeamError{
+			Code:    http.StatusBadRequest,
+			Message: "Domain should not be a public suffix.",
+		}
+	}
+	return domain, nil
+}
+
+func verificationFailedMessage(method string, rec db.TeamDomain) string {
+	if method == MethodEmail {
+		return fmt.Sprintf("Your account email is not on %s.", rec.Domain)
+	}
+	return fmt.Sprintf("TXT record %s%s with value %s%s was not found. DNS changes can take a while to propagate.", ChallengeRecordPrefix, rec.Domain, ChallengeValuePrefix, rec.Token)
+}
+
+func domainFromRecord(rec db.TeamDomain) Domain {
+	d := Domain{
+		Domain:   rec.Domain,
+		Company:  rec.Company,
+		Verified: rec.VerifiedAt.Valid,
+		Method:   rec.Method.String,
+	}
+	if rec.VerifiedAt.Valid {
+		verifiedAt := rec.VerifiedAt.Time
+		d.VerifiedAt = &verifiedAt
+	} else {
+		d.RecordName = ChallengeRecordPrefix + rec.Domain
+		d.RecordValue = ChallengeValuePrefix + rec.Token
+	}
+	return d
+}
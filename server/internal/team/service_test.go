@@ -0,0 +1,385 @@
+package team
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+type domainKey struct {
+	teamId int64
+	domain string
+}
+
+type MockTeamStore struct {
+	users   map[int64]db.User
+	teams   map[int64]db.Team
+	members map[int64]map[int64]string
+	domains map[domainKey]db.TeamDomain
+	// Allowlisted registrable domains of reserved companies
+	companies   map[string]string
+	invitations map[int64]map[int64]bool
+}
+
+func newMockTeamStore() *MockTeamStore {
+	return &MockTeamStore{
+		users: map[int64]db.User{
+			1: {ID: 1, Username: "alice", Email: "alice@acme.com"},
+			2: {ID: 2, Username: "bob", Email: "bob@gmail.com"},
+			3: {ID: 3, Username: "carol", Email: "carol@eng.acme.com"},
+		},
+		teams:       map[int64]db.Team{},
+		members:     map[int64]map[int64]string{},
+		domains:     map[domainKey]db.TeamDomain{},
+		companies:   map[string]string{"acme.com": "acme", "acme.co.uk": "acme"},
+		invitations: map[int64]map[int64]bool{},
+	}
+}
+
+func (ts *MockTeamStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	u, ok := ts.users[userId]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	return u, nil
+}
+
+func (ts *MockTeamStore) GetUserFromUsername(ctx context.Context, username string) (db.User, error) {
+	for _, u := range ts.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return db.User{}, pgx.ErrNoRows
+}
+
+func (ts *MockTeamStore) CreateTeam(ctx context.Context, name string) (db.Team, error) {
+	team := db.Team{ID: int64(len(ts.teams) + 1), Name: name}
+	ts.teams[team.ID] = team
+	ts.members[team.ID] = map[int64]string{}
+	return team, nil
+}
+
+func (ts *MockTeamStore) GetTeam(ctx context.Context, teamId int64) (db.Team, error) {
+	team, ok := ts.teams[teamId]
+	if !ok {
+		return db.Team{}, pgx.ErrNoRows
+	}
+	return team, nil
+}
+
+func (ts *MockTeamStore) AddTeamMember(ctx context.Context, params db.AddTeamMemberParams) (db.TeamMember, error) {
+	ts.members[params.TeamID][params.UserID] = params.Role
+	return db.TeamMember{TeamID: params.TeamID, UserID: params.UserID, Role: params.Role}, nil
+}
+
+func (ts *MockTeamStore) RemoveTeamMember(ctx context.Context, params db.RemoveTeamMemberParams) (int64, error) {
+	role, ok := ts.members[params.TeamID][params.UserID]
+	if !ok || role == RoleOwner {
+		return 0, nil
+	}
+	delete(ts.members[params.TeamID], params.UserID)
+	return 1, nil
+}
+
+func (ts *MockTeamStore) GetTeamMember(ctx context.Context, params db.GetTeamMemberParams) (db.TeamMember, error) {
+	role, ok := ts.members[params.TeamID][params.UserID]
+	if !ok {
+		return db.TeamMember{}, pgx.ErrNoRows
+	}
+	return db.TeamMember{TeamID: params.TeamID, UserID: params.UserID, Role: role}, nil
+}
+
+func (ts *MockTeamStore) ListUserTeams(ctx context.Context, userId int64) ([]db.ListUserTeamsRow, error) {
+	rows := []db.ListUserTeamsRow{}
+	for teamId, members := range ts.members {
+		if role, ok := members[userId]; ok {
+			rows = append(rows, db.ListUserTeamsRow{ID: teamId, Name: ts.teams[teamId].Name, Role: role})
+		}
+	}
+	return rows, nil
+}
+
+func (ts *MockTeamStore) ListTeamMembers(ctx context.Context, teamId int64) ([]db.ListTeamMembersRow, error) {
+	rows := []db.ListTeamMembersRow{}
+	for userId, role := range ts.members[teamId] {
+		rows = append(rows, db.ListTeamMembersRow{UserID: userId, Role: role, Username: ts.users[userId].Username})
+	}
+	return rows, nil
+}
+
+func (ts *MockTeamStore) CreateTeamDomain(ctx context.Context, params db.CreateTeamDomainParams) (db.TeamDomain, error) {
+	key := domainKey{params.TeamID, params.Domain}
+	if _, ok := ts.domains[key]; ok {
+		return db.TeamDomain{}, &pgconn.PgError{Code: "23505"}
+	}
+	d := db.TeamDomain{TeamID: params.TeamID, Domain: params.Domain, Company: params.Company, Token: params.Token}
+	ts.domains[key] = d
+	return d, nil
+}
+
+func (ts *MockTeamStore) GetTeamDomain(ctx context.Context, params db.GetTeamDomainParams) (db.TeamDomain, error) {
+	d, ok := ts.domains[domainKey{params.TeamID, params.Domain}]
+	if !ok {
+		return db.TeamDomain{}, pgx.ErrNoRows
+	}
+	return d, nil
+}
+
+func (ts *MockTeamStore) ListTeamDomains(ctx context.Context, teamId int64) ([]db.TeamDomain, error) {
+	domains := []db.TeamDomain{}
+	for key, d := range ts.domains {
+		if key.teamId == teamId {
+			domains = append(domains, d)
+		}
+	}
+	return domains, nil
+}
+
+func (ts *MockTeamStore) VerifyTeamDomain(ctx context.Context, params db.VerifyTeamDomainParams) (db.TeamDomain, error) {
+	for key, d := range ts.domains {
+		if key.domain == params.Domain && key.teamId != params.TeamID && d.VerifiedAt.Valid {
+			return db.TeamDomain{}, &pgconn.PgError{Code: "23505"}
+		}
+	}
+	key := domainKey{params.TeamID, params.Domain}
+	d := ts.domains[key]
+	d.Method = params.Method
+	d.VerifiedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	ts.domains[key] = d
+	return d, nil
+}
+
+func (ts *MockTeamStore) DeleteTeamDomain(ctx context.Context, params db.DeleteTeamDomainParams) (int64, error) {
+	key := domainKey{params.TeamID, params.Domain}
+	if _, ok := ts.domains[key]; !ok {
+		return 0, nil
+	}
+	delete(ts.domains, key)
+	return 1, nil
+}
+
+func (ts *MockTeamStore) GetCompanyOfDomain(ctx context.Context, domain string) (string, error) {
+	for d, company := range ts.companies {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return company, nil
+		}
+	}
+	return "", pgx.ErrNoRows
+}
+
+func (ts *MockTeamStore) CreateTeamInvitation(ctx context.Context, params db.CreateTeamInvitationParams) (db.TeamInvitation, error) {
+	if ts.invitations[params.TeamID][params.UserID] {
+		return db.TeamInvitation{}, &pgconn.PgError{Code: "23505"}
+	}
+	if ts.invitations[params.TeamID] == nil {
+		ts.invitations[params.TeamID] = map[int64]bool{}
+	}
+	ts.invitations[params.TeamID][params.UserID] = true
+	return db.TeamInvitation{TeamID: params.TeamID, UserID: params.UserID, InvitedBy: params.InvitedBy}, nil
+}
+
+func (ts *MockTeamStore) DeleteTeamInvitation(ctx context.Context, params db.DeleteTeamInvitationParams) (int64, error) {
+	if !ts.invitations[params.TeamID][params.UserID] {
+		return 0, nil
+	}
+	delete(ts.invitations[params.TeamID], params.UserID)
+	return 1, nil
+}
+
+func (ts *MockTeamStore) ListTeamInvitations(ctx context.Context, teamId int64) ([]db.ListTeamInvitationsRow, error) {
+	rows := []db.ListTeamInvitationsRow{}
+	for userId := range ts.invitations[teamId] {
+		rows = append(rows, db.ListTeamInvitationsRow{UserID: userId, Username: ts.users[userId].Username})
+	}
+	return rows, nil
+}
+
+func (ts *MockTeamStore) ListUserInvitations(ctx context.Context, userId int64) ([]db.ListUserInvitationsRow, error) {
+	rows := []db.ListUserInvitationsRow{}
+	for teamId, invitees := range ts.invitations {
+		if invitees[userId] {
+			rows = append(rows, db.ListUserInvitationsRow{TeamID: teamId, TeamName: ts.teams[teamId].Name})
+		}
+	}
+	return rows, nil
+}
+
+func (ts *MockTeamStore) WithTx(ctx context.Context, fn func(TeamQuerier) error) error {
+	return fn(ts)
+}
+
+type MockResolver struct {
+	records map[string][]string
+}
+
+func (r MockResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := r.records[name]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return records, nil
+}
+
+func newTeamWithDomain(t *testing.T, s *TeamService, ownerId int64, domain string) (Team, Domain) {
+	team, teamErr := s.CreateTeam(context.TODO(), ownerId, "Acme")
+	assert.Nil(t, teamErr)
+	d, teamErr := s.AddDomain(context.TODO(), ownerId, team.Id, domain)
+	assert.Nil(t, teamErr)
+	return team, d
+}
+
+func TestAddDomainDerivesCompanyAndChallenge(t *testing.T) {
+	s := NewTeamService(newMockTeamStore(), MockResolver{})
+
+	_, d := newTeamWithDomain(t, s, 1, "Mail.Acme.co.uk.")
+	assert.Equal(t, "mail.acme.co.uk", d.Domain)
+	assert.Equal(t, "acme", d.Company)
+	assert.False(t, d.Verified)
+	assert.Equal(t, "_checkpost-challenge.mail.acme.co.uk", d.RecordName)
+	assert.Contains(t, d.RecordValue, ChallengeValuePrefix)
+}
+
+func TestAddDomainOnlyAllowlistedDomainsStandForCompany(t *testing.T) {
+	s := NewTeamService(newMockTeamStore(), MockResolver{})
+
+	// The first label of acme.ninja is acme, it still is not a domain of the company
+	_, d := newTeamWithDomain(t, s, 1, "acme.ninja")
+	assert.Empty(t, d.Company)
+
+	_, d = newTeamWithDomain(t, s, 1, "eng.acme.com")
+	assert.Equal(t, "acme", d.Company)
+}
+
+func TestAddDomainRejectsPublicSuffix(t *testing.T) {
+	s := NewTeamService(newMockTeamStore(), MockResolver{})
+	team, _ := s.CreateTeam(context.TODO(), 1, "Acme")
+
+	_, teamErr := s.AddDomain(context.TODO(), 1, team.Id, "co.uk")
+	assert.NotNil(t, teamErr)
+	assert.Equal(t, http.StatusBadRequest, teamErr.Code)
+}
+
+func TestVerifyDomainThroughDns(t *testing.T) {
+	resolver := MockResolver{records: map[string][]string{}}
+	s := NewTeamService(newMockTeamStore(), resolver)
+	team, d := newTeamWithDomain(t, s, 2, "acme.com")
+
+	_, teamErr := s.VerifyDomain(context.TODO(), 2, team.Id, "acme.com", MethodDns)
+	assert.NotNil(t, teamErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, teamErr.Code)
+
+	resolver.records[d.RecordName] = []string{"v=spf1 -all", d.RecordValue}
+	verified, teamErr := s.VerifyDomain(context.TODO(), 2, team.Id, "acme.com", MethodDns)
+	assert.Nil(t, teamErr)
+	assert.True(t, verified.Verified)
+	assert.Equal(t, MethodDns, verified.Method)
+	assert.Empty(t, verified.RecordValue)
+}
+
+func TestVerifyDomainThroughEmail(t *testing.T) {
+	s := NewTeamService(newMockTeamStore(), MockResolver{})
+
+	// carol@eng.acme.com is on a subdomain of acme.com
+	team, _ := newTeamWithDomain(t, s, 3, "acme.com")
+	verified, teamErr := s.VerifyDomain(context.TODO(), 3, team.Id, "acme.com", MethodEmail)
+	assert.Nil(t, teamErr)
+	assert.True(t, verified.Verified)
+
+	// An email on acme.com does not prove control of acme.com.evil.io
+	team, _ = newTeamWithDomain(t, s, 1, "acme.com.evil.io")
+	_, teamErr = s.VerifyDomain(context.TODO(), 1, team.Id, "acme.com.evil.io", MethodEmail)
+	assert.NotNil(t, teamErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, teamErr.Code)
+}
+
+func TestVerifyDomainThroughFreeMailIsRejected(t *testing.T) {
+	s := NewTeamService(newMockTeamStore(), MockResolver{})
+	team, _ := newTeamWithDomain(t, s, 2, "gmail.com")
+
+	_, teamErr := s.VerifyDomain(context.TODO(), 2, team.Id, "gmail.com", MethodEmail)
+	assert.NotNil(t, teamErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, teamErr.Code)
+}
+
+func TestVerifyDomainAlreadyVerifiedByAnotherTeam(t *testing.T) {
+	s := NewTeamService(newMockTeamStore(), MockResolver{})
+
+	first, _ := newTeamWithDomain(t, s, 1, "acme.com")
+	_, teamErr := s.VerifyDomain(context.TODO(), 1, first.Id, "acme.com", MethodEmail)
+	assert.Nil(t, teamErr)
+
+	second, _ := newTeamWithDomain(t, s, 3, "acme.com")
+	_, teamErr = s.VerifyDomain(context.TODO(), 3, second.Id, "acme.com", MethodEmail)
+	assert.NotNil(t, teamErr)
+	assert.Equal(t, http.StatusConflict, teamErr.Code)
+}
+
+func TestOnlyOwnersManageDomains(t *testing.T) {
+	s := NewTeamService(newMockTeamStore(), MockResolver{})
+	team, _ := newTeamWithDomain(t, s, 1, "acme.com")
+
+	_, teamErr := s.InviteMember(context.TODO(), 1, team.Id, "carol")
+	assert.Nil(t, teamErr)
+	_, teamErr = s.AcceptInvitation(context.TODO(), 3, team.Id)
+	assert.Nil(t, teamErr)
+
+	_, teamErr = s.VerifyDomain(context.TODO(), 3, team.Id, "acme.com", MethodEmail)
+	assert.NotNil(t, teamErr)
+	assert.Equal(t, http.StatusForbidden, teamErr.Code)
+
+	// Non members do not learn that the team exists
+	teamErr = s.RemoveDomain(context.TODO(), 2, team.Id, "acme.com")
+	assert.NotNil(t, teamErr)
+	assert.Equal(t, http.StatusNotFound, teamErr.Code)
+}
+
+func TestMembersJoinOnlyByAcceptingInvitation(t *testing.T) {
+	store := newMockTeamStore()
+	s := NewTeamService(store, MockResolver{})
+	team, _ := s.CreateTeam(context.TODO(), 1, "Acme")
+
+	invitation, teamErr := s.InviteMember(context.TODO(), 1, team.Id, "bob")
+	assert.Nil(t, teamErr)
+	assert.Equal(t, int64(2), invitation.UserId)
+
+	_, teamErr = s.InviteMember(context.TODO(), 1, team.Id, "bob")
+	assert.NotNil(t, teamErr)
+	assert.Equal(t, http.StatusConflict, teamErr.Code)
+
+	// Invited users are not members yet
+	_, ok := store.members[team.Id][2]
+	assert.False(t, ok)
+
+	invitations, teamErr := s.ListInvitations(context.TODO(), 2)
+	assert.Nil(t, teamErr)
+	assert.Len(t, invitations, 1)
+	assert.Equal(t, "Acme", invitations[0].TeamName)
+
+	// Only the invited user can accept
+	_, teamErr = s.AcceptInvitation(context.TODO(), 3, team.Id)
+	assert.NotNil(t, teamErr)
+	assert.Equal(t, http.StatusNotFound, teamErr.Code)
+
+	joined, teamErr := s.AcceptInvitation(context.TODO(), 2, team.Id)
+	assert.Nil(t, teamErr)
+	assert.Equal(t, RoleMember, joined.Role)
+	assert.Len(t, joined.Members, 2)
+	assert.Empty(t, joined.Invitations)
+
+	// Declined invitations add nobody
+	_, teamErr = s.InviteMember(context.TODO(), 1, team.Id, "carol")
+	assert.Nil(t, teamErr)
+	assert.Nil(t, s.DeclineInvitation(context.TODO(), 3, team.Id))
+	_, ok = store.members[team.Id][3]
+	assert.False(t, ok)
+}
@@ -0,0 +1,137 @@
+package team
+
+import (
+	"context"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TeamQuerier interface {
+	GetUser(ctx context.Context, userId int64) (db.User, error)
+	GetUserFromUsername(ctx context.Context, username string) (db.User, error)
+
+	CreateTeam(ctx context.Context, name string) (db.Team, error)
+	GetTeam(ctx context.Context, teamId int64) (db.Team, error)
+	AddTeamMember(ctx context.Context, params db.AddTeamMemberParams) (db.TeamMember, error)
+	RemoveTeamMember(ctx context.Context, params db.RemoveTeamMemberParams) (int64, error)
+	GetTeamMember(ctx context.Context, params db.GetTeamMemberParams) (db.TeamMember, error)
+	ListUserTeams(ctx context.Context, userId int64) ([]db.ListUserTeamsRow, error)
+	ListTeamMembers(ctx context.Context, teamId int64) ([]db.ListTeamMembersRow, error)
+
+	CreateTeamDomain(ctx context.Context, params db.CreateTeamDomainParams) (db.TeamDomain, error)
+	GetTeamDomain(ctx context.Context, params db.GetTeamDomainParams) (db.TeamDomain, error)
+	ListTeamDomains(ctx context.Context, teamId int64) ([]db.TeamDomain, error)
+	VerifyTeamDomain(ctx context.Context, params db.VerifyTeamDomainParams) (db.TeamDomain, error)
+	DeleteTeamDomain(ctx context.Context, params db.DeleteTeamDomainParams) (int64, error)
+	GetCompanyOfDomain(ctx context.Context, domain string) (string, error)
+
+	CreateTeamInvitation(ctx context.Context, params db.CreateTeamInvitationParams) (db.TeamInvitation, error)
+	DeleteTeamInvitation(ctx context.Context, params db.DeleteTeamInvitationParams) (int64, error)
+	ListTeamInvitations(ctx context.Context, teamId int64) ([]db.ListTeamInvitationsRow, error)
+	ListUserInvitations(ctx context.Context, userId int64) ([]db.ListUserInvitationsRow, error)
+
+	// Runs fn within a transaction. The querier passed to fn is bound to the transaction.
+	WithTx(ctx context.Context, fn func(TeamQuerier) error) error
+}
+
+type TeamStore struct {
+	pool *pgxpool.Pool
+	q    *db.Queries
+}
+
+func NewTeamStore(pool *pgxpool.Pool) *TeamStore {
+	return &TeamStore{
+		pool: pool,
+		q:    db.New(pool),
+	}
+}
+
+func (ts TeamStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	return ts.q.GetUser(ctx, userId)
+}
+
+func (ts TeamStore) GetUserFromUsername(ctx context.Context, username string) (db.User, error) {
+	return ts.q.GetUserFromUsername(ctx, username)
+}
+
+func (ts TeamStore) CreateTeam(ctx context.Context, name string) (db.Team, error) {
+	return ts.q.CreateTeam(ctx, name)
+}
+
+func (ts TeamStore) GetTeam(ctx context.Context, teamId int64) (db.Team, error) {
+	return ts.q.GetTeam(ctx, teamId)
+}
+
+func (ts TeamStore) AddTeamMember(ctx context.Context, params db.AddTeamMemberParams) (db.TeamMember, error) {
+	return ts.q.AddTeamMember(ctx, params)
+}
+
+func (ts TeamStore) RemoveTeamMember(ctx context.Context, params db.RemoveTeamMemberParams) (int64, error) {
+	return ts.q.RemoveTeamMember(ctx, params)
+}
+
+func (ts TeamStore) GetTeamMember(ctx context.Context, params db.GetTeamMemberParams) (db.TeamMember, error) {
+	return ts.q.GetTeamMember(ctx, params)
+}
+
+func (ts TeamStore) ListUserTeams(ctx context.Context, userId int64) ([]db.ListUserTeamsRow, error) {
+	return ts.q.ListUserTeams(ctx, userId)
+}
+
+func (ts TeamStore) ListTeamMembers(ctx context.Context, teamId int64) ([]db.ListTeamMembersRow, error) {
+	return ts.q.ListTeamMembers(ctx, teamId)
+}
+
+func (ts TeamStore) CreateTeamDomain(ctx context.Context, params db.CreateTeamDomainParams) (db.TeamDomain, error) {
+	return ts.q.CreateTeamDomain(ctx, params)
+}
+
+func (ts TeamStore) GetTeamDomain(ctx context.Context, params db.GetTeamDomainParams) (db.TeamDomain, error) {
+	return ts.q.GetTeamDomain(ctx, params)
+}
+
+func (ts TeamStore) ListTeamDomains(ctx context.Context, teamId int64) ([]db.TeamDomain, error) {
+	return ts.q.ListTeamDomains(ctx, teamId)
+}
+
+func (ts TeamStore) VerifyTeamDomain(ctx context.Context, params db.VerifyTeamDomainParams) (db.TeamDomain, error) {
+	return ts.q.VerifyTeamDomain(ctx, params)
+}
+
+func (ts TeamStore) DeleteTeamDomain(ctx context.Context, params db.DeleteTeamDomainParams) (int64, error) {
+	return ts.q.DeleteTeamDomain(ctx, params)
+}
+
+func (ts TeamStore) GetCompanyOfDomain(ctx context.Context, domain string) (string, error) {
+	return ts.q.GetCompanyOfDomain(ctx, domain)
+}
+
+func (ts TeamStore) CreateTeamInvitation(ctx context.Context, params db.CreateTeamInvitationParams) (db.TeamInvitation, error) {
+	return ts.q.CreateTeamInvitation(ctx, params)
+}
+
+func (ts TeamStore) DeleteTeamInvitation(ctx context.Context, params db.DeleteTeamInvitationParams) (int64, error) {
+	return ts.q.DeleteTeamInvitation(ctx, params)
+}
+
+func (ts TeamStore) ListTeamInvitations(ctx context.Context, teamId int64) ([]db.ListTeamInvitationsRow, error) {
+	return ts.q.ListTeamInvitations(ctx, teamId)
+}
+
+func (ts TeamStore) ListUserInvitations(ctx context.Context, userId int64) ([]db.ListUserInvitationsRow, error) {
+	return ts.q.ListUserInvitations(ctx, userId)
+}
+
+func (ts TeamStore) WithTx(ctx context.Context, fn func(TeamQuerier) error) error {
+	tx, err := ts.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(TeamStore{pool: ts.pool, q: ts.q.WithTx(tx)}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,106 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are started through the global tracer provider, which
+// does nothing until Setup installs an exporting one.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/humanbeeng/checkpost/server/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/humanbeeng/checkpost/server"
+	DefaultServiceName  = "checkpost"
+)
+
+const (
+	// Attribute carrying the requestid local on every span of a request.
+	RequestIdKey = attribute.Key("checkpost.request_id")
+	EndpointKey  = attribute.Key("checkpost.endpoint")
+)
+
+type requestIdCtxKey struct{}
+
+// Installs an OTLP/HTTP exporting tracer provider and the W3C trace context propagator. The returned func
+// flushes pending spans and must be called on shutdown.
+func Setup(ctx context.Context, cfg config.Tracing, version string) (func(context.Context) error, error) {
+	opts := []otlptracehttp.Option{}
+	if cfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create otlp exporter: %w", err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(newSampler(cfg.SampleRatio)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Hook senders are untrusted, so their sampling decision is ignored. Traces they start are still continued
+// when sampled locally.
+func newSampler(ratio float64) sdktrace.Sampler {
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	local := sdktrace.TraceIDRatioBased(ratio)
+	return sdktrace.ParentBased(local,
+		sdktrace.WithRemoteParentSampled(local),
+		sdktrace.WithRemoteParentNotSampled(local),
+	)
+}
+
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdCtxKey{}, requestId)
+}
+
+// Starts a span tagged with the request id carried by ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if id, ok := ctx.Value(requestIdCtxKey{}).(string); ok {
+		opts = append(opts, trace.WithAttributes(RequestIdKey.String(id)))
+	}
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// Returns the traceparent header if it carries a valid span context, otherwise an empty string.
+func ValidTraceParent(header string) string {
+	carrier := propagation.MapCarrier{"traceparent": header}
+	ctx := propagation.TraceContext{}.Extract(context.Background(), carrier)
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ""
+	}
+	return header
+}
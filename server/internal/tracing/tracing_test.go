@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const senderTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	app := fiber.New()
+	app.Use(requestid.New())
+	app.Use(NewMiddleware())
+	app.Post("/endpoint/hook/:endpoint/*", func(c *fiber.Ctx) error {
+		_, span := Start(c.UserContext(), "EndpointService.StoreRequestDetails")
+		span.End()
+		return fiber.ErrServiceUnavailable
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/endpoint/hook/acme/push", nil)
+	req.Header.Set("traceparent", senderTraceParent)
+	res, err := app.Test(req)
+	assert.NoError(t, err)
+	requestId := res.Header.Get(fiber.HeaderXRequestID)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	child, server := spans[0], spans[1]
+
+	assert.Equal(t, "POST /endpoint/hook/:endpoint/*", server.Name)
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	// The trace of the sender is continued
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, server.SpanContext.SpanID(), child.Parent.SpanID())
+	assert.Equal(t, "Error", server.Status.Code.String())
+
+	for _, span := range spans {
+		assert.Contains(t, span.Attributes, RequestIdKey.String(requestId), span.Name)
+	}
+}
+
+func TestValidTraceParent(t *testing.T) {
+	assert.Equal(t, senderTraceParent, ValidTraceParent(senderTraceParent))
+	assert.Empty(t, ValidTraceParent(""))
+	assert.Empty(t, ValidTraceParent("00-00000000000000000000000000000000-00f067aa0ba902b7-01"))
+	assert.Empty(t, ValidTraceParent("not a traceparent"))
+}
+
+func TestQueryName(t *testing.T) {
+	assert.Equal(t, "GetEndpoint", queryName("-- name: GetEndpoint :one\nSELECT * FROM endpoint"))
+	assert.Equal(t, "SELECT", queryName("SELECT version, dirty FROM schema_migrations"))
+}
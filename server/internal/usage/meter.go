@@ -0,0 +1,160 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type QuotaStatus string
+
+const (
+	QuotaOk       QuotaStatus = "ok"
+	QuotaWarning  QuotaStatus = "warning"
+	QuotaExceeded QuotaStatus = "exceeded"
+)
+
+type Period struct {
+	Start        time.Time   `json:"start"`
+	End          time.Time   `json:"end"`
+	RequestCount int64       `json:"request_count"`
+	StoredBytes  int64       `json:"stored_bytes"`
+	Status       QuotaStatus `json:"status"`
+}
+
+type Report struct {
+	Plan            string   `json:"plan"`
+	MonthlyRequests int64    `json:"monthly_requests"`
+	MonthlyBytes    int64    `json:"monthly_bytes"`
+	Current         Period   `json:"current"`
+	History         []Period `json:"history"`
+}
+
+// Meters per user usage per billing period and enforces the monthly quotas of their plan.
+// Billing periods are UTC calendar months.
+type Meter struct {
+	usageq UsageQuerier
+	plans  *plan.Catalog
+	now    func() time.Time
+}
+
+func NewMeter(usageq UsageQuerier, plans *plan.Catalog) *Meter {
+	return &Meter{
+		usageq: usageq,
+		plans:  plans,
+		now:    time.Now,
+	}
+}
+
+func PeriodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Start of the period after the one t falls into, when exceeded quotas are reset.
+func NextPeriodStart(t time.Time) time.Time {
+	return PeriodStart(t).AddDate(0, 1, 0)
+}
+
+func toDate(t time.Time) pgtype.Date {
+	return pgtype.Date{Time: t, Valid: true}
+}
+
+// Status of the current period of a user against the quotas of the given plan.
+func (m *Meter) Check(ctx context.Context, userId int64, p db.Plan) (QuotaStatus, error) {
+	limits, ok := m.plans.Get(p)
+	if !ok || (limits.MonthlyRequests == 0 && limits.MonthlyBytes == 0) {
+		return QuotaOk, nil
+	}
+
+	rec, err := m.usageq.GetUsage(ctx, db.GetUsageParams{
+		UserID:      userId,
+		PeriodStart: toDate(PeriodStart(m.now())),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return QuotaOk, nil
+		}
+		slog.ErrorContext(ctx, "unable to fetch usage", "userId", userId, "err", err)
+		return QuotaOk, err
+	}
+
+	return status(rec, limits), nil
+}
+
+func (m *Meter) RecordRequest(ctx context.Context, userId int64, storedBytes int64) error {
+	return m.record(ctx, db.IncrementUsageParams{UserID: userId, RequestCount: 1, StoredBytes: storedBytes})
+}
+
+func (m *Meter) record(ctx context.Context, params db.IncrementUsageParams) error {
+	params.PeriodStart = toDate(PeriodStart(m.now()))
+	_, err := m.usageq.IncrementUsage(ctx, params)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to record usage", "userId", params.UserID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// Usage of the current period and up to the given number of past periods.
+func (m *Meter) Report(ctx context.Context, userId int64, p db.Plan, periods int32) (Report, error) {
+	limits, _ := m.plans.Get(p)
+
+	recs, err := m.usageq.ListUsage(ctx, db.ListUsageParams{UserID: userId, Limit: periods + 1})
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to list usage", "userId", userId, "err", err)
+		return Report{}, err
+	}
+
+	currentStart := PeriodStart(m.now())
+	report := Report{
+		Plan:            string(p),
+		MonthlyRequests: limits.MonthlyRequests,
+		MonthlyBytes:    limits.MonthlyBytes,
+		Current: Period{
+			Start:  currentStart,
+			End:    NextPeriodStart(currentStart),
+			Status: QuotaOk,
+		},
+		History: []Period{},
+	}
+
+	for _, rec := range recs {
+		start := rec.PeriodStart.Time
+		period := Period{
+			Start:        start,
+			End:          start.AddDate(0, 1, 0),
+			RequestCount: rec.RequestCount,
+			StoredBytes:  rec.StoredBytes,
+			Status:       status(rec, limits),
+		}
+		if start.Equal(currentStart) {
+			report.Current = period
+		} else if len(report.History) < int(periods) {
+			report.History = append(report.History, period)
+		}
+	}
+	return report, nil
+}
+
+func status(rec db.Usage, limits plan.Limits) QuotaStatus {
+	if exceeds(rec.RequestCount, limits.MonthlyRequests, 100) || exceeds(rec.StoredBytes, limits.MonthlyBytes, 100) {
+		return QuotaExceeded
+	}
+	if limits.QuotaWarnPercent > 0 &&
+		(exceeds(rec.RequestCount, limits.MonthlyRequests, limits.QuotaWarnPercent) || exceeds(rec.StoredBytes, limits.MonthlyBytes, limits.QuotaWarnPercent)) {
+		return QuotaWarning
+	}
+	return QuotaOk
+}
+
+// A quota of 0 is unlimited.
+func exceeds(used int64, quota int64, percent int) bool {
+	return quota > 0 && used*100 >= quota*int64(percent)
+}
@@ -0,0 +1,115 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockUsageStore struct {
+	usage map[time.Time]db.Usage
+}
+
+func (us *MockUsageStore) IncrementUsage(ctx context.Context, params db.IncrementUsageParams) (db.Usage, error) {
+	rec := us.usage[params.PeriodStart.Time]
+	rec.UserID = params.UserID
+	rec.PeriodStart = params.PeriodStart
+	rec.RequestCount += params.RequestCount
+	rec.StoredBytes += params.StoredBytes
+	rec.ReplayCount += params.ReplayCount
+	rec.ForwardCount += params.ForwardCount
+	us.usage[params.PeriodStart.Time] = rec
+	return rec, nil
+}
+
+func (us *MockUsageStore) GetUsage(ctx context.Context, params db.GetUsageParams) (db.Usage, error) {
+	rec, ok := us.usage[params.PeriodStart.Time]
+	if !ok {
+		return db.Usage{}, pgx.ErrNoRows
+	}
+	return rec, nil
+}
+
+func (us *MockUsageStore) ListUsage(ctx context.Context, params db.ListUsageParams) ([]db.Usage, error) {
+	var recs []db.Usage
+	for _, rec := range us.usage {
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+func newTestMeter(now time.Time) *Meter {
+	m := NewMeter(&MockUsageStore{usage: map[time.Time]db.Usage{}}, plan.NewCatalog(map[db.Plan]plan.Limits{
+		db.PlanFree: {Name: db.PlanFree, MonthlyRequests: 10, MonthlyBytes: 1_000, QuotaWarnPercent: 80},
+		db.PlanPro:  {Name: db.PlanPro},
+	}))
+	m.now = func() time.Time { return now }
+	return m
+}
+
+func TestPeriodStart(t *testing.T) {
+	start := PeriodStart(time.Date(2024, time.March, 17, 23, 10, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), start)
+}
+
+func TestQuotaWarningAndCutoff(t *testing.T) {
+	m := newTestMeter(time.Now())
+	ctx := context.TODO()
+
+	for range 8 {
+		assert.Nil(t, m.RecordRequest(ctx, 1, 10))
+	}
+	status, err := m.Check(ctx, 1, db.PlanFree)
+	assert.Nil(t, err)
+	assert.Equal(t, QuotaWarning, status)
+
+	for range 2 {
+		assert.Nil(t, m.RecordRequest(ctx, 1, 10))
+	}
+	status, err = m.Check(ctx, 1, db.PlanFree)
+	assert.Nil(t, err)
+	assert.Equal(t, QuotaExceeded, status)
+}
+
+func TestStoredBytesQuota(t *testing.T) {
+	m := newTestMeter(time.Now())
+	ctx := context.TODO()
+
+	assert.Nil(t, m.RecordRequest(ctx, 1, 1_000))
+	status, err := m.Check(ctx, 1, db.PlanFree)
+	assert.Nil(t, err)
+	assert.Equal(t, QuotaExceeded, status)
+}
+
+func TestUnlimitedPlan(t *testing.T) {
+	m := newTestMeter(time.Now())
+	ctx := context.TODO()
+
+	for range 100 {
+		m.RecordRequest(ctx, 1, 1_000)
+	}
+	status, err := m.Check(ctx, 1, db.PlanPro)
+	assert.Nil(t, err)
+	assert.Equal(t, QuotaOk, status)
+}
+
+func TestReportSplitsCurrentAndHistory(t *testing.T) {
+	now := time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC)
+	m := newTestMeter(now.AddDate(0, -1, 0))
+	ctx := context.TODO()
+	m.RecordRequest(ctx, 1, 10)
+
+	m.now = func() time.Time { return now }
+	m.RecordRequest(ctx, 1, 10)
+
+	report, err := m.Report(ctx, 1, db.PlanFree, 12)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), report.Current.RequestCount)
+	assert.Len(t, report.History, 1)
+	assert.Equal(t, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), report.History[0].Start)
+}
@@ -0,0 +1,35 @@
+package usage
+
+import (
+	"context"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+)
+
+type UsageQuerier interface {
+	IncrementUsage(ctx context.Context, params db.IncrementUsageParams) (db.Usage, error)
+	GetUsage(ctx context.Context, params db.GetUsageParams) (db.Usage, error)
+	ListUsage(ctx context.Context, params db.ListUsageParams) ([]db.Usage, error)
+}
+
+type UsageStore struct {
+	q db.Querier
+}
+
+func NewUsageStore(q db.Querier) *UsageStore {
+	return &UsageStore{
+		q: q,
+	}
+}
+
+func (us UsageStore) IncrementUsage(ctx context.Context, params db.IncrementUsageParams) (db.Usage, error) {
+	return us.q.IncrementUsage(ctx, params)
+}
+
+func (us UsageStore) GetUsage(ctx context.Context, params db.GetUsageParams) (db.Usage, error) {
+	return us.q.GetUsage(ctx, params)
+}
+
+func (us UsageStore) ListUsage(ctx context.Context, params db.ListUsageParams) ([]db.Usage, error) {
+	return us.q.ListUsage(ctx, params)
+}
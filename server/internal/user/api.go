@@ -1,18 +1,34 @@
 package user
 
 import (
+	"bufio"
+	"fmt"
 	"log/slog"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/audit"
+	"github.com/humanbeeng/checkpost/server/internal/auth"
+	"github.com/humanbeeng/checkpost/server/internal/usage"
 )
 
 type UserController struct {
-	store *UserStore
+	store    *UserStore
+	service  *UserService
+	meter    *usage.Meter
+	sessions *auth.SessionService
+	audit    *audit.AuditService
 }
 
-func NewUserController(store *UserStore) *UserController {
+func NewUserController(store *UserStore, service *UserService, meter *usage.Meter, sessions *auth.SessionService, audit *audit.AuditService) *UserController {
 	return &UserController{
-		store: store,
+		store:    store,
+		service:  service,
+		meter:    meter,
+		sessions: sessions,
+		audit:    audit,
 	}
 }
 
@@ -20,6 +36,12 @@ func (uc *UserController) RegisterRoutes(app *fiber.App, authmw fiber.Handler) {
 	urlGroup := app.Group("/user")
 
 	urlGroup.Get("/", authmw, uc.GetUserDetailsHandler)
+	urlGroup.Patch("/", authmw, uc.UpdateProfileHandler)
+	urlGroup.Delete("/", authmw, uc.DeleteAccountHandler)
+	urlGroup.Get("/export", authmw, uc.ExportHandler)
+	urlGroup.Get("/usage", authmw, uc.GetUsageHandler)
+	urlGroup.Get("/sessions", authmw, uc.GetSessionsHandler)
+	urlGroup.Delete("/sessions/:id", authmw, uc.RevokeSessionHandler)
 }
 
 type UserDetailsResponse struct {
@@ -33,14 +55,18 @@ type UserDetailsResponse struct {
 
 func (uc *UserController) GetUserDetailsHandler(c *fiber.Ctx) error {
 	userId := c.Locals("userId").(int64)
-	slog.Info("Requesting user details", "userId", userId)
+	slog.InfoContext(c.UserContext(), "Requesting user details", "userId", userId)
 
-	user, err := uc.store.GetUserFromUserId(c.Context(), userId)
+	user, err := uc.store.GetUserFromUserId(c.UserContext(), userId)
 	if err != nil {
 		return fiber.ErrNotFound
 	}
 
-	res := UserDetailsResponse{
+	return c.JSON(userDetails(user))
+}
+
+func userDetails(user db.User) UserDetailsResponse {
+	return UserDetailsResponse{
 		Id:        user.ID,
 		Name:      user.Name,
 		Username:  user.Username,
@@ -48,6 +74,141 @@ func (uc *UserController) GetUserDetailsHandler(c *fiber.Ctx) error {
 		Plan:      string(user.Plan),
 		AvatarUrl: user.AvatarUrl,
 	}
+}
+
+func (uc *UserController) UpdateProfileHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+
+	var req UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	slog.InfoContext(c.UserContext(), "Updating profile", "userId", userId)
+
+	before, err := uc.store.GetUserFromUserId(c.UserContext(), userId)
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+
+	user, userErr := uc.service.UpdateProfile(c.UserContext(), userId, req)
+	if userErr != nil {
+		return &fiber.Error{
+			Code:    userErr.Code,
+			Message: userErr.Message,
+		}
+	}
+
+	entry := audit.FromRequest(c, audit.ActionProfileUpdate, audit.UserTarget(userId))
+	entry.Before = userDetails(before)
+	entry.After = userDetails(user)
+	uc.audit.Record(c.UserContext(), entry)
+
+	return c.JSON(userDetails(user))
+}
+
+// Downloads all account data as a zip of JSON files. The zip is streamed, requests are never held in memory
+// all at once.
+func (uc *UserController) ExportHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	ctx := c.UserContext()
+	slog.InfoContext(ctx, "Exporting account data", "userId", userId)
+
+	export, userErr := uc.service.PrepareExport(ctx, userId)
+	if userErr != nil {
+		return &fiber.Error{
+			Code:    userErr.Code,
+			Message: userErr.Message,
+		}
+	}
+
+	uc.audit.Record(ctx, audit.FromRequest(c, audit.ActionDataExport, audit.UserTarget(userId)))
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Attachment(fmt.Sprintf("checkpost-export-%s.zip", time.Now().UTC().Format("2006-01-02")))
+	// Runs after the handler returns, so only values captured here may be used. Errors are logged by WriteTo,
+	// the client receives a truncated zip.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		_ = export.WriteTo(ctx, w)
+	})
+	return nil
+}
+
+// Deletes the account and all of its data. Requires ?confirm=<username>.
+func (uc *UserController) DeleteAccountHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	slog.InfoContext(c.UserContext(), "Received account deletion request", "userId", userId)
+
+	if userErr := uc.service.DeleteAccount(c.UserContext(), userId, c.Query("confirm")); userErr != nil {
+		return &fiber.Error{
+			Code:    userErr.Code,
+			Message: userErr.Message,
+		}
+	}
+
+	// Kept after the account is gone, as audit entries are not tied to the user row
+	entry := audit.FromRequest(c, audit.ActionAccountDelete, audit.UserTarget(userId))
+	entry.Before = map[string]string{"username": c.Query("confirm")}
+	uc.audit.Record(c.UserContext(), entry)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (uc *UserController) GetUsageHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+
+	periods, err := strconv.ParseInt(c.Query("periods", "12"), 10, 32)
+	if err != nil || periods < 0 || periods > 36 {
+		return fiber.ErrBadRequest
+	}
+
+	slog.InfoContext(c.UserContext(), "Requesting user usage", "userId", userId)
+
+	user, err := uc.store.GetUserFromUserId(c.UserContext(), userId)
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+
+	report, err := uc.meter.Report(c.UserContext(), userId, user.Plan, int32(periods))
+	if err != nil {
+		return fiber.ErrInternalServerError
+	}
+
+	return c.JSON(report)
+}
+
+func (uc *UserController) GetSessionsHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	sessionId := c.Locals("sessionId").(string)
+
+	sessions, authErr := uc.sessions.ListSessions(c.UserContext(), userId, sessionId)
+	if authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
+	}
+
+	return c.JSON(sessions)
+}
+
+func (uc *UserController) RevokeSessionHandler(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(int64)
+	sessionId := c.Params("id", "")
+	if sessionId == "" {
+		return fiber.ErrBadRequest
+	}
+
+	slog.InfoContext(c.UserContext(), "Revoking session", "userId", userId, "sessionId", sessionId)
+
+	if authErr := uc.sessions.RevokeSession(c.UserContext(), userId, sessionId); authErr != nil {
+		return &fiber.Error{
+			Code:    authErr.Code,
+			Message: authErr.Message,
+		}
+	}
+
+	uc.audit.Record(c.UserContext(), audit.FromRequest(c, audit.ActionSessionRevoke, audit.SessionTarget(sessionId)))
 
-	return c.JSON(res)
+	return c.SendStatus(fiber.StatusNoContent)
 }
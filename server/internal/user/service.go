@@ -0,0 +1,339 @@
+package user
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/auth"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	maxNameLength      = 100
+	maxAvatarUrlLength = 2048
+	// Requests are exported in pages to keep memory bounded
+	exportPageSize = 1000
+)
+
+// Usernames chosen by users cannot contain @. Accounts created by email sign in are named after their
+// address, so an email shaped username would block the sign up of that address.
+var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.+-]{0,59}$`)
+
+type UserError struct {
+	Code    int
+	Message string
+}
+
+func (u *UserError) Error() string {
+	return u.Message
+}
+
+func NewInternalServerError() *UserError {
+	return &UserError{
+		Code:    http.StatusInternalServerError,
+		Message: "Oops! Something went wrong :(",
+	}
+}
+
+type SessionRevoker interface {
+	RevokeAllSessions(ctx context.Context, userId int64) *auth.AuthError
+}
+
+// Fields left nil are not changed.
+type UpdateProfileRequest struct {
+	Name      *string `json:"name"`
+	AvatarUrl *string `json:"avatar_url"`
+	Username  *string `json:"username"`
+}
+
+type UserService struct {
+	userq    AccountQuerier
+	sessions SessionRevoker
+}
+
+func NewUserService(userq AccountQuerier, sessions SessionRevoker) *UserService {
+	return &UserService{
+		userq:    userq,
+		sessions: sessions,
+	}
+}
+
+func (s *UserService) UpdateProfile(ctx context.Context, userId int64, req UpdateProfileRequest) (db.User, *UserError) {
+	user, err := s.userq.GetUser(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to get user", "userId", userId, "err", err)
+		return db.User{}, NewInternalServerError()
+	}
+
+	params := db.UpdateUserProfileParams{
+		ID:        userId,
+		Name:      user.Name,
+		AvatarUrl: user.AvatarUrl,
+		Username:  user.Username,
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+			return db.User{}, &UserError{
+				Code:    http.StatusBadRequest,
+				Message: "Name should be between 1 and 100 characters.",
+			}
+		}
+		params.Name = name
+	}
+
+	if req.AvatarUrl != nil {
+		avatarUrl := strings.TrimSpace(*req.AvatarUrl)
+		u, err := url.Parse(avatarUrl)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(avatarUrl) > maxAvatarUrlLength {
+			return db.User{}, &UserError{
+				Code:    http.StatusBadRequest,
+				Message: "Avatar should be a valid http(s) url.",
+			}
+		}
+		params.AvatarUrl = avatarUrl
+	}
+
+	if req.Username != nil && *req.Username != user.Username {
+		username := strings.TrimSpace(*req.Username)
+		if !usernameRegex.MatchString(username) {
+			return db.User{}, &UserError{
+				Code:    http.StatusBadRequest,
+				Message: "Username should start with a letter or digit and contain at most 60 letters, digits or _ . + -",
+			}
+		}
+
+		existing, err := s.userq.GetUserFromUsername(ctx, username)
+		if err == nil && existing.ID != userId {
+			return db.User{}, usernameTakenError()
+		}
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			slog.ErrorContext(ctx, "unable to check username", "err", err)
+			return db.User{}, NewInternalServerError()
+		}
+		params.Username = username
+	}
+
+	updated, err := s.userq.UpdateUserProfile(ctx, params)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			// Lost a race against another user taking the same username
+			return db.User{}, usernameTakenError()
+		}
+		slog.ErrorContext(ctx, "unable to update profile", "userId", userId, "err", err)
+		return db.User{}, NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Updated profile", "userId", userId)
+	return updated, nil
+}
+
+func usernameTakenError() *UserError {
+	return &UserError{
+		Code:    http.StatusConflict,
+		Message: "Username is already taken.",
+	}
+}
+
+// Data held for a user. Requests are read page by page while writing, so that exports of any size can
+// be streamed.
+type AccountExport struct {
+	s       *UserService
+	userId  int64
+	ownerId pgtype.Int8
+	files   []exportFile
+}
+
+type exportFile struct {
+	name string
+	data any
+}
+
+// Writes all data held for the user as a zip of JSON files.
+func (s *UserService) Export(ctx context.Context, userId int64, w io.Writer) *UserError {
+	export, userErr := s.PrepareExport(ctx, userId)
+	if userErr != nil {
+		return userErr
+	}
+	if err := export.WriteTo(ctx, w); err != nil {
+		return NewInternalServerError()
+	}
+	return nil
+}
+
+// Reads everything but the requests, so that failures surface before anything is written.
+func (s *UserService) PrepareExport(ctx context.Context, userId int64) (*AccountExport, *UserError) {
+	user, err := s.userq.GetUser(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to get user", "userId", userId, "err", err)
+		return nil, NewInternalServerError()
+	}
+
+	identities, err := s.userq.ListUserIdentities(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to export identities", "userId", userId, "err", err)
+		return nil, NewInternalServerError()
+	}
+
+	ownerId := pgtype.Int8{Int64: userId, Valid: true}
+	endpoints, err := s.userq.ExportUserEndpoints(ctx, ownerId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to export endpoints", "userId", userId, "err", err)
+		return nil, NewInternalServerError()
+	}
+
+	responses, err := s.userq.ExportUserResponses(ctx, ownerId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to export responses", "userId", userId, "err", err)
+		return nil, NewInternalServerError()
+	}
+
+	return &AccountExport{
+		s:       s,
+		userId:  userId,
+		ownerId: ownerId,
+		files: []exportFile{
+			{"profile.json", user},
+			{"identities.json", identities},
+			{"endpoints.json", endpoints},
+			{"responses.json", responses},
+		},
+	}, nil
+}
+
+// Writes the zip. A failure leaves a truncated zip behind, since parts of it may already have been sent.
+func (e *AccountExport) WriteTo(ctx context.Context, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+
+	for _, file := range e.files {
+		if err := writeJSONFile(zw, file.name, now, file.data); err != nil {
+			slog.ErrorContext(ctx, "unable to write export file", "userId", e.userId, "file", file.name, "err", err)
+			return err
+		}
+	}
+
+	if err := e.s.exportRequests(ctx, zw, e.ownerId, now); err != nil {
+		slog.ErrorContext(ctx, "unable to export requests", "userId", e.userId, "err", err)
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		slog.ErrorContext(ctx, "unable to finish export", "userId", e.userId, "err", err)
+		return err
+	}
+
+	slog.InfoContext(ctx, "Exported account data", "userId", e.userId)
+	return nil
+}
+
+// Streams requests page by page into a single JSON array.
+func (s *UserService) exportRequests(ctx context.Context, zw *zip.Writer, ownerId pgtype.Int8, modified time.Time) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "requests.json", Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(f, "["); err != nil {
+		return err
+	}
+
+	var afterId int64
+	first := true
+	for {
+		requests, err := s.userq.ExportUserRequests(ctx, db.ExportUserRequestsParams{
+			UserID:  ownerId,
+			AfterID: afterId,
+			Limit:   exportPageSize,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, request := range requests {
+			if !first {
+				if _, err := io.WriteString(f, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+
+			b, err := json.Marshal(request)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(b); err != nil {
+				return err
+			}
+			afterId = request.ID
+		}
+
+		if len(requests) < exportPageSize {
+			break
+		}
+	}
+
+	_, err = io.WriteString(f, "]")
+	return err
+}
+
+func writeJSONFile(zw *zip.Writer, name string, modified time.Time, data any) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// Erases the account. Endpoints, requests, attachments, responses, usage and sessions are
+// removed along with the user by foreign key cascades.
+// confirmUsername has to match the username to guard against accidental deletion.
+func (s *UserService) DeleteAccount(ctx context.Context, userId int64, confirmUsername string) *UserError {
+	user, err := s.userq.GetUser(ctx, userId)
+	if err != nil {
+		slog.ErrorContext(ctx, "unable to get user", "userId", userId, "err", err)
+		return NewInternalServerError()
+	}
+
+	if confirmUsername != user.Username {
+		return &UserError{
+			Code:    http.StatusBadRequest,
+			Message: "Please confirm deletion with your username.",
+		}
+	}
+
+	// Revoked first, so that cached sessions stop working right away
+	if authErr := s.sessions.RevokeAllSessions(ctx, userId); authErr != nil {
+		return &UserError{Code: authErr.Code, Message: authErr.Message}
+	}
+
+	if err := s.userq.DeleteMagicLinksForEmail(ctx, user.Email); err != nil {
+		slog.ErrorContext(ctx, "unable to delete magic links", "userId", userId, "err", err)
+		return NewInternalServerError()
+	}
+
+	if err := s.userq.DeleteUser(ctx, userId); err != nil {
+		slog.ErrorContext(ctx, "unable to delete user", "userId", userId, "err", err)
+		return NewInternalServerError()
+	}
+
+	slog.InfoContext(ctx, "Deleted account", "userId", userId)
+	return nil
+}
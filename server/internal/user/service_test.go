@@ -0,0 +1,174 @@
+package user
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/auth"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockAccountStore struct {
+	users    map[int64]db.User
+	requests []db.Request
+	deleted  []int64
+}
+
+func newMockAccountStore() *MockAccountStore {
+	return &MockAccountStore{
+		users: map[int64]db.User{
+			1: {ID: 1, Name: "Alice", Username: "alice", Email: "alice@example.com"},
+			2: {ID: 2, Name: "Bob", Username: "bob", Email: "bob@example.com"},
+		},
+		requests: []db.Request{
+			{ID: 1, Uuid: "a", UserID: pgtype.Int8{Int64: 1, Valid: true}},
+			{ID: 2, Uuid: "b", UserID: pgtype.Int8{Int64: 2, Valid: true}},
+			{ID: 3, Uuid: "c", UserID: pgtype.Int8{Int64: 1, Valid: true}},
+		},
+	}
+}
+
+func (as *MockAccountStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	u, ok := as.users[userId]
+	if !ok {
+		return db.User{}, pgx.ErrNoRows
+	}
+	return u, nil
+}
+
+func (as *MockAccountStore) GetUserFromUsername(ctx context.Context, username string) (db.User, error) {
+	for _, u := range as.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return db.User{}, pgx.ErrNoRows
+}
+
+func (as *MockAccountStore) UpdateUserProfile(ctx context.Context, params db.UpdateUserProfileParams) (db.User, error) {
+	u := as.users[params.ID]
+	u.Name, u.AvatarUrl, u.Username = params.Name, params.AvatarUrl, params.Username
+	as.users[params.ID] = u
+	return u, nil
+}
+
+func (as *MockAccountStore) DeleteUser(ctx context.Context, userId int64) error {
+	as.deleted = append(as.deleted, userId)
+	return nil
+}
+
+func (as *MockAccountStore) DeleteMagicLinksForEmail(ctx context.Context, email string) error {
+	return nil
+}
+
+func (as *MockAccountStore) ListUserIdentities(ctx context.Context, userId int64) ([]db.Identity, error) {
+	return []db.Identity{{UserID: userId, Provider: "github", Subject: "1"}}, nil
+}
+
+func (as *MockAccountStore) ExportUserEndpoints(ctx context.Context, userId pgtype.Int8) ([]db.Endpoint, error) {
+	return []db.Endpoint{{ID: 1, Endpoint: "alice", UserID: userId}}, nil
+}
+
+func (as *MockAccountStore) ExportUserRequests(ctx context.Context, params db.ExportUserRequestsParams) ([]db.Request, error) {
+	var requests []db.Request
+	for _, r := range as.requests {
+		if r.UserID == params.UserID && r.ID > params.AfterID && len(requests) < int(params.Limit) {
+			requests = append(requests, r)
+		}
+	}
+	return requests, nil
+}
+
+func (as *MockAccountStore) ExportUserResponses(ctx context.Context, userId pgtype.Int8) ([]db.Response, error) {
+	return []db.Response{}, nil
+}
+
+type mockSessionRevoker struct {
+	revoked []int64
+}
+
+func (m *mockSessionRevoker) RevokeAllSessions(ctx context.Context, userId int64) *auth.AuthError {
+	m.revoked = append(m.revoked, userId)
+	return nil
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestUpdateProfile(t *testing.T) {
+	store := newMockAccountStore()
+	s := NewUserService(store, &mockSessionRevoker{})
+
+	user, userErr := s.UpdateProfile(context.TODO(), 1, UpdateProfileRequest{
+		Name:      ptr(" Alice Liddell "),
+		AvatarUrl: ptr("https://example.com/alice.png"),
+	})
+	assert.Nil(t, userErr)
+	assert.Equal(t, "Alice Liddell", user.Name)
+	assert.Equal(t, "alice", user.Username)
+
+	_, userErr = s.UpdateProfile(context.TODO(), 1, UpdateProfileRequest{Username: ptr("bob")})
+	assert.Equal(t, http.StatusConflict, userErr.Code)
+
+	_, userErr = s.UpdateProfile(context.TODO(), 1, UpdateProfileRequest{Username: ptr("-alice")})
+	assert.Equal(t, http.StatusBadRequest, userErr.Code)
+
+	// Would block the email sign up of that address
+	_, userErr = s.UpdateProfile(context.TODO(), 1, UpdateProfileRequest{Username: ptr("carol@example.com")})
+	assert.Equal(t, http.StatusBadRequest, userErr.Code)
+
+	_, userErr = s.UpdateProfile(context.TODO(), 1, UpdateProfileRequest{AvatarUrl: ptr("javascript:alert(1)")})
+	assert.Equal(t, http.StatusBadRequest, userErr.Code)
+
+	user, userErr = s.UpdateProfile(context.TODO(), 1, UpdateProfileRequest{Username: ptr("alice_l")})
+	assert.Nil(t, userErr)
+	assert.Equal(t, "alice_l", user.Username)
+}
+
+func TestExport(t *testing.T) {
+	s := NewUserService(newMockAccountStore(), &mockSessionRevoker{})
+
+	var buf bytes.Buffer
+	assert.Nil(t, s.Export(context.TODO(), 1, &buf))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+
+	names := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		names[f.Name] = f
+	}
+	for _, name := range []string{"profile.json", "identities.json", "endpoints.json", "responses.json", "requests.json"} {
+		assert.Contains(t, names, name)
+	}
+
+	rc, err := names["requests.json"].Open()
+	assert.Nil(t, err)
+	var requests []db.Request
+	assert.Nil(t, json.NewDecoder(rc).Decode(&requests))
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "a", requests[0].Uuid)
+	assert.Equal(t, "c", requests[1].Uuid)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	store := newMockAccountStore()
+	sessions := &mockSessionRevoker{}
+	s := NewUserService(store, sessions)
+
+	userErr := s.DeleteAccount(context.TODO(), 1, "bob")
+	assert.Equal(t, http.StatusBadRequest, userErr.Code)
+	assert.Empty(t, store.deleted)
+
+	assert.Nil(t, s.DeleteAccount(context.TODO(), 1, "alice"))
+	assert.Equal(t, []int64{1}, store.deleted)
+	assert.Equal(t, []int64{1}, sessions.revoked)
+}
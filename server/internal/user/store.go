@@ -4,6 +4,7 @@ import (
 	"context"
 
 	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type UserQuerier interface {
@@ -27,3 +28,48 @@ func (us UserStore) GetUserFromUsername(ctx context.Context, username string) (d
 func (us UserStore) GetUserFromUserId(ctx context.Context, userId int64) (db.User, error) {
 	return us.q.GetUser(ctx, userId)
 }
+
+type AccountQuerier interface {
+	GetUser(ctx context.Context, userId int64) (db.User, error)
+	GetUserFromUsername(ctx context.Context, username string) (db.User, error)
+	UpdateUserProfile(ctx context.Context, params db.UpdateUserProfileParams) (db.User, error)
+	DeleteUser(ctx context.Context, userId int64) error
+	DeleteMagicLinksForEmail(ctx context.Context, email string) error
+
+	ListUserIdentities(ctx context.Context, userId int64) ([]db.Identity, error)
+	ExportUserEndpoints(ctx context.Context, userId pgtype.Int8) ([]db.Endpoint, error)
+	ExportUserRequests(ctx context.Context, params db.ExportUserRequestsParams) ([]db.Request, error)
+	ExportUserResponses(ctx context.Context, userId pgtype.Int8) ([]db.Response, error)
+}
+
+func (us UserStore) GetUser(ctx context.Context, userId int64) (db.User, error) {
+	return us.q.GetUser(ctx, userId)
+}
+
+func (us UserStore) UpdateUserProfile(ctx context.Context, params db.UpdateUserProfileParams) (db.User, error) {
+	return us.q.UpdateUserProfile(ctx, params)
+}
+
+func (us UserStore) DeleteUser(ctx context.Context, userId int64) error {
+	return us.q.DeleteUser(ctx, userId)
+}
+
+func (us UserStore) DeleteMagicLinksForEmail(ctx context.Context, email string) error {
+	return us.q.DeleteMagicLinksForEmail(ctx, email)
+}
+
+func (us UserStore) ListUserIdentities(ctx context.Context, userId int64) ([]db.Identity, error) {
+	return us.q.ListUserIdentities(ctx, userId)
+}
+
+func (us UserStore) ExportUserEndpoints(ctx context.Context, userId pgtype.Int8) ([]db.Endpoint, error) {
+	return us.q.ExportUserEndpoints(ctx, userId)
+}
+
+func (us UserStore) ExportUserRequests(ctx context.Context, params db.ExportUserRequestsParams) ([]db.Request, error) {
+	return us.q.ExportUserRequests(ctx, params)
+}
+
+func (us UserStore) ExportUserResponses(ctx context.Context, userId pgtype.Int8) ([]db.Response, error) {
+	return us.q.ExportUserResponses(ctx, userId)
+}
@@ -2,43 +2,90 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/robfig/cron/v3"
 
 	"github.com/humanbeeng/checkpost/server/config"
+	"github.com/humanbeeng/checkpost/server/db/migration"
 	db "github.com/humanbeeng/checkpost/server/db/sqlc"
+	"github.com/humanbeeng/checkpost/server/internal/admin"
+	"github.com/humanbeeng/checkpost/server/internal/audit"
 	"github.com/humanbeeng/checkpost/server/internal/auth"
+	"github.com/humanbeeng/checkpost/server/internal/billing"
 	"github.com/humanbeeng/checkpost/server/internal/core"
 	"github.com/humanbeeng/checkpost/server/internal/core/jobs"
 	"github.com/humanbeeng/checkpost/server/internal/core/middleware"
+	"github.com/humanbeeng/checkpost/server/internal/customdomain"
 	"github.com/humanbeeng/checkpost/server/internal/endpoint"
+	"github.com/humanbeeng/checkpost/server/internal/health"
+	"github.com/humanbeeng/checkpost/server/internal/logging"
+	"github.com/humanbeeng/checkpost/server/internal/mail"
+	"github.com/humanbeeng/checkpost/server/internal/metrics"
+	"github.com/humanbeeng/checkpost/server/internal/plan"
+	"github.com/humanbeeng/checkpost/server/internal/reserved"
+	"github.com/humanbeeng/checkpost/server/internal/team"
+	"github.com/humanbeeng/checkpost/server/internal/tracing"
+	"github.com/humanbeeng/checkpost/server/internal/usage"
 	"github.com/humanbeeng/checkpost/server/internal/user"
 )
 
-// TODO: Implement graceful shutdown
+const defaultShutdownTimeout = 25 * time.Second
+
 func main() {
-	config, err := config.GetAppConfig()
+	config, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Println(commandUsage)
+		return
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	app := fiber.New()
+	// The effective config is printed even when invalid to help finding the offending source
+	if !isConfigCommand(args) {
+		if err := config.Validate(); err != nil {
+			log.Fatalf("invalid config.\n%v", err)
+		}
+	}
+
+	if err := logging.Setup(config.Log, os.Stdout); err != nil {
+		log.Fatalf("invalid log config. %v", err)
+	}
+
+	if len(args) > 0 {
+		if err := runCommand(args, config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	app := fiber.New(fiber.Config{
+		ProxyHeader:             config.Proxy.Header,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          config.Proxy.Trusted,
+	})
 
 	app.Use(requestid.New())
-	// TODO: Revisit this configuration and slog configuration
-	app.Use(logger.New(logger.Config{
-		// For more options, see the Config section
-		TimeFormat: "2006/03/01 15:04:05",
-		Format:     "${time} | ${latency} | ${locals:requestid} | ${status} | ${method} ${path}\n",
-	}))
+	app.Use(tracing.NewMiddleware())
+	app.Use(logging.NewRequestLogger())
 
 	app.Use(cors.New())
 	key := config.Paseto.Key
@@ -48,50 +95,313 @@ func main() {
 		slog.Error("unable to create new paseto verifier", "err", err)
 	}
 
-	authmw := middleware.NewAuthRequiredMiddleware(pasetoVerifier)
-	routermw := middleware.NewSubdomainRouterMiddleware()
-
-	app.Use(routermw)
+	hosts, err := core.NewHosts(config.Hosting.Scheme, config.Hosting.ApiHost, config.Hosting.Addressing, config.Hosting.Domains)
+	if err != nil {
+		log.Fatalf("invalid hosting config. %v", err)
+	}
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
 
-	connectionString := fmt.Sprintf("postgres://%v:%v@%v:%v/%v?sslmode=disable", config.Postgres.User, config.Postgres.Password, config.Postgres.Host, config.Postgres.Port, config.Postgres.Database)
+	shutdownTracing := func(context.Context) error { return nil }
+	if config.Tracing.Enabled {
+		shutdownTracing, err = tracing.Setup(ctx, config.Tracing, health.Version)
+		if err != nil {
+			log.Fatalf("unable to set up tracing. %v", err)
+		}
+	}
 
-	conn, err := pgxpool.New(ctx, connectionString)
+	conn, err := newPool(ctx, config.Postgres)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer conn.Close()
-	slog.Info("Connection established", "host", config.Postgres.Host, "database", config.Postgres.Database, "user", config.Postgres.User)
+	slog.Info("Connection established", "host", conn.Config().ConnConfig.Host, "database", conn.Config().ConnConfig.Database, "user", conn.Config().ConnConfig.User)
+
+	if err := migrateOnStart(conn, config.Postgres.AutoMigrate); err != nil {
+		log.Fatalf("unable to start on current schema. %v", err)
+	}
 
 	queries := db.New(conn)
 
-	ac, err := auth.NewAuthHandler(config, queries)
+	auditService := audit.NewAuditService(audit.NewAuditStore(queries))
+
+	sessions := auth.NewSessionService(auth.NewSessionStore(queries), pasetoVerifier, key)
+	authmw := middleware.NewAuthRequiredMiddleware(pasetoVerifier, sessions)
+
+	mailer, err := mail.NewMailer(config.Mail)
+	if err != nil {
+		log.Fatalf("unable to init mailer. %v", err)
+	}
+
+	identities := auth.NewIdentityService(auth.NewIdentityStore(conn))
+	magicLinks := auth.NewMagicLinkService(auth.NewMagicLinkStore(queries), identities, mailer, config.Mail.LinkUrl, key)
+
+	ac, err := auth.NewAuthHandler(config, sessions, identities, magicLinks, auditService)
 	if err != nil {
 		log.Fatalf("unable to init auth controller. %v", err)
 	}
 
 	endpointStore := endpoint.NewEndpointStore(queries)
 	userStore := user.NewUserStore(queries)
-	endpointService := endpoint.NewEndpointService(endpointStore, userStore)
+	plans := plan.NewCatalogFromConfig(config.Plans)
+	if err := plans.Load(ctx, queries); err != nil {
+		log.Fatalf("unable to load plan catalog. %v", err)
+	}
+
+	reservedNames := reserved.NewNames(reserved.DefaultSubdomains, reserved.DefaultCompanies)
+	if err := reservedNames.Load(ctx, queries); err != nil {
+		log.Fatalf("unable to load reserved names. %v", err)
+	}
+
+	customDomains := customdomain.NewCustomDomainService(customdomain.NewCustomDomainStore(queries), net.DefaultResolver, plans, hosts)
+
+	// Must run before any route is registered
+	routermw := middleware.NewSubdomainRouterMiddleware(hosts, customDomains)
+	app.Use(routermw)
+
+	rateLimiter := endpoint.NewHookRateLimiter(plans)
+	meter := usage.NewMeter(usage.NewUsageStore(queries), plans)
+	endpointService := endpoint.NewEndpointService(endpointStore, userStore, plans, reservedNames, rateLimiter, meter, hosts)
+	if err := endpointService.AssignPrimaryDomain(ctx); err != nil {
+		log.Fatalf("unable to assign primary domain to endpoints. %v", err)
+	}
 	wsManager := endpoint.NewWSManager()
-	endpointHandler := endpoint.NewEndpointController(endpointService, wsManager, pasetoVerifier)
+	endpointHandler := endpoint.NewEndpointController(endpointService, wsManager, pasetoVerifier, sessions, auditService)
 
 	cachemw := middleware.NewCacheMiddleware()
 
-	userc := user.NewUserController(userStore)
+	userc := user.NewUserController(userStore, user.NewUserService(userStore, sessions), meter, sessions, auditService)
 	userc.RegisterRoutes(app, authmw)
 
-	ac.RegisterRoutes(app)
+	billingService := billing.NewBillingService(billing.NewBillingStore(conn), plans, config.Billing)
+	billingc := billing.NewBillingController(billingService)
+	billingc.RegisterRoutes(app)
+
+	adminService := admin.NewAdminService(admin.NewAdminStore(queries), reservedNames, billingService, sessions)
+	if err := adminService.PromoteAdmins(ctx, config.Admin.Emails); err != nil {
+		log.Fatalf("unable to promote configured admins. %v", err)
+	}
+	adminmw := middleware.NewAdminRequiredMiddleware()
+	adminc := admin.NewAdminController(adminService, auditService)
+	adminc.RegisterRoutes(app, authmw, adminmw)
+
+	customDomainc := customdomain.NewCustomDomainController(customDomains, auditService)
+	customDomainc.RegisterRoutes(app, authmw)
+
+	teamc := team.NewTeamController(team.NewTeamService(team.NewTeamStore(conn), net.DefaultResolver), auditService)
+	teamc.RegisterRoutes(app, authmw)
+
+	auditc := audit.NewAuditController(auditService)
+	auditc.RegisterRoutes(app, authmw, adminmw)
+
+	ac.RegisterRoutes(app, authmw)
+
+	if config.DevAuth.Enabled {
+		devc, err := auth.NewDevAuthHandler(config, queries, identities, sessions, auditService)
+		if err != nil {
+			log.Fatalf("unable to init dev auth. %v", err)
+		}
+		devc.RegisterRoutes(app)
+	}
 	endpointHandler.RegisterRoutes(app, authmw, cachemw)
+	if hosts.IsPathAddressing() {
+		endpointHandler.RegisterPathRoutes(app, hosts)
+	}
+
+	jobRunner := cron.New()
 
-	re := jobs.NewExpiredRequestsRemover(cron.New(), *endpointStore)
+	re := jobs.NewExpiredRequestsRemover(jobRunner, *endpointStore)
 	re.Start()
 
-	err = app.Listen(":3000")
+	df := jobs.NewDroppedRequestsFlusher(jobRunner, endpointService)
+	df.Start()
+
+	pr := jobs.NewPlanCatalogRefresher(jobRunner, plans, queries)
+	pr.Start()
+
+	rr := jobs.NewReservedNamesRefresher(jobRunner, reservedNames, queries)
+	rr.Start()
+
+	sr := jobs.NewExpiredSessionsRemover(jobRunner, sessions, magicLinks)
+	sr.Start()
+
+	schemaVersion, err := migration.LatestVersion()
 	if err != nil {
+		log.Fatalf("unable to read migrations. %v", err)
+	}
+	healthService := health.NewHealthService(health.NewHealthStore(conn), jobRunner, schemaVersion, health.NewBuildInfo(health.FeaturesFromConfig(config)))
+	healthc := health.NewHealthController(healthService)
+	healthc.RegisterRoutes(app, authmw, adminmw)
+
+	var metricsServer *http.Server
+	if config.Metrics.Enabled {
+		if err := metrics.RegisterPool(conn); err != nil {
+			log.Fatalf("unable to register pool metrics. %v", err)
+		}
+		if config.Metrics.Addr == "" {
+			app.Get("/metrics", metrics.Handler())
+		} else {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.HTTPHandler())
+			metricsServer = &http.Server{Addr: config.Metrics.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+			go func() {
+				slog.Info("Serving metrics", "addr", config.Metrics.Addr)
+				if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					slog.Error("unable to serve metrics", "err", err)
+				}
+			}()
+		}
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if config.TLS.Enabled {
+			serverErr <- listenTLS(ctx, app, config.TLS)
+		} else {
+			serverErr <- app.Listen(":3000")
+		}
+	}()
+
+	select {
+	case err := <-serverErr:
 		slog.Error("unable to start fiber server", "err", err)
+		conn.Close()
 		return
+	case <-ctx.Done():
+		// Restore default signal handling so a second signal kills the process
+		stop()
+	}
+
+	timeout := defaultShutdownTimeout
+	if config.Shutdown.TimeoutSeconds > 0 {
+		timeout = time.Duration(config.Shutdown.TimeoutSeconds) * time.Second
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	slog.Info("Shutting down", "timeout", timeout)
+
+	// Stops accepting connections and waits for in flight hooks to be stored and broadcast
+	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
+		slog.Error("unable to drain in flight requests", "err", err)
+	}
+
+	if metricsServer != nil {
+		metricsServer.Shutdown(shutdownCtx)
+	}
+
+	// Websocket connections are hijacked from the server, so they are not drained by the shutdown above
+	if err := wsManager.Shutdown(shutdownCtx); err != nil {
+		slog.Error("unable to close websocket sessions", "err", err)
+	}
+
+	select {
+	case <-jobRunner.Stop().Done():
+	case <-shutdownCtx.Done():
+		slog.Error("running jobs did not finish in time")
+	}
+
+	if err := endpointService.FlushDroppedCounts(shutdownCtx); err != nil {
+		slog.Error("unable to flush dropped counts", "err", err)
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("unable to flush traces", "err", err)
+	}
+
+	// Close waits for acquired connections to be released, which abandoned requests may never do
+	closed := make(chan struct{})
+	go func() {
+		conn.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		slog.Info("Shutdown complete")
+	case <-shutdownCtx.Done():
+		slog.Error("unable to close database pool in time")
+	}
+}
+
+func newPool(ctx context.Context, cfg config.Postgres) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.URL())
+	if err != nil {
+		return nil, err
 	}
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = int32(cfg.MaxConns)
+	}
+	if cfg.MinConns > 0 {
+		poolConfig.MinConns = int32(cfg.MinConns)
+	}
+	if cfg.MaxConnLifetimeSeconds > 0 {
+		poolConfig.MaxConnLifetime = time.Duration(cfg.MaxConnLifetimeSeconds) * time.Second
+	}
+	if cfg.MaxConnIdleSeconds > 0 {
+		poolConfig.MaxConnIdleTime = time.Duration(cfg.MaxConnIdleSeconds) * time.Second
+	}
+	if cfg.StatementTimeoutSeconds > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.Itoa(cfg.StatementTimeoutSeconds * 1000)
+	}
+	poolConfig.ConnConfig.Tracer = tracing.NewQueryTracer()
+	return pgxpool.NewWithConfig(ctx, poolConfig)
+}
+
+// Applies pending migrations when enabled, then refuses schemas this build cannot run on.
+func migrateOnStart(pool *pgxpool.Pool, autoMigrate bool) error {
+	migrator, err := migration.NewMigrator(pool)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	if autoMigrate {
+		if err := migrator.Up(); err != nil {
+			return err
+		}
+	}
+	return migrator.Check()
+}
 
+// Terminates TLS in process. Certificates are reloaded when their files change and on SIGHUP.
+func listenTLS(ctx context.Context, app *fiber.App, cfg config.TLS) error {
+	files := make([]core.CertFiles, 0, len(cfg.Certificates))
+	for _, c := range cfg.Certificates {
+		files = append(files, core.CertFiles{CertFile: c.CertFile, KeyFile: c.KeyFile})
+	}
+	certs, err := core.NewCertStore(files, cfg.Dir)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := certs.TLSConfig(cfg.ClientAuth)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := certs.Watch(ctx); err != nil {
+			slog.Error("unable to watch tls certificates. Send SIGHUP to reload", "err", err)
+		}
+	}()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			slog.Info("Received SIGHUP. Reloading tls certificates")
+			if err := certs.Reload(); err != nil {
+				slog.Error("unable to reload tls certificates. Keeping current certificates", "err", err)
+			}
+		}
+	}()
+
+	addr := cfg.Addr
+	if addr == "" {
+		addr = ":443"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("Serving TLS", "addr", addr)
+	return app.Listener(tls.NewListener(ln, tlsConfig))
 }
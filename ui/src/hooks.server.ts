@@ -0,0 +1,21 @@
+import { PUBLIC_BASE_URL } from '$env/static/public';
+import { refreshSession } from '$lib/server/session';
+import type { Handle, HandleFetch } from '@sveltejs/kit';
+
+// The access token cookie expires shortly before the token itself, so a missing token with a refresh token
+// left means the session has to be extended before any API call of this request.
+export const handle: Handle = async ({ event, resolve }) => {
+	if (!event.cookies.get('token') && event.cookies.get('refresh_token')) {
+		await refreshSession(event.cookies, fetch);
+	}
+	return resolve(event);
+};
+
+// Calls to the API carry the access token of this request, including one that was just refreshed.
+export const handleFetch: HandleFetch = async ({ event, request, fetch }) => {
+	const token = event.cookies.get('token');
+	if (token && request.url.startsWith(PUBLIC_BASE_URL)) {
+		request.headers.set('cookie', `token=${token}`);
+	}
+	return fetch(request);
+};
@@ -0,0 +1,93 @@
+import { PUBLIC_BASE_URL } from '$env/static/public';
+import type { Cookies } from '@sveltejs/kit';
+
+export type AuthResponse = {
+	token: string;
+	refresh_token: string;
+	expires_at: string;
+	name: string;
+	username: string;
+	email: string;
+	avatar_url: string;
+};
+
+// Lifetime of a session without activity, matches the refresh token lifetime of the API
+const refreshTokenMaxAge = 60 * 60 * 24 * 30;
+
+// Access tokens are refreshed this long before they expire
+const refreshLeewayMs = 60 * 1000;
+
+function cookieOptions() {
+	return {
+		path: '/',
+		httpOnly: true,
+		secure: process.env.NODE_ENV === 'production',
+		sameSite: 'lax' as const,
+		domain: process.env.NODE_ENV === 'production' ? `.${process.env.DOMAIN}` : undefined,
+	};
+}
+
+// Keeps the short lived access token until shortly before it expires and the refresh token for the whole session.
+export function setSession(cookies: Cookies, res: AuthResponse) {
+	const expires = new Date(new Date(res.expires_at).getTime() - refreshLeewayMs);
+	cookies.set('token', res.token, { ...cookieOptions(), expires });
+	cookies.set('refresh_token', res.refresh_token, { ...cookieOptions(), maxAge: refreshTokenMaxAge });
+}
+
+export function clearSession(cookies: Cookies) {
+	cookies.delete('token', cookieOptions());
+	cookies.delete('refresh_token', cookieOptions());
+}
+
+// Parallel requests of a browser carry the same refresh token. They share a single refresh, which is kept
+// for a few seconds after it settles so that requests sent with the old cookie reuse its result.
+const sharedRefreshMs = 5 * 1000;
+const refreshes = new Map<string, Promise<AuthResponse | number | undefined>>();
+
+async function requestRefresh(refreshToken: string, fetch: typeof globalThis.fetch): Promise<AuthResponse | number | undefined> {
+	const res = await fetch(`${PUBLIC_BASE_URL}/auth/refresh`, {
+		method: 'POST',
+		headers: { 'Content-Type': 'application/json' },
+		body: JSON.stringify({ refresh_token: refreshToken }),
+	}).catch((err) => {
+		console.error('Unable to refresh session', err);
+	});
+
+	if (!res) {
+		return undefined;
+	}
+	if (!res.ok) {
+		return res.status;
+	}
+	return (await res.json()) as AuthResponse;
+}
+
+// Exchanges the refresh token for a new token pair. The session is cleared when the API refuses it.
+export async function refreshSession(cookies: Cookies, fetch: typeof globalThis.fetch): Promise<boolean> {
+	const refreshToken = cookies.get('refresh_token');
+	if (!refreshToken) {
+		return false;
+	}
+
+	let refresh = refreshes.get(refreshToken);
+	if (!refresh) {
+		refresh = requestRefresh(refreshToken, fetch);
+		refreshes.set(refreshToken, refresh);
+		const forget = () => setTimeout(() => refreshes.delete(refreshToken), sharedRefreshMs);
+		refresh.then(forget, forget);
+	}
+
+	const res = await refresh;
+	if (res === undefined) {
+		return false;
+	}
+	if (typeof res === 'number') {
+		if (res == 401) {
+			clearSession(cookies);
+		}
+		return false;
+	}
+
+	setSession(cookies, res);
+	return true;
+}
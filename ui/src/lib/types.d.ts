@@ -10,6 +10,8 @@ export type Plan = 'free' | 'guest' | 'hobby' | 'pro';
 
 export type Endpoint = {
 	endpoint: string;
+	domain: string;
+	url: string;
 	plan: Plan;
 	expires_at: string;
 };
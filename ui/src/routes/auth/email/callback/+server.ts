@@ -0,0 +1,22 @@
+import { PUBLIC_BASE_URL } from '$env/static/public';
+import { setSession, type AuthResponse } from '$lib/server/session';
+import { error, redirect } from '@sveltejs/kit';
+import type { RequestEvent } from './$types';
+
+export async function GET({ url, fetch, cookies }: RequestEvent) {
+	const token = url.searchParams.get('token') ?? '';
+	const endpoint = `${PUBLIC_BASE_URL}/auth/email/callback?token=${encodeURIComponent(token)}`;
+
+	const res = await fetch(endpoint).catch((err) => {
+		console.error('Unable to hit auth callback', err);
+		error(500, { message: 'Something went wrong while callback' });
+	});
+
+	if (res.ok) {
+		setSession(cookies, (await res.json()) as AuthResponse);
+
+		throw redirect(301, '/onboarding');
+	} else {
+		error(401);
+	}
+}
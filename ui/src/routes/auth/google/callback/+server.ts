@@ -1,28 +1,24 @@
 import { PUBLIC_BASE_URL } from '$env/static/public';
+import { setSession, type AuthResponse } from '$lib/server/session';
 import { error, redirect } from '@sveltejs/kit';
 import type { RequestEvent } from '../$types';
 
 export async function GET({ url, fetch, cookies }: RequestEvent) {
 	// TODO: Handle edge cases
-	const code = url.searchParams.get('code');
-	const endpoint = `${PUBLIC_BASE_URL}/auth/google/callback?code=${code}`;
+	const code = url.searchParams.get('code') ?? '';
+	const state = url.searchParams.get('state') ?? '';
+	const endpoint = `${PUBLIC_BASE_URL}/auth/google/callback?code=${encodeURIComponent(code)}&state=${encodeURIComponent(state)}`;
 
-	const res = await fetch(endpoint).catch((err) => {
+	const nonce = cookies.get('oauth_nonce') ?? '';
+	cookies.delete('oauth_nonce', { path: '/auth' });
+
+	const res = await fetch(endpoint, { headers: { 'X-OAuth-Nonce': nonce } }).catch((err) => {
 		console.error('Unable to hit auth callback', err);
 		error(500, { message: 'Something went wrong while callback' });
 	});
 
 	if (res.ok) {
-		const response = await res.json();
-		// TODO: Increase security
-
-		cookies.set('token', response.token, {
-			path: '/',
-			// TODO: Fetch expiry from response
-			httpOnly: true,
-			maxAge: 60 * 60 * 24 * 1000,
-			secure: process.env.NODE_ENV === 'production',
-		});
+		setSession(cookies, (await res.json()) as AuthResponse);
 
 		throw redirect(301, '/onboarding');
 	} else {
@@ -1,8 +1,16 @@
+import { PUBLIC_BASE_URL } from '$env/static/public';
+import { clearSession } from '$lib/server/session';
 import { redirect } from '@sveltejs/kit';
 import type { PageServerLoad } from '../../inspect/[endpoint]/$types';
 
-export const load: PageServerLoad = async ({ cookies }) => {
+export const load: PageServerLoad = async ({ cookies, fetch }) => {
 	console.log('Logout called');
-	cookies.delete('token', { path: '/' });
+	if (cookies.get('token')) {
+		// Revokes the refresh token as well
+		await fetch(`${PUBLIC_BASE_URL}/auth/logout`, { method: 'POST' }).catch((err) => {
+			console.error('Unable to revoke session', err);
+		});
+	}
+	clearSession(cookies);
 	throw redirect(301, '/');
 };
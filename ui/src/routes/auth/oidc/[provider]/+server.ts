@@ -0,0 +1,27 @@
+import { PUBLIC_BASE_URL } from '$env/static/public';
+import { error, redirect } from '@sveltejs/kit';
+import type { RequestEvent } from './$types';
+
+export async function GET({ fetch, cookies, params }: RequestEvent): Promise<Response> {
+	const res = await fetch(`${PUBLIC_BASE_URL}/auth/oidc/${params.provider}?redirect=false`).catch((err) => {
+		console.error('Unable to start oidc sign in', err);
+		error(500, { message: 'Something went wrong while signing in' });
+	});
+
+	if (!res.ok) {
+		error(res.status);
+	}
+
+	const { url, nonce } = await res.json();
+
+	// Forwarded to the callback, binds the sign in to this browser
+	cookies.set('oauth_nonce', nonce, {
+		path: '/auth',
+		httpOnly: true,
+		secure: process.env.NODE_ENV === 'production',
+		sameSite: 'lax',
+		maxAge: 60 * 10
+	});
+
+	throw redirect(302, url);
+}
@@ -0,0 +1,27 @@
+import { PUBLIC_BASE_URL } from '$env/static/public';
+import { setSession, type AuthResponse } from '$lib/server/session';
+import { error, redirect } from '@sveltejs/kit';
+import type { RequestEvent } from './$types';
+
+export async function GET({ url, fetch, cookies, params }: RequestEvent) {
+	// TODO: Handle edge cases
+	const code = url.searchParams.get('code') ?? '';
+	const state = url.searchParams.get('state') ?? '';
+	const endpoint = `${PUBLIC_BASE_URL}/auth/oidc/${params.provider}/callback?code=${encodeURIComponent(code)}&state=${encodeURIComponent(state)}`;
+
+	const nonce = cookies.get('oauth_nonce') ?? '';
+	cookies.delete('oauth_nonce', { path: '/auth' });
+
+	const res = await fetch(endpoint, { headers: { 'X-OAuth-Nonce': nonce } }).catch((err) => {
+		console.error('Unable to hit auth callback', err);
+		error(500, { message: 'Something went wrong while callback' });
+	});
+
+	if (res.ok) {
+		setSession(cookies, (await res.json()) as AuthResponse);
+
+		throw redirect(301, '/onboarding');
+	} else {
+		error(401);
+	}
+}
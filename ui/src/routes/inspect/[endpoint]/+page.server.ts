@@ -1,16 +1,20 @@
 import { PUBLIC_BASE_URL } from '$env/static/public';
-import type { EndpointHistory, User } from '@/types';
+import type { Endpoint, EndpointHistory, User } from '@/types';
 import { error, redirect } from '@sveltejs/kit';
 import type { PageServerLoad } from './$types';
 
 export const csr = true;
 
-export const load: PageServerLoad = async ({ fetch, params, cookies }) => {
+export const load: PageServerLoad = async ({ fetch, params, url, cookies }) => {
 	const endpoint = params.endpoint;
+	// Each base domain has its own set of endpoints. The API assumes the primary domain when empty.
+	const domain = url.searchParams.get('domain') ?? '';
 	const token = cookies.get('token');
 
 	const fetchEndpointHistory = async () => {
-		const res = await fetch(`${PUBLIC_BASE_URL}/endpoint/history/${endpoint}`).catch((err) => {
+		const res = await fetch(
+			`${PUBLIC_BASE_URL}/endpoint/history/${endpoint}?domain=${encodeURIComponent(domain)}`
+		).catch((err) => {
 			console.error('Unable to fetch endpoint request history', err);
 			error(500);
 		});
@@ -54,12 +58,39 @@ export const load: PageServerLoad = async ({ fetch, params, cookies }) => {
 		return user;
 	};
 
+	// The URL depends on the base domain and addressing mode of the endpoint, only the server knows it
+	const fetchEndpoint = async () => {
+		const res = await fetch(`${PUBLIC_BASE_URL}/endpoint`).catch((err) => {
+			console.error('Unable to fetch user endpoints', err);
+			error(500);
+		});
+
+		if (!res.ok) {
+			if (res.status == 401) {
+				throw redirect(301, '/auth/logout');
+			}
+			error(res.status, { message: await res.text() });
+		}
+
+		const { endpoints } = (await res.json().catch((err) => {
+			console.error('Unable to parse user endpoints', err);
+			error(500, { message: 'Something went wrong' });
+		})) as { endpoints: Endpoint[] | null };
+
+		return endpoints?.find(
+			(e) => e.endpoint === endpoint.toLowerCase() && (!domain || e.domain === domain.toLowerCase())
+		);
+	};
+
 	const user = await fetchUser();
 	const endpointHistory = await fetchEndpointHistory();
+	const endpointDetails = await fetchEndpoint();
 
 	return {
 		user,
 		endpointHistory,
+		endpointDetails,
+		domain,
 		token,
 	};
 };
@@ -66,7 +66,7 @@ export const load: PageServerLoad = async ({ fetch, cookies }) => {
 	if (user && userEndpoints && userEndpoints.endpoints) {
 		const endpoint = userEndpoints.endpoints.at(0);
 		if (endpoint) {
-			throw redirect(301, `/inspect/${endpoint.endpoint}`);
+			throw redirect(301, `/inspect/${endpoint.endpoint}?domain=${encodeURIComponent(endpoint.domain)}`);
 		} else {
 			throw redirect(301, `/onboarding`);
 		}
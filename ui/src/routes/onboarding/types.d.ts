@@ -5,6 +5,8 @@ export type GenerateEndpointRequest = {
 };
 
 export type GenerateEndpointResponse = {
+	endpoint: string;
+	domain: string;
 	url: string;
 	expires_at: string;
 	plan: Plan;
@@ -1,5 +1,6 @@
 export type EndpointExistsResponse = {
 	endpoint: string;
+	url: string;
 	exists: boolean;
 	message: string;
 };